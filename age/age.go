@@ -0,0 +1,143 @@
+//Package age implements the age file encryption format (age-encryption.org/v1) with the post-quantum hybrid
+//mlkem768x25519 recipient type, built on top of the ML-KEM mode of the kyber package.
+//Files produced by this package can be decrypted by the age command line tool and vice versa.
+package age
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+//fileKeySize is the size in bytes of the symmetric key protecting a file
+const fileKeySize = 16
+
+//Stanza is a section of the age header encapsulating the file key for one recipient
+type Stanza struct {
+	Type string
+	Args []string
+	Body []byte
+}
+
+//Recipient wraps a file key into one or more stanzas
+type Recipient interface {
+	Wrap(fileKey []byte) ([]*Stanza, error)
+}
+
+//Identity unwraps a file key from the stanzas of a header.
+//Unwrap must return ErrIncorrectIdentity if none of the stanzas is addressed to the identity.
+type Identity interface {
+	Unwrap(stanzas []*Stanza) ([]byte, error)
+}
+
+//ErrIncorrectIdentity is returned by Identity.Unwrap when the identity is not a recipient of the file
+var ErrIncorrectIdentity = errors.New("age: incorrect identity for recipient block")
+
+//NoIdentityMatchError is returned by Decrypt when none of the given identities can unwrap the file key
+type NoIdentityMatchError struct {
+	Errors []error
+}
+
+func (e *NoIdentityMatchError) Error() string {
+	if len(e.Errors) == 1 {
+		return "age: no identity matched any of the recipients: " + e.Errors[0].Error()
+	}
+	return "age: no identity matched any of the recipients"
+}
+
+//Encrypt writes the header of an age file addressed to the recipients to dst and returns a writer for the plaintext.
+//The returned writer must be closed to flush the last chunk of the payload.
+func Encrypt(dst io.Writer, recipients ...Recipient) (io.WriteCloser, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("age: no recipients specified")
+	}
+
+	fileKey := make([]byte, fileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+
+	hdr := &header{}
+	for _, r := range recipients {
+		stanzas, err := r.Wrap(fileKey)
+		if err != nil {
+			return nil, fmt.Errorf("age: failed to wrap key: %v", err)
+		}
+		hdr.stanzas = append(hdr.stanzas, stanzas...)
+	}
+	hdr.mac = headerMAC(fileKey, hdr.marshalWithoutMAC())
+	if _, err := dst.Write(hdr.marshal()); err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, streamNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	if _, err := dst.Write(nonce); err != nil {
+		return nil, err
+	}
+	return newStreamWriter(streamKey(fileKey, nonce), dst)
+}
+
+//Decrypt parses the header of an age file read from src, unwraps the file key with one of the identities and returns a reader for the plaintext.
+//The payload is authenticated chunk by chunk: a read error means the data returned so far may be truncated, but never forged.
+func Decrypt(src io.Reader, identities ...Identity) (io.Reader, error) {
+	if len(identities) == 0 {
+		return nil, errors.New("age: no identities specified")
+	}
+
+	br := bufio.NewReader(src)
+	hdr, err := parseHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileKey []byte
+	var errs []error
+	for _, id := range identities {
+		fileKey, err = id.Unwrap(hdr.stanzas)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrIncorrectIdentity) {
+			return nil, err
+		}
+		errs = append(errs, err)
+	}
+	if fileKey == nil {
+		return nil, &NoIdentityMatchError{Errors: errs}
+	}
+
+	if !hmac.Equal(headerMAC(fileKey, hdr.marshalWithoutMAC()), hdr.mac) {
+		return nil, errors.New("age: bad header MAC")
+	}
+
+	nonce := make([]byte, streamNonceSize)
+	if _, err := io.ReadFull(br, nonce); err != nil {
+		return nil, fmt.Errorf("age: failed to read nonce: %v", err)
+	}
+	return newStreamReader(streamKey(fileKey, nonce), br)
+}
+
+//headerMAC authenticates the header up to and including the "---" marker
+func headerMAC(fileKey, hdr []byte) []byte {
+	key := make([]byte, 32)
+	io.ReadFull(hkdf.New(sha256.New, fileKey, nil, []byte("header")), key)
+	h := hmac.New(sha256.New, key)
+	h.Write(hdr)
+	return h.Sum(nil)
+}
+
+//streamKey derives the payload key from the file key and the payload nonce
+func streamKey(fileKey, nonce []byte) []byte {
+	key := make([]byte, 32)
+	io.ReadFull(hkdf.New(sha256.New, fileKey, nonce, []byte("payload")), key)
+	return key
+}
@@ -0,0 +1,132 @@
+package age
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func encryptDecrypt(t *testing.T, msg []byte, r Recipient, ids ...Identity) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := Encrypt(&buf, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := Decrypt(&buf, ids...)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(out)
+}
+
+func TestRoundTrip(t *testing.T) {
+	id, err := GenerateHybridIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, 1, 1000, chunkSize - 1, chunkSize, chunkSize + 1, 2 * chunkSize, 3*chunkSize + 17} {
+		msg := make([]byte, size)
+		rand.Read(msg)
+		out, err := encryptDecrypt(t, msg, id.Recipient(), id)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(out, msg) {
+			t.Fatalf("size %d: payload mismatch", size)
+		}
+	}
+}
+
+func TestWrongIdentity(t *testing.T) {
+	id, _ := GenerateHybridIdentity()
+	other, _ := GenerateHybridIdentity()
+	_, err := encryptDecrypt(t, []byte("secret"), id.Recipient(), other)
+	var noMatch *NoIdentityMatchError
+	if !errors.As(err, &noMatch) {
+		t.Fatalf("expected NoIdentityMatchError, got %v", err)
+	}
+	out, err := encryptDecrypt(t, []byte("secret"), id.Recipient(), other, id)
+	if err != nil || string(out) != "secret" {
+		t.Fatal("second identity should match")
+	}
+}
+
+func TestTruncatedPayload(t *testing.T) {
+	id, _ := GenerateHybridIdentity()
+	var buf bytes.Buffer
+	w, _ := Encrypt(&buf, id.Recipient())
+	w.Write(make([]byte, 2*chunkSize+10))
+	w.Close()
+	for _, cut := range []int{10, tagSize + 10, encChunkSize + 10} {
+		data := buf.Bytes()[:buf.Len()-cut]
+		out, err := Decrypt(bytes.NewReader(data), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ioutil.ReadAll(out); err == nil {
+			t.Fatalf("truncation by %d bytes not detected", cut)
+		}
+	}
+}
+
+func TestEncodings(t *testing.T) {
+	id, _ := GenerateHybridIdentity()
+	s := id.String()
+	if !strings.HasPrefix(s, "AGE-SECRET-KEY-PQ-1") {
+		t.Fatalf("unexpected identity encoding %s", s)
+	}
+	id2, err := ParseHybridIdentity(s)
+	if err != nil || id2.Recipient().String() != id.Recipient().String() {
+		t.Fatal("identity does not round trip")
+	}
+	r := id.Recipient().String()
+	if !strings.HasPrefix(r, "age1pq1") {
+		t.Fatalf("unexpected recipient encoding %s", r)
+	}
+	if _, err := ParseHybridRecipient(r); err != nil {
+		t.Fatal(err)
+	}
+	last := "q"
+	if r[len(r)-1] == 'q' {
+		last = "p"
+	}
+	if _, err := ParseHybridRecipient(r[:len(r)-1] + last); err == nil {
+		t.Fatal("bad checksum accepted")
+	}
+	if _, err := ParseHybridRecipient(strings.ToUpper(r[:10]) + r[10:]); err == nil {
+		t.Fatal("mixed case accepted")
+	}
+	if _, err := ParseHybridRecipient(s); err == nil {
+		t.Fatal("identity accepted as recipient")
+	}
+}
+
+func TestHeaderRoundTrip(t *testing.T) {
+	body := make([]byte, 48*3)
+	hdr := &header{stanzas: []*Stanza{{Type: "test", Args: []string{"a", "b"}, Body: body}, {Type: "empty"}}, mac: make([]byte, 32)}
+	data := hdr.marshal()
+	if !bytes.Contains(data, []byte(strings.Repeat("A", 64)+"\n\n")) {
+		t.Fatal("body whose size is a multiple of 48 bytes must end with an empty line")
+	}
+	parsed, err := parseHeader(bufioReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsed.marshal(), data) {
+		t.Fatal("header does not round trip")
+	}
+}
+
+func bufioReader(b []byte) *bufio.Reader {
+	return bufio.NewReader(bytes.NewReader(b))
+}
@@ -0,0 +1,134 @@
+package age
+
+import (
+	"errors"
+	"strings"
+)
+
+//Bech32 as specified in BIP 173, without the 90 characters limit since age recipients and identities are longer.
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= bech32Generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	h := []byte(strings.ToLower(hrp))
+	r := make([]byte, 0, 2*len(h)+1)
+	for _, c := range h {
+		r = append(r, c>>5)
+	}
+	r = append(r, 0)
+	for _, c := range h {
+		r = append(r, c&31)
+	}
+	return r
+}
+
+//convertBits regroups data from frombits-wide to tobits-wide values
+func convertBits(data []byte, frombits, tobits uint, pad bool) ([]byte, error) {
+	var ret []byte
+	acc, bits := uint32(0), uint(0)
+	maxv := byte(1<<tobits - 1)
+	for _, v := range data {
+		if v>>frombits != 0 {
+			return nil, errors.New("invalid data range")
+		}
+		acc = acc<<frombits | uint32(v)
+		bits += frombits
+		for bits >= tobits {
+			bits -= tobits
+			ret = append(ret, byte(acc>>bits)&maxv)
+		}
+	}
+	if pad {
+		if bits > 0 {
+			ret = append(ret, byte(acc<<(tobits-bits))&maxv)
+		}
+	} else if bits >= frombits {
+		return nil, errors.New("illegal zero padding")
+	} else if byte(acc<<(tobits-bits))&maxv != 0 {
+		return nil, errors.New("non-zero padding")
+	}
+	return ret, nil
+}
+
+//bech32Encode encodes data under the human readable part hrp. The case of hrp is kept for the whole string.
+func bech32Encode(hrp string, data []byte) (string, error) {
+	values, err := convertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	if len(hrp) < 1 {
+		return "", errors.New("invalid human readable part")
+	}
+	for _, c := range []byte(hrp) {
+		if c < 33 || c > 126 {
+			return "", errors.New("invalid human readable part")
+		}
+	}
+	lower := strings.ToLower(hrp) == hrp
+	hrp = strings.ToLower(hrp)
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteString("1")
+	for _, v := range values {
+		sb.WriteByte(bech32Charset[v])
+	}
+	polymod := bech32Polymod(append(append(bech32HRPExpand(hrp), values...), 0, 0, 0, 0, 0, 0)) ^ 1
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+	if lower {
+		return sb.String(), nil
+	}
+	return strings.ToUpper(sb.String()), nil
+}
+
+//bech32Decode returns the human readable part and the data of a Bech32 string
+func bech32Decode(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("mixed case")
+	}
+	pos := strings.LastIndex(s, "1")
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, errors.New("separator '1' at invalid position")
+	}
+	hrp := s[:pos]
+	for _, c := range []byte(hrp) {
+		if c < 33 || c > 126 {
+			return "", nil, errors.New("invalid character in human readable part")
+		}
+	}
+	s = strings.ToLower(s)
+	var values []byte
+	for _, c := range []byte(s[pos+1:]) {
+		d := strings.IndexByte(bech32Charset, c)
+		if d == -1 {
+			return "", nil, errors.New("invalid character in data part")
+		}
+		values = append(values, byte(d))
+	}
+	if bech32Polymod(append(bech32HRPExpand(hrp), values...)) != 1 {
+		return "", nil, errors.New("invalid checksum")
+	}
+	data, err := convertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hrp, data, nil
+}
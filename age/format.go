@@ -0,0 +1,129 @@
+package age
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	intro          = "age-encryption.org/v1\n"
+	stanzaPrefix   = "->"
+	footerPrefix   = "---"
+	columnsPerLine = 64
+)
+
+//b64 is the unpadded, canonical base64 encoding used throughout the header
+var b64 = base64.RawStdEncoding.Strict()
+
+//header holds the parsed recipient stanzas and the MAC of an age file
+type header struct {
+	stanzas []*Stanza
+	mac     []byte
+}
+
+//marshal encodes a stanza, wrapping its body at 64 columns and ending with a line shorter than 64 columns
+func (s *Stanza) marshal(buf *bytes.Buffer) {
+	buf.WriteString(stanzaPrefix)
+	for _, a := range append([]string{s.Type}, s.Args...) {
+		buf.WriteString(" " + a)
+	}
+	buf.WriteString("\n")
+	body := b64.EncodeToString(s.Body)
+	for len(body) >= columnsPerLine {
+		buf.WriteString(body[:columnsPerLine] + "\n")
+		body = body[columnsPerLine:]
+	}
+	buf.WriteString(body + "\n")
+}
+
+//marshalWithoutMAC returns the bytes covered by the header MAC
+func (h *header) marshalWithoutMAC() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(intro)
+	for _, s := range h.stanzas {
+		s.marshal(&buf)
+	}
+	buf.WriteString(footerPrefix)
+	return buf.Bytes()
+}
+
+//marshal returns the full header, MAC line included
+func (h *header) marshal() []byte {
+	return append(h.marshalWithoutMAC(), []byte(" "+b64.EncodeToString(h.mac)+"\n")...)
+}
+
+//parseHeader reads a header from r, leaving r positioned at the start of the payload
+func parseHeader(r *bufio.Reader) (*header, error) {
+	line, err := r.ReadString('\n')
+	if err != nil || line != intro {
+		return nil, errors.New("age: invalid header intro, not an age file?")
+	}
+
+	h := &header{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("age: failed to read header: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		if strings.HasPrefix(line, footerPrefix) {
+			if !strings.HasPrefix(line, footerPrefix+" ") {
+				return nil, errors.New("age: malformed closing line")
+			}
+			mac, err := b64.DecodeString(line[len(footerPrefix)+1:])
+			if err != nil || len(mac) != 32 {
+				return nil, errors.New("age: malformed header MAC")
+			}
+			h.mac = mac
+			return h, nil
+		}
+
+		if !strings.HasPrefix(line, stanzaPrefix+" ") {
+			return nil, fmt.Errorf("age: malformed stanza opening line: %q", line)
+		}
+		args := strings.Split(line[len(stanzaPrefix)+1:], " ")
+		for _, a := range args {
+			if !isValidArg(a) {
+				return nil, fmt.Errorf("age: malformed stanza argument: %q", a)
+			}
+		}
+		s := &Stanza{Type: args[0], Args: args[1:]}
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return nil, fmt.Errorf("age: failed to read stanza body: %v", err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if len(line) > columnsPerLine {
+				return nil, errors.New("age: stanza body line too long")
+			}
+			b, err := b64.DecodeString(line)
+			if err != nil {
+				return nil, fmt.Errorf("age: malformed stanza body: %v", err)
+			}
+			s.Body = append(s.Body, b...)
+			if len(line) < columnsPerLine {
+				break
+			}
+		}
+		h.stanzas = append(h.stanzas, s)
+	}
+}
+
+//isValidArg checks that a stanza argument is a non-empty string of visible ASCII characters
+func isValidArg(a string) bool {
+	if len(a) == 0 {
+		return false
+	}
+	for _, c := range []byte(a) {
+		if c < 33 || c > 126 {
+			return false
+		}
+	}
+	return true
+}
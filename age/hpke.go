@@ -0,0 +1,190 @@
+package age
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/sha3"
+)
+
+//The mlkem768x25519 stanza uses single-shot HPKE (RFC 9180, base mode) with the MLKEM768-X25519 KEM of
+//draft-ietf-hpke-pq (also known as X-Wing), HKDF-SHA256 and ChaCha20-Poly1305.
+const (
+	xwingKEMID         = 0x647a
+	hkdfSHA256ID       = 0x0001
+	chacha20Poly1305ID = 0x0003
+
+	xwingSeedSize = 32
+	xwingPKSize   = kyber.Kyber768SizePK + 32
+	xwingEncSize  = kyber.Kyber768SizeC + 32
+)
+
+//xwingLabel is the domain separator of the X-Wing combiner
+const xwingLabel = `\./` + `/^\`
+
+//xwingKeyPair holds an expanded MLKEM768-X25519 private key
+type xwingKeyPair struct {
+	skM []byte //packed ML-KEM-768 secret key
+	skX []byte //X25519 scalar
+	pk  []byte //ML-KEM-768 public key || X25519 public key
+}
+
+//xwingDeriveKeyPair expands a 32 byte seed into an MLKEM768-X25519 key pair
+func xwingDeriveKeyPair(seed []byte) (*xwingKeyPair, error) {
+	if len(seed) != xwingSeedSize {
+		return nil, errors.New("invalid seed size")
+	}
+	expanded := make([]byte, 96)
+	h := sha3.NewShake256()
+	h.Write(seed)
+	h.Read(expanded)
+
+	pkM, skM := kyber.NewMLKEM768().KeyGen(expanded[:64])
+	pkX, err := curve25519.X25519(expanded[64:], curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return &xwingKeyPair{skM: skM, skX: expanded[64:], pk: append(pkM, pkX...)}, nil
+}
+
+//xwingCombiner derives the shared secret of the hybrid KEM from both components
+func xwingCombiner(ssM, ssX, ctX, pkX []byte) []byte {
+	h := sha3.New256()
+	h.Write(ssM)
+	h.Write(ssX)
+	h.Write(ctX)
+	h.Write(pkX)
+	h.Write([]byte(xwingLabel))
+	return h.Sum(nil)
+}
+
+//xwingEncaps generates a shared secret for pk and returns it with its encapsulation
+func xwingEncaps(pk []byte, rand io.Reader) (ss, enc []byte, err error) {
+	if len(pk) != xwingPKSize {
+		return nil, nil, errors.New("invalid public key size")
+	}
+	pkM, pkX := pk[:kyber.Kyber768SizePK], pk[kyber.Kyber768SizePK:]
+
+	ekX := make([]byte, 32)
+	coins := make([]byte, 32)
+	if _, err := io.ReadFull(rand, ekX); err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.ReadFull(rand, coins); err != nil {
+		return nil, nil, err
+	}
+	ctX, err := curve25519.X25519(ekX, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	ssX, err := curve25519.X25519(ekX, pkX)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctM, ssM := kyber.NewMLKEM768().Encaps(pkM, coins)
+	if ctM == nil {
+		return nil, nil, errors.New("invalid ML-KEM-768 public key")
+	}
+	return xwingCombiner(ssM, ssX, ctX, pkX), append(ctM, ctX...), nil
+}
+
+//decaps recovers the shared secret from an encapsulation
+func (kp *xwingKeyPair) decaps(enc []byte) ([]byte, error) {
+	if len(enc) != xwingEncSize {
+		return nil, errors.New("invalid encapsulation size")
+	}
+	ctM, ctX := enc[:kyber.Kyber768SizeC], enc[kyber.Kyber768SizeC:]
+	ssM := kyber.NewMLKEM768().Decaps(kp.skM, ctM)
+	ssX, err := curve25519.X25519(kp.skX, ctX)
+	if err != nil {
+		return nil, err
+	}
+	return xwingCombiner(ssM, ssX, ctX, kp.pk[kyber.Kyber768SizePK:]), nil
+}
+
+//hpkeContext holds the AEAD key and base nonce of a single-shot HPKE context
+type hpkeContext struct {
+	key       []byte
+	baseNonce []byte
+}
+
+func hpkeSuiteID() []byte {
+	suite := []byte("HPKE")
+	suite = append(suite, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint16(suite[4:], xwingKEMID)
+	binary.BigEndian.PutUint16(suite[6:], hkdfSHA256ID)
+	binary.BigEndian.PutUint16(suite[8:], chacha20Poly1305ID)
+	return suite
+}
+
+func labeledExtract(salt []byte, label string, ikm []byte) []byte {
+	labeled := append([]byte("HPKE-v1"), hpkeSuiteID()...)
+	labeled = append(labeled, label...)
+	labeled = append(labeled, ikm...)
+	return hkdf.Extract(sha256.New, labeled, salt)
+}
+
+func labeledExpand(prk []byte, label string, info []byte, length int) []byte {
+	labeled := []byte{byte(length >> 8), byte(length)}
+	labeled = append(labeled, "HPKE-v1"...)
+	labeled = append(labeled, hpkeSuiteID()...)
+	labeled = append(labeled, label...)
+	labeled = append(labeled, info...)
+	out := make([]byte, length)
+	io.ReadFull(hkdf.Expand(sha256.New, prk, labeled), out)
+	return out
+}
+
+//hpkeKeySchedule runs the base mode key schedule of RFC 9180
+func hpkeKeySchedule(sharedSecret, info []byte) *hpkeContext {
+	ctx := []byte{0x00} //mode_base
+	ctx = append(ctx, labeledExtract(nil, "psk_id_hash", nil)...)
+	ctx = append(ctx, labeledExtract(nil, "info_hash", info)...)
+	secret := labeledExtract(sharedSecret, "secret", nil)
+	return &hpkeContext{
+		key:       labeledExpand(secret, "key", ctx, chacha20poly1305.KeySize),
+		baseNonce: labeledExpand(secret, "base_nonce", ctx, chacha20poly1305.NonceSize),
+	}
+}
+
+//hpkeSeal encrypts plaintext to pk in a single shot and returns the encapsulation and ciphertext
+func hpkeSeal(pk, info, plaintext []byte, rand io.Reader) (enc, ct []byte, err error) {
+	ss, enc, err := xwingEncaps(pk, rand)
+	if err != nil {
+		return nil, nil, err
+	}
+	c := hpkeKeySchedule(ss, info)
+	aead, err := chacha20poly1305.New(c.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return enc, aead.Seal(nil, c.baseNonce, plaintext, nil), nil
+}
+
+//errHPKEOpen is returned by hpkeOpen when the ciphertext does not authenticate, as when it was sealed to another key
+var errHPKEOpen = errors.New("message authentication failed")
+
+//hpkeOpen decrypts a single-shot ciphertext with kp. An encapsulation that cannot be decapsulated, such as one
+//yielding the all-zero X25519 shared secret, is an error other than errHPKEOpen.
+func hpkeOpen(kp *xwingKeyPair, enc, info, ct []byte) ([]byte, error) {
+	ss, err := kp.decaps(enc)
+	if err != nil {
+		return nil, err
+	}
+	c := hpkeKeySchedule(ss, info)
+	aead, err := chacha20poly1305.New(c.key)
+	if err != nil {
+		return nil, err
+	}
+	pt, err := aead.Open(nil, c.baseNonce, ct, nil)
+	if err != nil {
+		return nil, errHPKEOpen
+	}
+	return pt, nil
+}
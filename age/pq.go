@@ -0,0 +1,128 @@
+package age
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	hybridStanzaType   = "mlkem768x25519"
+	hybridLabel        = "age-encryption.org/mlkem768x25519"
+	hybridRecipientHRP = "age1pq"
+	hybridIdentityHRP  = "AGE-SECRET-KEY-PQ-"
+)
+
+//HybridRecipient is a post-quantum hybrid age public key, encoded as an "age1pq1..." string.
+//Files encrypted to it stay confidential as long as either ML-KEM-768 or X25519 is secure.
+type HybridRecipient struct {
+	pk []byte
+}
+
+//HybridIdentity is the private key of a HybridRecipient, encoded as an "AGE-SECRET-KEY-PQ-1..." string
+type HybridIdentity struct {
+	seed []byte
+	kp   *xwingKeyPair
+}
+
+//GenerateHybridIdentity creates a new random hybrid identity
+func GenerateHybridIdentity() (*HybridIdentity, error) {
+	seed := make([]byte, xwingSeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	return newHybridIdentity(seed)
+}
+
+func newHybridIdentity(seed []byte) (*HybridIdentity, error) {
+	kp, err := xwingDeriveKeyPair(seed)
+	if err != nil {
+		return nil, err
+	}
+	return &HybridIdentity{seed: append([]byte{}, seed...), kp: kp}, nil
+}
+
+//ParseHybridIdentity decodes an "AGE-SECRET-KEY-PQ-1..." string
+func ParseHybridIdentity(s string) (*HybridIdentity, error) {
+	hrp, seed, err := bech32Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("age: malformed hybrid identity: %v", err)
+	}
+	if hrp != hybridIdentityHRP {
+		return nil, fmt.Errorf("age: malformed hybrid identity: unexpected type %q", hrp)
+	}
+	if len(seed) != xwingSeedSize {
+		return nil, errors.New("age: malformed hybrid identity: invalid length")
+	}
+	return newHybridIdentity(seed)
+}
+
+//ParseHybridRecipient decodes an "age1pq1..." string
+func ParseHybridRecipient(s string) (*HybridRecipient, error) {
+	hrp, pk, err := bech32Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("age: malformed hybrid recipient: %v", err)
+	}
+	if hrp != hybridRecipientHRP {
+		return nil, fmt.Errorf("age: malformed hybrid recipient: unexpected type %q", hrp)
+	}
+	if len(pk) != xwingPKSize {
+		return nil, errors.New("age: malformed hybrid recipient: invalid length")
+	}
+	return &HybridRecipient{pk: pk}, nil
+}
+
+//Recipient returns the public key matching the identity
+func (i *HybridIdentity) Recipient() *HybridRecipient {
+	return &HybridRecipient{pk: append([]byte{}, i.kp.pk...)}
+}
+
+//String returns the Bech32 encoding of the identity
+func (i *HybridIdentity) String() string {
+	s, _ := bech32Encode(hybridIdentityHRP, i.seed)
+	return strings.ToUpper(s)
+}
+
+//String returns the Bech32 encoding of the recipient
+func (r *HybridRecipient) String() string {
+	s, _ := bech32Encode(hybridRecipientHRP, r.pk)
+	return s
+}
+
+//Wrap encapsulates the file key in an mlkem768x25519 stanza
+func (r *HybridRecipient) Wrap(fileKey []byte) ([]*Stanza, error) {
+	enc, ct, err := hpkeSeal(r.pk, []byte(hybridLabel), fileKey, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return []*Stanza{{Type: hybridStanzaType, Args: []string{b64.EncodeToString(enc)}, Body: ct}}, nil
+}
+
+//Unwrap recovers the file key from the first mlkem768x25519 stanza addressed to the identity
+func (i *HybridIdentity) Unwrap(stanzas []*Stanza) ([]byte, error) {
+	for _, s := range stanzas {
+		if s.Type != hybridStanzaType {
+			continue
+		}
+		if len(s.Args) != 1 {
+			return nil, errors.New("age: invalid mlkem768x25519 stanza")
+		}
+		enc, err := b64.DecodeString(s.Args[0])
+		if err != nil || len(enc) != xwingEncSize {
+			return nil, errors.New("age: invalid mlkem768x25519 stanza")
+		}
+		if len(s.Body) != fileKeySize+tagSize {
+			return nil, errors.New("age: invalid mlkem768x25519 stanza")
+		}
+		fileKey, err := hpkeOpen(i.kp, enc, []byte(hybridLabel), s.Body)
+		if errors.Is(err, errHPKEOpen) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.New("age: invalid mlkem768x25519 stanza")
+		}
+		return fileKey, nil
+	}
+	return nil, ErrIncorrectIdentity
+}
@@ -0,0 +1,170 @@
+package age
+
+import (
+	"crypto/cipher"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+//The payload is split into chunks of 64 KiB, each sealed with ChaCha20-Poly1305 under a nonce made of an
+//11 byte big-endian counter and a final byte set to 1 for the last chunk only (STREAM construction).
+const (
+	streamNonceSize = 16
+	tagSize         = 16
+	chunkSize       = 64 * 1024
+	encChunkSize    = chunkSize + tagSize
+	lastChunkFlag   = 0x01
+)
+
+//streamWriter encrypts the payload written to it
+type streamWriter struct {
+	a     cipher.AEAD
+	dst   io.Writer
+	buf   []byte
+	nonce [chacha20poly1305.NonceSize]byte
+	err   error
+}
+
+func newStreamWriter(key []byte, dst io.Writer) (*streamWriter, error) {
+	a, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &streamWriter{a: a, dst: dst, buf: make([]byte, 0, encChunkSize)}, nil
+}
+
+//Write buffers p and flushes every full chunk that is known not to be the last one
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	total := len(p)
+	for len(p) > 0 {
+		if len(w.buf) == chunkSize {
+			if err := w.flushChunk(false); err != nil {
+				w.err = err
+				return total - len(p), err
+			}
+		}
+		n := chunkSize - len(w.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+	}
+	return total, nil
+}
+
+//Close seals the remaining buffered data as the last chunk. It does not close the underlying writer.
+func (w *streamWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.flushChunk(true)
+	if w.err != nil {
+		return w.err
+	}
+	w.err = errors.New("age: write on closed stream")
+	return nil
+}
+
+func (w *streamWriter) flushChunk(last bool) error {
+	if last {
+		w.nonce[len(w.nonce)-1] = lastChunkFlag
+	}
+	out := w.a.Seal(w.buf[:0], w.nonce[:], w.buf, nil)
+	if _, err := w.dst.Write(out); err != nil {
+		return err
+	}
+	w.buf = w.buf[:0]
+	return incNonce(&w.nonce)
+}
+
+//streamReader decrypts and authenticates the payload read from src
+type streamReader struct {
+	a       cipher.AEAD
+	src     io.Reader
+	buf     []byte //one chunk plus one byte of read-ahead
+	pending int    //number of read-ahead bytes already in buf
+	plain   []byte
+	out     []byte
+	nonce   [chacha20poly1305.NonceSize]byte
+	err     error
+}
+
+func newStreamReader(key []byte, src io.Reader) (*streamReader, error) {
+	a, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{a: a, src: src, buf: make([]byte, encChunkSize+1), plain: make([]byte, 0, chunkSize)}, nil
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.readChunk()
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+//readChunk decrypts the next chunk into r.out.
+//One byte past the chunk is read ahead to tell whether a full-size chunk is the last one.
+func (r *streamReader) readChunk() error {
+	first := r.nonce == [chacha20poly1305.NonceSize]byte{}
+	n, err := io.ReadFull(r.src, r.buf[r.pending:])
+	n += r.pending
+	switch {
+	case err == io.EOF && n == 0:
+		return errors.New("age: payload is truncated, last chunk is missing")
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+	case err != nil:
+		return err
+	}
+	last := n <= encChunkSize
+	in := r.buf[:n]
+	if !last {
+		in = r.buf[:encChunkSize]
+	}
+	if len(in) < tagSize {
+		return errors.New("age: payload chunk is too short")
+	}
+	if last {
+		r.nonce[len(r.nonce)-1] = lastChunkFlag
+	}
+	out, err := r.a.Open(r.plain[:0], r.nonce[:], in, nil)
+	if err != nil {
+		return errors.New("age: failed to decrypt and authenticate payload chunk")
+	}
+	if last && len(out) == 0 && !first {
+		return errors.New("age: last chunk is empty")
+	}
+	r.out = out
+	if last {
+		return io.EOF
+	}
+	r.buf[0] = r.buf[encChunkSize]
+	r.pending = 1
+	return incNonce(&r.nonce)
+}
+
+//incNonce increments the 11 byte big-endian counter of the nonce
+func incNonce(nonce *[chacha20poly1305.NonceSize]byte) error {
+	for i := len(nonce) - 2; i >= 0; i-- {
+		nonce[i]++
+		if nonce[i] != 0 {
+			return nil
+		}
+		if i == 0 {
+			return errors.New("age: stream counter overflow")
+		}
+	}
+	return nil
+}
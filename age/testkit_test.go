@@ -0,0 +1,148 @@
+package age
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//The vectors in testdata/testkit are the hybrid vectors of the age test suite of C2SP CCTV
+//(https://c2sp.org/CCTV/age): a few "key: value" lines, an empty line, then the age file, possibly compressed. Armored
+//vectors are skipped, as the package does not implement the armor, and so are vectors with identities of other
+//recipient types, whose expectation depends on them.
+func TestTestkit(t *testing.T) {
+	files, err := filepath.Glob("testdata/testkit/*")
+	if err != nil || len(files) == 0 {
+		t.Fatal("no testkit vectors found")
+	}
+	for _, name := range files {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			testVector(t, name)
+		})
+	}
+}
+
+func testVector(t *testing.T, name string) {
+	meta, body := readVector(t, name)
+	if meta["armored"] != nil {
+		t.Skip("armor is not implemented")
+	}
+	var ids []Identity
+	for _, s := range meta["identity"] {
+		if !strings.HasPrefix(s, "AGE-SECRET-KEY-PQ-") {
+			t.Skip("identity of an unsupported recipient type")
+		}
+		id, err := ParseHybridIdentity(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	out, err := Decrypt(body, ids...)
+	var payload []byte
+	if err == nil {
+		payload, err = ioutil.ReadAll(out)
+	}
+
+	var noMatch *NoIdentityMatchError
+	switch expect := meta["expect"][0]; expect {
+	case "success":
+		if err != nil {
+			t.Fatalf("expected success, got %v", err)
+		}
+		h := sha256.Sum256(payload)
+		if hex.EncodeToString(h[:]) != meta["payload"][0] {
+			t.Fatal("payload hash mismatch")
+		}
+	case "no match":
+		if !errors.As(err, &noMatch) {
+			t.Fatalf("expected no match, got %v", err)
+		}
+	case "HMAC failure":
+		if err == nil || !strings.Contains(err.Error(), "MAC") {
+			t.Fatalf("expected HMAC failure, got %v", err)
+		}
+	case "header failure":
+		if err == nil || errors.As(err, &noMatch) {
+			t.Fatalf("expected header failure, got %v", err)
+		}
+	default:
+		t.Fatalf("unknown expectation %q", expect)
+	}
+}
+
+//readVector returns the metadata of a vector, whose keys may repeat, and its age file
+func readVector(t *testing.T, name string) (map[string][]string, io.Reader) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(bytes.NewReader(data))
+	meta := map[string][]string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			break
+		}
+		kv := strings.SplitN(line, ": ", 2)
+		meta[kv[0]] = append(meta[kv[0]], kv[1])
+	}
+	if len(meta["expect"]) != 1 {
+		t.Fatal("vector without expectation")
+	}
+	switch c := meta["compressed"]; {
+	case c == nil:
+		return meta, r
+	case c[0] == "zlib":
+		z, err := zlib.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return meta, z
+	default:
+		t.Fatalf("unknown compression %q", c[0])
+	}
+	return nil, nil
+}
+
+//TestTestkitReencrypt checks that files produced by this package are byte-compatible with the vectors: the payload
+//of a success vector, encrypted again to the recipient of its identity, decrypts to the same bytes.
+func TestTestkitReencrypt(t *testing.T) {
+	meta, body := readVector(t, "testdata/testkit/hybrid")
+	id, err := ParseHybridIdentity(meta["identity"][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := Decrypt(body, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := ioutil.ReadAll(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, _ := Encrypt(&buf, id.Recipient())
+	w.Write(payload)
+	w.Close()
+	out, err := Decrypt(&buf, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadAll(out); !bytes.Equal(got, payload) {
+		t.Fatal("payload mismatch after re-encryption")
+	}
+}
@@ -0,0 +1,302 @@
+//Package agent implements a signing agent for ML-DSA and Dilithium keys in the spirit of ssh-agent: a process holds
+//the private keys and answers list and sign requests received on a Unix domain socket, so that the programs signing
+//with the keys never read them. Keys may be added with constraints: confirmation of every signature, a lifetime, a
+//maximum number of signatures and the ML-DSA contexts they sign with.
+//
+//Messages are framed like those of ssh-agent: a 4-byte big-endian length, then a message type byte and the fields of
+//the message, strings being prefixed by their 4-byte length. The message types are those of ssh-agent but the agents
+//are not compatible.
+package agent
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	"golang.org/x/crypto/sha3"
+)
+
+//SocketEnv is the environment variable holding the path of the socket of the agent
+const SocketEnv = "PQ_AGENT_SOCK"
+
+var algorithms = map[string]func(...bool) *dilithium.Dilithium{
+	"Dilithium2": dilithium.NewDilithium2,
+	"Dilithium3": dilithium.NewDilithium3,
+	"Dilithium5": dilithium.NewDilithium5,
+	"ML-DSA-44":  dilithium.NewMLDSA44,
+	"ML-DSA-65":  dilithium.NewMLDSA65,
+	"ML-DSA-87":  dilithium.NewMLDSA87,
+}
+
+//Key is a key held by an agent, with its constraints
+type Key struct {
+	//Algorithm is the name of the parameter set
+	Algorithm string
+	PublicKey []byte
+	Comment   string
+	//Confirm is set if every signature must be confirmed
+	Confirm bool
+	//Expiry is the time after which the key is removed, zero if it does not expire
+	Expiry time.Time
+	//Remaining is the number of signatures left before the key is removed, 0 if unlimited
+	Remaining int
+	//Contexts are the only ML-DSA contexts the key signs with, any if empty
+	Contexts []string
+}
+
+//Fingerprint returns the SHA-256 hash of the public key in the format of ssh-keygen -l, "SHA256:" followed by the
+//unpadded base64 hash
+func (k *Key) Fingerprint() string {
+	return Fingerprint(k.PublicKey)
+}
+
+//Fingerprint returns the fingerprint of a public key
+func Fingerprint(pk []byte) string {
+	h := sha256.Sum256(pk)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(h[:])
+}
+
+//allows reports whether the key signs with a context
+func (k *Key) allows(context []byte) bool {
+	if len(k.Contexts) == 0 {
+		return true
+	}
+	for _, c := range k.Contexts {
+		if c == string(context) {
+			return true
+		}
+	}
+	return false
+}
+
+//AddedKey is a private key to add to an agent. The key is either the seed given to KeyGen or the expanded private key
+//and its public key.
+type AddedKey struct {
+	Dilithium  *dilithium.Dilithium
+	Seed       []byte
+	PrivateKey []byte
+	PublicKey  []byte
+	Comment    string
+	//Confirm requires the confirmation of every signature through Agent.Confirm
+	Confirm bool
+	//Lifetime is the duration after which the key is removed, unlimited if 0
+	Lifetime time.Duration
+	//MaxSignatures is the number of signatures after which the key is removed, unlimited if 0
+	MaxSignatures int
+	//Contexts restricts the ML-DSA contexts of the signatures
+	Contexts []string
+}
+
+//agentKey is a key and its private key
+type agentKey struct {
+	Key
+	d  *dilithium.Dilithium
+	sk []byte
+}
+
+//wipe overwrites the private key
+func (k *agentKey) wipe() {
+	for i := range k.sk {
+		k.sk[i] = 0
+	}
+}
+
+//Agent holds private keys and signs with them. It is safe for concurrent use.
+type Agent struct {
+	//Confirm is called before signing with a key requiring confirmation, outside of the lock of the agent. If nil,
+	//these signatures are refused.
+	Confirm func(k Key, data, context []byte) bool
+
+	mu   sync.Mutex
+	keys []*agentKey
+}
+
+//Errors returned by Sign and sent to clients
+var (
+	ErrUnknownKey = errors.New("agent: unknown key")
+	ErrContext    = errors.New("agent: context not allowed for this key")
+	ErrRefused    = errors.New("agent: signature refused")
+)
+
+//NewAgent returns an agent without keys
+func NewAgent() *Agent {
+	return &Agent{}
+}
+
+//Add adds a private key to the agent, replacing the key with the same public key
+func (a *Agent) Add(key AddedKey) error {
+	d := key.Dilithium
+	if d == nil || algorithms[d.Name] == nil {
+		return errors.New("agent: unsupported parameter set")
+	}
+	d = algorithms[d.Name]()
+	k := &agentKey{d: d, Key: Key{
+		Algorithm: d.Name,
+		Comment:   key.Comment,
+		Confirm:   key.Confirm,
+		Remaining: key.MaxSignatures,
+		Contexts:  append([]string{}, key.Contexts...),
+	}}
+	switch {
+	case key.Seed != nil:
+		if len(key.Seed) != dilithium.SEEDBYTES {
+			return errors.New("agent: invalid seed length")
+		}
+		k.PublicKey, k.sk = d.KeyGen(key.Seed)
+		if key.PublicKey != nil && !bytes.Equal(key.PublicKey, k.PublicKey) {
+			return errors.New("agent: the seed does not match the public key")
+		}
+	case key.PrivateKey != nil && key.PublicKey != nil:
+		if len(key.PrivateKey) != d.SIZESK() || len(key.PublicKey) != d.SIZEPK() {
+			return errors.New("agent: invalid key length")
+		}
+		//the private key holds tr, the hash of the public key
+		tr := d.UnpackSK(key.PrivateKey).Tr
+		h := make([]byte, 32)
+		if d.IsMLDSA() {
+			h = make([]byte, 64)
+		}
+		sha3.ShakeSum256(h, key.PublicKey)
+		if subtle.ConstantTimeCompare(h, tr[:len(h)]) != 1 {
+			return errors.New("agent: the private key does not match the public key")
+		}
+		k.PublicKey = append([]byte{}, key.PublicKey...)
+		k.sk = append([]byte{}, key.PrivateKey...)
+	default:
+		return errors.New("agent: missing seed or private and public keys")
+	}
+	if len(k.Contexts) != 0 && !d.IsMLDSA() {
+		return errors.New("agent: contexts are only supported by ML-DSA")
+	}
+	for _, c := range k.Contexts {
+		if len(c) > 255 {
+			return errors.New("agent: context longer than 255 bytes")
+		}
+	}
+	if key.MaxSignatures < 0 || key.Lifetime < 0 {
+		return errors.New("agent: invalid constraint")
+	}
+	if key.Lifetime > 0 {
+		k.Expiry = time.Now().Add(key.Lifetime)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.removeLocked(k.PublicKey)
+	a.keys = append(a.keys, k)
+	return nil
+}
+
+//removeLocked removes and wipes the key of a public key, and reports whether it was found
+func (a *Agent) removeLocked(pk []byte) bool {
+	for i, k := range a.keys {
+		if bytes.Equal(k.PublicKey, pk) {
+			k.wipe()
+			a.keys = append(a.keys[:i], a.keys[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+//expireLocked removes the expired keys
+func (a *Agent) expireLocked() {
+	now := time.Now()
+	keys := a.keys[:0]
+	for _, k := range a.keys {
+		if !k.Expiry.IsZero() && now.After(k.Expiry) {
+			k.wipe()
+			continue
+		}
+		keys = append(keys, k)
+	}
+	a.keys = keys
+}
+
+//Remove removes the key of a public key
+func (a *Agent) Remove(pk []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.removeLocked(pk) {
+		return ErrUnknownKey
+	}
+	return nil
+}
+
+//RemoveAll removes all the keys
+func (a *Agent) RemoveAll() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, k := range a.keys {
+		k.wipe()
+	}
+	a.keys = nil
+}
+
+//List returns the keys of the agent, in the order they were added
+func (a *Agent) List() []Key {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.expireLocked()
+	keys := make([]Key, len(a.keys))
+	for i, k := range a.keys {
+		keys[i] = k.Key
+	}
+	return keys
+}
+
+//find returns the key of a public key
+func (a *Agent) find(pk []byte) *agentKey {
+	a.expireLocked()
+	for _, k := range a.keys {
+		if bytes.Equal(k.PublicKey, pk) {
+			return k
+		}
+	}
+	return nil
+}
+
+//Sign signs data with the key of a public key, with an ML-DSA context if not empty, once the constraints of the key
+//are satisfied. A key is removed after its last allowed signature.
+func (a *Agent) Sign(pk, data, context []byte) ([]byte, error) {
+	a.mu.Lock()
+	k := a.find(pk)
+	if k == nil {
+		a.mu.Unlock()
+		return nil, ErrUnknownKey
+	}
+	if !k.allows(context) || len(context) != 0 && !k.d.IsMLDSA() {
+		a.mu.Unlock()
+		return nil, ErrContext
+	}
+	key := k.Key
+	a.mu.Unlock()
+
+	if key.Confirm && (a.Confirm == nil || !a.Confirm(key, data, context)) {
+		return nil, ErrRefused
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	//the key may have been removed, used up or replaced with other constraints while confirming
+	if a.find(pk) != k {
+		return nil, ErrUnknownKey
+	}
+	var sig []byte
+	if k.d.IsMLDSA() {
+		sig = k.d.SignWithContext(k.sk, data, context)
+	} else {
+		sig = k.d.Sign(k.sk, data)
+	}
+	if k.Remaining > 0 {
+		if k.Remaining--; k.Remaining == 0 {
+			a.removeLocked(pk)
+		}
+	}
+	return sig, nil
+}
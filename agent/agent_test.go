@@ -0,0 +1,218 @@
+package agent
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+)
+
+var seed = bytes.Repeat([]byte{3}, dilithium.SEEDBYTES)
+
+//privateDir returns a temporary directory only accessible to the current user, whatever the umask
+func privateDir(t *testing.T) string {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+//serve starts an agent on a socket and returns a client connected to it
+func serve(t *testing.T, a *Agent) *Client {
+	l, err := Listen(filepath.Join(privateDir(t), "agent.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go a.Serve(l)
+	c, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestListSign(t *testing.T) {
+	a := NewAgent()
+	d := dilithium.NewMLDSA65()
+	pk, sk := d.KeyGen(seed)
+	if err := a.Add(AddedKey{Dilithium: d, PrivateKey: sk, PublicKey: pk, Comment: "release"}); err != nil {
+		t.Fatal(err)
+	}
+	d2 := dilithium.NewDilithium2()
+	if err := a.Add(AddedKey{Dilithium: d2, Seed: seed, Comment: "legacy", MaxSignatures: 3}); err != nil {
+		t.Fatal(err)
+	}
+	c := serve(t, a)
+
+	keys, err := c.List()
+	if err != nil || len(keys) != 2 || keys[0].Algorithm != "ML-DSA-65" || !bytes.Equal(keys[0].PublicKey, pk) ||
+		keys[0].Comment != "release" || keys[1].Remaining != 3 || keys[0].Fingerprint() != Fingerprint(pk) {
+		t.Fatal("unexpected keys", keys, err)
+	}
+	sig, err := c.Sign(pk, []byte("commit"), nil)
+	if err != nil || !d.Verify(pk, []byte("commit"), sig) {
+		t.Fatal("invalid signature", err)
+	}
+	sig, err = c.Sign(pk, []byte("commit"), []byte("git"))
+	if err != nil || !d.VerifyWithContext(pk, []byte("commit"), sig, []byte("git")) {
+		t.Fatal("invalid signature with context", err)
+	}
+	sig, err = c.Sign(keys[1].PublicKey, []byte("artifact"), nil)
+	if err != nil || !d2.Verify(keys[1].PublicKey, []byte("artifact"), sig) {
+		t.Fatal("invalid Dilithium2 signature", err)
+	}
+	if _, err := c.Sign(keys[1].PublicKey, []byte("artifact"), []byte("git")); err != ErrContext {
+		t.Fatal("context accepted by a round 3 key", err)
+	}
+	if _, err := c.Sign(pk[1:], []byte("commit"), nil); err != ErrUnknownKey {
+		t.Fatal("unknown key used", err)
+	}
+
+	a.Remove(pk)
+	if keys, _ := c.List(); len(keys) != 1 {
+		t.Fatal("key not removed")
+	}
+	a.RemoveAll()
+	if keys, _ := c.List(); len(keys) != 0 {
+		t.Fatal("keys not removed")
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	a := NewAgent()
+	d := dilithium.NewMLDSA44()
+	pk, _ := d.KeyGen(seed)
+	c := serve(t, a)
+
+	a.Add(AddedKey{Dilithium: d, Seed: seed, MaxSignatures: 2, Contexts: []string{"release"}})
+	if _, err := c.Sign(pk, []byte("data"), nil); err != ErrContext {
+		t.Fatal("signature without the allowed context", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Sign(pk, []byte("data"), []byte("release")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.Sign(pk, []byte("data"), []byte("release")); err != ErrUnknownKey {
+		t.Fatal("key used more than allowed", err)
+	}
+
+	a.Add(AddedKey{Dilithium: d, Seed: seed, Confirm: true})
+	if _, err := c.Sign(pk, []byte("data"), nil); err != ErrRefused {
+		t.Fatal("signature without confirmation", err)
+	}
+	var confirmed []byte
+	a.Confirm = func(k Key, data, context []byte) bool {
+		confirmed = data
+		return string(data) == "yes"
+	}
+	if _, err := c.Sign(pk, []byte("no"), nil); err != ErrRefused {
+		t.Fatal("refused signature", err)
+	}
+	if _, err := c.Sign(pk, []byte("yes"), nil); err != nil || string(confirmed) != "yes" {
+		t.Fatal("confirmed signature refused", err)
+	}
+
+	//a key replaced while confirming is not used with the constraints of the replaced key
+	a.Confirm = func(k Key, data, context []byte) bool {
+		a.Add(AddedKey{Dilithium: d, Seed: seed, Confirm: true, Contexts: []string{"release"}})
+		return true
+	}
+	if _, err := c.Sign(pk, []byte("data"), nil); err != ErrUnknownKey {
+		t.Fatal("replaced key used", err)
+	}
+
+	a.Add(AddedKey{Dilithium: d, Seed: seed, Lifetime: time.Millisecond})
+	if keys, _ := c.List(); len(keys) != 1 || keys[0].Expiry.IsZero() || keys[0].Confirm {
+		t.Fatal("key not replaced", keys)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, err := c.Sign(pk, []byte("data"), nil); err != ErrUnknownKey {
+		t.Fatal("expired key used", err)
+	}
+}
+
+func TestAddErrors(t *testing.T) {
+	a := NewAgent()
+	d := dilithium.NewMLDSA87()
+	pk, sk := d.KeyGen(seed)
+	otherPK, _ := d.KeyGen(nil)
+	for _, k := range []AddedKey{
+		{Dilithium: d, PrivateKey: sk, PublicKey: otherPK},
+		{Dilithium: d, PrivateKey: sk},
+		{Dilithium: d, Seed: seed[1:]},
+		{Dilithium: d, Seed: seed, PublicKey: otherPK},
+		{Dilithium: dilithium.NewDilithium5(), Seed: seed, Contexts: []string{"git"}},
+		{Dilithium: d, Seed: seed, MaxSignatures: -1},
+		{Seed: seed},
+	} {
+		if err := a.Add(k); err == nil {
+			t.Fatal("invalid key added")
+		}
+	}
+	if err := a.Add(AddedKey{Dilithium: d, PrivateKey: sk, PublicKey: pk}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMalformedRequests(t *testing.T) {
+	a := NewAgent()
+	a.Add(AddedKey{Dilithium: dilithium.NewMLDSA44(), Seed: seed})
+	server, client := net.Pipe()
+	go a.ServeConn(server)
+	defer client.Close()
+	for _, req := range [][]byte{
+		{msgListRequest, 0},
+		{msgSignRequest, 0, 0, 0, 9, 1},
+		{42},
+	} {
+		if err := writeMessage(client, req); err != nil {
+			t.Fatal(err)
+		}
+		answer, err := readMessage(client)
+		if err != nil || answer[0] != msgFailure {
+			t.Fatal("malformed request answered", req, err)
+		}
+	}
+	if keys, err := NewClient(client).List(); err != nil || len(keys) != 1 {
+		t.Fatal("connection not usable after failures", err)
+	}
+}
+
+func TestListenPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no Unix permissions")
+	}
+	dir := privateDir(t)
+	l, err := Listen(filepath.Join(dir, "agent.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	fi, err := os.Stat(filepath.Join(dir, "agent.sock"))
+	if err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatal("socket accessible to other users", err)
+	}
+
+	shared := filepath.Join(dir, "shared")
+	if err := os.Mkdir(shared, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []os.FileMode{0770, 0707, 0777 | os.ModeSticky} {
+		if err := os.Chmod(shared, mode); err != nil {
+			t.Fatal(err)
+		}
+		if l, err := Listen(filepath.Join(shared, "agent.sock")); err == nil {
+			l.Close()
+			t.Fatalf("socket created in a directory of mode %v", mode)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build windows || plan9 || js
+// +build windows plan9 js
+
+package agent
+
+import "net"
+
+//listen listens on the socket, whose access is left to the permissions of its directory
+func listen(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
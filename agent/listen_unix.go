@@ -0,0 +1,27 @@
+//go:build !windows && !plan9 && !js
+// +build !windows,!plan9,!js
+
+package agent
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+//listen checks the directory of the socket and creates it under a umask only leaving it accessible to the current
+//user. The umask is that of the process, so files created meanwhile by other goroutines are private too.
+func listen(path string) (net.Listener, error) {
+	fi, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode().Perm()&0022 != 0 {
+		return nil, errors.New("agent: directory of the socket is writable by other users")
+	}
+	old := syscall.Umask(0177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,320 @@
+package agent
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+//Message types, as in ssh-agent
+const (
+	msgFailure     = 5
+	msgListRequest = 11
+	msgListAnswer  = 12
+	msgSignRequest = 13
+	msgSignAnswer  = 14
+)
+
+const (
+	lengthPrefixBytes = 4
+	//maxMessageSize bounds the messages, and so the data signed, to 16 MiB
+	maxMessageSize = 1 << 24
+	//maxCount bounds the number of keys and contexts of a list answer
+	maxCount = 1 << 16
+)
+
+var errMessage = errors.New("agent: malformed message")
+
+//writeMessage writes a framed message
+func writeMessage(w io.Writer, msg []byte) error {
+	if len(msg) > maxMessageSize {
+		return errors.New("agent: message too long")
+	}
+	b := make([]byte, lengthPrefixBytes, lengthPrefixBytes+len(msg))
+	binary.BigEndian.PutUint32(b, uint32(len(msg)))
+	_, err := w.Write(append(b, msg...))
+	return err
+}
+
+//readMessage reads a framed message, which is not empty
+func readMessage(r io.Reader) ([]byte, error) {
+	var l [lengthPrefixBytes]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(l[:])
+	if n == 0 || n > maxMessageSize {
+		return nil, errMessage
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+//encoder appends the fields of a message
+type encoder []byte
+
+func (e *encoder) uint32(v uint32) {
+	*e = append(*e, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (e *encoder) string(s []byte) {
+	e.uint32(uint32(len(s)))
+	*e = append(*e, s...)
+}
+
+//decoder reads the fields of a message, setting err at the first malformed field
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) uint32() uint32 {
+	if d.err != nil || len(d.b) < 4 {
+		d.err = errMessage
+		return 0
+	}
+	v := binary.BigEndian.Uint32(d.b)
+	d.b = d.b[4:]
+	return v
+}
+
+func (d *decoder) string() []byte {
+	n := d.uint32()
+	if d.err != nil || uint32(len(d.b)) < n {
+		d.err = errMessage
+		return nil
+	}
+	s := d.b[:n:n]
+	d.b = d.b[n:]
+	return s
+}
+
+//end sets err if bytes are left
+func (d *decoder) end() error {
+	if d.err == nil && len(d.b) != 0 {
+		d.err = errMessage
+	}
+	return d.err
+}
+
+//marshalKey encodes a key of a list answer: algorithm, public key, comment, confirmation flag, expiry in Unix
+//seconds or 0, remaining signatures or 0 and contexts
+func marshalKey(e *encoder, k *Key) {
+	e.string([]byte(k.Algorithm))
+	e.string(k.PublicKey)
+	e.string([]byte(k.Comment))
+	confirm := uint32(0)
+	if k.Confirm {
+		confirm = 1
+	}
+	e.uint32(confirm)
+	expiry := int64(0)
+	if !k.Expiry.IsZero() {
+		expiry = k.Expiry.Unix()
+	}
+	e.uint32(uint32(uint64(expiry) >> 32))
+	e.uint32(uint32(expiry))
+	e.uint32(uint32(k.Remaining))
+	e.uint32(uint32(len(k.Contexts)))
+	for _, c := range k.Contexts {
+		e.string([]byte(c))
+	}
+}
+
+func unmarshalKey(d *decoder) Key {
+	k := Key{
+		Algorithm: string(d.string()),
+		PublicKey: append([]byte{}, d.string()...),
+		Comment:   string(d.string()),
+		Confirm:   d.uint32() == 1,
+	}
+	if expiry := int64(uint64(d.uint32())<<32 | uint64(d.uint32())); expiry != 0 {
+		k.Expiry = time.Unix(expiry, 0)
+	}
+	k.Remaining = int(d.uint32())
+	n := d.uint32()
+	if n > maxCount {
+		d.err = errMessage
+	}
+	for i := uint32(0); i < n && d.err == nil; i++ {
+		k.Contexts = append(k.Contexts, string(d.string()))
+	}
+	return k
+}
+
+//failure returns a failure message with the reason
+func failure(err error) []byte {
+	e := encoder{msgFailure}
+	e.string([]byte(err.Error()))
+	return e
+}
+
+//handle returns the answer to a request
+func (a *Agent) handle(req []byte) []byte {
+	d := &decoder{b: req[1:]}
+	switch req[0] {
+	case msgListRequest:
+		if err := d.end(); err != nil {
+			return failure(err)
+		}
+		keys := a.List()
+		e := encoder{msgListAnswer}
+		e.uint32(uint32(len(keys)))
+		for i := range keys {
+			marshalKey(&e, &keys[i])
+		}
+		return e
+	case msgSignRequest:
+		pk, data, context := d.string(), d.string(), d.string()
+		if err := d.end(); err != nil {
+			return failure(err)
+		}
+		sig, err := a.Sign(pk, data, context)
+		if err != nil {
+			return failure(err)
+		}
+		e := encoder{msgSignAnswer}
+		e.string(sig)
+		return e
+	}
+	return failure(errors.New("agent: unsupported request"))
+}
+
+//ServeConn answers the requests of a connection until it is closed
+func (a *Agent) ServeConn(rw io.ReadWriter) error {
+	for {
+		req, err := readMessage(rw)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := writeMessage(rw, a.handle(req)); err != nil {
+			return err
+		}
+	}
+}
+
+//Serve accepts connections on a listener and serves each of them in a goroutine, until the listener is closed
+func (a *Agent) Serve(l net.Listener) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer c.Close()
+			a.ServeConn(c)
+		}()
+	}
+}
+
+//Listen listens on a Unix domain socket only accessible to the current user. The socket is created with a restrictive
+//umask, so it is never accessible to others, and its directory must not be writable by the group or other users, who
+//could otherwise replace it.
+func Listen(path string) (net.Listener, error) {
+	return listen(path)
+}
+
+//Client sends requests to an agent. It is safe for concurrent use.
+type Client struct {
+	mu   sync.Mutex
+	conn io.ReadWriter
+}
+
+//NewClient returns a client of the agent at the other end of a connection
+func NewClient(conn io.ReadWriter) *Client {
+	return &Client{conn: conn}
+}
+
+//Dial connects to the agent listening on a socket, the one of the SocketEnv environment variable if path is empty.
+//The connection is closed with Close.
+func Dial(path string) (*Client, error) {
+	if path == "" {
+		if path = os.Getenv(SocketEnv); path == "" {
+			return nil, errors.New("agent: " + SocketEnv + " not set")
+		}
+	}
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(c), nil
+}
+
+//Close closes the connection of the client if it is an io.Closer
+func (c *Client) Close() error {
+	if closer, ok := c.conn.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+//call sends a request and returns the answer, of the expected type or a failure
+func (c *Client) call(req []byte, answerType byte) (*decoder, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := writeMessage(c.conn, req); err != nil {
+		return nil, err
+	}
+	answer, err := readMessage(c.conn)
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{b: answer[1:]}
+	switch answer[0] {
+	case answerType:
+		return d, nil
+	case msgFailure:
+		reason := d.string()
+		if err := d.end(); err != nil {
+			return nil, err
+		}
+		for _, e := range []error{ErrUnknownKey, ErrContext, ErrRefused} {
+			if string(reason) == e.Error() {
+				return nil, e
+			}
+		}
+		return nil, errors.New(string(reason))
+	}
+	return nil, errMessage
+}
+
+//List returns the keys of the agent
+func (c *Client) List() ([]Key, error) {
+	d, err := c.call([]byte{msgListRequest}, msgListAnswer)
+	if err != nil {
+		return nil, err
+	}
+	n := d.uint32()
+	if n > maxCount {
+		return nil, errMessage
+	}
+	var keys []Key
+	for i := uint32(0); i < n && d.err == nil; i++ {
+		keys = append(keys, unmarshalKey(d))
+	}
+	return keys, d.end()
+}
+
+//Sign asks the agent for a signature of data with the key of a public key, with an ML-DSA context if not empty
+func (c *Client) Sign(pk, data, context []byte) ([]byte, error) {
+	e := encoder{msgSignRequest}
+	e.string(pk)
+	e.string(data)
+	e.string(context)
+	d, err := c.call(e, msgSignAnswer)
+	if err != nil {
+		return nil, err
+	}
+	sig := d.string()
+	return append([]byte{}, sig...), d.end()
+}
@@ -0,0 +1,251 @@
+//Package ake implements the authenticated key exchanges of the Kyber paper (https://eprint.iacr.org/2017/634).
+//Kyber.UAKE authenticates the responder only, Kyber.AKE authenticates both parties; in both cases the authentication
+//is implicit and comes from static Kyber keys, without signatures.
+//
+//The protocol takes one round trip. The initiator sends message 1, pk_e || c_B where pk_e is an ephemeral public key
+//and c_B encapsulates K_B to the static key of the responder. The responder answers with message 2, c_e || c_A where
+//c_e encapsulates K_e to pk_e and, for Kyber.AKE only, c_A encapsulates K_A to the static key of the initiator. Both
+//parties derive the session key SHAKE256(K_e || K_A || K_B), as the kex of the reference implementation does.
+//
+//No party learns whether the exchange succeeded: a peer without the expected static key derives a different session
+//key, so the application must use the session key, for instance with an AEAD, before trusting the peer.
+package ake
+
+import (
+	"errors"
+	"io"
+
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/internal/randutil"
+	"golang.org/x/crypto/sha3"
+)
+
+//SessionKeySize is the size in bytes of the session key
+const SessionKeySize = 32
+
+//Config holds the parameters shared by both parties
+type Config struct {
+	//KEM is the Kyber instance of all keys, NewKyber768() if nil
+	KEM *kyber.Kyber
+	//Rand is the source of the ephemeral key seeds and the encapsulation coins, crypto/rand if nil
+	Rand io.Reader
+}
+
+func (c *Config) kem() *kyber.Kyber {
+	if c == nil || c.KEM == nil {
+		return kyber.NewKyber768()
+	}
+	return c.KEM
+}
+
+func (c *Config) rand() io.Reader {
+	if c == nil {
+		return randutil.Reader(nil)
+	}
+	return randutil.Reader(c.Rand)
+}
+
+//encaps encapsulates to pk with coins read from the configured randomness source
+func (c *Config) encaps(pk []byte) ([]byte, []byte, error) {
+	coins := make([]byte, kyber.SEEDBYTES)
+	if _, err := io.ReadFull(c.rand(), coins); err != nil {
+		return nil, nil, err
+	}
+	ct, ss := c.kem().Encaps(pk, coins)
+	if ct == nil {
+		return nil, nil, errInvalidKey
+	}
+	return ct, ss, nil
+}
+
+//Message1Size returns the size in bytes of message 1
+func (c *Config) Message1Size() int {
+	return c.kem().SIZEPK() + c.kem().SIZEC()
+}
+
+//Message2Size returns the size in bytes of message 2, mutual is true for Kyber.AKE
+func (c *Config) Message2Size(mutual bool) int {
+	if mutual {
+		return 2 * c.kem().SIZEC()
+	}
+	return c.kem().SIZEC()
+}
+
+func kdf(keys ...[]byte) []byte {
+	h := sha3.NewShake256()
+	for _, k := range keys {
+		h.Write(k)
+	}
+	key := make([]byte, SessionKeySize)
+	h.Read(key)
+	return key
+}
+
+//ErrState is returned when a method is called out of order or after a failure
+var ErrState = errors.New("ake: unexpected call for the state of the exchange")
+
+var (
+	errInvalidKey     = errors.New("ake: invalid static key")
+	errInvalidMessage = errors.New("ake: invalid message size")
+)
+
+type state int
+
+const (
+	stateStart state = iota
+	stateWaiting
+	stateDone
+	stateFailed
+)
+
+//Initiator runs the initiator side of an exchange. It is used for a single exchange.
+type Initiator struct {
+	config      *Config
+	responderPK []byte
+	staticSK    []byte //nil for Kyber.UAKE
+	ephemeralSK []byte
+	kB          []byte
+	key         []byte
+	state       state
+}
+
+//NewInitiator returns an initiator of Kyber.UAKE with the static public key of the responder
+func NewInitiator(c *Config, responderPK []byte) (*Initiator, error) {
+	if len(responderPK) != c.kem().SIZEPK() {
+		return nil, errInvalidKey
+	}
+	return &Initiator{config: c, responderPK: responderPK}, nil
+}
+
+//NewMutualInitiator returns an initiator of Kyber.AKE with the static public key of the responder and the static
+//private key of the initiator
+func NewMutualInitiator(c *Config, responderPK, initiatorSK []byte) (*Initiator, error) {
+	i, err := NewInitiator(c, responderPK)
+	if err != nil {
+		return nil, err
+	}
+	if len(initiatorSK) != c.kem().SIZESK() {
+		return nil, errInvalidKey
+	}
+	i.staticSK = initiatorSK
+	return i, nil
+}
+
+//Start generates the ephemeral key pair and returns message 1
+func (i *Initiator) Start() ([]byte, error) {
+	if i.state != stateStart {
+		return nil, ErrState
+	}
+	i.state = stateFailed
+	seed := make([]byte, 2*kyber.SEEDBYTES)
+	if _, err := io.ReadFull(i.config.rand(), seed); err != nil {
+		return nil, err
+	}
+	pk, sk := i.config.kem().KeyGen(seed)
+	cB, kB, err := i.config.encaps(i.responderPK)
+	if err != nil {
+		return nil, err
+	}
+	i.ephemeralSK, i.kB = sk, kB
+	i.state = stateWaiting
+	return append(pk, cB...), nil
+}
+
+//Finish processes message 2 and returns the session key
+func (i *Initiator) Finish(msg []byte) ([]byte, error) {
+	if i.state != stateWaiting {
+		return nil, ErrState
+	}
+	i.state = stateFailed
+	k := i.config.kem()
+	if len(msg) != i.config.Message2Size(i.staticSK != nil) {
+		return nil, errInvalidMessage
+	}
+	kE := k.Decaps(i.ephemeralSK, msg[:k.SIZEC()])
+	if i.staticSK != nil {
+		kA := k.Decaps(i.staticSK, msg[k.SIZEC():])
+		i.key = kdf(kE, kA, i.kB)
+	} else {
+		i.key = kdf(kE, i.kB)
+	}
+	i.ephemeralSK, i.kB = nil, nil
+	i.state = stateDone
+	return i.SessionKey(), nil
+}
+
+//SessionKey returns the session key once the exchange is finished, nil before
+func (i *Initiator) SessionKey() []byte {
+	if i.state != stateDone {
+		return nil
+	}
+	return append([]byte{}, i.key...)
+}
+
+//Responder runs the responder side of an exchange. It is used for a single exchange.
+type Responder struct {
+	config      *Config
+	staticSK    []byte
+	initiatorPK []byte //nil for Kyber.UAKE
+	key         []byte
+	state       state
+}
+
+//NewResponder returns a responder of Kyber.UAKE with its static private key
+func NewResponder(c *Config, responderSK []byte) (*Responder, error) {
+	if len(responderSK) != c.kem().SIZESK() {
+		return nil, errInvalidKey
+	}
+	return &Responder{config: c, staticSK: responderSK}, nil
+}
+
+//NewMutualResponder returns a responder of Kyber.AKE with its static private key and the static public key of the
+//initiator
+func NewMutualResponder(c *Config, responderSK, initiatorPK []byte) (*Responder, error) {
+	r, err := NewResponder(c, responderSK)
+	if err != nil {
+		return nil, err
+	}
+	if len(initiatorPK) != c.kem().SIZEPK() {
+		return nil, errInvalidKey
+	}
+	r.initiatorPK = initiatorPK
+	return r, nil
+}
+
+//Respond processes message 1 and returns message 2 and the session key
+func (r *Responder) Respond(msg []byte) ([]byte, []byte, error) {
+	if r.state != stateStart {
+		return nil, nil, ErrState
+	}
+	r.state = stateFailed
+	k := r.config.kem()
+	if len(msg) != r.config.Message1Size() {
+		return nil, nil, errInvalidMessage
+	}
+	cE, kE, err := r.config.encaps(msg[:k.SIZEPK()])
+	if err != nil {
+		return nil, nil, errors.New("ake: invalid ephemeral key")
+	}
+	kB := k.Decaps(r.staticSK, msg[k.SIZEPK():])
+	out := cE
+	if r.initiatorPK != nil {
+		cA, kA, err := r.config.encaps(r.initiatorPK)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = append(out, cA...)
+		r.key = kdf(kE, kA, kB)
+	} else {
+		r.key = kdf(kE, kB)
+	}
+	r.state = stateDone
+	return out, r.SessionKey(), nil
+}
+
+//SessionKey returns the session key once the exchange is finished, nil before
+func (r *Responder) SessionKey() []byte {
+	if r.state != stateDone {
+		return nil
+	}
+	return append([]byte{}, r.key...)
+}
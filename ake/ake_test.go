@@ -0,0 +1,120 @@
+package ake
+
+import (
+	"bytes"
+	"testing"
+
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+)
+
+func run(t *testing.T, i *Initiator, r *Responder) ([]byte, []byte) {
+	m1, err := i.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, kR, err := r.Respond(m1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kI, err := i.Finish(m2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kI, kR
+}
+
+func TestExchange(t *testing.T) {
+	for _, k := range []*kyber.Kyber{kyber.NewKyber512(), kyber.NewKyber768(), kyber.NewKyber1024(), kyber.NewMLKEM768()} {
+		t.Run(k.Name, func(t *testing.T) {
+			c := &Config{KEM: k}
+			pkA, skA := k.KeyGen(nil)
+			pkB, skB := k.KeyGen(nil)
+
+			i, _ := NewInitiator(c, pkB)
+			r, _ := NewResponder(c, skB)
+			kI, kR := run(t, i, r)
+			if !bytes.Equal(kI, kR) || len(kI) != SessionKeySize {
+				t.Fatal("UAKE session keys differ")
+			}
+
+			i, _ = NewMutualInitiator(c, pkB, skA)
+			r, _ = NewMutualResponder(c, skB, pkA)
+			kI2, kR2 := run(t, i, r)
+			if !bytes.Equal(kI2, kR2) || bytes.Equal(kI, kI2) {
+				t.Fatal("AKE session keys differ")
+			}
+			if !bytes.Equal(i.SessionKey(), kI2) || !bytes.Equal(r.SessionKey(), kR2) {
+				t.Fatal("SessionKey does not return the derived key")
+			}
+		})
+	}
+}
+
+func TestWrongStaticKeys(t *testing.T) {
+	k := kyber.NewKyber768()
+	c := &Config{KEM: k}
+	pkA, skA := k.KeyGen(nil)
+	pkB, skB := k.KeyGen(nil)
+	pkM, skM := k.KeyGen(nil)
+
+	//a responder without the private key of pkB
+	i, _ := NewInitiator(c, pkB)
+	r, _ := NewResponder(c, skM)
+	if kI, kR := run(t, i, r); bytes.Equal(kI, kR) {
+		t.Fatal("impersonated responder agreed on the session key")
+	}
+
+	//a responder expecting another initiator
+	i, _ = NewMutualInitiator(c, pkB, skA)
+	r, _ = NewMutualResponder(c, skB, pkM)
+	if kI, kR := run(t, i, r); bytes.Equal(kI, kR) {
+		t.Fatal("unexpected initiator agreed on the session key")
+	}
+
+	i, _ = NewMutualInitiator(c, pkB, skA)
+	r, _ = NewMutualResponder(c, skB, pkA)
+	if kI, kR := run(t, i, r); !bytes.Equal(kI, kR) {
+		t.Fatal("expected parties disagree on the session key")
+	}
+}
+
+func TestStateMachine(t *testing.T) {
+	k := kyber.NewKyber512()
+	c := &Config{KEM: k}
+	pkB, skB := k.KeyGen(nil)
+	i, _ := NewInitiator(c, pkB)
+	r, _ := NewResponder(c, skB)
+
+	if _, err := i.Finish(make([]byte, c.Message2Size(false))); err != ErrState {
+		t.Fatal("Finish before Start accepted")
+	}
+	m1, _ := i.Start()
+	if len(m1) != c.Message1Size() {
+		t.Fatal("unexpected message 1 size")
+	}
+	if _, err := i.Start(); err != ErrState {
+		t.Fatal("second Start accepted")
+	}
+	if _, _, err := r.Respond(m1[1:]); err == nil {
+		t.Fatal("truncated message 1 accepted")
+	}
+	if _, _, err := r.Respond(m1); err != ErrState {
+		t.Fatal("responder reused after a failure")
+	}
+	if i.SessionKey() != nil {
+		t.Fatal("session key available before the end of the exchange")
+	}
+	if _, err := i.Finish(make([]byte, c.Message2Size(true))); err == nil {
+		t.Fatal("message 2 of the wrong mode accepted")
+	}
+	if _, err := i.Finish(make([]byte, c.Message2Size(false))); err != ErrState {
+		t.Fatal("initiator reused after a failure")
+	}
+
+	if _, err := NewInitiator(c, pkB[1:]); err == nil {
+		t.Fatal("invalid responder key accepted")
+	}
+	if _, err := NewMutualResponder(c, skB, pkB[1:]); err == nil {
+		t.Fatal("invalid initiator key accepted")
+	}
+}
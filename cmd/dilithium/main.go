@@ -0,0 +1,323 @@
+//Command dilithium generates ML-DSA and Dilithium keys, signs and verifies files with detached signatures and
+//inspects keys and signatures.
+//
+//Usage:
+//
+//	dilithium keygen  [-alg name] [-seed hex] [-format f] [-pub file] [-priv file]
+//	dilithium sign    [-alg name] [-deterministic] [-context s] [-prehash] [-format f] -priv file [-in file] [-sig file]
+//	dilithium verify  [-alg name] [-context s] [-prehash] [-q] -pub file -sig file [-in file]
+//	dilithium inspect [-alg name] file
+//
+//The parameter set is one of Dilithium2, Dilithium3, Dilithium5, ML-DSA-44, ML-DSA-65 (the default) and ML-DSA-87.
+//Keys and signatures are written as raw bytes, hex, base64 or PEM, and read in any of these formats. A file name of
+//"-" is the standard input or output.
+//
+//ML-DSA and Dilithium sign the message itself, not a hash of it, so the signed file is read in memory and limited to
+//256 MiB. With -prehash, ML-DSA keys sign and verify the SHA-512 hash of the file instead (HashML-DSA), which is
+//streamed whatever its size. These signatures are distinct from the signatures of the file itself: a file signed with
+//-prehash is verified with -prehash.
+//
+//Signatures are hedged by default, -deterministic selects the deterministic variant. Contexts are only supported by
+//ML-DSA. The exit status is 0 on success, 1 if a signature is invalid and 2 on any other error.
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	"github.com/kudelskisecurity/crystals-go/internal/cli"
+	"github.com/kudelskisecurity/crystals-go/internal/keyio"
+)
+
+var algorithms = map[string]func(...bool) *dilithium.Dilithium{
+	"Dilithium2": dilithium.NewDilithium2,
+	"Dilithium3": dilithium.NewDilithium3,
+	"Dilithium5": dilithium.NewDilithium5,
+	"ML-DSA-44":  dilithium.NewMLDSA44,
+	"ML-DSA-65":  dilithium.NewMLDSA65,
+	"ML-DSA-87":  dilithium.NewMLDSA87,
+}
+
+func algorithmNames() []string {
+	names := make([]string, 0, len(algorithms))
+	for n := range algorithms {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newDilithium(name string, randomized bool) (*dilithium.Dilithium, error) {
+	newSigner, ok := algorithms[name]
+	if !ok {
+		return nil, errors.New("unknown parameter set " + name + ", expected one of " + strings.Join(algorithmNames(), ", "))
+	}
+	return newSigner(randomized), nil
+}
+
+//maxInput is the maximum size of a signed file
+var maxInput int64 = 256 << 20
+
+//errInvalidSignature is returned by verify, with exit status 1
+var errInvalidSignature = errors.New("invalid signature")
+
+var program = &cli.Program{Name: "dilithium", Commands: []cli.Subcommand{
+	{Name: "keygen", Summary: "generate a key pair", Run: keygen},
+	{Name: "sign", Summary: "write a detached signature of a file", Run: sign},
+	{Name: "verify", Summary: "verify a detached signature of a file", Run: verify},
+	{Name: "inspect", Summary: "describe a key or signature file", Run: inspect},
+}}
+
+func main() {
+	program.Main(errInvalidSignature)
+}
+
+//read reads a key or signature of the parameter set and checks its length
+func read(c *cli.Command, d *dilithium.Dilithium, path, kind string, size int) ([]byte, error) {
+	pemType := d.Name + " " + kind
+	b, err := keyio.ReadDecoded(path, c.Stdin, keyio.Auto, pemType)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(b) != size {
+		return nil, fmt.Errorf("%s: invalid %s length %d, expected %d", path, pemType, len(b), size)
+	}
+	return b, nil
+}
+
+//openInput opens the signed file, or stdin if the path is "-"
+func openInput(c *cli.Command, path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return ioutil.NopCloser(c.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+//readInput reads the signed file up to maxInput bytes, or only returns its SHA-512 hash if prehash is set
+func readInput(c *cli.Command, d *dilithium.Dilithium, path string, prehash bool) ([]byte, error) {
+	if prehash && !d.IsMLDSA() {
+		return nil, errors.New("prehashed signatures are only supported by ML-DSA")
+	}
+	src, err := openInput(c, path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	if prehash {
+		h := sha512.New()
+		if _, err := io.Copy(h, src); err != nil {
+			return nil, err
+		}
+		return h.Sum(nil), nil
+	}
+	msg, err := ioutil.ReadAll(io.LimitReader(src, maxInput+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(msg)) > maxInput {
+		return nil, fmt.Errorf("%s: larger than %d bytes, sign its hash with -prehash", path, maxInput)
+	}
+	return msg, nil
+}
+
+//parseContext returns the context, which must be empty for round 3 Dilithium
+func parseContext(d *dilithium.Dilithium, ctx string) ([]byte, error) {
+	if len(ctx) > 255 {
+		return nil, errors.New("the context is longer than 255 bytes")
+	}
+	if ctx != "" && !d.IsMLDSA() {
+		return nil, errors.New("contexts are only supported by ML-DSA")
+	}
+	return []byte(ctx), nil
+}
+
+func keygen(c *cli.Command) error {
+	alg := c.String("alg", "ML-DSA-65", "parameter set")
+	seedHex := c.String("seed", "", "hex encoded 32 byte seed, for deterministic keys")
+	format := c.String("format", keyio.PEM, "output format: raw, hex, base64 or pem")
+	pubPath := c.String("pub", "-", "public key output file")
+	privPath := c.String("priv", "-", "private key output file")
+	if err := c.ParseArgs(0); err != nil {
+		return err
+	}
+	d, err := newDilithium(*alg, true)
+	if err != nil {
+		return err
+	}
+	var seed []byte
+	if *seedHex != "" {
+		if seed, err = keyio.Decode([]byte(*seedHex), keyio.Hex, ""); err != nil || len(seed) != dilithium.SEEDBYTES {
+			return errors.New("the seed must be 32 hex encoded bytes")
+		}
+	}
+	pk, sk := d.KeyGen(seed)
+	if err := keyio.WriteEncoded(*pubPath, pk, *format, d.Name+" PUBLIC KEY", false, c.Stdout); err != nil {
+		return err
+	}
+	return keyio.WriteEncoded(*privPath, sk, *format, d.Name+" PRIVATE KEY", true, c.Stdout)
+}
+
+func sign(c *cli.Command) error {
+	alg := c.String("alg", "ML-DSA-65", "parameter set")
+	deterministic := c.Bool("deterministic", false, "deterministic instead of hedged signature")
+	ctx := c.String("context", "", "ML-DSA context string")
+	prehash := c.Bool("prehash", false, "sign the SHA-512 hash of the file with HashML-DSA")
+	format := c.String("format", keyio.PEM, "output format: raw, hex, base64 or pem")
+	privPath := c.String("priv", "", "private key file")
+	in := c.String("in", "-", "file to sign")
+	sigPath := c.String("sig", "-", "signature output file")
+	if err := c.ParseArgs(0); err != nil {
+		return err
+	}
+	if err := cli.Required(map[string]*string{"priv": privPath}); err != nil {
+		return err
+	}
+	d, err := newDilithium(*alg, !*deterministic)
+	if err != nil {
+		return err
+	}
+	context, err := parseContext(d, *ctx)
+	if err != nil {
+		return err
+	}
+	sk, err := read(c, d, *privPath, "PRIVATE KEY", d.SIZESK())
+	if err != nil {
+		return err
+	}
+	msg, err := readInput(c, d, *in, *prehash)
+	if err != nil {
+		return err
+	}
+	var sig []byte
+	switch {
+	case *prehash:
+		sig = d.SignPrehashed(sk, msg, context)
+	case d.IsMLDSA():
+		sig = d.SignWithContext(sk, msg, context)
+	default:
+		sig = d.Sign(sk, msg)
+	}
+	if sig == nil {
+		return errors.New("signature failed")
+	}
+	return keyio.WriteEncoded(*sigPath, sig, *format, d.Name+" SIGNATURE", false, c.Stdout)
+}
+
+func verify(c *cli.Command) error {
+	alg := c.String("alg", "ML-DSA-65", "parameter set")
+	ctx := c.String("context", "", "ML-DSA context string")
+	prehash := c.Bool("prehash", false, "verify a HashML-DSA signature of the SHA-512 hash of the file")
+	quiet := c.Bool("q", false, "do not print OK on success")
+	pubPath := c.String("pub", "", "public key file")
+	sigPath := c.String("sig", "", "signature file")
+	in := c.String("in", "-", "signed file")
+	if err := c.ParseArgs(0); err != nil {
+		return err
+	}
+	if err := cli.Required(map[string]*string{"pub": pubPath, "sig": sigPath}); err != nil {
+		return err
+	}
+	d, err := newDilithium(*alg, true)
+	if err != nil {
+		return err
+	}
+	context, err := parseContext(d, *ctx)
+	if err != nil {
+		return err
+	}
+	pk, err := read(c, d, *pubPath, "PUBLIC KEY", d.SIZEPK())
+	if err != nil {
+		return err
+	}
+	sig, err := read(c, d, *sigPath, "SIGNATURE", d.SIZESIG())
+	if err != nil {
+		return err
+	}
+	msg, err := readInput(c, d, *in, *prehash)
+	if err != nil {
+		return err
+	}
+	var valid bool
+	switch {
+	case *prehash:
+		valid = d.VerifyPrehashed(pk, msg, sig, context)
+	case d.IsMLDSA():
+		valid = d.VerifyWithContext(pk, msg, sig, context)
+	default:
+		valid = d.Verify(pk, msg, sig)
+	}
+	if !valid {
+		return errInvalidSignature
+	}
+	if !*quiet {
+		fmt.Fprintln(c.Stdout, "OK")
+	}
+	return nil
+}
+
+//inspect describes a key or signature: its kind and parameter set, from the PEM block type or from its length, its
+//size and its SHA-256 fingerprint
+func inspect(c *cli.Command) error {
+	alg := c.String("alg", "", "parameter set, by default all are considered")
+	if err := c.ParseArgs(1); err != nil {
+		return err
+	}
+	path := c.Arg(0)
+	data, err := keyio.Read(path, c.Stdin)
+	if err != nil {
+		return err
+	}
+	names := algorithmNames()
+	if *alg != "" {
+		if _, ok := algorithms[*alg]; !ok {
+			return errors.New("unknown parameter set " + *alg)
+		}
+		names = []string{*alg}
+	}
+	kinds := []string{"PUBLIC KEY", "PRIVATE KEY", "SIGNATURE"}
+	var b []byte
+	var matches []string
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "-----BEGIN ") {
+		for _, name := range names {
+			for _, kind := range kinds {
+				if b, err = keyio.Decode(data, keyio.PEM, name+" "+kind); err == nil {
+					matches = []string{name + " " + strings.ToLower(kind)}
+					break
+				}
+			}
+			if matches != nil {
+				break
+			}
+		}
+		if matches == nil {
+			return errors.New(path + ": not an ML-DSA or Dilithium PEM block")
+		}
+	} else {
+		if b, err = keyio.Decode(data, keyio.Auto, ""); err != nil {
+			return err
+		}
+		for _, name := range names {
+			d := algorithms[name]()
+			for i, size := range []int{d.SIZEPK(), d.SIZESK(), d.SIZESIG()} {
+				if len(b) == size {
+					matches = append(matches, name+" "+strings.ToLower(kinds[i]))
+				}
+			}
+		}
+		if matches == nil {
+			return fmt.Errorf("%s: no parameter set has keys or signatures of %d bytes", path, len(b))
+		}
+	}
+	sum := sha256.Sum256(b)
+	fmt.Fprintf(c.Stdout, "type: %s\nsize: %d bytes\nsha256: %s\n", strings.Join(matches, " or "), len(b), hex.EncodeToString(sum[:]))
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//dilithiumCmd runs a command and returns its standard output
+func dilithiumCmd(stdin []byte, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	err := program.Run(args, bytes.NewReader(stdin), &stdout, &stderr)
+	return stdout.Bytes(), err
+}
+
+func mustRun(t *testing.T, stdin []byte, args ...string) []byte {
+	out, err := dilithiumCmd(stdin, args...)
+	if err != nil {
+		t.Fatal(args, err)
+	}
+	return out
+}
+
+var release = bytes.Repeat([]byte("release tarball\n"), 1000)
+
+func TestSignVerify(t *testing.T) {
+	dir := t.TempDir()
+	for _, alg := range []string{"Dilithium2", "ML-DSA-44", "ML-DSA-65", "ML-DSA-87"} {
+		for _, format := range []string{"raw", "hex", "base64", "pem"} {
+			pub, priv, sig := filepath.Join(dir, "pub"), filepath.Join(dir, "priv"), filepath.Join(dir, "sig")
+			mustRun(t, nil, "keygen", "-alg", alg, "-format", format, "-pub", pub, "-priv", priv)
+			mustRun(t, release, "sign", "-alg", alg, "-format", format, "-priv", priv, "-sig", sig)
+			if out := mustRun(t, release, "verify", "-alg", alg, "-pub", pub, "-sig", sig); string(out) != "OK\n" {
+				t.Fatal(alg, format, "unexpected output", string(out))
+			}
+			if _, err := dilithiumCmd(release[1:], "verify", "-alg", alg, "-pub", pub, "-sig", sig); err != errInvalidSignature {
+				t.Fatal(alg, format, "signature of another file accepted", err)
+			}
+		}
+	}
+}
+
+func TestDeterministicContext(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv := filepath.Join(dir, "pub"), filepath.Join(dir, "priv")
+	mustRun(t, nil, "keygen", "-pub", pub, "-priv", priv)
+	a := mustRun(t, release, "sign", "-deterministic", "-context", "release", "-priv", priv)
+	b := mustRun(t, release, "sign", "-deterministic", "-context", "release", "-priv", priv)
+	if !bytes.Equal(a, b) {
+		t.Fatal("deterministic signatures differ")
+	}
+	if c := mustRun(t, release, "sign", "-context", "release", "-priv", priv); bytes.Equal(a, c) {
+		t.Fatal("hedged signature equal to the deterministic one")
+	}
+	sig := filepath.Join(dir, "sig")
+	ioutil.WriteFile(sig, a, 0644)
+	if out := mustRun(t, release, "verify", "-q", "-context", "release", "-pub", pub, "-sig", sig); len(out) != 0 {
+		t.Fatal("output with -q")
+	}
+	if _, err := dilithiumCmd(release, "verify", "-pub", pub, "-sig", sig); err != errInvalidSignature {
+		t.Fatal("signature accepted without its context", err)
+	}
+	if _, err := dilithiumCmd(release, "sign", "-alg", "Dilithium3", "-context", "release", "-priv", priv); err == nil {
+		t.Fatal("context accepted for round 3 Dilithium")
+	}
+}
+
+func TestInspect(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv := filepath.Join(dir, "pub"), filepath.Join(dir, "priv")
+	mustRun(t, nil, "keygen", "-alg", "ML-DSA-44", "-format", "hex", "-pub", pub, "-priv", priv)
+	out := string(mustRun(t, nil, "inspect", pub))
+	if !strings.Contains(out, "type: Dilithium2 public key or ML-DSA-44 public key\nsize: 1312 bytes\nsha256: ") {
+		t.Fatal("unexpected description", out)
+	}
+	if out := string(mustRun(t, nil, "inspect", priv)); !strings.HasPrefix(out, "type: ML-DSA-44 private key\n") {
+		t.Fatal("unexpected description", out)
+	}
+	pem := mustRun(t, nil, "keygen", "-alg", "ML-DSA-87", "-priv", filepath.Join(dir, "priv87"))
+	if out := string(mustRun(t, pem, "inspect", "-")); !strings.HasPrefix(out, "type: ML-DSA-87 public key\n") {
+		t.Fatal("unexpected description", out)
+	}
+	if _, err := dilithiumCmd([]byte("00ff"), "inspect", "-"); err == nil {
+		t.Fatal("unknown data described")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"encaps"},
+		{"keygen", "-alg", "ML-DSA-99"},
+		{"keygen", "-seed", "00"},
+		{"sign"},
+		{"verify", "-pub", "missing"},
+		{"inspect"},
+	} {
+		if _, err := dilithiumCmd(nil, args...); err == nil || err == errInvalidSignature {
+			t.Fatal(args, "unexpected error", err)
+		}
+	}
+}
+
+func TestInputLimit(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv := filepath.Join(dir, "pub"), filepath.Join(dir, "priv")
+	mustRun(t, nil, "keygen", "-pub", pub, "-priv", priv)
+	defer func(n int64) { maxInput = n }(maxInput)
+	maxInput = int64(len(release))
+	sig := filepath.Join(dir, "sig")
+	mustRun(t, release, "sign", "-priv", priv, "-sig", sig)
+	mustRun(t, release, "verify", "-pub", pub, "-sig", sig)
+	in := filepath.Join(dir, "in")
+	ioutil.WriteFile(in, append(release, '\n'), 0644)
+	if _, err := dilithiumCmd(nil, "sign", "-priv", priv, "-in", in); err == nil {
+		t.Fatal("file larger than the limit signed")
+	}
+	if _, err := dilithiumCmd(append(release, '\n'), "verify", "-pub", pub, "-sig", sig); err == nil || err == errInvalidSignature {
+		t.Fatal("file larger than the limit read", err)
+	}
+}
+
+func TestPrehash(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv, sig := filepath.Join(dir, "pub"), filepath.Join(dir, "priv"), filepath.Join(dir, "sig")
+	mustRun(t, nil, "keygen", "-pub", pub, "-priv", priv)
+	defer func(n int64) { maxInput = n }(maxInput)
+	maxInput = int64(len(release)) / 2
+	mustRun(t, release, "sign", "-prehash", "-context", "release", "-priv", priv, "-sig", sig)
+	mustRun(t, release, "verify", "-prehash", "-context", "release", "-pub", pub, "-sig", sig)
+	if _, err := dilithiumCmd(release[1:], "verify", "-prehash", "-context", "release", "-pub", pub, "-sig", sig); err != errInvalidSignature {
+		t.Fatal("signature of another file accepted", err)
+	}
+	//a prehashed signature is not a signature of the file itself, nor of its hash
+	maxInput = 1 << 20
+	if _, err := dilithiumCmd(release, "verify", "-context", "release", "-pub", pub, "-sig", sig); err != errInvalidSignature {
+		t.Fatal("prehashed signature accepted as a signature of the file", err)
+	}
+	digest := sha512.Sum512(release)
+	if _, err := dilithiumCmd(digest[:], "verify", "-context", "release", "-pub", pub, "-sig", sig); err != errInvalidSignature {
+		t.Fatal("prehashed signature accepted as a signature of the hash", err)
+	}
+	mustRun(t, nil, "keygen", "-alg", "Dilithium3", "-pub", pub, "-priv", priv)
+	if _, err := dilithiumCmd(release, "sign", "-alg", "Dilithium3", "-prehash", "-priv", priv); err == nil {
+		t.Fatal("prehashed signature with round 3 Dilithium")
+	}
+}
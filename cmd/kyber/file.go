@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kudelskisecurity/crystals-go/age"
+	"github.com/kudelskisecurity/crystals-go/internal/cli"
+	"github.com/kudelskisecurity/crystals-go/internal/keyio"
+)
+
+//readLines returns the lines of a recipients or identities file, without blank lines and "#" comments
+func readLines(c *cli.Command, path string) ([]string, error) {
+	data, err := keyio.Read(path, c.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%s: no key found", path)
+	}
+	return lines, nil
+}
+
+//readRecipients reads a file of age1pq1 recipients, one per line
+func readRecipients(c *cli.Command, path string) ([]age.Recipient, error) {
+	lines, err := readLines(c, path)
+	if err != nil {
+		return nil, err
+	}
+	recipients := make([]age.Recipient, len(lines))
+	for i, line := range lines {
+		if recipients[i], err = age.ParseHybridRecipient(line); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return recipients, nil
+}
+
+//readIdentities reads a file of AGE-SECRET-KEY-PQ-1 identities, one per line
+func readIdentities(c *cli.Command, path string) ([]age.Identity, error) {
+	lines, err := readLines(c, path)
+	if err != nil {
+		return nil, err
+	}
+	identities := make([]age.Identity, len(lines))
+	for i, line := range lines {
+		if identities[i], err = age.ParseHybridIdentity(line); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return identities, nil
+}
+
+//openStreams opens the input and the output of a file command, "-" being the standard streams. An output file is
+//written to a temporary file of the same directory, which the returned finish function renames only if the command
+//succeeded, so that a failed decryption never leaves unauthenticated data behind. The input and the output must be
+//different files.
+func openStreams(c *cli.Command, in, out string) (io.Reader, io.Writer, func(error) error, error) {
+	src, dst := c.Stdin, c.Stdout
+	var inFile, tmp *os.File
+	if in != "-" {
+		f, err := os.Open(in)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		src, inFile = f, f
+	}
+	if out != "-" {
+		if inFile != nil {
+			inInfo, err := inFile.Stat()
+			if err != nil {
+				inFile.Close()
+				return nil, nil, nil, err
+			}
+			if outInfo, err := os.Stat(out); err == nil && os.SameFile(inInfo, outInfo) {
+				inFile.Close()
+				return nil, nil, nil, errors.New("the input and output files are the same")
+			}
+		}
+		//created with private permissions
+		f, err := ioutil.TempFile(filepath.Dir(out), "."+filepath.Base(out)+".tmp")
+		if err != nil {
+			if inFile != nil {
+				inFile.Close()
+			}
+			return nil, nil, nil, err
+		}
+		dst, tmp = f, f
+	}
+	finish := func(err error) error {
+		if inFile != nil {
+			inFile.Close()
+		}
+		if tmp == nil {
+			return err
+		}
+		if err == nil {
+			err = tmp.Sync()
+		}
+		if e := tmp.Close(); err == nil {
+			err = e
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), out)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+		return err
+	}
+	return src, dst, finish, nil
+}
+
+func ageKeygen(c *cli.Command) error {
+	pubPath := c.String("pub", "", "recipient output file")
+	privPath := c.String("priv", "-", "identity output file")
+	if err := c.ParseArgs(0); err != nil {
+		return err
+	}
+	identity, err := age.GenerateHybridIdentity()
+	if err != nil {
+		return err
+	}
+	recipient := identity.Recipient().String()
+	if *pubPath != "" {
+		if err := keyio.Write(*pubPath, []byte(recipient+"\n"), false, c.Stdout); err != nil {
+			return err
+		}
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# public key: %s\n%s\n", recipient, identity)
+	return keyio.Write(*privPath, b.Bytes(), true, c.Stdout)
+}
+
+func encryptFile(c *cli.Command) error {
+	pubPath := c.String("pub", "", "recipients file")
+	in := c.String("in", "-", "plaintext input file")
+	out := c.String("out", "-", "encrypted output file")
+	if err := c.ParseArgs(0); err != nil {
+		return err
+	}
+	if err := cli.Required(map[string]*string{"pub": pubPath}); err != nil {
+		return err
+	}
+	recipients, err := readRecipients(c, *pubPath)
+	if err != nil {
+		return err
+	}
+	src, dst, finish, err := openStreams(c, *in, *out)
+	if err != nil {
+		return err
+	}
+	return finish(func() error {
+		w, err := age.Encrypt(dst, recipients...)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, src); err != nil {
+			return err
+		}
+		return w.Close()
+	}())
+}
+
+func decryptFile(c *cli.Command) error {
+	privPath := c.String("priv", "", "identities file")
+	in := c.String("in", "-", "encrypted input file")
+	out := c.String("out", "-", "plaintext output file")
+	if err := c.ParseArgs(0); err != nil {
+		return err
+	}
+	if err := cli.Required(map[string]*string{"priv": privPath}); err != nil {
+		return err
+	}
+	identities, err := readIdentities(c, *privPath)
+	if err != nil {
+		return err
+	}
+	src, dst, finish, err := openStreams(c, *in, *out)
+	if err != nil {
+		return err
+	}
+	return finish(func() error {
+		r, err := age.Decrypt(src, identities...)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, r)
+		return err
+	}())
+}
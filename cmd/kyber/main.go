@@ -0,0 +1,170 @@
+//Command kyber generates Kyber and ML-KEM keys, encapsulates and decapsulates shared secrets and encrypts files.
+//
+//Usage:
+//
+//	kyber keygen       [-alg name] [-seed hex] [-format f] [-pub file] [-priv file]
+//	kyber encaps       [-alg name] [-format f] -pub file [-ct file] [-ss file]
+//	kyber decaps       [-alg name] [-format f] -priv file -ct file [-ss file]
+//	kyber age-keygen   [-pub file] [-priv file]
+//	kyber encrypt-file -pub file [-in file] [-out file]
+//	kyber decrypt-file -priv file [-in file] [-out file]
+//
+//The parameter set is one of Kyber512, Kyber768, Kyber1024, ML-KEM-512, ML-KEM-768 (the default) and ML-KEM-1024.
+//Keys, ciphertexts and shared secrets are written as raw bytes, hex, base64 or PEM, and read in any of these
+//formats. A file name of "-" is the standard input or output. Private keys are the packed private keys of the kyber
+//package.
+//
+//Files are encrypted in the age format to mlkem768x25519 recipients, with the age package, and can be decrypted by
+//the age command line tool and vice versa. age-keygen writes an identity file in the format of age-keygen, with the
+//"age1pq1..." recipient in a comment, and optionally the recipient alone. encrypt-file reads a recipients file and
+//decrypt-file an identities file, one key per line. An output file is only replaced once the whole command succeeded.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/internal/cli"
+	"github.com/kudelskisecurity/crystals-go/internal/keyio"
+)
+
+var algorithms = map[string]func() *kyber.Kyber{
+	"Kyber512":    kyber.NewKyber512,
+	"Kyber768":    kyber.NewKyber768,
+	"Kyber1024":   kyber.NewKyber1024,
+	"ML-KEM-512":  kyber.NewMLKEM512,
+	"ML-KEM-768":  kyber.NewMLKEM768,
+	"ML-KEM-1024": kyber.NewMLKEM1024,
+}
+
+func newKyber(name string) (*kyber.Kyber, error) {
+	newKEM, ok := algorithms[name]
+	if !ok {
+		names := make([]string, 0, len(algorithms))
+		for n := range algorithms {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, errors.New("unknown parameter set " + name + ", expected one of " + strings.Join(names, ", "))
+	}
+	return newKEM(), nil
+}
+
+var program = &cli.Program{Name: "kyber", Commands: []cli.Subcommand{
+	{Name: "keygen", Summary: "generate a key pair", Run: keygen},
+	{Name: "encaps", Summary: "encapsulate a shared secret to a public key", Run: encaps},
+	{Name: "decaps", Summary: "decapsulate a shared secret with a private key", Run: decaps},
+	{Name: "age-keygen", Summary: "generate an age mlkem768x25519 identity", Run: ageKeygen},
+	{Name: "encrypt-file", Summary: "encrypt a file to age recipients", Run: encryptFile},
+	{Name: "decrypt-file", Summary: "decrypt a file with age identities", Run: decryptFile},
+}}
+
+func main() {
+	program.Main(nil)
+}
+
+//parse parses the flags with the -alg flag and returns the parameter set
+func parse(c *cli.Command) (*kyber.Kyber, error) {
+	alg := c.String("alg", "ML-KEM-768", "parameter set")
+	if err := c.ParseArgs(0); err != nil {
+		return nil, err
+	}
+	return newKyber(*alg)
+}
+
+//readKey reads a public or private key and checks its length
+func readKey(c *cli.Command, k *kyber.Kyber, path string, private bool) ([]byte, error) {
+	pemType, size := k.Name+" PUBLIC KEY", k.SIZEPK()
+	if private {
+		pemType, size = k.Name+" PRIVATE KEY", k.SIZESK()
+	}
+	key, err := keyio.ReadDecoded(path, c.Stdin, keyio.Auto, pemType)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(key) != size {
+		return nil, fmt.Errorf("%s: invalid %s length %d, expected %d", path, pemType, len(key), size)
+	}
+	return key, nil
+}
+
+func keygen(c *cli.Command) error {
+	seedHex := c.String("seed", "", "hex encoded 64 byte seed, for deterministic keys")
+	format := c.String("format", keyio.PEM, "output format: raw, hex, base64 or pem")
+	pubPath := c.String("pub", "-", "public key output file")
+	privPath := c.String("priv", "-", "private key output file")
+	k, err := parse(c)
+	if err != nil {
+		return err
+	}
+	var seed []byte
+	if *seedHex != "" {
+		if seed, err = keyio.Decode([]byte(*seedHex), keyio.Hex, ""); err != nil || len(seed) != kyber.SEEDBYTES+kyber.SIZEZ {
+			return errors.New("the seed must be 64 hex encoded bytes")
+		}
+	}
+	pk, sk := k.KeyGen(seed)
+	if err := keyio.WriteEncoded(*pubPath, pk, *format, k.Name+" PUBLIC KEY", false, c.Stdout); err != nil {
+		return err
+	}
+	return keyio.WriteEncoded(*privPath, sk, *format, k.Name+" PRIVATE KEY", true, c.Stdout)
+}
+
+func encaps(c *cli.Command) error {
+	format := c.String("format", keyio.Hex, "output format: raw, hex, base64 or pem")
+	pubPath := c.String("pub", "", "public key file")
+	ctPath := c.String("ct", "-", "ciphertext output file")
+	ssPath := c.String("ss", "-", "shared secret output file")
+	k, err := parse(c)
+	if err != nil {
+		return err
+	}
+	if err := cli.Required(map[string]*string{"pub": pubPath}); err != nil {
+		return err
+	}
+	pk, err := readKey(c, k, *pubPath, false)
+	if err != nil {
+		return err
+	}
+	ct, ss := k.Encaps(pk, nil)
+	if ss == nil {
+		return errors.New("encapsulation failed")
+	}
+	if err := keyio.WriteEncoded(*ctPath, ct, *format, k.Name+" CIPHERTEXT", false, c.Stdout); err != nil {
+		return err
+	}
+	return keyio.WriteEncoded(*ssPath, ss, *format, "SHARED SECRET", true, c.Stdout)
+}
+
+func decaps(c *cli.Command) error {
+	format := c.String("format", keyio.Hex, "output format: raw, hex, base64 or pem")
+	privPath := c.String("priv", "", "private key file")
+	ctPath := c.String("ct", "", "ciphertext file")
+	ssPath := c.String("ss", "-", "shared secret output file")
+	k, err := parse(c)
+	if err != nil {
+		return err
+	}
+	if err := cli.Required(map[string]*string{"priv": privPath, "ct": ctPath}); err != nil {
+		return err
+	}
+	sk, err := readKey(c, k, *privPath, true)
+	if err != nil {
+		return err
+	}
+	ct, err := keyio.ReadDecoded(*ctPath, c.Stdin, keyio.Auto, k.Name+" CIPHERTEXT")
+	if err != nil {
+		return fmt.Errorf("%s: %v", *ctPath, err)
+	}
+	if len(ct) != k.SIZEC() {
+		return fmt.Errorf("%s: invalid ciphertext length %d, expected %d", *ctPath, len(ct), k.SIZEC())
+	}
+	ss := k.Decaps(sk, ct)
+	if ss == nil {
+		return errors.New("decapsulation failed")
+	}
+	return keyio.WriteEncoded(*ssPath, ss, *format, "SHARED SECRET", true, c.Stdout)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kudelskisecurity/crystals-go/age"
+)
+
+var document = []byte("release v1.2.0 checksums\n")
+
+//kyberCmd runs a command and returns its standard output
+func kyberCmd(stdin []byte, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	err := program.Run(args, bytes.NewReader(stdin), &stdout, &stderr)
+	return stdout.Bytes(), err
+}
+
+func mustRun(t *testing.T, stdin []byte, args ...string) []byte {
+	out, err := kyberCmd(stdin, args...)
+	if err != nil {
+		t.Fatal(args, err)
+	}
+	return out
+}
+
+func TestEncapsDecaps(t *testing.T) {
+	dir := t.TempDir()
+	for _, alg := range []string{"Kyber512", "ML-KEM-768", "ML-KEM-1024"} {
+		for _, format := range []string{"raw", "hex", "base64", "pem"} {
+			pub, priv := filepath.Join(dir, "pub"), filepath.Join(dir, "priv")
+			mustRun(t, nil, "keygen", "-alg", alg, "-format", format, "-pub", pub, "-priv", priv)
+			ct, ss := filepath.Join(dir, "ct"), filepath.Join(dir, "ss")
+			mustRun(t, nil, "encaps", "-alg", alg, "-format", format, "-pub", pub, "-ct", ct, "-ss", ss)
+			out := mustRun(t, nil, "decaps", "-alg", alg, "-format", format, "-priv", priv, "-ct", ct)
+			expected, _ := ioutil.ReadFile(ss)
+			if !bytes.Equal(out, expected) {
+				t.Fatal(alg, format, "shared secrets differ")
+			}
+		}
+	}
+}
+
+func TestKeygenSeed(t *testing.T) {
+	seed := strings.Repeat("01", 64)
+	a := mustRun(t, nil, "keygen", "-seed", seed, "-format", "hex")
+	b := mustRun(t, nil, "keygen", "-seed", seed, "-format", "hex")
+	if !bytes.Equal(a, b) || len(bytes.Split(bytes.TrimSpace(a), []byte("\n"))) != 2 {
+		t.Fatal("keys from the same seed differ")
+	}
+	if _, err := kyberCmd(nil, "keygen", "-seed", "0101"); err == nil {
+		t.Fatal("short seed accepted")
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv := filepath.Join(dir, "pub"), filepath.Join(dir, "priv")
+	mustRun(t, nil, "age-keygen", "-pub", pub, "-priv", priv)
+	plaintext := bytes.Repeat([]byte("release artifact\n"), 10000)
+	encrypted := mustRun(t, plaintext, "encrypt-file", "-pub", pub)
+	if !bytes.HasPrefix(encrypted, []byte("age-encryption.org/v1\n-> mlkem768x25519 ")) {
+		t.Fatal("unexpected header")
+	}
+	in, out := filepath.Join(dir, "in"), filepath.Join(dir, "out")
+	ioutil.WriteFile(in, encrypted, 0600)
+	mustRun(t, nil, "decrypt-file", "-priv", priv, "-in", in, "-out", out)
+	if decrypted, _ := ioutil.ReadFile(out); !bytes.Equal(decrypted, plaintext) {
+		t.Fatal("unexpected plaintext")
+	}
+	otherPub, otherPriv := filepath.Join(dir, "otherpub"), filepath.Join(dir, "otherpriv")
+	mustRun(t, nil, "age-keygen", "-pub", otherPub, "-priv", otherPriv)
+	if _, err := kyberCmd(encrypted, "decrypt-file", "-priv", otherPriv); err == nil {
+		t.Fatal("decrypted with another key")
+	}
+	//several recipients, and identities in the identity file
+	both := filepath.Join(dir, "both")
+	ioutil.WriteFile(both, append(readFile(t, pub), readFile(t, otherPub)...), 0600)
+	encrypted = mustRun(t, plaintext, "encrypt-file", "-pub", both)
+	if decrypted := mustRun(t, encrypted, "decrypt-file", "-priv", otherPriv); !bytes.Equal(decrypted, plaintext) {
+		t.Fatal("unexpected plaintext for the second recipient")
+	}
+	if _, err := kyberCmd(nil, "encrypt-file", "-pub", priv); err == nil {
+		t.Fatal("identity accepted as a recipient")
+	}
+}
+
+func readFile(t *testing.T, path string) []byte {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+//Files are interoperable with the age package, and so with the age command line tool
+func TestAgeInterop(t *testing.T) {
+	dir := t.TempDir()
+	priv := filepath.Join(dir, "priv")
+	mustRun(t, nil, "age-keygen", "-priv", priv)
+	lines := strings.Split(strings.TrimSpace(string(readFile(t, priv))), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "# public key: age1pq1") {
+		t.Fatal("unexpected identity file")
+	}
+	identity, err := age.ParseHybridIdentity(lines[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if "# public key: "+identity.Recipient().String() != lines[0] {
+		t.Fatal("unexpected recipient")
+	}
+	pub := filepath.Join(dir, "pub")
+	ioutil.WriteFile(pub, []byte(identity.Recipient().String()+"\n"), 0644)
+	r, err := age.Decrypt(bytes.NewReader(mustRun(t, document, "encrypt-file", "-pub", pub)), identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(decrypted, document) {
+		t.Fatal("unexpected plaintext", err)
+	}
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, identity.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(document)
+	w.Close()
+	if decrypted := mustRun(t, encrypted.Bytes(), "decrypt-file", "-priv", priv); !bytes.Equal(decrypted, document) {
+		t.Fatal("unexpected plaintext")
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv := filepath.Join(dir, "pub"), filepath.Join(dir, "priv")
+	mustRun(t, nil, "age-keygen", "-pub", pub, "-priv", priv)
+	in, out := filepath.Join(dir, "in"), filepath.Join(dir, "out")
+	encrypted := mustRun(t, document, "encrypt-file", "-pub", pub)
+	//a modified file is rejected without touching the output file
+	encrypted[len(encrypted)-1] ^= 1
+	ioutil.WriteFile(in, encrypted, 0600)
+	ioutil.WriteFile(out, []byte("previous content"), 0600)
+	if _, err := kyberCmd(nil, "decrypt-file", "-priv", priv, "-in", in, "-out", out); err == nil {
+		t.Fatal("modified file accepted")
+	}
+	if content := readFile(t, out); string(content) != "previous content" {
+		t.Fatal("output file modified")
+	}
+	if _, err := kyberCmd(nil, "encrypt-file", "-pub", pub, "-in", in, "-out", in); err == nil {
+		t.Fatal("input file overwritten")
+	}
+	if _, err := kyberCmd(nil, "encrypt-file", "-pub", pub, "-in", in, "-out", filepath.Join(dir, ".", "in")); err == nil {
+		t.Fatal("input file overwritten through another path")
+	}
+	if content := readFile(t, in); !bytes.Equal(content, encrypted) {
+		t.Fatal("input file modified")
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 4 {
+		t.Fatal("temporary file left behind")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"sign"},
+		{"keygen", "-alg", "Kyber999"},
+		{"keygen", "-format", "der"},
+		{"encaps"},
+		{"decaps", "-priv", "missing", "-ct", "missing"},
+		{"keygen", "extra"},
+		{"encrypt-file", "-alg", "Kyber512", "-pub", "missing"},
+	} {
+		if _, err := kyberCmd(nil, args...); err == nil {
+			t.Fatal(args, "accepted")
+		}
+	}
+}
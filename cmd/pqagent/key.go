@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kudelskisecurity/crystals-go/age"
+	"github.com/kudelskisecurity/crystals-go/agent"
+	"github.com/kudelskisecurity/crystals-go/cms"
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	"github.com/kudelskisecurity/crystals-go/jose"
+	"github.com/kudelskisecurity/crystals-go/keyfile"
+)
+
+var jwkAlgorithms = map[string]func(...bool) *dilithium.Dilithium{
+	jose.MLDSA44:    dilithium.NewMLDSA44,
+	jose.MLDSA65:    dilithium.NewMLDSA65,
+	jose.MLDSA87:    dilithium.NewMLDSA87,
+	jose.Dilithium2: dilithium.NewDilithium2,
+	jose.Dilithium3: dilithium.NewDilithium3,
+	jose.Dilithium5: dilithium.NewDilithium5,
+}
+
+//ageHeader starts the files encrypted with age
+const ageHeader = "age-encryption.org/v1\n"
+
+//parseKeySpec reads a key argument of serve, "file[,option...]", and returns the key to add to the agent
+func parseKeySpec(spec string, identity age.Identity, password []byte) (*agent.AddedKey, error) {
+	fields := strings.Split(spec, ",")
+	path := fields[0]
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	k, err := parseKey(data, identity, password)
+	if err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+	k.Comment = path
+	for _, option := range fields[1:] {
+		name, value := option, ""
+		if i := strings.IndexByte(option, '='); i >= 0 {
+			name, value = option[:i], option[i+1:]
+		}
+		switch {
+		case name == "confirm" && value == "":
+			k.Confirm = true
+		case name == "lifetime":
+			if k.Lifetime, err = time.ParseDuration(value); err != nil || k.Lifetime <= 0 {
+				return nil, errors.New(path + ": invalid lifetime " + value)
+			}
+		case name == "max":
+			if k.MaxSignatures, err = strconv.Atoi(value); err != nil || k.MaxSignatures <= 0 {
+				return nil, errors.New(path + ": invalid maximum number of signatures " + value)
+			}
+		case name == "context":
+			k.Contexts = append(k.Contexts, value)
+		case name == "comment":
+			k.Comment = value
+		default:
+			return nil, errors.New(path + ": unknown option " + option)
+		}
+	}
+	return k, nil
+}
+
+//parseKey decodes a private key: an ML-DSA PKCS #8 key in DER or PEM with the seed, or an AKP JSON Web Key,
+//possibly encrypted with age, or a key encrypted with a password by the keyfile package or as PKCS #8
+func parseKey(data []byte, identity age.Identity, password []byte) (*agent.AddedKey, error) {
+	if bytes.HasPrefix(data, []byte(ageHeader)) {
+		if identity == nil {
+			return nil, errors.New("encrypted key, -identity is required")
+		}
+		r, err := age.Decrypt(bytes.NewReader(data), identity)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = ioutil.ReadAll(r); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := keyfile.ParseHeader(data); err == nil || isPEM(data, keyfile.PKCS8PEMType) {
+		if password == nil {
+			return nil, errors.New("encrypted key, -passphrase-file is required")
+		}
+		k, err := keyfile.Decrypt(data, password)
+		if err != nil {
+			return nil, err
+		}
+		d := k.Dilithium()
+		if d == nil {
+			return nil, errors.New("not an ML-DSA or Dilithium key")
+		}
+		if k.Seed == nil {
+			return nil, errors.New("encrypted key without its seed, the public key is unknown")
+		}
+		return &agent.AddedKey{Dilithium: d, Seed: k.Seed}, nil
+	}
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("{")) {
+		var jwk jose.JWK
+		if err := json.Unmarshal(trimmed, &jwk); err != nil {
+			return nil, err
+		}
+		newDilithium, ok := jwkAlgorithms[jwk.Algorithm]
+		if !ok || !jwk.IsPrivate() {
+			return nil, errors.New("not an ML-DSA or Dilithium private JSON Web Key")
+		}
+		return &agent.AddedKey{Dilithium: newDilithium(), Seed: jwk.Seed, PublicKey: jwk.PublicKey}, nil
+	}
+	if b, _ := pem.Decode(data); b != nil {
+		if b.Type != "PRIVATE KEY" {
+			return nil, errors.New("unexpected PEM block " + b.Type + ", expected PRIVATE KEY")
+		}
+		data = b.Bytes
+	}
+	d, seed, _, err := cms.ParseDilithiumPrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	if seed == nil {
+		return nil, errors.New("PKCS #8 key without its seed, the public key is unknown")
+	}
+	return &agent.AddedKey{Dilithium: d, Seed: seed}, nil
+}
+
+//isPEM reports whether data is a PEM block of the given type
+func isPEM(data []byte, pemType string) bool {
+	b, _ := pem.Decode(data)
+	return b != nil && b.Type == pemType
+}
@@ -0,0 +1,259 @@
+//Command pqagent is a signing agent for ML-DSA and Dilithium keys, in the spirit of ssh-agent: serve loads private
+//keys and answers on a Unix domain socket the requests of list, sign and of the programs using the agent package,
+//which never read the keys.
+//
+//Usage:
+//
+//	pqagent serve [-a socket] [-identity file] [-passphrase-file file] [-confirm-cmd command] key[,option...]...
+//	pqagent list  [-a socket]
+//	pqagent sign  [-a socket] [-key id] [-context ctx] [-format f] [-in file] [-sig file]
+//
+//Keys are ML-DSA PKCS #8 private keys with their seed, in DER or PEM, or AKP JSON Web Keys, as written by pqkey
+//convert. Key files encrypted with age to a hybrid identity are decrypted with the identity file given by -identity,
+//and keys encrypted with a passphrase, by the keyfile package or as PKCS #8 EncryptedPrivateKeyInfo, with the
+//passphrase on the first line of the file given by -passphrase-file. The options of a key constrain its use:
+//
+//	confirm         run the -confirm-cmd command before each signature, which must exit with status 0
+//	lifetime=1h     remove the key after this duration
+//	max=n           remove the key after n signatures
+//	context=ctx     only sign with this ML-DSA context, may be repeated
+//	comment=text    comment listed with the key, the file name by default
+//
+//serve listens on a socket created in a new private directory unless -a is given, in which case the directory of
+//the socket must not be writable by the group or other users. It prints the path of the socket in the
+//PQ_AGENT_SOCK environment variable for the shell, and stops on SIGINT or SIGTERM. list and sign connect to the
+//socket of -a or PQ_AGENT_SOCK. sign signs the data read from -in (the standard input by default) with the key whose
+//fingerprint or comment is given by -key, which may be omitted if the agent has a single key, and writes the
+//signature in the format of the dilithium command.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kudelskisecurity/crystals-go/age"
+	"github.com/kudelskisecurity/crystals-go/agent"
+	"github.com/kudelskisecurity/crystals-go/internal/cli"
+	"github.com/kudelskisecurity/crystals-go/internal/keyio"
+)
+
+var program = &cli.Program{Name: "pqagent", Commands: []cli.Subcommand{
+	{Name: "serve", Summary: "load keys and answer requests on a socket", Run: agentCommand(serve)},
+	{Name: "list", Summary: "list the keys of the agent", Run: agentCommand(list)},
+	{Name: "sign", Summary: "sign data with a key of the agent", Run: agentCommand(sign)},
+}}
+
+func main() {
+	program.Main(nil)
+}
+
+//command holds the socket flag common to the commands
+type command struct {
+	*cli.Command
+	socket *string
+}
+
+//agentCommand defines the socket flag before running f
+func agentCommand(f func(*command) error) func(*cli.Command) error {
+	return func(cc *cli.Command) error {
+		c := &command{Command: cc}
+		c.socket = c.String("a", "", "socket of the agent, by default $"+agent.SocketEnv+" or a new socket for serve")
+		return f(c)
+	}
+}
+
+//confirmCommand returns the confirmation function of the agent, which runs a command with the description of the
+//signature as last argument
+func confirmCommand(command string) func(agent.Key, []byte, []byte) bool {
+	if command == "" {
+		return nil
+	}
+	args := strings.Fields(command)
+	return func(k agent.Key, data, context []byte) bool {
+		msg := fmt.Sprintf("Sign %d bytes with %s (%s)", len(data), k.Comment, k.Fingerprint())
+		if len(context) != 0 {
+			msg += fmt.Sprintf(" in context %q", context)
+		}
+		return exec.Command(args[0], append(args[1:], msg+"?")...).Run() == nil
+	}
+}
+
+//newAgent returns an agent holding the keys of the arguments of serve
+func newAgent(specs []string, identityPath, passphrasePath, confirm string) (*agent.Agent, error) {
+	var identity age.Identity
+	if identityPath != "" {
+		data, err := ioutil.ReadFile(identityPath)
+		if err != nil {
+			return nil, err
+		}
+		if identity, err = age.ParseHybridIdentity(strings.TrimSpace(string(data))); err != nil {
+			return nil, err
+		}
+	}
+	var password []byte
+	if passphrasePath != "" {
+		var err error
+		if password, err = keyio.ReadPassphrase(passphrasePath); err != nil {
+			return nil, err
+		}
+	}
+	a := agent.NewAgent()
+	a.Confirm = confirmCommand(confirm)
+	for _, spec := range specs {
+		k, err := parseKeySpec(spec, identity, password)
+		if err != nil {
+			return nil, err
+		}
+		if k.Confirm && a.Confirm == nil {
+			return nil, errors.New(spec + ": confirm requires -confirm-cmd")
+		}
+		if err := a.Add(*k); err != nil {
+			return nil, errors.New(spec + ": " + err.Error())
+		}
+	}
+	return a, nil
+}
+
+func serve(c *command) error {
+	identity := c.String("identity", "", "age hybrid identity file decrypting the keys encrypted with age")
+	passphrase := c.String("passphrase-file", "", "file holding the passphrase of the keys encrypted with a passphrase")
+	confirm := c.String("confirm-cmd", "", "command confirming the signatures of keys with the confirm option")
+	if err := c.ParseArgs(-1); err != nil {
+		return err
+	}
+	if c.NArg() == 0 {
+		return errors.New("no key given")
+	}
+	a, err := newAgent(c.Args(), *identity, *passphrase, *confirm)
+	if err != nil {
+		return err
+	}
+	socket := *c.socket
+	if socket == "" {
+		dir, err := ioutil.TempDir("", "pqagent-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(dir)
+		socket = filepath.Join(dir, "agent.sock")
+	}
+	l, err := agent.Listen(socket)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	fmt.Fprintf(c.Stdout, "%s=%s; export %s;\n", agent.SocketEnv, socket, agent.SocketEnv)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	errs := make(chan error, 1)
+	go func() { errs <- a.Serve(l) }()
+	select {
+	case <-signals:
+		a.RemoveAll()
+		return nil
+	case err := <-errs:
+		return err
+	}
+}
+
+func (c *command) dial() (*agent.Client, error) {
+	return agent.Dial(*c.socket)
+}
+
+func list(c *command) error {
+	if err := c.ParseArgs(0); err != nil {
+		return err
+	}
+	client, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	keys, err := client.List()
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		var constraints []string
+		if k.Confirm {
+			constraints = append(constraints, "confirm")
+		}
+		if !k.Expiry.IsZero() {
+			constraints = append(constraints, "expires "+k.Expiry.Format(time.RFC3339))
+		}
+		if k.Remaining != 0 {
+			constraints = append(constraints, fmt.Sprintf("signatures left: %d", k.Remaining))
+		}
+		for _, ctx := range k.Contexts {
+			constraints = append(constraints, fmt.Sprintf("context %q", ctx))
+		}
+		line := fmt.Sprintf("%s %s %s", k.Algorithm, k.Fingerprint(), k.Comment)
+		if constraints != nil {
+			line += " (" + strings.Join(constraints, ", ") + ")"
+		}
+		fmt.Fprintln(c.Stdout, line)
+	}
+	return nil
+}
+
+//findKey returns the key with the given fingerprint or comment, or the only key if id is empty
+func findKey(keys []agent.Key, id string) (*agent.Key, error) {
+	var found []agent.Key
+	for _, k := range keys {
+		if id == "" || k.Fingerprint() == id || k.Comment == id {
+			found = append(found, k)
+		}
+	}
+	switch {
+	case len(found) == 1:
+		return &found[0], nil
+	case len(found) == 0:
+		return nil, errors.New("no key " + id + " in the agent")
+	case id == "":
+		return nil, errors.New("several keys in the agent, -key selects one")
+	}
+	return nil, errors.New("several keys " + id + " in the agent")
+}
+
+func sign(c *command) error {
+	id := c.String("key", "", "fingerprint or comment of the key")
+	context := c.String("context", "", "ML-DSA context")
+	format := c.String("format", keyio.PEM, "output format: raw, hex, base64 or pem")
+	in := c.String("in", "-", "data to sign")
+	sigPath := c.String("sig", "-", "signature output file")
+	if err := c.ParseArgs(0); err != nil {
+		return err
+	}
+	data, err := keyio.Read(*in, c.Stdin)
+	if err != nil {
+		return err
+	}
+	client, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	keys, err := client.List()
+	if err != nil {
+		return err
+	}
+	k, err := findKey(keys, *id)
+	if err != nil {
+		return err
+	}
+	sig, err := client.Sign(k.PublicKey, data, []byte(*context))
+	if err != nil {
+		return err
+	}
+	return keyio.WriteEncoded(*sigPath, sig, *format, k.Algorithm+" SIGNATURE", false, c.Stdout)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kudelskisecurity/crystals-go/age"
+	"github.com/kudelskisecurity/crystals-go/agent"
+	"github.com/kudelskisecurity/crystals-go/cms"
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	"github.com/kudelskisecurity/crystals-go/internal/keyio"
+	"github.com/kudelskisecurity/crystals-go/jose"
+	"github.com/kudelskisecurity/crystals-go/keyfile"
+)
+
+//pqagentCmd runs a command and returns its standard output
+func pqagentCmd(stdin []byte, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	err := program.Run(args, bytes.NewReader(stdin), &stdout, &stderr)
+	return stdout.Bytes(), err
+}
+
+func mustRun(t *testing.T, stdin []byte, args ...string) []byte {
+	out, err := pqagentCmd(stdin, args...)
+	if err != nil {
+		t.Fatal(args, err)
+	}
+	return out
+}
+
+var seed = bytes.Repeat([]byte{5}, dilithium.SEEDBYTES)
+
+//writeKeys writes an ML-DSA-65 PKCS #8 key, a Dilithium2 JWK and the PKCS #8 key encrypted with age, and returns
+//their paths and the identity file
+func writeKeys(t *testing.T, dir string) (pkcs8, jwk, encrypted, identity string) {
+	d := dilithium.NewMLDSA65()
+	der, _ := cms.MarshalDilithiumPrivateKey(d, seed, nil)
+	pkcs8 = filepath.Join(dir, "release.pem")
+	ioutil.WriteFile(pkcs8, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+
+	k, _ := jose.GenerateKey(jose.Dilithium2, nil)
+	b, _ := json.Marshal(k)
+	jwk = filepath.Join(dir, "dev.jwk")
+	ioutil.WriteFile(jwk, b, 0600)
+
+	id, _ := age.GenerateHybridIdentity()
+	identity = filepath.Join(dir, "identity")
+	ioutil.WriteFile(identity, []byte(id.String()+"\n"), 0600)
+	var buf bytes.Buffer
+	w, _ := age.Encrypt(&buf, id.Recipient())
+	w.Write(der)
+	w.Close()
+	encrypted = filepath.Join(dir, "release.pem.age")
+	ioutil.WriteFile(encrypted, buf.Bytes(), 0600)
+	return
+}
+
+func TestKeys(t *testing.T) {
+	dir := t.TempDir()
+	pkcs8, jwk, encrypted, identity := writeKeys(t, dir)
+	a, err := newAgent([]string{pkcs8 + ",max=2,context=git,context=release", jwk + ",lifetime=1h,comment=dev"}, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := a.List()
+	if len(keys) != 2 || keys[0].Algorithm != "ML-DSA-65" || keys[0].Comment != pkcs8 || keys[0].Remaining != 2 ||
+		len(keys[0].Contexts) != 2 || keys[1].Algorithm != "Dilithium2" || keys[1].Comment != "dev" || keys[1].Expiry.IsZero() {
+		t.Fatal("unexpected keys", keys)
+	}
+	if _, err := newAgent([]string{encrypted}, "", "", ""); err == nil {
+		t.Fatal("encrypted key loaded without identity")
+	}
+	a, err = newAgent([]string{encrypted}, identity, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pk, _ := dilithium.NewMLDSA65().KeyGen(seed); !bytes.Equal(a.List()[0].PublicKey, pk) {
+		t.Fatal("unexpected decrypted key")
+	}
+	passphrase := filepath.Join(dir, "passphrase")
+	ioutil.WriteFile(passphrase, []byte("correct horse\n"), 0600)
+	locked := filepath.Join(dir, "release.key")
+	b, _ := keyfile.Encrypt(&keyfile.Key{Scheme: "ML-DSA-65", Seed: seed}, []byte("correct horse"), &keyfile.Params{Time: 1, Memory: 64, Threads: 1}, nil)
+	ioutil.WriteFile(locked, b, 0600)
+	if _, err := newAgent([]string{locked}, "", "", ""); err == nil {
+		t.Fatal("encrypted key loaded without passphrase")
+	}
+	a, err = newAgent([]string{locked}, "", passphrase, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pk, _ := dilithium.NewMLDSA65().KeyGen(seed); !bytes.Equal(a.List()[0].PublicKey, pk) {
+		t.Fatal("unexpected key decrypted with the passphrase")
+	}
+	for _, spec := range []string{pkcs8 + ",confirm", pkcs8 + ",max=0", pkcs8 + ",lifetime=soon", pkcs8 + ",unknown", identity, jwk + ",context=git"} {
+		if _, err := newAgent([]string{spec}, "", "", ""); err == nil {
+			t.Fatal(spec, "accepted")
+		}
+	}
+	a, err = newAgent([]string{pkcs8 + ",confirm"}, "", "", "false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Sign(a.List()[0].PublicKey, []byte("data"), nil); err != agent.ErrRefused {
+		t.Fatal("signature not refused by the confirmation command", err)
+	}
+}
+
+func TestListSign(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, jwk, _, _ := writeKeys(t, dir)
+	a, err := newAgent([]string{pkcs8 + ",context=git", jwk + ",comment=dev"}, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "agent.sock")
+	l, err := agent.Listen(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go a.Serve(l)
+
+	out := string(mustRun(t, nil, "list", "-a", socket))
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "ML-DSA-65 SHA256:") || !strings.HasSuffix(lines[0], pkcs8+` (context "git")`) ||
+		!strings.HasSuffix(lines[1], " dev") {
+		t.Fatal("unexpected list", out)
+	}
+
+	pemSig := mustRun(t, []byte("commit"), "sign", "-a", socket, "-key", "dev")
+	sig, err := keyio.Decode(pemSig, keyio.PEM, "Dilithium2 SIGNATURE")
+	if err != nil || !dilithium.NewDilithium2().Verify(a.List()[1].PublicKey, []byte("commit"), sig) {
+		t.Fatal("invalid signature", err)
+	}
+	fingerprint := strings.Fields(lines[0])[1]
+	sig = mustRun(t, []byte("commit"), "sign", "-a", socket, "-key", fingerprint, "-context", "git", "-format", "raw")
+	if !dilithium.NewMLDSA65().VerifyWithContext(a.List()[0].PublicKey, []byte("commit"), sig, []byte("git")) {
+		t.Fatal("invalid signature with context")
+	}
+	for _, args := range [][]string{
+		{"-key", fingerprint},
+		{},
+		{"-key", "unknown"},
+	} {
+		if _, err := pqagentCmd([]byte("commit"), append([]string{"sign", "-a", socket}, args...)...); err == nil {
+			t.Fatal(args, "accepted")
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/kudelskisecurity/crystals-go/cms"
+	"github.com/kudelskisecurity/crystals-go/internal/keyio"
+	"github.com/kudelskisecurity/crystals-go/jose"
+	"github.com/kudelskisecurity/crystals-go/keyfile"
+)
+
+//encode encodes the parts of a completed key selected by form in a format
+func (k *key) encode(format, form string) ([]byte, error) {
+	var seed, expanded []byte
+	switch form {
+	case formPublic:
+		if k.public == nil {
+			return nil, errors.New("the public key of an expanded " + k.scheme.name + " private key is unknown, -pub gives it")
+		}
+	case formSeed, formBoth:
+		if k.seed == nil {
+			return nil, errors.New("the seed cannot be recovered from an expanded private key")
+		}
+		seed = k.seed
+		if form == formBoth {
+			expanded = k.expanded
+		}
+	case formExpanded:
+		if !k.private() {
+			return nil, errors.New("not a private key")
+		}
+		expanded = k.expanded
+	default:
+		return nil, errors.New("unknown form " + form + ", expected public, seed, expanded or both")
+	}
+	switch format {
+	case keyio.Raw, keyio.Hex, keyio.Base64, keyio.PEM:
+		switch form {
+		case formPublic:
+			return keyio.Encode(k.public, format, k.scheme.name+" PUBLIC KEY")
+		case formSeed:
+			return keyio.Encode(seed, format, k.scheme.name+" SEED")
+		case formExpanded:
+			return keyio.Encode(expanded, format, k.scheme.name+" PRIVATE KEY")
+		}
+		return nil, errors.New("the seed and the expanded key together need the der or der-pem format")
+	case formatDER, formatDERPEM:
+		der, pemType, err := k.marshalDER(form, seed, expanded)
+		if err != nil || format == formatDER {
+			return der, err
+		}
+		return keyio.Encode(der, keyio.PEM, pemType)
+	case formatJWK:
+		if k.scheme.jwk == "" {
+			return nil, errors.New(k.scheme.name + " keys have no JWK form")
+		}
+		if expanded != nil {
+			return nil, errors.New("JWK private keys hold the seed only")
+		}
+		b, err := json.Marshal(&jose.JWK{Algorithm: k.scheme.jwk, PublicKey: k.public, Seed: seed})
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	}
+	return nil, errors.New("unknown format " + format + ", expected raw, hex, base64, pem, der, der-pem or jwk")
+}
+
+//marshalDER returns the SubjectPublicKeyInfo or the PKCS #8 PrivateKeyInfo of the key and its PEM block type
+func (k *key) marshalDER(form string, seed, expanded []byte) ([]byte, string, error) {
+	var der []byte
+	var err error
+	switch {
+	case form == formPublic && k.scheme.sig != nil:
+		der, err = cms.MarshalDilithiumPublicKey(k.scheme.sig(), k.public)
+	case form == formPublic:
+		der, err = cms.MarshalKEMPublicKey(k.scheme.kem(), k.public)
+	case k.scheme.sig != nil:
+		der, err = cms.MarshalDilithiumPrivateKey(k.scheme.sig(), seed, expanded)
+	default:
+		der, err = cms.MarshalKEMPrivateKey(k.scheme.kem(), seed, expanded)
+	}
+	if form == formPublic {
+		return der, "PUBLIC KEY", err
+	}
+	return der, "PRIVATE KEY", err
+}
+
+//encrypt encrypts the seed or the expanded private key with a passphrase, in the encrypted or der-encrypted format
+func (k *key) encrypt(format, form, kdf string, password []byte) ([]byte, error) {
+	fk := &keyfile.Key{Scheme: k.scheme.name}
+	switch {
+	case form == formSeed && k.seed != nil:
+		fk.Seed = k.seed
+	case form == formSeed:
+		return nil, errors.New("the seed cannot be recovered from an expanded private key")
+	case form == formExpanded && k.private():
+		fk.PrivateKey = k.expanded
+	default:
+		return nil, errors.New("the encrypted formats hold the seed or the expanded private key")
+	}
+	if format == formatDEREncrypted {
+		return keyfile.EncryptPKCS8(fk, password, 0, nil)
+	}
+	params := &keyfile.Params{KDF: keyfile.Argon2id}
+	switch kdf {
+	case "argon2id":
+	case "scrypt":
+		params.KDF = keyfile.Scrypt
+	default:
+		return nil, errors.New("unknown key derivation function " + kdf + ", expected argon2id or scrypt")
+	}
+	return keyfile.Encrypt(fk, password, params, nil)
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kudelskisecurity/crystals-go/cms"
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/internal/keyio"
+	"github.com/kudelskisecurity/crystals-go/jose"
+	"github.com/kudelskisecurity/crystals-go/keyfile"
+	"golang.org/x/crypto/sha3"
+)
+
+//scheme is a parameter set of the dilithium or of the kyber package
+type scheme struct {
+	name string
+	jwk  string //JOSE algorithm, empty if keys have no JWK form
+	eta  int32  //bound of the coefficients of s1 and s2, for signature schemes
+	sig  func(...bool) *dilithium.Dilithium
+	kem  func() *kyber.Kyber
+}
+
+var schemes = []*scheme{
+	{name: "ML-DSA-44", jwk: jose.MLDSA44, eta: 2, sig: dilithium.NewMLDSA44},
+	{name: "ML-DSA-65", jwk: jose.MLDSA65, eta: 4, sig: dilithium.NewMLDSA65},
+	{name: "ML-DSA-87", jwk: jose.MLDSA87, eta: 2, sig: dilithium.NewMLDSA87},
+	{name: "Dilithium2", jwk: jose.Dilithium2, eta: 2, sig: dilithium.NewDilithium2},
+	{name: "Dilithium3", jwk: jose.Dilithium3, eta: 4, sig: dilithium.NewDilithium3},
+	{name: "Dilithium5", jwk: jose.Dilithium5, eta: 2, sig: dilithium.NewDilithium5},
+	{name: "ML-KEM-512", jwk: jose.MLKEM512, kem: kyber.NewMLKEM512},
+	{name: "ML-KEM-768", jwk: jose.MLKEM768, kem: kyber.NewMLKEM768},
+	{name: "ML-KEM-1024", jwk: jose.MLKEM1024, kem: kyber.NewMLKEM1024},
+	{name: "Kyber512", kem: kyber.NewKyber512},
+	{name: "Kyber768", kem: kyber.NewKyber768},
+	{name: "Kyber1024", kem: kyber.NewKyber1024},
+}
+
+func schemeByName(name string) *scheme {
+	for _, s := range schemes {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func schemeByJWK(alg string) *scheme {
+	for _, s := range schemes {
+		if s.jwk != "" && s.jwk == alg {
+			return s
+		}
+	}
+	return nil
+}
+
+//sizes returns the sizes of the public key, of the expanded private key and of the seed
+func (s *scheme) sizes() (int, int, int) {
+	if s.sig != nil {
+		d := s.sig()
+		return d.SIZEPK(), d.SIZESK(), dilithium.SEEDBYTES
+	}
+	k := s.kem()
+	return k.SIZEPK(), k.SIZESK(), kyber.SEEDBYTES + kyber.SIZEZ
+}
+
+func (s *scheme) keyGen(seed []byte) ([]byte, []byte) {
+	if s.sig != nil {
+		return s.sig().KeyGen(seed)
+	}
+	return s.kem().KeyGen(seed)
+}
+
+//key is a decoded key. public is nil for an expanded ML-DSA or Dilithium private key, from which the public key
+//cannot be recovered without the seed.
+type key struct {
+	scheme   *scheme
+	encoding string
+	public   []byte
+	seed     []byte
+	expanded []byte
+	pairErr  error //mismatch with the public key given separately
+}
+
+func (k *key) private() bool {
+	return k.seed != nil || k.expanded != nil
+}
+
+func (k *key) kind() string {
+	switch {
+	case k.seed != nil && k.expanded != nil:
+		return "private key (seed and expanded key)"
+	case k.seed != nil:
+		return "private key (seed)"
+	case k.expanded != nil:
+		return "private key (expanded key)"
+	}
+	return "public key"
+}
+
+//complete fills the parts of the key that can be derived from the others and checks that they agree
+func (k *key) complete() error {
+	if k.seed != nil {
+		pk, sk := k.scheme.keyGen(k.seed)
+		if k.expanded != nil && subtle.ConstantTimeCompare(sk, k.expanded) != 1 {
+			return errors.New("the expanded key was not generated from the seed")
+		}
+		if k.public != nil && !bytes.Equal(pk, k.public) {
+			return errors.New("the public key was not generated from the seed")
+		}
+		k.public, k.expanded = pk, sk
+	}
+	if k.scheme.kem != nil && k.expanded != nil {
+		kem := k.scheme.kem()
+		pk := kem.UnpackSK(k.expanded).Pk
+		if k.public != nil && !bytes.Equal(pk, k.public) {
+			return errors.New("the public key does not match the private key")
+		}
+		k.public = append([]byte{}, pk...)
+	}
+	return nil
+}
+
+//withPublic sets the public key of a private key given separately, after checking that they match
+func (k *key) withPublic(pub *key) error {
+	if k.public != nil && !bytes.Equal(k.public, pub.public) {
+		return errors.New("the public key does not match the private key")
+	}
+	if k.scheme.sig != nil && k.public == nil {
+		d := k.scheme.sig()
+		sk, tr := d.UnpackSK(k.expanded), hashPublicKey(d, pub.public)
+		if !bytes.Equal(sk.Rho[:], pub.public[:dilithium.SEEDBYTES]) || !bytes.Equal(sk.Tr[:len(tr)], tr) {
+			return errors.New("the public key does not match the private key")
+		}
+	}
+	k.public = pub.public
+	return nil
+}
+
+//hashPublicKey returns tr, the hash of the public key that the private key holds
+func hashPublicKey(d *dilithium.Dilithium, pk []byte) []byte {
+	tr := make([]byte, dilithium.SEEDBYTES)
+	if d.IsMLDSA() {
+		tr = make([]byte, 2*dilithium.SEEDBYTES)
+	}
+	sha3.ShakeSum256(tr, pk)
+	return tr
+}
+
+//candidates returns the keys of the schemes considered whose public key, expanded private key or seed has the size
+//of b
+func candidates(b []byte, encoding string, considered []*scheme) []*key {
+	var keys []*key
+	for _, s := range considered {
+		pkSize, skSize, seedSize := s.sizes()
+		k := &key{scheme: s, encoding: encoding}
+		switch len(b) {
+		case pkSize:
+			k.public = b
+		case skSize:
+			k.expanded = b
+		case seedSize:
+			k.seed = b
+		default:
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+//parseDER decodes a SubjectPublicKeyInfo or a PKCS #8 PrivateKeyInfo
+func parseDER(der []byte, encoding string) (*key, error) {
+	if d, pk, err := cms.ParseDilithiumPublicKey(der); err == nil {
+		return &key{scheme: schemeByName(d.Name), encoding: encoding, public: pk}, nil
+	}
+	if k, pk, err := cms.ParseKEMPublicKey(der); err == nil {
+		return &key{scheme: schemeByName(k.Name), encoding: encoding, public: pk}, nil
+	}
+	if d, seed, sk, err := cms.ParseDilithiumPrivateKey(der); err == nil {
+		return &key{scheme: schemeByName(d.Name), encoding: encoding, seed: seed, expanded: sk}, nil
+	}
+	k, seed, sk, err := cms.ParseKEMPrivateKey(der)
+	if err != nil {
+		return nil, errors.New("not an ML-DSA, Dilithium or ML-KEM SubjectPublicKeyInfo or PrivateKeyInfo")
+	}
+	return &key{scheme: schemeByName(k.Name), encoding: encoding, seed: seed, expanded: sk}, nil
+}
+
+//encrypted reports whether data is a key encrypted with a passphrase: an encrypted key file of the keyfile package
+//or a PKCS #8 EncryptedPrivateKeyInfo in PEM
+func encrypted(data []byte) bool {
+	if _, err := keyfile.ParseHeader(data); err == nil {
+		return true
+	}
+	block, _ := pem.Decode(bytes.TrimSpace(data))
+	return block != nil && block.Type == keyfile.PKCS8PEMType
+}
+
+//decryptKey decrypts a key encrypted with a passphrase, which must be of the scheme alg if not empty
+func decryptKey(data, password []byte, alg string) ([]*key, error) {
+	encoding := formatDEREncrypted
+	if h, err := keyfile.ParseHeader(data); err == nil {
+		p := h.Params
+		cost := fmt.Sprintf("N=2^%d r=%d p=%d", p.LogN, p.R, p.P)
+		if p.KDF == keyfile.Argon2id {
+			cost = fmt.Sprintf("t=%d m=%d KiB p=%d", p.Time, p.Memory, p.Threads)
+		}
+		encoding = fmt.Sprintf("%s (%s %s, %s)", formatEncrypted, p.KDF, cost, p.Cipher)
+	}
+	fk, err := keyfile.Decrypt(data, password)
+	if err != nil {
+		return nil, err
+	}
+	s := schemeByName(fk.Scheme)
+	if s == nil {
+		return nil, errors.New("unknown scheme " + fk.Scheme)
+	}
+	if alg != "" && alg != s.name {
+		return nil, errors.New("not a key of " + alg)
+	}
+	return []*key{{scheme: s, encoding: encoding, seed: fk.Seed, expanded: fk.PrivateKey}}, nil
+}
+
+//parseKey detects the encoding of data and returns the keys it may hold, restricted to the scheme alg if not empty.
+//JWK, PEM and DER keys name their scheme, raw keys are recognized by their size.
+func parseKey(data []byte, alg string) ([]*key, error) {
+	considered := schemes
+	if alg != "" {
+		s := schemeByName(alg)
+		if s == nil {
+			return nil, errors.New("unknown scheme " + alg)
+		}
+		considered = []*scheme{s}
+	}
+	keys, err := detect(data, considered)
+	if err != nil {
+		return nil, err
+	}
+	var matching []*key
+	for _, k := range keys {
+		if alg == "" || k.scheme.name == alg {
+			matching = append(matching, k)
+		}
+	}
+	if len(matching) == 0 {
+		return nil, errors.New("not a key of " + schemeNames(considered))
+	}
+	return matching, nil
+}
+
+func detect(data []byte, considered []*scheme) ([]*key, error) {
+	text := bytes.TrimSpace(data)
+	if bytes.HasPrefix(text, []byte("{")) {
+		var jwk jose.JWK
+		if err := json.Unmarshal(text, &jwk); err != nil {
+			return nil, err
+		}
+		s := schemeByJWK(jwk.Algorithm)
+		if s == nil {
+			return nil, errors.New("unsupported JWK algorithm " + jwk.Algorithm)
+		}
+		return []*key{{scheme: s, encoding: formatJWK, public: jwk.PublicKey, seed: jwk.Seed}}, nil
+	}
+	if bytes.HasPrefix(text, []byte("-----BEGIN ")) {
+		block, _ := pem.Decode(text)
+		if block == nil {
+			return nil, errors.New("malformed PEM block")
+		}
+		switch block.Type {
+		case "PUBLIC KEY", "PRIVATE KEY":
+			k, err := parseDER(block.Bytes, formatDERPEM)
+			if err != nil {
+				return nil, err
+			}
+			return []*key{k}, nil
+		}
+		for _, s := range schemes {
+			for _, suffix := range []string{" PUBLIC KEY", " PRIVATE KEY", " SEED"} {
+				if block.Type == s.name+suffix {
+					return candidates(block.Bytes, keyio.PEM, []*scheme{s}), nil
+				}
+			}
+		}
+		return nil, errors.New("unknown PEM block type " + block.Type)
+	}
+	encoding, b := keyio.Raw, data
+	for _, format := range []string{keyio.Hex, keyio.Base64} {
+		if decoded, err := keyio.Decode(data, format, ""); err == nil {
+			encoding, b = format, decoded
+			break
+		}
+	}
+	if len(b) > 0 && b[0] == 0x30 {
+		if k, err := parseDER(b, formatDER); err == nil {
+			if encoding != keyio.Raw {
+				k.encoding = encoding + " " + formatDER
+			}
+			return []*key{k}, nil
+		}
+	}
+	return candidates(b, encoding, considered), nil
+}
+
+func schemeNames(list []*scheme) string {
+	names := make([]string, len(list))
+	for i, s := range list {
+		names[i] = s.name
+	}
+	return strings.Join(names, ", ")
+}
+
+//Forms of a key
+const (
+	formPublic   = "public"
+	formSeed     = "seed"
+	formExpanded = "expanded"
+	formBoth     = "both"
+)
+
+//form returns the form of the key as decoded, before it is completed
+func (k *key) form() string {
+	switch {
+	case k.seed != nil && k.expanded != nil:
+		return formBoth
+	case k.seed != nil:
+		return formSeed
+	case k.expanded != nil:
+		return formExpanded
+	}
+	return formPublic
+}
+
+//check completes the key and returns its inconsistencies
+func (k *key) check() []string {
+	var problems []string
+	if err := k.complete(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if k.pairErr != nil {
+		problems = append(problems, k.pairErr.Error())
+	}
+	if k.scheme.sig != nil && k.expanded != nil {
+		sk := k.scheme.sig().UnpackSK(k.expanded)
+		if !smallCoefficients(sk.S1, k.scheme.eta) || !smallCoefficients(sk.S2, k.scheme.eta) {
+			problems = append(problems, "coefficients of s1 or s2 out of range")
+		}
+	}
+	if k.scheme.kem != nil {
+		kem := k.scheme.kem()
+		if k.public != nil && !bytes.Equal(kem.PackPK(kem.UnpackPK(k.public)), k.public) {
+			problems = append(problems, "coefficients of the public key not reduced modulo q")
+		}
+		if k.expanded != nil {
+			if subtle.ConstantTimeCompare(kem.PackSK(kem.UnpackSK(k.expanded)), k.expanded) != 1 {
+				problems = append(problems, "hash of the public key in the private key does not match")
+			}
+			skP := kem.UnpackSK(k.expanded).SkP
+			if subtle.ConstantTimeCompare(kem.PackPKESK(kem.UnpackPKESK(skP)), skP) != 1 {
+				problems = append(problems, "coefficients of the private key not reduced modulo q")
+			}
+		}
+	}
+	return problems
+}
+
+func smallCoefficients(v dilithium.Vec, eta int32) bool {
+	for _, p := range v {
+		for _, c := range p {
+			if c < -eta || c > eta {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+//components returns the names and values of the public components of the key: the seed of the matrix A, a summary
+//of the vector t1 or t and the hash of the public key
+func (k *key) components() [][2]string {
+	var components [][2]string
+	if k.scheme.sig != nil {
+		d := k.scheme.sig()
+		if k.public == nil {
+			sk := d.UnpackSK(k.expanded)
+			tr := sk.Tr[:len(hashPublicKey(d, nil))]
+			return append(components, [2]string{"rho", hex.EncodeToString(sk.Rho[:])}, [2]string{"tr", hex.EncodeToString(tr)})
+		}
+		pk := d.UnpackPK(k.public)
+		min, max := pk.T1[0][0], pk.T1[0][0]
+		for _, p := range pk.T1 {
+			for _, c := range p {
+				if c < min {
+					min = c
+				}
+				if c > max {
+					max = c
+				}
+			}
+		}
+		return append(components,
+			[2]string{"rho", hex.EncodeToString(pk.Rho[:])},
+			[2]string{"t1", fmt.Sprintf("%d polynomials of %d coefficients in [%d, %d]", len(pk.T1), len(pk.T1[0]), min, max)},
+			[2]string{"tr", hex.EncodeToString(hashPublicKey(d, k.public))})
+	}
+	if k.public == nil {
+		return nil
+	}
+	kem := k.scheme.kem()
+	pk := kem.UnpackPK(k.public)
+	min, max := pk.T[0][0], pk.T[0][0]
+	for _, p := range pk.T {
+		for _, c := range p {
+			if c < min {
+				min = c
+			}
+			if c > max {
+				max = c
+			}
+		}
+	}
+	h := sha3.Sum256(k.public)
+	return append(components,
+		[2]string{"rho", hex.EncodeToString(pk.Rho)},
+		[2]string{"t", fmt.Sprintf("%d polynomials of %d coefficients in [%d, %d], in the NTT domain", len(pk.T), len(pk.T[0]), min, max)},
+		[2]string{"h", hex.EncodeToString(h[:])})
+}
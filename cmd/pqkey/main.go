@@ -0,0 +1,253 @@
+//Command pqkey identifies, checks and converts the keys of the dilithium and kyber packages.
+//
+//Usage:
+//
+//	pqkey inspect [-alg name] [-pub file] [-passphrase-file file] file
+//	pqkey convert [-alg name] [-pub file] [-passphrase-file file] [-to format] [-form form] [-kdf kdf] [-out file] file
+//
+//inspect detects the encoding and the scheme of a key, prints its fingerprints and its public components, and checks
+//that its parts are consistent: the seed generates the expanded key, the hash of the public key stored in a private
+//key matches it and the coefficients are in range. Keys may be
+//
+//	raw, hex or base64   the public key, the expanded private key or the seed, recognized by size
+//	pem                  the same in a PEM block of type "<scheme> PUBLIC KEY", "<scheme> PRIVATE KEY" or
+//	                     "<scheme> SEED", as written by the kyber and dilithium commands
+//	der, der-pem         a SubjectPublicKeyInfo or a PKCS #8 PrivateKeyInfo, in DER or in a PEM block of type
+//	                     "PUBLIC KEY" or "PRIVATE KEY", as written by OpenSSL
+//	jwk                  an AKP JSON Web Key
+//	encrypted            a private key encrypted with a passphrase, in a PEM block of type "PQ ENCRYPTED PRIVATE KEY"
+//	                     as written by the keyfile package
+//	der-encrypted        a PKCS #8 EncryptedPrivateKeyInfo (PBES2) in a PEM block of type "ENCRYPTED PRIVATE KEY"
+//
+//Sizes are ambiguous: round 3 Dilithium2 and ML-DSA-44 public keys have the same size, as have all the seeds of a
+//family. inspect describes every candidate, -alg selects one. The public key of an expanded ML-DSA or Dilithium
+//private key cannot be recovered, -pub gives it to check the pair.
+//
+//convert writes the key in another format and, with -form, keeps only the public key, the seed, the expanded
+//private key or both. An expanded key cannot be converted back to its seed. PKCS #8 is only defined for ML-DSA and
+//ML-KEM, and JWK private keys hold the seed.
+//
+//Encrypted keys are decrypted, and written by convert, with the passphrase on the first line of the file given by
+//-passphrase-file. convert encrypts the encrypted format with Argon2id, or scrypt if -kdf is scrypt, and
+//ChaCha20-Poly1305, and the der-encrypted format with PBKDF2-HMAC-SHA256 and AES-256-CBC.
+//
+//The exit status is 0 on success, 1 if a key is inconsistent and 2 on any other error.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/kudelskisecurity/crystals-go/internal/cli"
+	"github.com/kudelskisecurity/crystals-go/internal/keyio"
+	"github.com/kudelskisecurity/crystals-go/jose"
+)
+
+//Formats in addition to those of keyio
+const (
+	formatDER    = "der"
+	formatDERPEM = "der-pem"
+	formatJWK    = "jwk"
+
+	formatEncrypted    = "encrypted"
+	formatDEREncrypted = "der-encrypted"
+)
+
+//errInvalidKey is returned for inconsistent keys, with exit status 1
+var errInvalidKey = errors.New("invalid key")
+
+var program = &cli.Program{Name: "pqkey", Synopsis: "[flags] file", Commands: []cli.Subcommand{
+	{Name: "inspect", Summary: "identify and check a key", Run: keyCommand(inspect)},
+	{Name: "convert", Summary: "convert a key to another format or form", Run: keyCommand(convert)},
+}}
+
+func main() {
+	program.Main(errInvalidKey)
+}
+
+//command holds the flags common to the commands, which read a key
+type command struct {
+	*cli.Command
+	alg        *string
+	pub        *string
+	passphrase *string
+}
+
+//keyCommand defines the common flags before running f
+func keyCommand(f func(*command) error) func(*cli.Command) error {
+	return func(cc *cli.Command) error {
+		c := &command{Command: cc}
+		c.alg = c.String("alg", "", "scheme, by default detected")
+		c.pub = c.String("pub", "", "public key file matching an expanded private key")
+		c.passphrase = c.String("passphrase-file", "", "file holding the passphrase of encrypted keys")
+		return f(c)
+	}
+}
+
+//parse parses the flags and reads the keys of the file argument, with the public key of -pub if set
+func (c *command) parse() ([]*key, error) {
+	if err := c.ParseArgs(-1); err != nil {
+		return nil, err
+	}
+	if c.NArg() != 1 {
+		return nil, errors.New("expected one key file")
+	}
+	keys, err := c.readKey(c.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+	if *c.pub == "" {
+		return keys, nil
+	}
+	data, err := keyio.Read(*c.pub, c.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	var matching []*key
+	for _, k := range keys {
+		if !k.private() {
+			return nil, errors.New("-pub is only used with private keys")
+		}
+		pubs, err := parseKey(data, k.scheme.name)
+		if err != nil || len(pubs) != 1 || pubs[0].private() {
+			continue
+		}
+		k.pairErr = k.withPublic(pubs[0])
+		matching = append(matching, k)
+	}
+	if matching == nil {
+		return nil, errors.New(*c.pub + ": not a public key of the scheme of " + c.Arg(0))
+	}
+	return matching, nil
+}
+
+func (c *command) readKey(path string) ([]*key, error) {
+	data, err := keyio.Read(path, c.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	var keys []*key
+	if encrypted(data) {
+		var password []byte
+		if password, err = c.password(); err == nil {
+			keys, err = decryptKey(data, password, *c.alg)
+		}
+	} else {
+		keys, err = parseKey(data, *c.alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return keys, nil
+}
+
+//password returns the passphrase of the -passphrase-file flag
+func (c *command) password() ([]byte, error) {
+	if *c.passphrase == "" {
+		return nil, errors.New("encrypted key, -passphrase-file gives its passphrase")
+	}
+	return keyio.ReadPassphrase(*c.passphrase)
+}
+
+func inspect(c *command) error {
+	keys, err := c.parse()
+	if err != nil {
+		return err
+	}
+	if len(keys) > 1 {
+		fmt.Fprintf(c.Stdout, "%d candidate schemes, -alg selects one\n", len(keys))
+	}
+	valid := 0
+	for i, k := range keys {
+		if i > 0 || len(keys) > 1 {
+			fmt.Fprintln(c.Stdout)
+		}
+		if describe(c.Stdout, k) {
+			valid++
+		}
+	}
+	if valid == 0 {
+		return errInvalidKey
+	}
+	return nil
+}
+
+//describe prints a key and its checks, and reports whether it is consistent
+func describe(w io.Writer, k *key) bool {
+	fmt.Fprintf(w, "scheme: %s\nencoding: %s\nkind: %s\n", k.scheme.name, k.encoding, k.kind())
+	problems := k.check()
+	if k.public != nil {
+		sum := sha256.Sum256(k.public)
+		fmt.Fprintf(w, "public key sha256: %s\n", hex.EncodeToString(sum[:]))
+		if k.scheme.jwk != "" {
+			jwk := &jose.JWK{Algorithm: k.scheme.jwk, PublicKey: k.public}
+			if thumbprint, err := jwk.Thumbprint(); err == nil {
+				fmt.Fprintf(w, "jwk thumbprint: %s\n", base64.RawURLEncoding.EncodeToString(thumbprint))
+			}
+		}
+	}
+	for _, c := range k.components() {
+		fmt.Fprintf(w, "%s: %s\n", c[0], c[1])
+	}
+	if len(problems) == 0 {
+		fmt.Fprintln(w, "check: ok")
+		return true
+	}
+	for _, p := range problems {
+		fmt.Fprintf(w, "check: %s\n", p)
+	}
+	return false
+}
+
+func convert(c *command) error {
+	to := c.String("to", formatDERPEM, "output format: raw, hex, base64, pem, der, der-pem, jwk, encrypted or der-encrypted")
+	form := c.String("form", "", "public, seed, expanded or both, by default the form of the input")
+	kdf := c.String("kdf", "argon2id", "key derivation function of the encrypted format: argon2id or scrypt")
+	out := c.String("out", "-", "output file")
+	keys, err := c.parse()
+	if err != nil {
+		return err
+	}
+	if len(keys) > 1 {
+		return errors.New("the scheme is ambiguous (" + schemeNames(schemesOf(keys)) + "), -alg selects one")
+	}
+	k := keys[0]
+	if *form == "" {
+		*form = k.form()
+	}
+	if problems := k.check(); len(problems) != 0 {
+		for _, p := range problems {
+			fmt.Fprintln(c.Output(), "pqkey:", p)
+		}
+		return errInvalidKey
+	}
+	var b []byte
+	if *to == formatEncrypted || *to == formatDEREncrypted {
+		if *c.passphrase == "" {
+			return errors.New("-to " + *to + " requires -passphrase-file")
+		}
+		var password []byte
+		if password, err = keyio.ReadPassphrase(*c.passphrase); err != nil {
+			return err
+		}
+		b, err = k.encrypt(*to, *form, *kdf, password)
+	} else {
+		b, err = k.encode(*to, *form)
+	}
+	if err != nil {
+		return err
+	}
+	return keyio.Write(*out, b, *form != formPublic, c.Stdout)
+}
+
+func schemesOf(keys []*key) []*scheme {
+	list := make([]*scheme, len(keys))
+	for i, k := range keys {
+		list[i] = k.scheme
+	}
+	return list
+}
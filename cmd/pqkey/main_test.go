@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kudelskisecurity/crystals-go/cms"
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+)
+
+//pqkeyCmd runs a command and returns its standard output
+func pqkeyCmd(stdin []byte, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	err := program.Run(args, bytes.NewReader(stdin), &stdout, &stderr)
+	return stdout.Bytes(), err
+}
+
+func mustRun(t *testing.T, stdin []byte, args ...string) []byte {
+	out, err := pqkeyCmd(stdin, args...)
+	if err != nil {
+		t.Fatal(args, err)
+	}
+	return out
+}
+
+var seed = bytes.Repeat([]byte{7}, dilithium.SEEDBYTES)
+
+func TestInspect(t *testing.T) {
+	pk, sk := dilithium.NewMLDSA44().KeyGen(seed)
+	out := string(mustRun(t, []byte(hex.EncodeToString(pk)), "inspect", "-"))
+	if !strings.HasPrefix(out, "2 candidate schemes") || !strings.Contains(out, "scheme: ML-DSA-44\nencoding: hex\nkind: public key\n") || !strings.Contains(out, "scheme: Dilithium2\n") {
+		t.Fatal("unexpected description", out)
+	}
+	out = string(mustRun(t, sk, "inspect", "-"))
+	if !strings.HasPrefix(out, "scheme: ML-DSA-44\nencoding: raw\nkind: private key (expanded key)\n") || strings.Contains(out, "public key sha256") {
+		t.Fatal("unexpected description", out)
+	}
+	out = string(mustRun(t, seed, "inspect", "-alg", "ML-DSA-44", "-"))
+	if !strings.Contains(out, "kind: private key (seed)\n") || !strings.Contains(out, "t1: 4 polynomials of 256 coefficients") || !strings.HasSuffix(out, "check: ok\n") {
+		t.Fatal("unexpected description", out)
+	}
+
+	kemSeed := bytes.Repeat([]byte{9}, kyber.SEEDBYTES+kyber.SIZEZ)
+	_, dk := kyber.NewMLKEM768().KeyGen(kemSeed)
+	der, _ := cms.MarshalKEMPrivateKey(kyber.NewMLKEM768(), nil, dk)
+	out = string(mustRun(t, der, "inspect", "-"))
+	if !strings.HasPrefix(out, "scheme: ML-KEM-768\nencoding: der\nkind: private key (expanded key)\npublic key sha256: ") {
+		t.Fatal("unexpected description", out)
+	}
+	if _, err := pqkeyCmd(bytes.Repeat([]byte{1}, 100), "inspect", "-"); err == nil || err == errInvalidKey {
+		t.Fatal("unknown data described", err)
+	}
+}
+
+func TestInconsistentKeys(t *testing.T) {
+	d := dilithium.NewMLDSA65()
+	pk, sk := d.KeyGen(seed)
+	dir := t.TempDir()
+	pub := filepath.Join(dir, "pub")
+	ioutil.WriteFile(pub, pk, 0644)
+	if out := string(mustRun(t, sk, "inspect", "-pub", pub, "-")); !strings.Contains(out, "t1: 6 polynomials") {
+		t.Fatal("public key not used", out)
+	}
+	otherPK, _ := d.KeyGen(nil)
+	ioutil.WriteFile(pub, otherPK, 0644)
+	if _, err := pqkeyCmd(sk, "inspect", "-pub", pub, "-"); err != errInvalidKey {
+		t.Fatal("mismatched public key accepted", err)
+	}
+
+	bad := append([]byte{}, sk...)
+	bad[4*dilithium.SEEDBYTES] = 0xFF //first coefficients of s1, 4 - 15 with eta = 4
+	if _, err := pqkeyCmd(bad, "inspect", "-"); err != errInvalidKey {
+		t.Fatal("out of range s1 accepted", err)
+	}
+
+	k := kyber.NewMLKEM512()
+	_, dk := k.KeyGen(nil)
+	dk[k.SIZESK()-kyber.SIZEZ-1] ^= 1
+	if out, err := pqkeyCmd(dk, "inspect", "-alg", "ML-KEM-512", "-"); err != errInvalidKey || !strings.Contains(string(out), "check: hash of the public key") {
+		t.Fatal("private key with a wrong public key hash accepted", err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	d := dilithium.NewMLDSA87()
+	pk, sk := d.KeyGen(seed)
+	dir := t.TempDir()
+	both := filepath.Join(dir, "both.pem")
+	mustRun(t, []byte(hex.EncodeToString(seed)), "convert", "-alg", "ML-DSA-87", "-form", "both", "-out", both, "-")
+	der := mustRun(t, nil, "convert", "-to", "der", both)
+	if _, seed2, sk2, err := cms.ParseDilithiumPrivateKey(der); err != nil || !bytes.Equal(seed2, seed) || !bytes.Equal(sk2, sk) {
+		t.Fatal("unexpected PKCS #8 key", err)
+	}
+	if raw := mustRun(t, nil, "convert", "-to", "raw", "-form", "expanded", both); !bytes.Equal(raw, sk) {
+		t.Fatal("unexpected expanded key")
+	}
+	jwk := mustRun(t, nil, "convert", "-to", "jwk", "-form", "seed", both)
+	if raw := mustRun(t, jwk, "convert", "-to", "raw", "-form", "public", "-"); !bytes.Equal(raw, pk) {
+		t.Fatal("unexpected public key")
+	}
+	spki := mustRun(t, jwk, "convert", "-to", "der", "-form", "public", "-")
+	if _, pk2, err := cms.ParseDilithiumPublicKey(spki); err != nil || !bytes.Equal(pk2, pk) {
+		t.Fatal("unexpected SubjectPublicKeyInfo", err)
+	}
+
+	for _, args := range [][]string{
+		{"-form", "seed"},
+		{"-form", "public"},
+		{"-to", "jwk"},
+		{"-to", "pem", "-form", "both"},
+		{"-to", "xml"},
+	} {
+		if _, err := pqkeyCmd(sk, append(append([]string{"convert"}, args...), "-")...); err == nil {
+			t.Fatal(args, "accepted for an expanded key")
+		}
+	}
+	if _, err := pqkeyCmd(pk[:dilithium.Dilithium2SizePK], "convert", "-"); err == nil {
+		t.Fatal("ambiguous key converted")
+	}
+	if _, err := pqkeyCmd(nil, "convert", "-alg", "Dilithium3", "-to", "der", "-form", "seed", both); err == nil {
+		t.Fatal("ML-DSA-87 key read as Dilithium3")
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	passphrase := filepath.Join(dir, "passphrase")
+	ioutil.WriteFile(passphrase, []byte("correct horse\n"), 0600)
+	kemSeed := bytes.Repeat([]byte{0xa5}, kyber.SEEDBYTES+kyber.SIZEZ)
+	_, dk := kyber.NewKyber768().KeyGen(kemSeed)
+
+	encrypted := mustRun(t, kemSeed, "convert", "-alg", "Kyber768", "-to", "encrypted", "-kdf", "scrypt", "-passphrase-file", passphrase, "-")
+	out := string(mustRun(t, encrypted, "inspect", "-passphrase-file", passphrase, "-"))
+	if !strings.HasPrefix(out, "scheme: Kyber768\nencoding: encrypted (scrypt N=2^15 r=8 p=1, chacha20-poly1305)\nkind: private key (seed)\n") {
+		t.Fatal("unexpected description", out)
+	}
+	if raw := mustRun(t, encrypted, "convert", "-passphrase-file", passphrase, "-to", "raw", "-form", "expanded", "-"); !bytes.Equal(raw, dk) {
+		t.Fatal("unexpected decrypted key")
+	}
+
+	pkcs8 := mustRun(t, seed, "convert", "-alg", "ML-DSA-44", "-to", "der-encrypted", "-passphrase-file", passphrase, "-")
+	encrypted = mustRun(t, pkcs8, "convert", "-to", "encrypted", "-form", "expanded", "-passphrase-file", passphrase, "-")
+	out = string(mustRun(t, encrypted, "inspect", "-passphrase-file", passphrase, "-"))
+	if !strings.Contains(out, "encoding: encrypted (argon2id t=3 m=65536 KiB p=4, chacha20-poly1305)\nkind: private key (expanded key)\n") {
+		t.Fatal("unexpected description", out)
+	}
+
+	wrong := filepath.Join(dir, "wrong")
+	ioutil.WriteFile(wrong, []byte("battery staple"), 0600)
+	for _, args := range [][]string{
+		{"inspect", "-"},
+		{"inspect", "-passphrase-file", wrong, "-"},
+		{"inspect", "-passphrase-file", passphrase, "-alg", "ML-DSA-65", "-"},
+		{"convert", "-to", "encrypted", "-form", "public", "-passphrase-file", passphrase, "-"},
+		{"convert", "-to", "der-encrypted", "-"},
+	} {
+		if _, err := pqkeyCmd(pkcs8, args...); err == nil {
+			t.Fatal(args, "accepted")
+		}
+	}
+}
@@ -0,0 +1,309 @@
+//Command pqsign signs and verifies files and directories with the minisign-style formats of the minisign package and
+//ML-DSA or Dilithium keys.
+//
+//Usage:
+//
+//	pqsign keygen     [-alg name] [-pub file] [-priv file]
+//	pqsign sign       -priv file [-legacy] [-deterministic] [-c comment] [-t comment] [-sig file] file
+//	pqsign verify     -pub file [-sig file] [-q] file
+//	pqsign sign-dir   -priv file [-deterministic] [-c comment] [-t comment] [-manifest name] dir
+//	pqsign verify-dir -pub file [-manifest name] [-q] dir
+//
+//The parameter set is one of Dilithium2, Dilithium3, Dilithium5, ML-DSA-44, ML-DSA-65 (the default) and ML-DSA-87.
+//Files are signed through their BLAKE2b-512 hash, -legacy signs the file itself. The signature of a file is written
+//next to it with the ".minisig" extension unless -sig is given, a file name of "-" being the standard input or
+//output. verify prints the trusted comment.
+//
+//sign-dir writes in the directory a manifest of the SHA-256 hashes of all its files, "MANIFEST" by default, and its
+//signature. verify-dir verifies the signature, then checks that no file is missing, modified or unlisted.
+//
+//The exit status is 0 on success, 1 if a signature is invalid or a directory does not match its manifest and 2 on
+//any other error.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	"github.com/kudelskisecurity/crystals-go/internal/cli"
+	"github.com/kudelskisecurity/crystals-go/internal/keyio"
+	"github.com/kudelskisecurity/crystals-go/minisign"
+)
+
+var algorithms = map[string]func(...bool) *dilithium.Dilithium{
+	"Dilithium2": dilithium.NewDilithium2,
+	"Dilithium3": dilithium.NewDilithium3,
+	"Dilithium5": dilithium.NewDilithium5,
+	"ML-DSA-44":  dilithium.NewMLDSA44,
+	"ML-DSA-65":  dilithium.NewMLDSA65,
+	"ML-DSA-87":  dilithium.NewMLDSA87,
+}
+
+func newDilithium(name string) (*dilithium.Dilithium, error) {
+	newSigner, ok := algorithms[name]
+	if !ok {
+		names := make([]string, 0, len(algorithms))
+		for n := range algorithms {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, errors.New("unknown parameter set " + name + ", expected one of " + strings.Join(names, ", "))
+	}
+	return newSigner(), nil
+}
+
+//errVerification is returned when a signature is invalid or a directory does not match its manifest, with exit
+//status 1
+var errVerification = errors.New("verification failed")
+
+var program = &cli.Program{Name: "pqsign", Commands: []cli.Subcommand{
+	{Name: "keygen", Summary: "generate a key pair", Run: keygen},
+	{Name: "sign", Summary: "sign a file", Run: sign},
+	{Name: "verify", Summary: "verify the signature of a file", Run: verify},
+	{Name: "sign-dir", Summary: "sign the manifest of a directory", Run: signDir},
+	{Name: "verify-dir", Summary: "verify the manifest of a directory and its files", Run: verifyDir},
+}}
+
+func main() {
+	program.Main(errVerification)
+}
+
+func readPrivateKey(c *cli.Command, path string, deterministic bool) (*minisign.PrivateKey, error) {
+	data, err := keyio.Read(path, c.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	k, err := minisign.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if deterministic {
+		k.Dilithium = algorithms[k.Dilithium.Name](false)
+	}
+	return k, nil
+}
+
+func readPublicKey(c *cli.Command, path string) (*minisign.PublicKey, error) {
+	data, err := keyio.Read(path, c.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	k, err := minisign.ParsePublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return k, nil
+}
+
+//trustedComment returns the default trusted comment of minisign
+func trustedComment(name string, prehashed bool) string {
+	comment := fmt.Sprintf("timestamp:%d\tfile:%s", time.Now().Unix(), filepath.Base(name))
+	if prehashed {
+		comment += "\thashed"
+	}
+	return comment
+}
+
+//printTrustedComment prints the trusted comment of a verified signature, unless quiet
+func printTrustedComment(c *cli.Command, sig *minisign.Signature, quiet bool) {
+	if !quiet {
+		fmt.Fprintf(c.Stdout, "Signature and comment signature verified\nTrusted comment: %s\n", sig.TrustedComment)
+	}
+}
+
+func keygen(c *cli.Command) error {
+	alg := c.String("alg", "ML-DSA-65", "parameter set")
+	pubPath := c.String("pub", "-", "public key output file")
+	privPath := c.String("priv", "-", "secret key output file")
+	if err := c.ParseArgs(0); err != nil {
+		return err
+	}
+	d, err := newDilithium(*alg)
+	if err != nil {
+		return err
+	}
+	k, err := minisign.GenerateKey(d, nil)
+	if err != nil {
+		return err
+	}
+	if err := keyio.Write(*pubPath, k.MarshalPublicKey(), false, c.Stdout); err != nil {
+		return err
+	}
+	return keyio.Write(*privPath, k.MarshalPrivateKey(), true, c.Stdout)
+}
+
+func sign(c *cli.Command) error {
+	privPath := c.String("priv", "", "secret key file")
+	legacy := c.Bool("legacy", false, "sign the file rather than its hash")
+	deterministic := c.Bool("deterministic", false, "deterministic instead of hedged signature")
+	untrusted := c.String("c", "signature from pqsign secret key", "untrusted comment")
+	trusted := c.String("t", "", "trusted comment, by default the timestamp and the file name")
+	sigPath := c.String("sig", "", "signature output file, by default the file name with the .minisig extension")
+	if err := c.ParseArgs(1); err != nil {
+		return err
+	}
+	if err := cli.Required(map[string]*string{"priv": privPath}); err != nil {
+		return err
+	}
+	k, err := readPrivateKey(c, *privPath, *deterministic)
+	if err != nil {
+		return err
+	}
+	name := c.Arg(0)
+	if *trusted == "" {
+		*trusted = trustedComment(name, !*legacy)
+	}
+	if *sigPath == "" {
+		*sigPath = "-"
+		if name != "-" {
+			*sigPath = name + ".minisig"
+		}
+	}
+	in := c.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	sig, err := k.Sign(in, !*legacy, *untrusted, *trusted)
+	if err != nil {
+		return err
+	}
+	return keyio.Write(*sigPath, sig.Marshal(), false, c.Stdout)
+}
+
+func verify(c *cli.Command) error {
+	pubPath := c.String("pub", "", "public key file")
+	sigPath := c.String("sig", "", "signature file, by default the file name with the .minisig extension")
+	quiet := c.Bool("q", false, "do not print the trusted comment")
+	if err := c.ParseArgs(1); err != nil {
+		return err
+	}
+	name := c.Arg(0)
+	if *sigPath == "" && name != "-" {
+		*sigPath = name + ".minisig"
+	}
+	if err := cli.Required(map[string]*string{"pub": pubPath, "sig": sigPath}); err != nil {
+		return err
+	}
+	k, err := readPublicKey(c, *pubPath)
+	if err != nil {
+		return err
+	}
+	data, err := keyio.Read(*sigPath, c.Stdin)
+	if err != nil {
+		return err
+	}
+	sig, err := minisign.ParseSignature(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", *sigPath, err)
+	}
+	in := c.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	if err := k.Verify(in, sig); err == minisign.ErrInvalidSignature {
+		return errVerification
+	} else if err != nil {
+		return err
+	}
+	printTrustedComment(c, sig, *quiet)
+	return nil
+}
+
+func signDir(c *cli.Command) error {
+	privPath := c.String("priv", "", "secret key file")
+	deterministic := c.Bool("deterministic", false, "deterministic instead of hedged signature")
+	untrusted := c.String("c", "signature from pqsign secret key", "untrusted comment")
+	trusted := c.String("t", "", "trusted comment, by default the timestamp and the manifest name")
+	manifestName := c.String("manifest", "MANIFEST", "name of the manifest in the directory")
+	if err := c.ParseArgs(1); err != nil {
+		return err
+	}
+	if err := cli.Required(map[string]*string{"priv": privPath}); err != nil {
+		return err
+	}
+	k, err := readPrivateKey(c, *privPath, *deterministic)
+	if err != nil {
+		return err
+	}
+	if *trusted == "" {
+		*trusted = trustedComment(*manifestName, true)
+	}
+	dir := c.Arg(0)
+	manifest, sig, err := k.SignDirectory(dir, *untrusted, *trusted, *manifestName, *manifestName+".minisig")
+	if err != nil {
+		return err
+	}
+	if err := keyio.Write(filepath.Join(dir, *manifestName), manifest, false, c.Stdout); err != nil {
+		return err
+	}
+	return keyio.Write(filepath.Join(dir, *manifestName+".minisig"), sig.Marshal(), false, c.Stdout)
+}
+
+func verifyDir(c *cli.Command) error {
+	pubPath := c.String("pub", "", "public key file")
+	manifestName := c.String("manifest", "MANIFEST", "name of the manifest in the directory")
+	quiet := c.Bool("q", false, "do not print the trusted comment")
+	if err := c.ParseArgs(1); err != nil {
+		return err
+	}
+	if err := cli.Required(map[string]*string{"pub": pubPath}); err != nil {
+		return err
+	}
+	k, err := readPublicKey(c, *pubPath)
+	if err != nil {
+		return err
+	}
+	dir := c.Arg(0)
+	manifestPath := filepath.Join(dir, *manifestName)
+	manifest, err := keyio.Read(manifestPath, nil)
+	if err != nil {
+		return err
+	}
+	data, err := keyio.Read(manifestPath+".minisig", nil)
+	if err != nil {
+		return err
+	}
+	sig, err := minisign.ParseSignature(data)
+	if err != nil {
+		return fmt.Errorf("%s.minisig: %v", manifestPath, err)
+	}
+	_, err = k.VerifyDirectory(dir, manifest, sig, *manifestName, *manifestName+".minisig")
+	if ce, ok := err.(*minisign.CheckError); ok {
+		var report bytes.Buffer
+		for _, d := range []struct {
+			status string
+			paths  []string
+		}{{"MISSING", ce.Missing}, {"MODIFIED", ce.Modified}, {"UNLISTED", ce.Unlisted}} {
+			for _, p := range d.paths {
+				fmt.Fprintf(&report, "%s: %s\n", p, d.status)
+			}
+		}
+		c.Output().Write(report.Bytes())
+		return errVerification
+	}
+	if err == minisign.ErrInvalidSignature {
+		return errVerification
+	}
+	if err != nil {
+		return err
+	}
+	printTrustedComment(c, sig, *quiet)
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//pqsignCmd runs a command and returns its standard output
+func pqsignCmd(stdin []byte, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	err := program.Run(args, bytes.NewReader(stdin), &stdout, &stderr)
+	return stdout.Bytes(), err
+}
+
+func mustRun(t *testing.T, stdin []byte, args ...string) []byte {
+	out, err := pqsignCmd(stdin, args...)
+	if err != nil {
+		t.Fatal(args, err)
+	}
+	return out
+}
+
+func TestSignVerify(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv := filepath.Join(dir, "key.pub"), filepath.Join(dir, "key.sec")
+	mustRun(t, nil, "keygen", "-alg", "ML-DSA-44", "-pub", pub, "-priv", priv)
+	file := filepath.Join(dir, "release.tar.gz")
+	ioutil.WriteFile(file, []byte("release"), 0644)
+
+	for _, legacy := range []string{"-legacy=false", "-legacy"} {
+		mustRun(t, nil, "sign", "-priv", priv, legacy, "-t", "release 1.0", file)
+		out := string(mustRun(t, nil, "verify", "-pub", pub, file))
+		if !strings.HasSuffix(out, "Trusted comment: release 1.0\n") {
+			t.Fatal("unexpected output", out)
+		}
+		if out := mustRun(t, nil, "verify", "-pub", pub, "-q", file); len(out) != 0 {
+			t.Fatal("unexpected output with -q", string(out))
+		}
+	}
+
+	sig := mustRun(t, []byte("release"), "sign", "-priv", priv, "-deterministic", "-")
+	if !bytes.Equal(sig, mustRun(t, []byte("release"), "sign", "-priv", priv, "-deterministic", "-")) {
+		t.Fatal("deterministic signatures differ")
+	}
+	sigFile := filepath.Join(dir, "stdin.minisig")
+	ioutil.WriteFile(sigFile, sig, 0644)
+	out := string(mustRun(t, []byte("release"), "verify", "-pub", pub, "-sig", sigFile, "-"))
+	if !strings.Contains(out, "file:-\thashed") {
+		t.Fatal("unexpected default trusted comment", out)
+	}
+	if _, err := pqsignCmd([]byte("tampered"), "verify", "-pub", pub, "-sig", sigFile, "-"); err != errVerification {
+		t.Fatal("tampered file accepted", err)
+	}
+
+	otherPub := filepath.Join(dir, "other.pub")
+	mustRun(t, nil, "keygen", "-pub", otherPub, "-priv", filepath.Join(dir, "other.sec"))
+	if _, err := pqsignCmd(nil, "verify", "-pub", otherPub, file); err == nil || err == errVerification {
+		t.Fatal("signature of another key not reported as such", err)
+	}
+	if _, err := pqsignCmd(nil, "sign", file); err == nil {
+		t.Fatal("missing -priv accepted")
+	}
+}
+
+func TestDirectory(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv := filepath.Join(dir, "key.pub"), filepath.Join(dir, "key.sec")
+	mustRun(t, nil, "keygen", "-pub", pub, "-priv", priv)
+	release := filepath.Join(dir, "release")
+	os.MkdirAll(filepath.Join(release, "bin"), 0755)
+	ioutil.WriteFile(filepath.Join(release, "README"), []byte("readme"), 0644)
+	ioutil.WriteFile(filepath.Join(release, "bin", "tool"), []byte("tool"), 0755)
+
+	mustRun(t, nil, "sign-dir", "-priv", priv, release)
+	manifest, err := ioutil.ReadFile(filepath.Join(release, "MANIFEST"))
+	if err != nil || !strings.Contains(string(manifest), "  bin/tool\n") || strings.Contains(string(manifest), "MANIFEST") {
+		t.Fatal("unexpected manifest", string(manifest), err)
+	}
+	mustRun(t, nil, "verify-dir", "-pub", pub, release)
+
+	ioutil.WriteFile(filepath.Join(release, "bin", "tool"), []byte("backdoor"), 0755)
+	ioutil.WriteFile(filepath.Join(release, "extra"), nil, 0644)
+	var stdout, stderr bytes.Buffer
+	if err := program.Run([]string{"verify-dir", "-pub", pub, release}, nil, &stdout, &stderr); err != errVerification {
+		t.Fatal("modified directory accepted", err)
+	}
+	if report := stderr.String(); report != "bin/tool: MODIFIED\nextra: UNLISTED\n" {
+		t.Fatal("unexpected report", report)
+	}
+
+	manifest[0] ^= 1
+	ioutil.WriteFile(filepath.Join(release, "MANIFEST"), manifest, 0644)
+	if _, err := pqsignCmd(nil, "verify-dir", "-pub", pub, release); err != errVerification {
+		t.Fatal("modified manifest accepted", err)
+	}
+}
@@ -0,0 +1,75 @@
+//Package cms implements the parts of the Cryptographic Message Syntax (RFC 5652) needed to protect documents with the
+//post-quantum algorithms of this module: EnvelopedData and AuthEnvelopedData (RFC 5083) whose recipients hold ML-KEM
+//keys, with the KEMRecipientInfo structure of RFC 9629 and the algorithm identifiers of RFC 9936, and SignedData
+//whose signers hold ML-DSA keys (RFC 9882) or round 3 Dilithium keys. Signatures of RSA, ECDSA and Ed25519 signers are
+//verified too, so that post-quantum and classical signers can be accepted side by side.
+//
+//Messages are DER encoded ContentInfo structures. BER encodings with indefinite lengths, as produced by streaming
+//encoders, are not supported.
+package cms
+
+import (
+	"encoding/asn1"
+	"errors"
+)
+
+//Content types
+var (
+	OIDData              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	OIDEnvelopedData     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	OIDAuthEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 23}
+)
+
+//Algorithm identifiers
+var (
+	oidOtherRecipientKEM = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 13, 3}
+	oidHKDFSHA256        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 3, 28}
+	oidHKDFSHA384        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 3, 29}
+	oidHKDFSHA512        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 3, 30}
+	oidAES128Wrap        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 5}
+	oidAES192Wrap        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 25}
+	oidAES256Wrap        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 45}
+	oidAES128CBC         = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES256CBC         = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidAES128GCM         = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 6}
+	oidAES256GCM         = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 46}
+)
+
+//contentInfo is the outer structure of CMS messages. encoding/asn1 does not apply the explicit tag to RawValue fields
+//when marshaling, and decodes them as the tagged element.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+func marshalContentInfo(contentType asn1.ObjectIdentifier, content []byte) ([]byte, error) {
+	explicit := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: content}
+	return asn1.Marshal(contentInfo{ContentType: contentType, Content: explicit})
+}
+
+//parseContentInfo returns the content type and the encoded content of a message
+func parseContentInfo(der []byte) (asn1.ObjectIdentifier, []byte, error) {
+	var ci contentInfo
+	rest, err := asn1.Unmarshal(der, &ci)
+	if err != nil || len(rest) != 0 {
+		return nil, nil, errors.New("cms: malformed ContentInfo")
+	}
+	return ci.ContentType, ci.Content.Bytes, nil
+}
+
+//unmarshalDER decodes a DER structure without trailing data
+func unmarshalDER(der []byte, out interface{}, what string) error {
+	rest, err := asn1.Unmarshal(der, out)
+	if err != nil || len(rest) != 0 {
+		return errors.New("cms: malformed " + what)
+	}
+	return nil
+}
+
+//retag replaces the tag of an encoded element by a universal one, to decode IMPLICIT tagged elements with
+//encoding/asn1. The tag must fit in one byte.
+func retag(der []byte, tag byte) []byte {
+	out := append([]byte{}, der...)
+	out[0] = tag
+	return out
+}
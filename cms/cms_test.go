@@ -0,0 +1,227 @@
+package cms
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"io"
+	"math/big"
+	"testing"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"golang.org/x/crypto/hkdf"
+)
+
+func fromHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+//The info input of HKDF is the DER encoding of CMSORIforKEMOtherInfo, here with AES-256 key wrap and no UKM
+func TestDeriveKEK(t *testing.T) {
+	ri := &kemRecipientInfo{
+		KDF:       pkix.AlgorithmIdentifier{Algorithm: oidHKDFSHA256},
+		KEKLength: 32,
+		Wrap:      pkix.AlgorithmIdentifier{Algorithm: oidAES256Wrap},
+	}
+	ss := bytes.Repeat([]byte{7}, 32)
+	kek, err := deriveKEK(ri, ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := make([]byte, 32)
+	io.ReadFull(hkdf.New(sha256.New, ss, nil, fromHex("3010300b060960864801650304012d020120")), expected)
+	if !bytes.Equal(kek, expected) {
+		t.Fatal("unexpected key-encryption key")
+	}
+	ri.KEKLength = 16
+	if _, err := deriveKEK(ri, ss); err == nil {
+		t.Fatal("KEK length that does not match the key wrap accepted")
+	}
+}
+
+//testCertificate returns a certificate as parsed by crypto/x509, which does not know ML-KEM keys
+func testCertificate(t *testing.T, k *kyber.Kyber, pk []byte, serial int64) *x509.Certificate {
+	spki, err := MarshalKEMPublicKey(k, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, _ := asn1.Marshal(pkix.Name{CommonName: "Test CA"}.ToRDNSequence())
+	return &x509.Certificate{RawIssuer: issuer, SerialNumber: big.NewInt(serial), RawSubjectPublicKeyInfo: spki}
+}
+
+func TestEnveloped(t *testing.T) {
+	for _, k := range []*kyber.Kyber{kyber.NewMLKEM512(), kyber.NewMLKEM768(), kyber.NewMLKEM1024()} {
+		pkA, skA := k.KeyGen(nil)
+		pkB, skB := k.KeyGen(nil)
+		cert := testCertificate(t, k, pkA, 1)
+		alice, err := NewRecipient(cert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bob := &Recipient{KEM: k, PublicKey: pkB, SubjectKeyID: []byte("bob")}
+		content := []byte("document for alice and bob")
+
+		for _, encrypt := range []func([]byte, []*Recipient, *EncryptOptions) ([]byte, error){Encrypt, EncryptAuthenticated} {
+			der, err := encrypt(content, []*Recipient{alice, bob}, &EncryptOptions{UKM: []byte("ukm")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := ParseEnveloped(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(m.Recipients) != 2 || m.Recipients[0].KEM != k.Name || !bytes.Equal(m.Recipients[0].UKM, []byte("ukm")) {
+				t.Fatal("unexpected recipient infos")
+			}
+			for _, key := range []*RecipientKey{
+				{KEM: k, PrivateKey: skA, Certificate: cert},
+				{KEM: k, PrivateKey: skB, SubjectKeyID: []byte("bob")},
+				{KEM: k, PrivateKey: skB},
+			} {
+				out, err := m.Decrypt(key)
+				if err != nil || !bytes.Equal(out, content) {
+					t.Fatal(k.Name, "decryption failed", err)
+				}
+			}
+			if _, err := m.Decrypt(&RecipientKey{KEM: k, PrivateKey: skB, Certificate: cert}); err == nil {
+				t.Fatal("wrong key accepted")
+			}
+			if _, err := m.Decrypt(&RecipientKey{KEM: k, PrivateKey: skA, SubjectKeyID: []byte("carol")}); err == nil {
+				t.Fatal("unknown recipient accepted")
+			}
+		}
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	k := kyber.NewMLKEM768()
+	pk, sk := k.KeyGen(nil)
+	r := &Recipient{KEM: k, PublicKey: pk, SubjectKeyID: []byte{1}}
+	der, err := EncryptAuthenticated([]byte("authenticated content"), []*Recipient{r}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ParseEnveloped(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.encrypted[0] ^= 1
+	if _, err := m.Decrypt(&RecipientKey{KEM: k, PrivateKey: sk}); err == nil {
+		t.Fatal("modified content accepted")
+	}
+	if _, err := ParseEnveloped(der[:len(der)-1]); err == nil {
+		t.Fatal("truncated message accepted")
+	}
+}
+
+func TestKEMPublicKey(t *testing.T) {
+	k := kyber.NewMLKEM1024()
+	pk, _ := k.KeyGen(nil)
+	spki, err := MarshalKEMPublicKey(k, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, pk2, err := ParseKEMPublicKey(spki)
+	if err != nil || k2.Name != k.Name || !bytes.Equal(pk, pk2) {
+		t.Fatal("public key does not round trip", err)
+	}
+	if _, err := MarshalKEMPublicKey(kyber.NewKyber768(), pk); err == nil {
+		t.Fatal("round 3 Kyber key encoded")
+	}
+	if _, err := Encrypt([]byte("x"), []*Recipient{{KEM: k, PublicKey: pk}}, nil); err == nil {
+		t.Fatal("recipient without identifier accepted")
+	}
+}
+
+func TestPrivateKeys(t *testing.T) {
+	d := dilithium.NewMLDSA65()
+	seed := bytes.Repeat([]byte{7}, dilithium.SEEDBYTES)
+	_, sk := d.KeyGen(seed)
+	for _, key := range [][2][]byte{{seed, nil}, {nil, sk}, {seed, sk}} {
+		der, err := MarshalDilithiumPrivateKey(d, key[0], key[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		d2, seed2, sk2, err := ParseDilithiumPrivateKey(der)
+		if err != nil || d2.Name != d.Name || !bytes.Equal(seed2, key[0]) || !bytes.Equal(sk2, sk) {
+			t.Fatal("ML-DSA private key does not round trip", err)
+		}
+	}
+	_, other := d.KeyGen(nil)
+	if der, _ := MarshalDilithiumPrivateKey(d, seed, other); der != nil {
+		if _, _, _, err := ParseDilithiumPrivateKey(der); err == nil {
+			t.Fatal("mismatched seed and expanded key accepted")
+		}
+	}
+	if _, err := MarshalDilithiumPrivateKey(dilithium.NewDilithium3(), seed, nil); err == nil {
+		t.Fatal("round 3 Dilithium key encoded")
+	}
+
+	k := kyber.NewMLKEM768()
+	kemSeed := bytes.Repeat([]byte{9}, kyber.SEEDBYTES+kyber.SIZEZ)
+	_, dk := k.KeyGen(kemSeed)
+	der, err := MarshalKEMPrivateKey(k, nil, dk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, dk2, err := ParseKEMPrivateKey(der); err != nil || !bytes.Equal(dk, dk2) {
+		t.Fatal("ML-KEM private key does not round trip", err)
+	}
+	der, _ = MarshalKEMPrivateKey(k, kemSeed, nil)
+	if _, seed2, dk2, err := ParseKEMPrivateKey(der); err != nil || !bytes.Equal(seed2, kemSeed) || !bytes.Equal(dk, dk2) {
+		t.Fatal("ML-KEM seed does not round trip", err)
+	}
+	dk[k.SIZESK()-40] ^= 1
+	der, _ = MarshalKEMPrivateKey(k, nil, dk)
+	if _, _, _, err := ParseKEMPrivateKey(der); err == nil {
+		t.Fatal("private key with a wrong public key hash accepted")
+	}
+}
+
+//The encrypted keys were written by OpenSSL 3.0 from the Ed25519 key k: openssl pkcs8 -topk8 -scrypt -scrypt_N 1024
+//and -v2 aes-128-cbc -v2prf hmacWithSHA1 -iter 2048
+func TestEncryptedPrivateKeys(t *testing.T) {
+	k := fromHex("302e020100300506032b6570042204204595950b2a13c135acbbea29100da385c56b66c60a442f21dec2db46d210a9b1")
+	for _, encrypted := range []string{
+		"308193304f06092a864886f70d01050d3042302106092b06010401da47040b30140408f5d866f97947021b02020400020108020101301d06" +
+			"0960864801650304012a041094cf2a23e4990d71473a8f2b89afeba304406e3ce61d6e9d0fda620d67cc57141e6b76e019be79de0517" +
+			"bf5aa6be41e6323a453c9e7709645e759e27d3b1af5a83899734e629f7fa910cad1d994b4ec42920",
+		"30818d304906092a864886f70d01050d303c301b06092a864886f70d01050c300e0408fc272c7188e582d102020800301d060960864801" +
+			"65030401020410e1c4e29a5c4e4d50340f6c36aea7b977044087e2584216ae226dd9176a8692e0be2f661335008c040d4c1164754169" +
+			"b46b7f6caec3c88db75331bccd467580372297fb45d8091cb943b5f8350ea9d837f97b",
+	} {
+		der := fromHex(encrypted)
+		if got, err := DecryptPrivateKeyInfo(der, []byte("correct-horse")); err != nil || !bytes.Equal(got, k) {
+			t.Fatal("OpenSSL encrypted key not decrypted", err)
+		}
+		if _, err := DecryptPrivateKeyInfo(der, []byte("battery-staple")); err != ErrIncorrectPassword {
+			t.Fatal("key decrypted with a wrong password", err)
+		}
+	}
+
+	d := dilithium.NewMLDSA44()
+	seed := bytes.Repeat([]byte{7}, dilithium.SEEDBYTES)
+	der, _ := MarshalDilithiumPrivateKey(d, seed, nil)
+	encrypted, err := EncryptPrivateKeyInfo(der, []byte("correct-horse"), 1000, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := DecryptPrivateKeyInfo(encrypted, []byte("correct-horse"))
+	if err != nil || !bytes.Equal(decrypted, der) {
+		t.Fatal("encrypted private key does not round trip", err)
+	}
+	if _, seed2, _, err := ParseDilithiumPrivateKey(decrypted); err != nil || !bytes.Equal(seed2, seed) {
+		t.Fatal("decrypted private key not parsed", err)
+	}
+	if _, err := EncryptPrivateKeyInfo(der, nil, -1, nil); err == nil {
+		t.Fatal("negative iteration count accepted")
+	}
+}
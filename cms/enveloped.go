@@ -0,0 +1,456 @@
+package cms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/kudelskisecurity/crystals-go/internal/keywrap"
+	"github.com/kudelskisecurity/crystals-go/internal/randutil"
+	"golang.org/x/crypto/hkdf"
+)
+
+type kemRecipientInfo struct {
+	Version       int
+	RID           asn1.RawValue
+	KEM           pkix.AlgorithmIdentifier
+	KEMCiphertext []byte
+	KDF           pkix.AlgorithmIdentifier
+	KEKLength     int
+	UKM           []byte `asn1:"optional,explicit,tag:0"`
+	Wrap          pkix.AlgorithmIdentifier
+	EncryptedKey  []byte
+}
+
+type otherRecipientInfo struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+//kemOtherInfo is CMSORIforKEMOtherInfo, the info input of the KDF
+type kemOtherInfo struct {
+	Wrap      pkix.AlgorithmIdentifier
+	KEKLength int
+	UKM       []byte `asn1:"optional,explicit,tag:0"`
+}
+
+type encryptedContentInfo struct {
+	ContentType      asn1.ObjectIdentifier
+	Algorithm        pkix.AlgorithmIdentifier
+	EncryptedContent []byte `asn1:"optional,tag:0"`
+}
+
+type envelopedData struct {
+	Version              int
+	OriginatorInfo       asn1.RawValue   `asn1:"optional,tag:0"`
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+	UnprotectedAttrs     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type authEnvelopedData struct {
+	Version                  int
+	OriginatorInfo           asn1.RawValue   `asn1:"optional,tag:0"`
+	RecipientInfos           []asn1.RawValue `asn1:"set"`
+	AuthEncryptedContentInfo encryptedContentInfo
+	AuthAttrs                asn1.RawValue `asn1:"optional,tag:1"`
+	MAC                      []byte
+	UnauthAttrs              asn1.RawValue `asn1:"optional,tag:2"`
+}
+
+type gcmParameters struct {
+	Nonce  []byte
+	ICVLen int `asn1:"default:12"`
+}
+
+const gcmTagSize = 16
+
+//EncryptOptions are the options of Encrypt and EncryptAuthenticated
+type EncryptOptions struct {
+	//UKM is the optional user keying material, input of the KDF of every recipient
+	UKM []byte
+	//Rand is the source of the content encryption key, of the IV and of the recipient encapsulations, crypto/rand if
+	//nil
+	Rand io.Reader
+}
+
+func (o *EncryptOptions) rand() io.Reader {
+	if o == nil {
+		return randutil.Reader(nil)
+	}
+	return randutil.Reader(o.Rand)
+}
+
+func (o *EncryptOptions) ukm() []byte {
+	if o == nil {
+		return nil
+	}
+	return o.UKM
+}
+
+//kdfHash returns the hash function of an HKDF algorithm identifier
+func kdfHash(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	switch {
+	case oid.Equal(oidHKDFSHA256):
+		return crypto.SHA256, true
+	case oid.Equal(oidHKDFSHA384):
+		return crypto.SHA384, true
+	case oid.Equal(oidHKDFSHA512):
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+//wrapKEKLength returns the key size of an AES key wrap algorithm identifier
+func wrapKEKLength(oid asn1.ObjectIdentifier) int {
+	switch {
+	case oid.Equal(oidAES128Wrap):
+		return 16
+	case oid.Equal(oidAES192Wrap):
+		return 24
+	case oid.Equal(oidAES256Wrap):
+		return 32
+	}
+	return 0
+}
+
+//deriveKEK computes the key-encryption key from the KEM shared secret with HKDF, an empty salt and the DER encoding of
+//CMSORIforKEMOtherInfo as info
+func deriveKEK(ri *kemRecipientInfo, ss []byte) ([]byte, error) {
+	h, ok := kdfHash(ri.KDF.Algorithm)
+	if !ok || len(ri.KDF.Parameters.FullBytes) != 0 {
+		return nil, errors.New("cms: unsupported key derivation algorithm")
+	}
+	if ri.KEKLength != wrapKEKLength(ri.Wrap.Algorithm) || len(ri.Wrap.Parameters.FullBytes) != 0 {
+		return nil, errors.New("cms: unsupported key wrap algorithm")
+	}
+	info, err := asn1.Marshal(kemOtherInfo{Wrap: ri.Wrap, KEKLength: ri.KEKLength, UKM: ri.UKM})
+	if err != nil {
+		return nil, err
+	}
+	kek := make([]byte, ri.KEKLength)
+	if _, err := io.ReadFull(hkdf.New(h.New, ss, nil, info), kek); err != nil {
+		return nil, err
+	}
+	return kek, nil
+}
+
+//newRecipientInfo encapsulates to a recipient and wraps the content-encryption key. ML-KEM-512 recipients use AES-128
+//key wrap and the others AES-256 key wrap, with HKDF-SHA256 as in RFC 9936.
+func newRecipientInfo(r *Recipient, cek, ukm []byte, rand io.Reader) (asn1.RawValue, error) {
+	oid, err := kemOID(r.KEM)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	rid, err := certIdentifier(r.Certificate, r.SubjectKeyID)
+	if err != nil || rid == nil {
+		return asn1.RawValue{}, errors.New("cms: recipients need a certificate or a subject key identifier")
+	}
+	coins := make([]byte, 32)
+	if _, err := io.ReadFull(rand, coins); err != nil {
+		return asn1.RawValue{}, err
+	}
+	ct, ss := r.KEM.Encaps(r.PublicKey, coins)
+	if ct == nil {
+		return asn1.RawValue{}, errors.New("cms: invalid recipient public key")
+	}
+	ri := &kemRecipientInfo{
+		RID:           asn1.RawValue{FullBytes: rid},
+		KEM:           pkix.AlgorithmIdentifier{Algorithm: oid},
+		KEMCiphertext: ct,
+		KDF:           pkix.AlgorithmIdentifier{Algorithm: oidHKDFSHA256},
+		KEKLength:     32,
+		UKM:           ukm,
+		Wrap:          pkix.AlgorithmIdentifier{Algorithm: oidAES256Wrap},
+	}
+	if r.KEM.Name == "ML-KEM-512" {
+		ri.KEKLength, ri.Wrap.Algorithm = 16, oidAES128Wrap
+	}
+	kek, err := deriveKEK(ri, ss)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	if ri.EncryptedKey, err = keywrap.Wrap(kek, cek); err != nil {
+		return asn1.RawValue{}, err
+	}
+	value, err := asn1.Marshal(*ri)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	ori, err := asn1.Marshal(otherRecipientInfo{Type: oidOtherRecipientKEM, Value: asn1.RawValue{FullBytes: value}})
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	//the ori alternative of RecipientInfo is [4] IMPLICIT OtherRecipientInfo
+	return asn1.RawValue{FullBytes: retag(ori, 0xa4)}, nil
+}
+
+func recipientInfos(recipients []*Recipient, cek []byte, opts *EncryptOptions) ([]asn1.RawValue, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("cms: no recipients")
+	}
+	var ris []asn1.RawValue
+	for _, r := range recipients {
+		ri, err := newRecipientInfo(r, cek, opts.ukm(), opts.rand())
+		if err != nil {
+			return nil, err
+		}
+		ris = append(ris, ri)
+	}
+	return ris, nil
+}
+
+//Encrypt returns an EnvelopedData message of type id-data, encrypted with AES-256-CBC for the recipients
+func Encrypt(content []byte, recipients []*Recipient, opts *EncryptOptions) ([]byte, error) {
+	cek := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(opts.rand(), cek); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(opts.rand(), iv); err != nil {
+		return nil, err
+	}
+	ris, err := recipientInfos(recipients, cek, opts)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := aes.NewCipher(cek)
+	n := aes.BlockSize - len(content)%aes.BlockSize
+	ciphertext := append(append([]byte{}, content...), bytes.Repeat([]byte{byte(n)}, n)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+	params, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	//the version is 3 because of the ori recipient infos
+	ed, err := asn1.Marshal(envelopedData{
+		Version:        3,
+		RecipientInfos: ris,
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:      OIDData,
+			Algorithm:        pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: params}},
+			EncryptedContent: ciphertext,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return marshalContentInfo(OIDEnvelopedData, ed)
+}
+
+//EncryptAuthenticated returns an AuthEnvelopedData message of type id-data, encrypted with AES-256-GCM for the
+//recipients
+func EncryptAuthenticated(content []byte, recipients []*Recipient, opts *EncryptOptions) ([]byte, error) {
+	cek := make([]byte, 32)
+	nonce := make([]byte, 12)
+	if _, err := io.ReadFull(opts.rand(), cek); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(opts.rand(), nonce); err != nil {
+		return nil, err
+	}
+	ris, err := recipientInfos(recipients, cek, opts)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := aes.NewCipher(cek)
+	aead, _ := cipher.NewGCM(block)
+	sealed := aead.Seal(nil, nonce, content, nil)
+	params, err := asn1.Marshal(gcmParameters{Nonce: nonce, ICVLen: gcmTagSize})
+	if err != nil {
+		return nil, err
+	}
+	ad, err := asn1.Marshal(authEnvelopedData{
+		RecipientInfos: ris,
+		AuthEncryptedContentInfo: encryptedContentInfo{
+			ContentType:      OIDData,
+			Algorithm:        pkix.AlgorithmIdentifier{Algorithm: oidAES256GCM, Parameters: asn1.RawValue{FullBytes: params}},
+			EncryptedContent: sealed[:len(sealed)-gcmTagSize],
+		},
+		MAC: sealed[len(sealed)-gcmTagSize:],
+	})
+	if err != nil {
+		return nil, err
+	}
+	return marshalContentInfo(OIDAuthEnvelopedData, ad)
+}
+
+//KEMRecipientInfo describes a recipient of a message
+type KEMRecipientInfo struct {
+	//Issuer (DER encoded Name) and SerialNumber, or SubjectKeyID, identify the recipient
+	Issuer       []byte
+	SerialNumber *big.Int
+	SubjectKeyID []byte
+	//KEM is the name of the KEM, for example "ML-KEM-768"
+	KEM string
+	UKM []byte
+
+	ri *kemRecipientInfo
+}
+
+//EnvelopedMessage is a parsed EnvelopedData or AuthEnvelopedData message
+type EnvelopedMessage struct {
+	Authenticated bool
+	//ContentType is the type of the encrypted content, OIDData for messages created by this package
+	ContentType asn1.ObjectIdentifier
+	//Recipients are the KEM recipients of the message, other types of recipients are ignored
+	Recipients []*KEMRecipientInfo
+
+	algorithm pkix.AlgorithmIdentifier
+	encrypted []byte
+	mac       []byte
+	authAttrs []byte
+}
+
+//ParseEnveloped decodes an EnvelopedData or AuthEnvelopedData message
+func ParseEnveloped(der []byte) (*EnvelopedMessage, error) {
+	contentType, content, err := parseContentInfo(der)
+	if err != nil {
+		return nil, err
+	}
+	m := &EnvelopedMessage{}
+	var ris []asn1.RawValue
+	var eci encryptedContentInfo
+	switch {
+	case contentType.Equal(OIDEnvelopedData):
+		var ed envelopedData
+		if err := unmarshalDER(content, &ed, "EnvelopedData"); err != nil {
+			return nil, err
+		}
+		ris, eci = ed.RecipientInfos, ed.EncryptedContentInfo
+	case contentType.Equal(OIDAuthEnvelopedData):
+		var ad authEnvelopedData
+		if err := unmarshalDER(content, &ad, "AuthEnvelopedData"); err != nil {
+			return nil, err
+		}
+		ris, eci = ad.RecipientInfos, ad.AuthEncryptedContentInfo
+		m.Authenticated, m.mac = true, ad.MAC
+		if len(ad.AuthAttrs.FullBytes) != 0 {
+			//authenticated attributes are authenticated with their SET OF tag
+			m.authAttrs = retag(ad.AuthAttrs.FullBytes, 0x31)
+		}
+	default:
+		return nil, errors.New("cms: not an EnvelopedData or AuthEnvelopedData message")
+	}
+	m.ContentType, m.algorithm, m.encrypted = eci.ContentType, eci.Algorithm, eci.EncryptedContent
+	if m.encrypted == nil {
+		return nil, errors.New("cms: detached encrypted content is not supported")
+	}
+	for _, raw := range ris {
+		if raw.Class != asn1.ClassContextSpecific || raw.Tag != 4 {
+			continue
+		}
+		var ori otherRecipientInfo
+		if err := unmarshalDER(retag(raw.FullBytes, 0x30), &ori, "OtherRecipientInfo"); err != nil {
+			return nil, err
+		}
+		if !ori.Type.Equal(oidOtherRecipientKEM) {
+			continue
+		}
+		ri := &kemRecipientInfo{}
+		if err := unmarshalDER(ori.Value.FullBytes, ri, "KEMRecipientInfo"); err != nil {
+			return nil, err
+		}
+		if ri.Version != 0 {
+			return nil, errors.New("cms: unsupported KEMRecipientInfo version")
+		}
+		info := &KEMRecipientInfo{UKM: ri.UKM, ri: ri}
+		if k := kemFromOID(ri.KEM.Algorithm); k != nil {
+			info.KEM = k.Name
+		}
+		if ri.RID.Class == asn1.ClassContextSpecific && ri.RID.Tag == 0 {
+			info.SubjectKeyID = ri.RID.Bytes
+		} else {
+			var ias issuerAndSerialNumber
+			if err := unmarshalDER(ri.RID.FullBytes, &ias, "RecipientIdentifier"); err != nil {
+				return nil, err
+			}
+			info.Issuer, info.SerialNumber = ias.Issuer.FullBytes, ias.SerialNumber
+		}
+		m.Recipients = append(m.Recipients, info)
+	}
+	return m, nil
+}
+
+//Decrypt decrypts the content with the key of a recipient
+func (m *EnvelopedMessage) Decrypt(key *RecipientKey) ([]byte, error) {
+	found := false
+	for _, info := range m.Recipients {
+		if !key.matches(info.ri) {
+			continue
+		}
+		found = true
+		ss := key.KEM.Decaps(key.PrivateKey, info.ri.KEMCiphertext)
+		if ss == nil {
+			continue
+		}
+		kek, err := deriveKEK(info.ri, ss)
+		if err != nil {
+			return nil, err
+		}
+		//ML-KEM decapsulation rejects implicitly, a wrong key is detected by the key unwrap
+		cek, err := keywrap.Unwrap(kek, info.ri.EncryptedKey)
+		if err != nil {
+			continue
+		}
+		return m.decryptContent(cek)
+	}
+	if !found {
+		return nil, errors.New("cms: no recipient matches the key")
+	}
+	return nil, errors.New("cms: failed to decrypt the content-encryption key")
+}
+
+func (m *EnvelopedMessage) decryptContent(cek []byte) ([]byte, error) {
+	alg := m.algorithm.Algorithm
+	if m.Authenticated {
+		if !alg.Equal(oidAES128GCM) && !alg.Equal(oidAES256GCM) {
+			return nil, errors.New("cms: unsupported content-encryption algorithm")
+		}
+		var params gcmParameters
+		if err := unmarshalDER(m.algorithm.Parameters.FullBytes, &params, "GCMParameters"); err != nil {
+			return nil, err
+		}
+		if len(params.Nonce) != 12 || params.ICVLen != len(m.mac) || params.ICVLen < 12 || params.ICVLen > 16 {
+			return nil, errors.New("cms: unsupported GCM parameters")
+		}
+		block, err := aes.NewCipher(cek)
+		if err != nil || (alg.Equal(oidAES256GCM) != (len(cek) == 32)) {
+			return nil, errors.New("cms: invalid content-encryption key")
+		}
+		aead, _ := cipher.NewGCMWithTagSize(block, params.ICVLen)
+		content, err := aead.Open(nil, params.Nonce, append(append([]byte{}, m.encrypted...), m.mac...), m.authAttrs)
+		if err != nil {
+			return nil, errors.New("cms: message authentication failed")
+		}
+		return content, nil
+	}
+
+	if !alg.Equal(oidAES128CBC) && !alg.Equal(oidAES256CBC) {
+		return nil, errors.New("cms: unsupported content-encryption algorithm")
+	}
+	var iv []byte
+	if err := unmarshalDER(m.algorithm.Parameters.FullBytes, &iv, "CBC parameters"); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil || (alg.Equal(oidAES256CBC) != (len(cek) == 32)) {
+		return nil, errors.New("cms: invalid content-encryption key")
+	}
+	if len(iv) != aes.BlockSize || len(m.encrypted) == 0 || len(m.encrypted)%aes.BlockSize != 0 {
+		return nil, errors.New("cms: malformed encrypted content")
+	}
+	content := make([]byte, len(m.encrypted))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(content, m.encrypted)
+	n := int(content[len(content)-1])
+	if n == 0 || n > aes.BlockSize || !bytes.Equal(content[len(content)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, errors.New("cms: invalid padding")
+	}
+	return content[:len(content)-n], nil
+}
@@ -0,0 +1,131 @@
+package cms
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+)
+
+//Algorithm identifiers of ML-KEM, whose parameters are absent. Round 3 Kyber has no CMS identifier.
+var kemOIDs = map[string]asn1.ObjectIdentifier{
+	"ML-KEM-512":  {2, 16, 840, 1, 101, 3, 4, 4, 1},
+	"ML-KEM-768":  {2, 16, 840, 1, 101, 3, 4, 4, 2},
+	"ML-KEM-1024": {2, 16, 840, 1, 101, 3, 4, 4, 3},
+}
+
+func kemOID(k *kyber.Kyber) (asn1.ObjectIdentifier, error) {
+	if oid, ok := kemOIDs[k.Name]; ok {
+		return oid, nil
+	}
+	return nil, errors.New("cms: no algorithm identifier for " + k.Name)
+}
+
+func kemFromOID(oid asn1.ObjectIdentifier) *kyber.Kyber {
+	switch {
+	case oid.Equal(kemOIDs["ML-KEM-512"]):
+		return kyber.NewMLKEM512()
+	case oid.Equal(kemOIDs["ML-KEM-768"]):
+		return kyber.NewMLKEM768()
+	case oid.Equal(kemOIDs["ML-KEM-1024"]):
+		return kyber.NewMLKEM1024()
+	}
+	return nil
+}
+
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+//MarshalKEMPublicKey returns the SubjectPublicKeyInfo of an ML-KEM encapsulation key, as found in certificates
+func MarshalKEMPublicKey(k *kyber.Kyber, pk []byte) ([]byte, error) {
+	oid, err := kemOID(k)
+	if err != nil {
+		return nil, err
+	}
+	if len(pk) != k.SIZEPK() {
+		return nil, errors.New("cms: invalid public key length")
+	}
+	return asn1.Marshal(subjectPublicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oid},
+		PublicKey: asn1.BitString{Bytes: pk, BitLength: 8 * len(pk)},
+	})
+}
+
+//ParseKEMPublicKey decodes the SubjectPublicKeyInfo of an ML-KEM encapsulation key
+func ParseKEMPublicKey(der []byte) (*kyber.Kyber, []byte, error) {
+	var spki subjectPublicKeyInfo
+	if err := unmarshalDER(der, &spki, "SubjectPublicKeyInfo"); err != nil {
+		return nil, nil, err
+	}
+	k := kemFromOID(spki.Algorithm.Algorithm)
+	if k == nil || len(spki.Algorithm.Parameters.FullBytes) != 0 {
+		return nil, nil, errors.New("cms: not an ML-KEM public key")
+	}
+	pk := spki.PublicKey.RightAlign()
+	if spki.PublicKey.BitLength%8 != 0 || len(pk) != k.SIZEPK() {
+		return nil, nil, errors.New("cms: invalid ML-KEM public key")
+	}
+	return k, pk, nil
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+//certIdentifier encodes the RecipientIdentifier or SignerIdentifier of a certificate or of a subject key identifier
+func certIdentifier(cert *x509.Certificate, ski []byte) ([]byte, error) {
+	if cert != nil {
+		return asn1.Marshal(issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, SerialNumber: cert.SerialNumber})
+	}
+	if len(ski) != 0 {
+		return asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: ski})
+	}
+	return nil, nil
+}
+
+//Recipient is the encapsulation key of a recipient and the identifier written in its KEMRecipientInfo: the issuer and
+//serial number of Certificate if set, SubjectKeyID otherwise
+type Recipient struct {
+	KEM          *kyber.Kyber
+	PublicKey    []byte
+	Certificate  *x509.Certificate
+	SubjectKeyID []byte
+}
+
+//NewRecipient returns the recipient of a certificate carrying an ML-KEM key, identified by issuer and serial number
+func NewRecipient(cert *x509.Certificate) (*Recipient, error) {
+	k, pk, err := ParseKEMPublicKey(cert.RawSubjectPublicKeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	return &Recipient{KEM: k, PublicKey: pk, Certificate: cert}, nil
+}
+
+//RecipientKey is the decapsulation key of a recipient. If Certificate or SubjectKeyID is set, only the
+//KEMRecipientInfo structures with the same identifier are tried, otherwise all those of the same KEM are.
+type RecipientKey struct {
+	KEM          *kyber.Kyber
+	PrivateKey   []byte
+	Certificate  *x509.Certificate
+	SubjectKeyID []byte
+}
+
+//matches reports whether a KEMRecipientInfo may be for the key
+func (k *RecipientKey) matches(ri *kemRecipientInfo) bool {
+	oid, err := kemOID(k.KEM)
+	if err != nil || !ri.KEM.Algorithm.Equal(oid) {
+		return false
+	}
+	rid, err := certIdentifier(k.Certificate, k.SubjectKeyID)
+	if err != nil {
+		return false
+	}
+	return rid == nil || bytes.Equal(rid, ri.RID.FullBytes)
+}
@@ -0,0 +1,233 @@
+package cms
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"hash"
+	"io"
+
+	"github.com/kudelskisecurity/crystals-go/internal/randutil"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+//Password-based encryption algorithm identifiers of PKCS #5 (RFC 8018) and of scrypt (RFC 7914)
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+)
+
+const (
+	//DefaultPBKDF2Iterations is the iteration count of PBKDF2-HMAC-SHA256 used by EncryptPrivateKeyInfo
+	DefaultPBKDF2Iterations = 600000
+	//maxPBKDF2Iterations and maxScryptWork bound the work of decrypting a key, 128 N r p for scrypt
+	maxPBKDF2Iterations = 1 << 24
+	maxScryptWork       = 1 << 30
+)
+
+//ErrIncorrectPassword is returned when an EncryptedPrivateKeyInfo does not decrypt to a PrivateKeyInfo
+var ErrIncorrectPassword = errors.New("cms: incorrect password")
+
+//encryptedPrivateKeyInfo is the EncryptedPrivateKeyInfo of PKCS #8 (RFC 5958)
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+//pbkdf2Params has the specified salt only, the otherSource alternative being reserved
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+//prfHash returns the hash of a PBKDF2 pseudorandom function, HMAC-SHA1 when absent
+func prfHash(prf pkix.AlgorithmIdentifier) func() hash.Hash {
+	if len(prf.Parameters.FullBytes) != 0 && !bytes.Equal(prf.Parameters.FullBytes, asn1.NullBytes) {
+		return nil
+	}
+	switch {
+	case prf.Algorithm == nil, prf.Algorithm.Equal(oidHMACWithSHA1):
+		return sha1.New
+	case prf.Algorithm.Equal(oidHMACWithSHA224):
+		return sha256.New224
+	case prf.Algorithm.Equal(oidHMACWithSHA256):
+		return sha256.New
+	case prf.Algorithm.Equal(oidHMACWithSHA384):
+		return sha512.New384
+	case prf.Algorithm.Equal(oidHMACWithSHA512):
+		return sha512.New
+	}
+	return nil
+}
+
+//EncryptPrivateKeyInfo encrypts a PKCS #8 PrivateKeyInfo, as returned by MarshalDilithiumPrivateKey or
+//MarshalKEMPrivateKey, with a password and returns the EncryptedPrivateKeyInfo. The key is encrypted with PBES2
+//using PBKDF2-HMAC-SHA256 with a 16-byte salt and AES-256-CBC, the default of OpenSSL, with the given number of
+//iterations or DefaultPBKDF2Iterations if 0. random defaults to crypto/rand.
+func EncryptPrivateKeyInfo(der, password []byte, iterations int, random io.Reader) ([]byte, error) {
+	random = randutil.Reader(random)
+	if iterations == 0 {
+		iterations = DefaultPBKDF2Iterations
+	}
+	if iterations < 0 || iterations > maxPBKDF2Iterations {
+		return nil, errors.New("cms: invalid PBKDF2 iteration count")
+	}
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(random, salt); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(random, iv); err != nil {
+		return nil, err
+	}
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: iterations,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivParams, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParams}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := aes.NewCipher(pbkdf2.Key(password, salt, iterations, 32, sha256.New))
+	n := aes.BlockSize - len(der)%aes.BlockSize
+	ciphertext := append(append([]byte{}, der...), bytes.Repeat([]byte{byte(n)}, n)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: ciphertext,
+	})
+}
+
+//DecryptPrivateKeyInfo decrypts a PKCS #8 EncryptedPrivateKeyInfo with a password and returns the PrivateKeyInfo, to
+//be parsed with ParseDilithiumPrivateKey or ParseKEMPrivateKey. The encryption scheme must be PBES2 with PBKDF2 (any
+//HMAC-SHA1 or SHA-2 pseudorandom function) or scrypt, and AES-CBC, as written by OpenSSL and most libraries. The
+//older PBES1 schemes are not supported. ErrIncorrectPassword is returned if the key does not decrypt.
+func DecryptPrivateKeyInfo(der, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if err := unmarshalDER(der, &info, "EncryptedPrivateKeyInfo"); err != nil {
+		return nil, err
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errors.New("cms: unsupported password-based encryption scheme, expected PBES2")
+	}
+	var params pbes2Params
+	if err := unmarshalDER(info.Algorithm.Parameters.FullBytes, &params, "PBES2 parameters"); err != nil {
+		return nil, err
+	}
+
+	var keyLength int
+	scheme := params.EncryptionScheme.Algorithm
+	switch {
+	case scheme.Equal(oidAES128CBC):
+		keyLength = 16
+	case scheme.Equal(oidAES192CBC):
+		keyLength = 24
+	case scheme.Equal(oidAES256CBC):
+		keyLength = 32
+	default:
+		return nil, errors.New("cms: unsupported PBES2 encryption scheme")
+	}
+	var iv []byte
+	if err := unmarshalDER(params.EncryptionScheme.Parameters.FullBytes, &iv, "CBC parameters"); err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize || len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, errors.New("cms: malformed encrypted private key")
+	}
+
+	key, err := deriveKey(params.KeyDerivationFunc, password, keyLength)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := aes.NewCipher(key)
+	content := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(content, info.EncryptedData)
+	n := int(content[len(content)-1])
+	if n == 0 || n > aes.BlockSize || !hmac.Equal(content[len(content)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, ErrIncorrectPassword
+	}
+	content = content[:len(content)-n]
+	var raw asn1.RawValue
+	if rest, err := asn1.Unmarshal(content, &raw); err != nil || len(rest) != 0 || raw.Tag != asn1.TagSequence {
+		return nil, ErrIncorrectPassword
+	}
+	return content, nil
+}
+
+//deriveKey derives a key of keyLength bytes with the PBKDF2 or scrypt key derivation function of PBES2
+func deriveKey(kdf pkix.AlgorithmIdentifier, password []byte, keyLength int) ([]byte, error) {
+	switch {
+	case kdf.Algorithm.Equal(oidPBKDF2):
+		var p pbkdf2Params
+		if err := unmarshalDER(kdf.Parameters.FullBytes, &p, "PBKDF2 parameters"); err != nil {
+			return nil, err
+		}
+		h := prfHash(p.PRF)
+		if h == nil {
+			return nil, errors.New("cms: unsupported PBKDF2 pseudorandom function")
+		}
+		if p.KeyLength != 0 && p.KeyLength != keyLength {
+			return nil, errors.New("cms: PBKDF2 key length does not match the encryption scheme")
+		}
+		if p.IterationCount <= 0 || p.IterationCount > maxPBKDF2Iterations {
+			return nil, errors.New("cms: unsupported PBKDF2 iteration count")
+		}
+		return pbkdf2.Key(password, p.Salt, p.IterationCount, keyLength, h), nil
+	case kdf.Algorithm.Equal(oidScrypt):
+		var p scryptParams
+		if err := unmarshalDER(kdf.Parameters.FullBytes, &p, "scrypt parameters"); err != nil {
+			return nil, err
+		}
+		if p.KeyLength != 0 && p.KeyLength != keyLength {
+			return nil, errors.New("cms: scrypt key length does not match the encryption scheme")
+		}
+		if p.BlockSize <= 0 || p.ParallelizationParameter <= 0 || p.CostParameter <= 1 ||
+			p.CostParameter > maxScryptWork/128/p.BlockSize/p.ParallelizationParameter {
+			return nil, errors.New("cms: unsupported scrypt parameters")
+		}
+		return scrypt.Key(password, p.Salt, p.CostParameter, p.BlockSize, p.ParallelizationParameter, keyLength)
+	}
+	return nil, errors.New("cms: unsupported PBES2 key derivation function")
+}
@@ -0,0 +1,157 @@
+package cms
+
+import (
+	"crypto/subtle"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+)
+
+//privateKeyInfo is the PrivateKeyInfo of PKCS #8 (RFC 5208). The optional attributes and public key of
+//OneAsymmetricKey (RFC 5958) are ignored when parsing.
+type privateKeyInfo struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+//bothPrivateKey is the "both" alternative of the private key formats of RFC 9881 and RFC 9935
+type bothPrivateKey struct {
+	Seed        []byte
+	ExpandedKey []byte
+}
+
+//marshalPrivateKey encodes a private key as the seed, the expanded key, or both if both are given:
+//
+//	PrivateKey ::= CHOICE {
+//	    seed        [0] IMPLICIT OCTET STRING,
+//	    expandedKey OCTET STRING,
+//	    both        SEQUENCE { seed OCTET STRING, expandedKey OCTET STRING } }
+func marshalPrivateKey(oid asn1.ObjectIdentifier, seed, sk []byte) ([]byte, error) {
+	var key []byte
+	var err error
+	switch {
+	case seed != nil && sk != nil:
+		key, err = asn1.Marshal(bothPrivateKey{seed, sk})
+	case seed != nil:
+		key, err = asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: seed})
+	case sk != nil:
+		key, err = asn1.Marshal(sk)
+	default:
+		return nil, errors.New("cms: no private key")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(privateKeyInfo{Algorithm: pkix.AlgorithmIdentifier{Algorithm: oid}, PrivateKey: key})
+}
+
+//parsePrivateKey decodes a PrivateKeyInfo and returns its algorithm, seed and expanded key, nil when absent
+func parsePrivateKey(der []byte) (asn1.ObjectIdentifier, []byte, []byte, error) {
+	var info privateKeyInfo
+	if err := unmarshalDER(der, &info, "PrivateKeyInfo"); err != nil {
+		return nil, nil, nil, err
+	}
+	if info.Version != 0 && info.Version != 1 || len(info.Algorithm.Parameters.FullBytes) != 0 {
+		return nil, nil, nil, errors.New("cms: unsupported PrivateKeyInfo")
+	}
+	var raw asn1.RawValue
+	if err := unmarshalDER(info.PrivateKey, &raw, "private key"); err != nil {
+		return nil, nil, nil, err
+	}
+	switch {
+	case raw.Class == asn1.ClassContextSpecific && raw.Tag == 0 && !raw.IsCompound:
+		return info.Algorithm.Algorithm, raw.Bytes, nil, nil
+	case raw.Class == asn1.ClassUniversal && raw.Tag == asn1.TagOctetString:
+		return info.Algorithm.Algorithm, nil, raw.Bytes, nil
+	case raw.Class == asn1.ClassUniversal && raw.Tag == asn1.TagSequence:
+		var both bothPrivateKey
+		if err := unmarshalDER(info.PrivateKey, &both, "private key"); err != nil {
+			return nil, nil, nil, err
+		}
+		return info.Algorithm.Algorithm, both.Seed, both.ExpandedKey, nil
+	}
+	return nil, nil, nil, errors.New("cms: malformed private key")
+}
+
+//MarshalDilithiumPrivateKey returns the PKCS #8 PrivateKeyInfo of an ML-DSA private key in the format of RFC 9881:
+//the 32-byte seed, the expanded private key of the dilithium package, or both if both are given. Round 3 Dilithium
+//has no private key format.
+func MarshalDilithiumPrivateKey(d *dilithium.Dilithium, seed, sk []byte) ([]byte, error) {
+	oid, err := dilithiumOID(d)
+	if err != nil || !d.IsMLDSA() {
+		return nil, errors.New("cms: no private key format for " + d.Name)
+	}
+	if seed != nil && len(seed) != dilithium.SEEDBYTES || sk != nil && len(sk) != d.SIZESK() {
+		return nil, errors.New("cms: invalid private key length")
+	}
+	return marshalPrivateKey(oid, seed, sk)
+}
+
+//ParseDilithiumPrivateKey decodes the PKCS #8 PrivateKeyInfo of an ML-DSA private key. It returns the seed, nil if
+//the key is only expanded, and the expanded private key, generated from the seed if absent. When both are present
+//they must match.
+func ParseDilithiumPrivateKey(der []byte) (*dilithium.Dilithium, []byte, []byte, error) {
+	oid, seed, sk, err := parsePrivateKey(der)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	d := dilithiumFromOID(oid)
+	if d == nil || !d.IsMLDSA() {
+		return nil, nil, nil, errors.New("cms: not an ML-DSA private key")
+	}
+	if seed != nil && len(seed) != dilithium.SEEDBYTES || sk != nil && len(sk) != d.SIZESK() {
+		return nil, nil, nil, errors.New("cms: invalid ML-DSA private key")
+	}
+	if seed != nil {
+		_, expanded := d.KeyGen(seed)
+		if sk != nil && subtle.ConstantTimeCompare(sk, expanded) != 1 {
+			return nil, nil, nil, errors.New("cms: ML-DSA seed and expanded key do not match")
+		}
+		sk = expanded
+	}
+	return d, seed, sk, nil
+}
+
+//MarshalKEMPrivateKey returns the PKCS #8 PrivateKeyInfo of an ML-KEM decapsulation key in the format of RFC 9935:
+//the 64-byte seed (d || z), the expanded private key of the kyber package, or both if both are given
+func MarshalKEMPrivateKey(k *kyber.Kyber, seed, sk []byte) ([]byte, error) {
+	oid, err := kemOID(k)
+	if err != nil {
+		return nil, err
+	}
+	if seed != nil && len(seed) != kyber.SEEDBYTES+kyber.SIZEZ || sk != nil && len(sk) != k.SIZESK() {
+		return nil, errors.New("cms: invalid private key length")
+	}
+	return marshalPrivateKey(oid, seed, sk)
+}
+
+//ParseKEMPrivateKey decodes the PKCS #8 PrivateKeyInfo of an ML-KEM decapsulation key. It returns the seed, nil if
+//the key is only expanded, and the expanded private key, generated from the seed if absent. When both are present
+//they must match. The hash of the encapsulation key embedded in an expanded key is checked.
+func ParseKEMPrivateKey(der []byte) (*kyber.Kyber, []byte, []byte, error) {
+	oid, seed, sk, err := parsePrivateKey(der)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	k := kemFromOID(oid)
+	if k == nil {
+		return nil, nil, nil, errors.New("cms: not an ML-KEM private key")
+	}
+	if seed != nil && len(seed) != kyber.SEEDBYTES+kyber.SIZEZ || sk != nil && len(sk) != k.SIZESK() {
+		return nil, nil, nil, errors.New("cms: invalid ML-KEM private key")
+	}
+	if seed != nil {
+		_, expanded := k.KeyGen(seed)
+		if sk != nil && subtle.ConstantTimeCompare(sk, expanded) != 1 {
+			return nil, nil, nil, errors.New("cms: ML-KEM seed and expanded key do not match")
+		}
+		sk = expanded
+	} else if subtle.ConstantTimeCompare(k.PackSK(k.UnpackSK(sk)), sk) != 1 {
+		return nil, nil, nil, errors.New("cms: inconsistent ML-KEM private key")
+	}
+	return k, seed, sk, nil
+}
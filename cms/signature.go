@@ -0,0 +1,164 @@
+package cms
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+)
+
+//Algorithm identifiers of ML-DSA (RFC 9882) and round 3 Dilithium, whose parameters are absent. The round 3
+//identifiers are the experimental ones of the Open Quantum Safe project.
+var dilithiumOIDs = map[string]asn1.ObjectIdentifier{
+	"ML-DSA-44":  {2, 16, 840, 1, 101, 3, 4, 3, 17},
+	"ML-DSA-65":  {2, 16, 840, 1, 101, 3, 4, 3, 18},
+	"ML-DSA-87":  {2, 16, 840, 1, 101, 3, 4, 3, 19},
+	"Dilithium2": {1, 3, 6, 1, 4, 1, 2, 267, 7, 4, 4},
+	"Dilithium3": {1, 3, 6, 1, 4, 1, 2, 267, 7, 6, 5},
+	"Dilithium5": {1, 3, 6, 1, 4, 1, 2, 267, 7, 8, 7},
+}
+
+var dilithiumConstructors = map[string]func(...bool) *dilithium.Dilithium{
+	"ML-DSA-44":  dilithium.NewMLDSA44,
+	"ML-DSA-65":  dilithium.NewMLDSA65,
+	"ML-DSA-87":  dilithium.NewMLDSA87,
+	"Dilithium2": dilithium.NewDilithium2,
+	"Dilithium3": dilithium.NewDilithium3,
+	"Dilithium5": dilithium.NewDilithium5,
+}
+
+func dilithiumOID(d *dilithium.Dilithium) (asn1.ObjectIdentifier, error) {
+	if oid, ok := dilithiumOIDs[d.Name]; ok {
+		return oid, nil
+	}
+	return nil, errors.New("cms: no algorithm identifier for " + d.Name)
+}
+
+func dilithiumFromOID(oid asn1.ObjectIdentifier) *dilithium.Dilithium {
+	for name, id := range dilithiumOIDs {
+		if id.Equal(oid) {
+			return dilithiumConstructors[name]()
+		}
+	}
+	return nil
+}
+
+//MarshalDilithiumPublicKey returns the SubjectPublicKeyInfo of an ML-DSA or Dilithium public key
+func MarshalDilithiumPublicKey(d *dilithium.Dilithium, pk []byte) ([]byte, error) {
+	oid, err := dilithiumOID(d)
+	if err != nil {
+		return nil, err
+	}
+	if len(pk) != d.SIZEPK() {
+		return nil, errors.New("cms: invalid public key length")
+	}
+	return asn1.Marshal(subjectPublicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oid},
+		PublicKey: asn1.BitString{Bytes: pk, BitLength: 8 * len(pk)},
+	})
+}
+
+//ParseDilithiumPublicKey decodes the SubjectPublicKeyInfo of an ML-DSA or Dilithium public key
+func ParseDilithiumPublicKey(der []byte) (*dilithium.Dilithium, []byte, error) {
+	var spki subjectPublicKeyInfo
+	if err := unmarshalDER(der, &spki, "SubjectPublicKeyInfo"); err != nil {
+		return nil, nil, err
+	}
+	d := dilithiumFromOID(spki.Algorithm.Algorithm)
+	if d == nil || len(spki.Algorithm.Parameters.FullBytes) != 0 {
+		return nil, nil, errors.New("cms: not an ML-DSA or Dilithium public key")
+	}
+	pk := spki.PublicKey.RightAlign()
+	if spki.PublicKey.BitLength%8 != 0 || len(pk) != d.SIZEPK() {
+		return nil, nil, errors.New("cms: invalid ML-DSA or Dilithium public key")
+	}
+	return d, pk, nil
+}
+
+//Digest algorithms
+var (
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+func digestHash(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	switch {
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, true
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, true
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+//Classical signature algorithms, checked with crypto/x509
+var (
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+//x509Algorithm returns the crypto/x509 algorithm of a classical signer info. Signer infos often use rsaEncryption
+//as signature algorithm, the hash is then given by the digest algorithm.
+func x509Algorithm(sig, digest asn1.ObjectIdentifier) x509.SignatureAlgorithm {
+	h, _ := digestHash(digest)
+	switch {
+	case sig.Equal(oidRSAEncryption):
+		switch h {
+		case crypto.SHA256:
+			return x509.SHA256WithRSA
+		case crypto.SHA384:
+			return x509.SHA384WithRSA
+		case crypto.SHA512:
+			return x509.SHA512WithRSA
+		}
+	case sig.Equal(oidSHA256WithRSA):
+		return x509.SHA256WithRSA
+	case sig.Equal(oidSHA384WithRSA):
+		return x509.SHA384WithRSA
+	case sig.Equal(oidSHA512WithRSA):
+		return x509.SHA512WithRSA
+	case sig.Equal(oidECDSAWithSHA256):
+		return x509.ECDSAWithSHA256
+	case sig.Equal(oidECDSAWithSHA384):
+		return x509.ECDSAWithSHA384
+	case sig.Equal(oidECDSAWithSHA512):
+		return x509.ECDSAWithSHA512
+	case sig.Equal(oidEd25519):
+		return x509.PureEd25519
+	}
+	return x509.UnknownSignatureAlgorithm
+}
+
+//checkSignature verifies the signature of a signer info with the key of its certificate
+func checkSignature(cert *x509.Certificate, sigAlg, digestAlg asn1.ObjectIdentifier, signed, sig []byte) error {
+	if d := dilithiumFromOID(sigAlg); d != nil {
+		keyAlg, pk, err := ParseDilithiumPublicKey(cert.RawSubjectPublicKeyInfo)
+		if err != nil {
+			return err
+		}
+		if keyAlg.Name != d.Name {
+			return errors.New("cms: signature algorithm does not match the certificate key")
+		}
+		if !d.Verify(pk, signed, sig) {
+			return errors.New("cms: invalid " + d.Name + " signature")
+		}
+		return nil
+	}
+	alg := x509Algorithm(sigAlg, digestAlg)
+	if alg == x509.UnknownSignatureAlgorithm {
+		return errors.New("cms: unsupported signature algorithm")
+	}
+	return cert.CheckSignature(alg, signed, sig)
+}
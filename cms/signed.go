@@ -0,0 +1,395 @@
+package cms
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"sort"
+	"time"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+)
+
+//OIDSignedData is the content type of SignedData messages
+var OIDSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+//Attributes of signer infos
+var (
+	oidAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttributeSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+)
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+//encapsulatedContentInfo holds the content in an explicitly tagged OCTET STRING, absent for detached signatures
+type encapsulatedContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional,explicit,tag:0"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+//contextSpecific returns the [tag] IMPLICIT encoding of the concatenated elements
+func contextSpecific(tag int, elements ...[]byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: bytes.Join(elements, nil)}
+}
+
+func newAttribute(typ asn1.ObjectIdentifier, value interface{}) ([]byte, error) {
+	v, err := asn1.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(attribute{Type: typ, Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: v}})
+}
+
+//Signer is an ML-DSA or Dilithium private key and its certificate, which is included in the messages. The signer is
+//identified by the issuer and serial number of the certificate, or by its subject key identifier if
+//UseSubjectKeyID is set.
+type Signer struct {
+	Dilithium       *dilithium.Dilithium
+	PrivateKey      []byte
+	Certificate     *x509.Certificate
+	UseSubjectKeyID bool
+}
+
+//SignOptions are the options of Sign
+type SignOptions struct {
+	//ContentType is the type of the signed content, OIDData if nil
+	ContentType asn1.ObjectIdentifier
+	//Detached leaves the content out of the message
+	Detached bool
+	//SigningTime is added as a signed attribute if not zero
+	SigningTime time.Time
+	//Certificates are included in the message in addition to those of the signers, for example intermediate CAs
+	Certificates []*x509.Certificate
+}
+
+//Sign returns a SignedData message where each signer signs the content-type, message-digest and optional
+//signing-time attributes. The digest algorithm is SHA-512, as recommended for ML-DSA by RFC 9882.
+func Sign(content []byte, signers []*Signer, opts *SignOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &SignOptions{}
+	}
+	contentType := opts.ContentType
+	if contentType == nil {
+		contentType = OIDData
+	}
+	if len(signers) == 0 {
+		return nil, errors.New("cms: no signers")
+	}
+	digest := sha512.Sum512(content)
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA512}},
+		EncapContentInfo: encapsulatedContentInfo{ContentType: contentType},
+	}
+	if !contentType.Equal(OIDData) {
+		sd.Version = 3
+	}
+	var certs [][]byte
+	addCert := func(c *x509.Certificate) {
+		for _, raw := range certs {
+			if bytes.Equal(raw, c.Raw) {
+				return
+			}
+		}
+		certs = append(certs, c.Raw)
+	}
+
+	for _, s := range signers {
+		if s.Certificate == nil || len(s.Certificate.Raw) == 0 {
+			return nil, errors.New("cms: signers need a certificate")
+		}
+		sigAlg, err := dilithiumOID(s.Dilithium)
+		if err != nil {
+			return nil, err
+		}
+		si := signerInfo{
+			Version:            1,
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA512},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: sigAlg},
+		}
+		var sid []byte
+		if s.UseSubjectKeyID {
+			if len(s.Certificate.SubjectKeyId) == 0 {
+				return nil, errors.New("cms: certificate without subject key identifier")
+			}
+			si.Version, sd.Version = 3, 3
+			sid, err = certIdentifier(nil, s.Certificate.SubjectKeyId)
+		} else {
+			sid, err = certIdentifier(s.Certificate, nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+		si.SID = asn1.RawValue{FullBytes: sid}
+
+		attrs := make([][]byte, 0, 3)
+		for _, a := range []struct {
+			typ   asn1.ObjectIdentifier
+			value interface{}
+		}{
+			{oidAttributeContentType, contentType},
+			{oidAttributeMessageDigest, digest[:]},
+			{oidAttributeSigningTime, opts.SigningTime.UTC()},
+		} {
+			if a.typ.Equal(oidAttributeSigningTime) && opts.SigningTime.IsZero() {
+				continue
+			}
+			attr, err := newAttribute(a.typ, a.value)
+			if err != nil {
+				return nil, err
+			}
+			attrs = append(attrs, attr)
+		}
+		//DER sorts the elements of a SET OF by their encodings
+		sort.Slice(attrs, func(i, j int) bool { return bytes.Compare(attrs[i], attrs[j]) < 0 })
+		si.SignedAttrs = contextSpecific(0, attrs...)
+		signed, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: si.SignedAttrs.Bytes})
+		if err != nil {
+			return nil, err
+		}
+		if si.Signature = s.Dilithium.Sign(s.PrivateKey, signed); si.Signature == nil {
+			return nil, errors.New("cms: failed to sign with " + s.Dilithium.Name)
+		}
+		sd.SignerInfos = append(sd.SignerInfos, si)
+		addCert(s.Certificate)
+	}
+	for _, c := range opts.Certificates {
+		addCert(c)
+	}
+	sd.Certificates = contextSpecific(0, certs...)
+
+	if !opts.Detached {
+		octets, err := asn1.Marshal(content)
+		if err != nil {
+			return nil, err
+		}
+		sd.EncapContentInfo.Content = contextSpecific(0, octets)
+	}
+	der, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	return marshalContentInfo(OIDSignedData, der)
+}
+
+//SignerInfo describes a signer of a message
+type SignerInfo struct {
+	//Issuer (DER encoded Name) and SerialNumber, or SubjectKeyID, identify the certificate of the signer
+	Issuer             []byte
+	SerialNumber       *big.Int
+	SubjectKeyID       []byte
+	DigestAlgorithm    asn1.ObjectIdentifier
+	SignatureAlgorithm asn1.ObjectIdentifier
+	//SigningTime is the value of the signing-time attribute, zero if absent
+	SigningTime time.Time
+
+	si *signerInfo
+}
+
+//SignedMessage is a parsed SignedData message
+type SignedMessage struct {
+	ContentType asn1.ObjectIdentifier
+	//Content is nil for detached signatures
+	Content      []byte
+	Certificates []*x509.Certificate
+	Signers      []*SignerInfo
+}
+
+//ParseSigned decodes a SignedData message
+func ParseSigned(der []byte) (*SignedMessage, error) {
+	contentType, content, err := parseContentInfo(der)
+	if err != nil {
+		return nil, err
+	}
+	if !contentType.Equal(OIDSignedData) {
+		return nil, errors.New("cms: not a SignedData message")
+	}
+	var sd signedData
+	if err := unmarshalDER(content, &sd, "SignedData"); err != nil {
+		return nil, err
+	}
+	m := &SignedMessage{ContentType: sd.EncapContentInfo.ContentType}
+	if len(sd.EncapContentInfo.Content.FullBytes) != 0 {
+		if err := unmarshalDER(sd.EncapContentInfo.Content.Bytes, &m.Content, "encapsulated content"); err != nil {
+			return nil, err
+		}
+		if m.Content == nil {
+			m.Content = []byte{}
+		}
+	}
+	if len(sd.Certificates.Bytes) != 0 {
+		if m.Certificates, err = x509.ParseCertificates(sd.Certificates.Bytes); err != nil {
+			return nil, err
+		}
+	}
+	for i := range sd.SignerInfos {
+		si := &sd.SignerInfos[i]
+		info := &SignerInfo{DigestAlgorithm: si.DigestAlgorithm.Algorithm, SignatureAlgorithm: si.SignatureAlgorithm.Algorithm, si: si}
+		if si.SID.Class == asn1.ClassContextSpecific && si.SID.Tag == 0 {
+			info.SubjectKeyID = si.SID.Bytes
+		} else {
+			var ias issuerAndSerialNumber
+			if err := unmarshalDER(si.SID.FullBytes, &ias, "SignerIdentifier"); err != nil {
+				return nil, err
+			}
+			info.Issuer, info.SerialNumber = ias.Issuer.FullBytes, ias.SerialNumber
+		}
+		if len(si.SignedAttrs.FullBytes) != 0 {
+			attrs, err := parseAttributes(si.SignedAttrs.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			if v, ok := attrs[oidAttributeSigningTime.String()]; ok {
+				if err := unmarshalDER(v, &info.SigningTime, "signing-time attribute"); err != nil {
+					return nil, err
+				}
+			}
+		}
+		m.Signers = append(m.Signers, info)
+	}
+	return m, nil
+}
+
+//parseAttributes returns the value of the attributes indexed by type. Each attribute must appear once, with a single
+//value.
+func parseAttributes(der []byte) (map[string][]byte, error) {
+	attrs := make(map[string][]byte)
+	for len(der) > 0 {
+		var a attribute
+		rest, err := asn1.Unmarshal(der, &a)
+		if err != nil {
+			return nil, errors.New("cms: malformed attribute")
+		}
+		der = rest
+		var v asn1.RawValue
+		if rest, err := asn1.Unmarshal(a.Values.Bytes, &v); err != nil || len(rest) != 0 {
+			return nil, errors.New("cms: attributes must have a single value")
+		}
+		if _, ok := attrs[a.Type.String()]; ok {
+			return nil, errors.New("cms: duplicate attribute")
+		}
+		attrs[a.Type.String()] = v.FullBytes
+	}
+	return attrs, nil
+}
+
+//VerifyOptions are the options of Verify
+type VerifyOptions struct {
+	//Content is the signed content of detached signatures
+	Content []byte
+	//Certificates are searched for the certificates of signers in addition to those of the message
+	Certificates []*x509.Certificate
+}
+
+//certificate finds the certificate of a signer
+func (m *SignedMessage) certificate(info *SignerInfo, extra []*x509.Certificate) *x509.Certificate {
+	for _, c := range append(append([]*x509.Certificate{}, m.Certificates...), extra...) {
+		if info.SubjectKeyID != nil {
+			if bytes.Equal(c.SubjectKeyId, info.SubjectKeyID) {
+				return c
+			}
+		} else if bytes.Equal(c.RawIssuer, info.Issuer) && c.SerialNumber != nil && c.SerialNumber.Cmp(info.SerialNumber) == 0 {
+			return c
+		}
+	}
+	return nil
+}
+
+//Verify checks the signatures of all the signers and returns their certificates, in the order of Signers. It does not
+//check the certificates themselves, which must be validated by the caller, for example with x509.Certificate.Verify
+//for classical certificate chains.
+func (m *SignedMessage) Verify(opts *VerifyOptions) ([]*x509.Certificate, error) {
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+	content := m.Content
+	if content == nil {
+		if opts.Content == nil {
+			return nil, errors.New("cms: detached signature without content")
+		}
+		content = opts.Content
+	}
+	if len(m.Signers) == 0 {
+		return nil, errors.New("cms: no signers")
+	}
+	var certs []*x509.Certificate
+	for _, info := range m.Signers {
+		cert := m.certificate(info, opts.Certificates)
+		if cert == nil {
+			return nil, errors.New("cms: certificate of the signer not found")
+		}
+		signed, err := m.signedBytes(info, content)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkSignature(cert, info.SignatureAlgorithm, info.DigestAlgorithm, signed, info.si.Signature); err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+//signedBytes returns the input of the signature of a signer: the DER encoding of the signed attributes, after checking
+//the content-type and message-digest attributes, or the content itself
+func (m *SignedMessage) signedBytes(info *SignerInfo, content []byte) ([]byte, error) {
+	h, ok := digestHash(info.DigestAlgorithm)
+	if !ok {
+		return nil, errors.New("cms: unsupported digest algorithm")
+	}
+	if len(info.si.SignedAttrs.FullBytes) == 0 {
+		if !m.ContentType.Equal(OIDData) {
+			return nil, errors.New("cms: signed attributes are required for this content type")
+		}
+		return content, nil
+	}
+	attrs, err := parseAttributes(info.si.SignedAttrs.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	var contentType asn1.ObjectIdentifier
+	var digest []byte
+	ct, ok1 := attrs[oidAttributeContentType.String()]
+	md, ok2 := attrs[oidAttributeMessageDigest.String()]
+	if !ok1 || !ok2 || unmarshalDER(ct, &contentType, "content-type attribute") != nil ||
+		unmarshalDER(md, &digest, "message-digest attribute") != nil {
+		return nil, errors.New("cms: missing or malformed content-type or message-digest attribute")
+	}
+	if !contentType.Equal(m.ContentType) {
+		return nil, errors.New("cms: content-type attribute does not match the content")
+	}
+	d := h.New()
+	d.Write(content)
+	if !bytes.Equal(d.Sum(nil), digest) {
+		return nil, errors.New("cms: message digest mismatch")
+	}
+	//the signature covers the attributes with their SET OF tag
+	return retag(info.si.SignedAttrs.FullBytes, 0x31), nil
+}
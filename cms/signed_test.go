@@ -0,0 +1,213 @@
+package cms
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+)
+
+type tbsCertificate struct {
+	Version            int `asn1:"optional,explicit,default:0,tag:0"`
+	SerialNumber       *big.Int
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Issuer             asn1.RawValue
+	Validity           struct{ NotBefore, NotAfter time.Time }
+	Subject            asn1.RawValue
+	PublicKey          asn1.RawValue
+	Extensions         []pkix.Extension `asn1:"optional,explicit,tag:3"`
+}
+
+type certificate struct {
+	TBSCertificate     asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+}
+
+//testSigner returns a signer with a self-signed certificate, as crypto/x509 cannot create ML-DSA certificates
+func testSigner(t *testing.T, d *dilithium.Dilithium, name string, ski []byte) *Signer {
+	pk, sk := d.KeyGen(nil)
+	spki, err := MarshalDilithiumPublicKey(d, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oid, _ := dilithiumOID(d)
+	subject, _ := asn1.Marshal(pkix.Name{CommonName: name}.ToRDNSequence())
+	tbs := tbsCertificate{
+		Version:            2,
+		SerialNumber:       big.NewInt(42),
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oid},
+		Issuer:             asn1.RawValue{FullBytes: subject},
+		Subject:            asn1.RawValue{FullBytes: subject},
+		PublicKey:          asn1.RawValue{FullBytes: spki},
+	}
+	tbs.Validity.NotBefore = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tbs.Validity.NotAfter = time.Date(2035, 1, 1, 0, 0, 0, 0, time.UTC)
+	if ski != nil {
+		v, _ := asn1.Marshal(ski)
+		tbs.Extensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 14}, Value: v}}
+	}
+	tbsDER, err := asn1.Marshal(tbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := d.Sign(sk, tbsDER)
+	der, err := asn1.Marshal(certificate{
+		TBSCertificate:     asn1.RawValue{FullBytes: tbsDER},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oid},
+		Signature:          asn1.BitString{Bytes: sig, BitLength: 8 * len(sig)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Signer{Dilithium: d, PrivateKey: sk, Certificate: cert, UseSubjectKeyID: ski != nil}
+}
+
+func TestSigned(t *testing.T) {
+	content := []byte("firmware manifest v1\n")
+	signingTime := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	for _, d := range []*dilithium.Dilithium{dilithium.NewMLDSA44(), dilithium.NewMLDSA65(), dilithium.NewMLDSA87(), dilithium.NewDilithium3()} {
+		bySerial := testSigner(t, d, "serial signer", nil)
+		bySKI := testSigner(t, d, "ski signer", []byte{1, 2, 3, 4})
+		for _, detached := range []bool{false, true} {
+			der, err := Sign(content, []*Signer{bySerial, bySKI}, &SignOptions{Detached: detached, SigningTime: signingTime})
+			if err != nil {
+				t.Fatal(d.Name, err)
+			}
+			m, err := ParseSigned(der)
+			if err != nil {
+				t.Fatal(d.Name, err)
+			}
+			if !m.ContentType.Equal(OIDData) || len(m.Certificates) != 2 || len(m.Signers) != 2 {
+				t.Fatal(d.Name, "unexpected message")
+			}
+			if detached != (m.Content == nil) {
+				t.Fatal(d.Name, "content handling")
+			}
+			certs, err := m.Verify(&VerifyOptions{Content: content})
+			if err != nil {
+				t.Fatal(d.Name, err)
+			}
+			//DER sorts the signer infos, so the order of the signers is not kept
+			for i, info := range m.Signers {
+				if !info.SigningTime.Equal(signingTime) {
+					t.Fatal(d.Name, "unexpected signing time", info.SigningTime)
+				}
+				switch {
+				case info.SubjectKeyID != nil:
+					if !bytes.Equal(info.SubjectKeyID, []byte{1, 2, 3, 4}) || certs[i].Subject.CommonName != "ski signer" {
+						t.Fatal(d.Name, "unexpected subject key identifier signer")
+					}
+				case info.SerialNumber.Int64() != 42 || certs[i].Subject.CommonName != "serial signer":
+					t.Fatal(d.Name, "unexpected issuer and serial number signer")
+				}
+			}
+			if _, err := m.Verify(&VerifyOptions{Content: []byte("other content")}); detached && err == nil {
+				t.Fatal(d.Name, "signature of other content accepted")
+			}
+			if detached {
+				if _, err := m.Verify(nil); err == nil {
+					t.Fatal(d.Name, "detached signature verified without content")
+				}
+			}
+		}
+	}
+}
+
+func TestSignedTampering(t *testing.T) {
+	s := testSigner(t, dilithium.NewMLDSA65(), "signer", nil)
+	content := []byte("firmware manifest v1\n")
+	der, err := Sign(content, []*Signer{s}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the content is the first occurrence in the message
+	i := bytes.Index(der, content)
+	tampered := append([]byte{}, der...)
+	tampered[i] ^= 1
+	m, err := ParseSigned(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Verify(nil); err == nil {
+		t.Fatal("modified content accepted")
+	}
+	m, _ = ParseSigned(der)
+	m.Signers[0].si.Signature[0] ^= 1
+	if _, err := m.Verify(nil); err == nil {
+		t.Fatal("modified signature accepted")
+	}
+	//the certificate may be given by the verifier instead of the message
+	m, _ = ParseSigned(der)
+	m.Certificates = nil
+	if _, err := m.Verify(nil); err == nil {
+		t.Fatal("signer without certificate accepted")
+	}
+	if _, err := m.Verify(&VerifyOptions{Certificates: []*x509.Certificate{s.Certificate}}); err != nil {
+		t.Fatal(err)
+	}
+	//a certificate with another key does not verify
+	other := testSigner(t, dilithium.NewMLDSA65(), "signer", nil)
+	if _, err := m.Verify(&VerifyOptions{Certificates: []*x509.Certificate{other.Certificate}}); err == nil {
+		t.Fatal("signature accepted with another key")
+	}
+}
+
+func TestSignedContentType(t *testing.T) {
+	s := testSigner(t, dilithium.NewMLDSA44(), "signer", nil)
+	contentType := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 16} //id-ct-firmwarePackage
+	der, err := Sign([]byte{0xff}, []*Signer{s}, &SignOptions{ContentType: contentType})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ParseSigned(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.ContentType.Equal(contentType) {
+		t.Fatal("unexpected content type")
+	}
+	if _, err := m.Verify(nil); err != nil {
+		t.Fatal(err)
+	}
+	m.ContentType = OIDData
+	if _, err := m.Verify(nil); err == nil {
+		t.Fatal("content type mismatch accepted")
+	}
+}
+
+//The RSA messages were created with
+//openssl cms -sign -binary [-nodetach] -md sha256 -outform DER -in manifest.txt -signer cert.pem -inkey key.pem
+func TestSignedRSA(t *testing.T) {
+	content := []byte("firmware manifest v1\n")
+	for _, name := range []string{"testdata/rsa_attached.der", "testdata/rsa_detached.der"} {
+		der, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := ParseSigned(der)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		certs, err := m.Verify(&VerifyOptions{Content: content})
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if certs[0].Subject.CommonName != "Firmware RSA signer" {
+			t.Fatal(name, "unexpected signer certificate")
+		}
+		if _, err := m.Verify(&VerifyOptions{Content: []byte("other content")}); m.Content == nil && err == nil {
+			t.Fatal(name, "signature of other content accepted")
+		}
+	}
+}
@@ -0,0 +1,275 @@
+//Package composite implements the composite ML-DSA signatures of the IETF LAMPS draft (draft-ietf-lamps-pq-composite-sigs):
+//an ML-DSA signature and an Ed25519 or ECDSA signature of the same message representative, so that a composite
+//signature cannot be forged as long as one of the two algorithms is secure.
+//
+//The message representative is M' = Prefix || Domain || len(ctx) || ctx || PH(M), where Domain is the DER encoding of
+//the object identifier of the composite algorithm and PH its pre-hash function. ML-DSA signs M' with Domain as its
+//context and the traditional algorithm signs M'. Keys and signatures are the concatenation of the ML-DSA component
+//and the traditional one:
+//
+//	public key:  ML-DSA public key || Ed25519 public key or uncompressed ECDSA point
+//	private key: ML-DSA seed || Ed25519 seed or ECDSA ECPrivateKey (RFC 5915)
+//	signature:   ML-DSA signature || Ed25519 signature or DER encoded ECDSA signature
+//
+//Verification requires both components to be valid. The object identifiers are the prototype ones of the draft and
+//will change once the draft is published.
+package composite
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"hash"
+	"io"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	"github.com/kudelskisecurity/crystals-go/internal/randutil"
+)
+
+//Prefix starts every message representative, it is the ASCII string "CompositeAlgorithmSignatures2025"
+var Prefix = []byte("CompositeAlgorithmSignatures2025")
+
+//Scheme is a composite signature algorithm: an ML-DSA parameter set, a traditional algorithm and a pre-hash function
+type Scheme struct {
+	Name string
+	OID  asn1.ObjectIdentifier
+
+	newMLDSA func(...bool) *dilithium.Dilithium
+	//curve is nil for Ed25519
+	curve     elliptic.Curve
+	ecdsaHash func() hash.Hash
+	preHash   func() hash.Hash
+}
+
+//Composite signature algorithms of the draft
+var (
+	MLDSA44Ed25519SHA512 = &Scheme{Name: "id-MLDSA44-Ed25519-SHA512", OID: asn1.ObjectIdentifier{2, 16, 840, 1, 114027, 80, 9, 1, 2},
+		newMLDSA: dilithium.NewMLDSA44, preHash: sha512.New}
+	MLDSA44ECDSAP256SHA256 = &Scheme{Name: "id-MLDSA44-ECDSA-P256-SHA256", OID: asn1.ObjectIdentifier{2, 16, 840, 1, 114027, 80, 9, 1, 3},
+		newMLDSA: dilithium.NewMLDSA44, curve: elliptic.P256(), ecdsaHash: sha256.New, preHash: sha256.New}
+	MLDSA65ECDSAP256SHA512 = &Scheme{Name: "id-MLDSA65-ECDSA-P256-SHA512", OID: asn1.ObjectIdentifier{2, 16, 840, 1, 114027, 80, 9, 1, 8},
+		newMLDSA: dilithium.NewMLDSA65, curve: elliptic.P256(), ecdsaHash: sha256.New, preHash: sha512.New}
+	MLDSA65ECDSAP384SHA512 = &Scheme{Name: "id-MLDSA65-ECDSA-P384-SHA512", OID: asn1.ObjectIdentifier{2, 16, 840, 1, 114027, 80, 9, 1, 9},
+		newMLDSA: dilithium.NewMLDSA65, curve: elliptic.P384(), ecdsaHash: sha512.New384, preHash: sha512.New}
+	MLDSA65Ed25519SHA512 = &Scheme{Name: "id-MLDSA65-Ed25519-SHA512", OID: asn1.ObjectIdentifier{2, 16, 840, 1, 114027, 80, 9, 1, 11},
+		newMLDSA: dilithium.NewMLDSA65, preHash: sha512.New}
+	MLDSA87ECDSAP384SHA512 = &Scheme{Name: "id-MLDSA87-ECDSA-P384-SHA512", OID: asn1.ObjectIdentifier{2, 16, 840, 1, 114027, 80, 9, 1, 12},
+		newMLDSA: dilithium.NewMLDSA87, curve: elliptic.P384(), ecdsaHash: sha512.New384, preHash: sha512.New}
+)
+
+//Schemes lists the supported composite signature algorithms
+var Schemes = []*Scheme{MLDSA44Ed25519SHA512, MLDSA44ECDSAP256SHA256, MLDSA65ECDSAP256SHA512, MLDSA65ECDSAP384SHA512,
+	MLDSA65Ed25519SHA512, MLDSA87ECDSAP384SHA512}
+
+//SchemeByOID returns the composite signature algorithm of an object identifier, or nil
+func SchemeByOID(oid asn1.ObjectIdentifier) *Scheme {
+	for _, s := range Schemes {
+		if s.OID.Equal(oid) {
+			return s
+		}
+	}
+	return nil
+}
+
+//domain returns the DER encoding of the object identifier
+func (s *Scheme) domain() []byte {
+	d, _ := asn1.Marshal(s.OID)
+	return d
+}
+
+//representative returns the message representative M' of a message and a context
+func (s *Scheme) representative(message, ctx []byte) ([]byte, error) {
+	if len(ctx) > 255 {
+		return nil, errors.New("composite: context longer than 255 bytes")
+	}
+	h := s.preHash()
+	h.Write(message)
+	m := append(append([]byte{}, Prefix...), s.domain()...)
+	m = append(append(m, byte(len(ctx))), ctx...)
+	return h.Sum(m), nil
+}
+
+//PublicKey is a composite public key
+type PublicKey struct {
+	scheme  *Scheme
+	mldsa   []byte
+	ed25519 ed25519.PublicKey
+	ecdsa   *ecdsa.PublicKey
+}
+
+//Scheme returns the algorithm of the key
+func (k *PublicKey) Scheme() *Scheme {
+	return k.scheme
+}
+
+//Bytes returns the encoding of the key: the ML-DSA public key followed by the traditional one
+func (k *PublicKey) Bytes() []byte {
+	if k.ecdsa != nil {
+		return append(append([]byte{}, k.mldsa...), elliptic.Marshal(k.ecdsa.Curve, k.ecdsa.X, k.ecdsa.Y)...)
+	}
+	return append(append([]byte{}, k.mldsa...), k.ed25519...)
+}
+
+//Equal reports whether two public keys are the same
+func (k *PublicKey) Equal(other *PublicKey) bool {
+	return k.scheme == other.scheme && bytes.Equal(k.Bytes(), other.Bytes())
+}
+
+//ParsePublicKey decodes a composite public key of the scheme
+func (s *Scheme) ParsePublicKey(b []byte) (*PublicKey, error) {
+	size := s.newMLDSA().SIZEPK()
+	if len(b) < size {
+		return nil, errors.New("composite: invalid public key length")
+	}
+	k := &PublicKey{scheme: s, mldsa: append([]byte{}, b[:size]...)}
+	trad := b[size:]
+	if s.curve == nil {
+		if len(trad) != ed25519.PublicKeySize {
+			return nil, errors.New("composite: invalid Ed25519 public key")
+		}
+		k.ed25519 = append(ed25519.PublicKey{}, trad...)
+		return k, nil
+	}
+	x, y := elliptic.Unmarshal(s.curve, trad)
+	if x == nil {
+		return nil, errors.New("composite: invalid ECDSA public key")
+	}
+	k.ecdsa = &ecdsa.PublicKey{Curve: s.curve, X: x, Y: y}
+	return k, nil
+}
+
+//PrivateKey is a composite private key, holding the ML-DSA key generation seed and the traditional private key
+type PrivateKey struct {
+	public  PublicKey
+	seed    []byte
+	mldsa   []byte
+	ed25519 ed25519.PrivateKey
+	ecdsa   *ecdsa.PrivateKey
+}
+
+//newPrivateKey expands the ML-DSA seed and completes the key with the traditional private key
+func (s *Scheme) newPrivateKey(seed []byte, ed ed25519.PrivateKey, ec *ecdsa.PrivateKey) *PrivateKey {
+	pk, sk := s.newMLDSA().KeyGen(seed)
+	k := &PrivateKey{public: PublicKey{scheme: s, mldsa: pk}, seed: seed, mldsa: sk, ed25519: ed, ecdsa: ec}
+	if ec != nil {
+		k.public.ecdsa = &ec.PublicKey
+	} else {
+		k.public.ed25519 = ed.Public().(ed25519.PublicKey)
+	}
+	return k
+}
+
+//GenerateKey generates a composite key pair. If rand is nil, crypto/rand is used.
+func (s *Scheme) GenerateKey(rand io.Reader) (*PrivateKey, error) {
+	rand = randutil.Reader(rand)
+	seed := make([]byte, dilithium.SEEDBYTES)
+	if _, err := io.ReadFull(rand, seed); err != nil {
+		return nil, err
+	}
+	if s.curve == nil {
+		_, ed, err := ed25519.GenerateKey(rand)
+		if err != nil {
+			return nil, err
+		}
+		return s.newPrivateKey(seed, ed, nil), nil
+	}
+	ec, err := ecdsa.GenerateKey(s.curve, rand)
+	if err != nil {
+		return nil, err
+	}
+	return s.newPrivateKey(seed, nil, ec), nil
+}
+
+//Public returns the public key
+func (k *PrivateKey) Public() *PublicKey {
+	return &k.public
+}
+
+//Bytes returns the encoding of the key: the ML-DSA seed followed by the traditional private key
+func (k *PrivateKey) Bytes() ([]byte, error) {
+	if k.ecdsa != nil {
+		der, err := x509.MarshalECPrivateKey(k.ecdsa)
+		if err != nil {
+			return nil, err
+		}
+		return append(append([]byte{}, k.seed...), der...), nil
+	}
+	return append(append([]byte{}, k.seed...), k.ed25519.Seed()...), nil
+}
+
+//ParsePrivateKey decodes a composite private key of the scheme
+func (s *Scheme) ParsePrivateKey(b []byte) (*PrivateKey, error) {
+	if len(b) < dilithium.SEEDBYTES {
+		return nil, errors.New("composite: invalid private key length")
+	}
+	seed, trad := append([]byte{}, b[:dilithium.SEEDBYTES]...), b[dilithium.SEEDBYTES:]
+	if s.curve == nil {
+		if len(trad) != ed25519.SeedSize {
+			return nil, errors.New("composite: invalid Ed25519 private key")
+		}
+		return s.newPrivateKey(seed, ed25519.NewKeyFromSeed(trad), nil), nil
+	}
+	ec, err := x509.ParseECPrivateKey(trad)
+	if err != nil {
+		return nil, err
+	}
+	if ec.Curve != s.curve {
+		return nil, errors.New("composite: ECDSA private key on another curve")
+	}
+	return s.newPrivateKey(seed, nil, ec), nil
+}
+
+//Sign returns the composite signature of the message with a context of at most 255 bytes, which may be empty. The
+//random source, crypto/rand if nil, is only used by ECDSA.
+func (k *PrivateKey) Sign(rand io.Reader, message, ctx []byte) ([]byte, error) {
+	s := k.public.scheme
+	m, err := s.representative(message, ctx)
+	if err != nil {
+		return nil, err
+	}
+	sig := s.newMLDSA().SignWithContext(k.mldsa, m, s.domain())
+	if sig == nil {
+		return nil, errors.New("composite: ML-DSA signature failed")
+	}
+	if k.ecdsa == nil {
+		return append(sig, ed25519.Sign(k.ed25519, m)...), nil
+	}
+	h := s.ecdsaHash()
+	h.Write(m)
+	tradSig, err := ecdsa.SignASN1(randutil.Reader(rand), k.ecdsa, h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return append(sig, tradSig...), nil
+}
+
+//Verify reports whether sig is a valid composite signature of the message with the context. Both the ML-DSA and the
+//traditional signatures must be valid.
+func Verify(pub *PublicKey, message, sig, ctx []byte) bool {
+	s := pub.scheme
+	m, err := s.representative(message, ctx)
+	if err != nil {
+		return false
+	}
+	d := s.newMLDSA()
+	if len(sig) < d.SIZESIG() {
+		return false
+	}
+	mldsaValid := d.VerifyWithContext(pub.mldsa, m, sig[:d.SIZESIG()], s.domain())
+	tradSig := sig[d.SIZESIG():]
+	var tradValid bool
+	if pub.ecdsa == nil {
+		tradValid = len(tradSig) == ed25519.SignatureSize && ed25519.Verify(pub.ed25519, m, tradSig)
+	} else {
+		h := s.ecdsaHash()
+		h.Write(m)
+		tradValid = ecdsa.VerifyASN1(pub.ecdsa, h.Sum(nil), tradSig)
+	}
+	return mldsaValid && tradValid
+}
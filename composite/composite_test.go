@@ -0,0 +1,123 @@
+package composite
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"testing"
+)
+
+var message = []byte("firmware image v3")
+
+func TestSignVerify(t *testing.T) {
+	for _, s := range Schemes {
+		key, err := s.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(s.Name, err)
+		}
+		other, _ := s.GenerateKey(nil)
+		sig, err := key.Sign(nil, message, []byte("ctx"))
+		if err != nil {
+			t.Fatal(s.Name, err)
+		}
+		if !Verify(key.Public(), message, sig, []byte("ctx")) {
+			t.Fatal(s.Name, "valid signature rejected")
+		}
+		if Verify(key.Public(), message, sig, nil) {
+			t.Fatal(s.Name, "signature accepted with another context")
+		}
+		if Verify(key.Public(), message[1:], sig, []byte("ctx")) {
+			t.Fatal(s.Name, "signature of another message accepted")
+		}
+		if Verify(other.Public(), message, sig, []byte("ctx")) {
+			t.Fatal(s.Name, "signature accepted for another key")
+		}
+		//a signature with a single valid component is rejected, whichever component is valid
+		otherSig, _ := other.Sign(nil, message, []byte("ctx"))
+		n := s.newMLDSA().SIZESIG()
+		for _, mixed := range [][]byte{
+			append(append([]byte{}, sig[:n]...), otherSig[n:]...),
+			append(append([]byte{}, otherSig[:n]...), sig[n:]...),
+		} {
+			if Verify(key.Public(), message, mixed, []byte("ctx")) {
+				t.Fatal(s.Name, "signature with one invalid component accepted")
+			}
+		}
+		if Verify(key.Public(), message, sig[:len(sig)-1], []byte("ctx")) {
+			t.Fatal(s.Name, "truncated signature accepted")
+		}
+		if _, err := key.Sign(nil, message, make([]byte, 256)); err == nil {
+			t.Fatal(s.Name, "context longer than 255 bytes accepted")
+		}
+	}
+}
+
+func TestKeyEncoding(t *testing.T) {
+	for _, s := range Schemes {
+		key, _ := s.GenerateKey(nil)
+		b, err := key.Bytes()
+		if err != nil {
+			t.Fatal(s.Name, err)
+		}
+		parsed, err := s.ParsePrivateKey(b)
+		if err != nil {
+			t.Fatal(s.Name, err)
+		}
+		if !parsed.Public().Equal(key.Public()) {
+			t.Fatal(s.Name, "private key changed by encoding")
+		}
+		pub, err := s.ParsePublicKey(key.Public().Bytes())
+		if err != nil {
+			t.Fatal(s.Name, err)
+		}
+		sig, _ := parsed.Sign(nil, message, nil)
+		if !Verify(pub, message, sig, nil) {
+			t.Fatal(s.Name, "signature of the decoded key rejected")
+		}
+		if _, err := s.ParsePublicKey(key.Public().Bytes()[1:]); err == nil {
+			t.Fatal(s.Name, "short public key accepted")
+		}
+		if _, err := s.ParsePrivateKey(b[:len(b)-1]); err == nil {
+			t.Fatal(s.Name, "short private key accepted")
+		}
+	}
+	//an ECDSA key on another curve
+	p384, _ := MLDSA65ECDSAP384SHA512.GenerateKey(nil)
+	b, _ := p384.Bytes()
+	if _, err := MLDSA65ECDSAP256SHA512.ParsePrivateKey(b); err == nil {
+		t.Fatal("P-384 key accepted for a P-256 scheme")
+	}
+}
+
+func TestRepresentative(t *testing.T) {
+	s := MLDSA65Ed25519SHA512
+	key, _ := s.GenerateKey(nil)
+	m, _ := s.representative(message, []byte("ctx"))
+	//Prefix || DER(OID) || len(ctx) || ctx || SHA-512(M)
+	domain := []byte{0x06, 0x0b, 0x60, 0x86, 0x48, 0x01, 0x86, 0xfa, 0x6b, 0x50, 0x09, 0x01, 0x0b}
+	ph := sha512.Sum512(message)
+	expected := append(append(append([]byte("CompositeAlgorithmSignatures2025"), domain...), 3, 'c', 't', 'x'), ph[:]...)
+	if !bytes.Equal(m, expected) {
+		t.Fatalf("unexpected message representative %x", m)
+	}
+	//each component verifies on its own over the message representative
+	sig, _ := key.Sign(nil, message, []byte("ctx"))
+	d := s.newMLDSA()
+	if !d.VerifyWithContext(key.Public().mldsa, m, sig[:d.SIZESIG()], domain) {
+		t.Fatal("invalid ML-DSA component")
+	}
+	if !ed25519.Verify(key.Public().ed25519, m, sig[d.SIZESIG():]) {
+		t.Fatal("invalid Ed25519 component")
+	}
+}
+
+func TestSchemeByOID(t *testing.T) {
+	for _, s := range Schemes {
+		if SchemeByOID(s.OID) != s {
+			t.Fatal(s.Name, "unexpected scheme")
+		}
+	}
+	if SchemeByOID([]int{2, 16, 840, 1, 101, 3, 4, 3, 18}) != nil {
+		t.Fatal("ML-DSA-65 is not a composite scheme")
+	}
+}
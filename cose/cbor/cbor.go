@@ -0,0 +1,358 @@
+//Package cbor is a minimal CBOR (RFC 8949) encoder and decoder, covering what COSE structures and CWT claims need:
+//integers, byte and text strings, arrays, maps, tags, booleans, null and floating point numbers.
+//
+//Values are represented by the Go types int64, uint64 (for unsigned integers above the int64 range), []byte, string,
+//[]interface{}, map[interface{}]interface{}, Tag, bool, nil and float64. Marshal also accepts the other integer types,
+//RawMessage and maps and slices of these types. The encoding is the core deterministic encoding of RFC 8949: integers
+//and lengths in their shortest form and map keys sorted by their encodings. Unmarshal only accepts definite lengths,
+//and rejects duplicate map keys and map keys other than integers and text strings.
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+)
+
+//Major types
+const (
+	majorUnsigned = 0
+	majorNegative = 1
+	majorBytes    = 2
+	majorText     = 3
+	majorArray    = 4
+	majorMap      = 5
+	majorTag      = 6
+	majorSimple   = 7
+)
+
+//Simple values and additional information
+const (
+	simpleFalse     = 20
+	simpleTrue      = 21
+	simpleNull      = 22
+	simpleUndefined = 23
+	infoFloat16     = 25
+	infoFloat32     = 26
+	infoFloat64     = 27
+	infoIndefinite  = 31
+)
+
+//maxDepth bounds the nesting of arrays, maps and tags accepted by Unmarshal
+const maxDepth = 32
+
+//Tag is a tagged data item
+type Tag struct {
+	Number  uint64
+	Content interface{}
+}
+
+//RawMessage is an already encoded data item, written as is by Marshal
+type RawMessage []byte
+
+//Marshal returns the deterministic encoding of a value
+func Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//writeHead writes the initial byte of a data item and its argument in the shortest form
+func writeHead(buf *bytes.Buffer, major byte, arg uint64) {
+	major <<= 5
+	switch {
+	case arg < 24:
+		buf.WriteByte(major | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.Write([]byte{major | 24, byte(arg)})
+	case arg <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		binary.Write(buf, binary.BigEndian, uint16(arg))
+	case arg <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		binary.Write(buf, binary.BigEndian, uint32(arg))
+	default:
+		buf.WriteByte(major | 27)
+		binary.Write(buf, binary.BigEndian, arg)
+	}
+}
+
+func encode(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(majorSimple<<5 | simpleNull)
+	case bool:
+		if v {
+			buf.WriteByte(majorSimple<<5 | simpleTrue)
+		} else {
+			buf.WriteByte(majorSimple<<5 | simpleFalse)
+		}
+	case []byte:
+		writeHead(buf, majorBytes, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		writeHead(buf, majorText, uint64(len(v)))
+		buf.WriteString(v)
+	case RawMessage:
+		if _, err := Unmarshal(v); err != nil {
+			return err
+		}
+		buf.Write(v)
+	case Tag:
+		writeHead(buf, majorTag, v.Number)
+		return encode(buf, v.Content)
+	case float64:
+		buf.WriteByte(majorSimple<<5 | infoFloat64)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case uint64:
+		writeHead(buf, majorUnsigned, v)
+	case int64:
+		if v < 0 {
+			writeHead(buf, majorNegative, uint64(-(v + 1)))
+		} else {
+			writeHead(buf, majorUnsigned, uint64(v))
+		}
+	default:
+		return encodeReflect(buf, reflect.ValueOf(v))
+	}
+	return nil
+}
+
+//encodeReflect encodes the other integer types, and slices and maps of any supported type
+func encodeReflect(buf *bytes.Buffer, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return encode(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return encode(buf, v.Uint())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return encode(buf, b)
+		}
+		writeHead(buf, majorArray, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := encode(buf, v.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		type entry struct{ key, value []byte }
+		entries := make([]entry, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := Marshal(iter.Key().Interface())
+			if err != nil {
+				return err
+			}
+			value, err := Marshal(iter.Value().Interface())
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry{key, value})
+		}
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].key, entries[j].key) < 0 })
+		writeHead(buf, majorMap, uint64(len(entries)))
+		for i, e := range entries {
+			if i > 0 && bytes.Equal(e.key, entries[i-1].key) {
+				return errors.New("cbor: duplicate map key")
+			}
+			buf.Write(e.key)
+			buf.Write(e.value)
+		}
+		return nil
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return encode(buf, nil)
+		}
+		return encode(buf, v.Elem().Interface())
+	}
+	return errors.New("cbor: unsupported type " + v.Type().String())
+}
+
+//Unmarshal decodes a single data item, which must span all of data
+func Unmarshal(data []byte) (interface{}, error) {
+	v, rest, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("cbor: trailing data")
+	}
+	return v, nil
+}
+
+//Decode decodes the first data item of data and returns the remaining bytes
+func Decode(data []byte) (interface{}, []byte, error) {
+	d := decoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, d.data, nil
+}
+
+type decoder struct {
+	data []byte
+}
+
+var errTruncated = errors.New("cbor: unexpected end of data")
+
+func (d *decoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)) {
+		return nil, errTruncated
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b, nil
+}
+
+//head reads the initial byte and the argument of a data item, rejecting non-shortest forms
+func (d *decoder) head() (byte, byte, uint64, error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	if info < 24 {
+		return major, info, uint64(info), nil
+	}
+	if info > 27 {
+		if info == infoIndefinite {
+			return 0, 0, 0, errors.New("cbor: indefinite lengths are not supported")
+		}
+		return 0, 0, 0, errors.New("cbor: invalid additional information")
+	}
+	n := uint64(1) << (info - 24)
+	arg, err := d.read(n)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	var v uint64
+	for _, c := range arg {
+		v = v<<8 | uint64(c)
+	}
+	//floating point numbers keep their width, other arguments must be minimal
+	if major != majorSimple && ((n == 1 && v < 24) || (n > 1 && v < uint64(1)<<(4*n))) {
+		return 0, 0, 0, errors.New("cbor: non-minimal encoding")
+	}
+	return major, info, v, nil
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errors.New("cbor: nesting too deep")
+	}
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case majorUnsigned:
+		if arg > math.MaxInt64 {
+			return arg, nil
+		}
+		return int64(arg), nil
+	case majorNegative:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("cbor: negative integer out of range")
+		}
+		return -1 - int64(arg), nil
+	case majorBytes:
+		b, err := d.read(arg)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, b...), nil
+	case majorText:
+		b, err := d.read(arg)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case majorArray:
+		if arg > uint64(len(d.data)) {
+			return nil, errTruncated
+		}
+		a := make([]interface{}, arg)
+		for i := range a {
+			if a[i], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	case majorMap:
+		if arg > uint64(len(d.data))/2 {
+			return nil, errTruncated
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, uint64, string:
+			default:
+				return nil, errors.New("cbor: unsupported map key type")
+			}
+			if _, ok := m[k]; ok {
+				return nil, errors.New("cbor: duplicate map key")
+			}
+			if m[k], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case majorTag:
+		content, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Tag{Number: arg, Content: content}, nil
+	}
+	switch info {
+	case simpleFalse:
+		return false, nil
+	case simpleTrue:
+		return true, nil
+	case simpleNull, simpleUndefined:
+		return nil, nil
+	case infoFloat16:
+		return float16(uint16(arg)), nil
+	case infoFloat32:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case infoFloat64:
+		return math.Float64frombits(arg), nil
+	}
+	return nil, errors.New("cbor: unsupported simple value")
+}
+
+//float16 converts a half precision number
+func float16(h uint16) float64 {
+	exp, mant := int(h>>10)&0x1f, float64(h&0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,123 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// Examples of RFC 8949, Appendix A
+var examples = []struct {
+	value   interface{}
+	encoded string
+}{
+	{int64(0), "00"},
+	{int64(23), "17"},
+	{int64(24), "1818"},
+	{int64(1000), "1903e8"},
+	{int64(1000000), "1a000f4240"},
+	{int64(1000000000000), "1b000000e8d4a51000"},
+	{uint64(18446744073709551615), "1bffffffffffffffff"},
+	{int64(-1), "20"},
+	{int64(-1000), "3903e7"},
+	{int64(math.MinInt64), "3b7fffffffffffffff"},
+	{float64(1.1), "fb3ff199999999999a"},
+	{false, "f4"},
+	{true, "f5"},
+	{nil, "f6"},
+	{Tag{1, int64(1363896240)}, "c11a514b67b0"},
+	{[]byte{1, 2, 3, 4}, "4401020304"},
+	{"", "60"},
+	{"IETF", "6449455446"},
+	{"ü", "62c3bc"},
+	{[]interface{}{}, "80"},
+	{[]interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}, "8301820203820405"},
+	{map[interface{}]interface{}{}, "a0"},
+	{map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}, "a201020304"},
+	{map[interface{}]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}, "a26161016162820203"},
+}
+
+func TestExamples(t *testing.T) {
+	for _, e := range examples {
+		encoded, err := Marshal(e.value)
+		if err != nil {
+			t.Fatal(e.encoded, err)
+		}
+		if hex.EncodeToString(encoded) != e.encoded {
+			t.Fatalf("%v encoded as %x, expected %s", e.value, encoded, e.encoded)
+		}
+		v, err := Unmarshal(encoded)
+		if err != nil {
+			t.Fatal(e.encoded, err)
+		}
+		if !reflect.DeepEqual(v, e.value) {
+			t.Fatalf("%s decoded as %#v", e.encoded, v)
+		}
+	}
+}
+
+func TestDecodeOnly(t *testing.T) {
+	for encoded, value := range map[string]interface{}{
+		"f93c00":     float64(1),
+		"f97bff":     float64(65504),
+		"f90001":     5.960464477539063e-8,
+		"fa47c35000": float64(100000),
+		"f7":         nil,
+	} {
+		b, _ := hex.DecodeString(encoded)
+		v, err := Unmarshal(b)
+		if err != nil || !reflect.DeepEqual(v, value) {
+			t.Fatal(encoded, "decoded as", v, err)
+		}
+	}
+}
+
+func TestMarshalTypes(t *testing.T) {
+	encoded, err := Marshal(map[int]interface{}{
+		-1: [2]byte{1, 2},
+		1:  []int{7},
+		4:  RawMessage{0x43, 1, 2, 3},
+		10: uint8(200),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//keys sorted by encoding: 1, 4, 10, -1
+	if hex.EncodeToString(encoded) != "a401810704430102030a18c820420102" {
+		t.Fatalf("unexpected encoding %x", encoded)
+	}
+	if _, err := Marshal(struct{}{}); err == nil {
+		t.Fatal("struct encoded")
+	}
+	if _, err := Marshal(RawMessage{0x44, 1}); err == nil {
+		t.Fatal("invalid raw message encoded")
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	for _, encoded := range []string{
+		"",
+		"1817",               //non-minimal
+		"190017",             //non-minimal
+		"5f4101ff",           //indefinite length
+		"44010203",           //truncated
+		"a201020103",         //duplicate key
+		"a1410102",           //byte string key
+		"9a7fffffff",         //huge array
+		"0000",               //trailing data
+		"1c",                 //reserved additional information
+		"f820",               //unsupported simple value
+		"3bffffffffffffffff", //negative out of range
+	} {
+		b, _ := hex.DecodeString(encoded)
+		if _, err := Unmarshal(b); err == nil {
+			t.Fatal(encoded, "accepted")
+		}
+	}
+	deep := append(bytes.Repeat([]byte{0x81}, maxDepth+2), 0)
+	if _, err := Unmarshal(deep); err == nil {
+		t.Fatal("deep nesting accepted")
+	}
+}
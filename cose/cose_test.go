@@ -0,0 +1,156 @@
+package cose
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/kudelskisecurity/crystals-go/cose/cbor"
+)
+
+func TestKey(t *testing.T) {
+	for _, alg := range []int64{AlgMLDSA44, AlgMLDSA65, AlgMLDSA87, AlgMLKEM512, AlgMLKEM768, AlgMLKEM1024} {
+		key, err := GenerateKey(alg, nil)
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		key.KeyID = []byte("device-1")
+		for _, k := range []*Key{key, key.Public()} {
+			data, err := k.Marshal()
+			if err != nil {
+				t.Fatal(alg, err)
+			}
+			parsed, err := ParseKey(data)
+			if err != nil {
+				t.Fatal(alg, err)
+			}
+			if parsed.Algorithm != alg || !bytes.Equal(parsed.KeyID, k.KeyID) || !bytes.Equal(parsed.PublicKey, k.PublicKey) ||
+				!bytes.Equal(parsed.Seed, k.Seed) {
+				t.Fatal(alg, "key changed by encoding")
+			}
+		}
+	}
+}
+
+func TestKeyErrors(t *testing.T) {
+	key, _ := GenerateKey(AlgMLDSA44, nil)
+	other, _ := GenerateKey(AlgMLDSA44, nil)
+	for _, m := range []map[int64]interface{}{
+		{1: int64(1), 3: AlgMLDSA44, -1: key.PublicKey},
+		{1: KeyTypeAKP, 3: AlgMLDSA65, -1: key.PublicKey},
+		{1: KeyTypeAKP, 3: AlgMLDSA44, -1: key.PublicKey, -2: other.Seed},
+		{1: KeyTypeAKP, 3: AlgMLDSA44, -1: key.PublicKey, 2: "kid"},
+		{1: KeyTypeAKP, 3: "ML-DSA-44", -1: key.PublicKey},
+		{1: KeyTypeAKP, -1: key.PublicKey},
+	} {
+		data, _ := cbor.Marshal(m)
+		if _, err := ParseKey(data); err == nil {
+			t.Fatal("invalid key decoded", m[1], m[3])
+		}
+	}
+}
+
+func TestSign1(t *testing.T) {
+	payload := []byte("SUIT manifest")
+	for _, alg := range []int64{AlgMLDSA44, AlgMLDSA65, AlgMLDSA87} {
+		key, _ := GenerateKey(alg, nil)
+		key.KeyID = []byte("signer")
+		msg, err := Sign1(payload, key, &SignOptions{ContentType: "application/cwt", ExternalAAD: []byte("aad")})
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		got, err := VerifySign1(msg, key.Public(), &VerifyOptions{ExternalAAD: []byte("aad")})
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Fatal(alg, "unexpected payload")
+		}
+		if kid, err := MessageKeyID(msg); err != nil || !bytes.Equal(kid, key.KeyID) {
+			t.Fatal(alg, "unexpected key ID", err)
+		}
+		if _, err := VerifySign1(msg, key.Public(), nil); err == nil {
+			t.Fatal(alg, "verified without the external additional data")
+		}
+		other, _ := GenerateKey(alg, nil)
+		if _, err := VerifySign1(msg, other.Public(), &VerifyOptions{ExternalAAD: []byte("aad")}); err == nil {
+			t.Fatal(alg, "verified with another key")
+		}
+		tampered := bytes.Replace(msg, payload, []byte("SUIT manifesT"), 1)
+		if _, err := VerifySign1(tampered, key.Public(), &VerifyOptions{ExternalAAD: []byte("aad")}); err == nil {
+			t.Fatal(alg, "modified payload accepted")
+		}
+	}
+}
+
+func TestSign1Structure(t *testing.T) {
+	key, _ := GenerateKey(AlgMLDSA44, nil)
+	msg, err := Sign1([]byte("payload"), key, &SignOptions{Detached: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//tag 18, array of 4, protected header {1: -48}, empty unprotected header, nil payload, signature of 2420 bytes
+	if prefix := "d28444a101382fa0f6590974"; hex.EncodeToString(msg[:12]) != prefix || len(msg) != 12+2420 {
+		t.Fatalf("unexpected message %x", msg[:12])
+	}
+	if _, err := VerifySign1(msg, key.Public(), nil); err == nil {
+		t.Fatal("detached message verified without payload")
+	}
+	if _, err := VerifySign1(msg, key.Public(), &VerifyOptions{Payload: []byte("payload")}); err != nil {
+		t.Fatal(err)
+	}
+	//untagged messages are accepted too
+	v, _ := cbor.Unmarshal(msg)
+	untagged, _ := cbor.Marshal(v.(cbor.Tag).Content)
+	if _, err := VerifySign1(untagged, key.Public(), &VerifyOptions{Payload: []byte("payload")}); err != nil {
+		t.Fatal(err)
+	}
+	kem, _ := GenerateKey(AlgMLKEM768, nil)
+	if _, err := Sign1(nil, kem, nil); err == nil {
+		t.Fatal("signed with a key establishment key")
+	}
+	if _, err := Sign1(nil, key.Public(), nil); err == nil {
+		t.Fatal("signed with a public key")
+	}
+}
+
+func TestEncrypt0(t *testing.T) {
+	plaintext := []byte("CWT claims")
+	for _, alg := range []int64{AlgMLKEM512, AlgMLKEM768, AlgMLKEM1024} {
+		key, _ := GenerateKey(alg, nil)
+		key.KeyID = []byte("recipient")
+		msg, err := Encrypt0(plaintext, key.Public(), []byte("aad"))
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		got, err := Decrypt0(msg, key, []byte("aad"))
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Fatal(alg, "unexpected plaintext")
+		}
+		if kid, err := MessageKeyID(msg); err != nil || !bytes.Equal(kid, key.KeyID) {
+			t.Fatal(alg, "unexpected key ID", err)
+		}
+		if _, err := Decrypt0(msg, key, nil); err == nil {
+			t.Fatal(alg, "decrypted without the external additional data")
+		}
+		if _, err := Decrypt0(msg, key.Public(), []byte("aad")); err == nil {
+			t.Fatal(alg, "decrypted with a public key")
+		}
+		other, _ := GenerateKey(alg, nil)
+		if _, err := Decrypt0(msg, other, []byte("aad")); err == nil {
+			t.Fatal(alg, "decrypted with another key")
+		}
+		tampered := append([]byte{}, msg...)
+		tampered[len(tampered)-1] ^= 1
+		if _, err := Decrypt0(tampered, key, []byte("aad")); err == nil {
+			t.Fatal(alg, "modified ciphertext accepted")
+		}
+	}
+	sig, _ := GenerateKey(AlgMLDSA65, nil)
+	if _, err := Encrypt0(plaintext, sig, nil); err == nil {
+		t.Fatal("encrypted to a signature key")
+	}
+}
@@ -0,0 +1,141 @@
+package cose
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"github.com/kudelskisecurity/crystals-go/cose/cbor"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	cekSize   = 32
+	nonceSize = 12
+)
+
+//deriveKey derives the AES-256-GCM key from the ML-KEM shared secret with HKDF-SHA256. The info is the
+//COSE_KDF_Context of RFC 9053 with empty party infos and the protected header as supplementary public info.
+func deriveKey(ss, protected []byte) ([]byte, error) {
+	info, err := cbor.Marshal([]interface{}{
+		algA256GCM,
+		[]interface{}{nil, nil, nil},
+		[]interface{}{nil, nil, nil},
+		[]interface{}{8 * cekSize, protected},
+	})
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, cekSize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ss, nil, info), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+//encStructure returns the additional data of the content encryption
+func encStructure(protected, externalAAD []byte) ([]byte, error) {
+	if externalAAD == nil {
+		externalAAD = []byte{}
+	}
+	return cbor.Marshal([]interface{}{"Encrypt0", protected, externalAAD})
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//Encrypt0 returns a tagged COSE_Encrypt0 message of the plaintext for the holder of an ML-KEM key. The external
+//additional data is authenticated but not included in the message.
+func Encrypt0(plaintext []byte, key *Key, externalAAD []byte) ([]byte, error) {
+	k := newKEM(key.Algorithm)
+	if k == nil {
+		return nil, errors.New("cose: not a key establishment key")
+	}
+	if err := key.check(); err != nil {
+		return nil, err
+	}
+	ct, ss := k.Encaps(key.PublicKey, nil)
+	if ss == nil {
+		return nil, errors.New("cose: encapsulation failed")
+	}
+	protected, err := cbor.Marshal(map[int64]interface{}{HeaderAlgorithm: key.Algorithm})
+	if err != nil {
+		return nil, err
+	}
+	cek, err := deriveKey(ss, protected)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	aad, err := encStructure(protected, externalAAD)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(cek)
+	if err != nil {
+		return nil, err
+	}
+	unprotected := map[int64]interface{}{HeaderIV: nonce, HeaderEncapsulatedKey: ct}
+	if key.KeyID != nil {
+		unprotected[HeaderKeyID] = key.KeyID
+	}
+	ciphertext := aead.Seal(nil, nonce, plaintext, aad)
+	return cbor.Marshal(cbor.Tag{Number: TagEncrypt0, Content: []interface{}{protected, unprotected, ciphertext}})
+}
+
+//Decrypt0 decrypts a COSE_Encrypt0 message, tagged or not, with an ML-KEM private key
+func Decrypt0(msg []byte, key *Key, externalAAD []byte) ([]byte, error) {
+	k := newKEM(key.Algorithm)
+	if k == nil {
+		return nil, errors.New("cose: not a key establishment key")
+	}
+	sk, err := key.privateKey()
+	if err != nil {
+		return nil, err
+	}
+	protected, encoded, unprotected, rest, err := parseMessage(msg, TagEncrypt0, 3)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAlgorithm(protected, key); err != nil {
+		return nil, err
+	}
+	ct, ok1 := unprotected[HeaderEncapsulatedKey].([]byte)
+	nonce, ok2 := unprotected[HeaderIV].([]byte)
+	ciphertext, ok3 := rest[0].([]byte)
+	if !ok1 || !ok2 || !ok3 || len(ct) != k.SIZEC() || len(nonce) != nonceSize {
+		return nil, errors.New("cose: malformed encrypted message")
+	}
+	ss := k.Decaps(sk, ct)
+	if ss == nil {
+		return nil, errors.New("cose: decapsulation failed")
+	}
+	cek, err := deriveKey(ss, encoded)
+	if err != nil {
+		return nil, err
+	}
+	aad, err := encStructure(encoded, externalAAD)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(cek)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, errors.New("cose: decryption failed")
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,175 @@
+package cose
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/kudelskisecurity/crystals-go/cose/cbor"
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/internal/randutil"
+)
+
+//KeyTypeAKP is the COSE key type of ML-DSA and ML-KEM keys
+const KeyTypeAKP int64 = 7
+
+//COSE_Key parameters
+const (
+	keyParamType      int64 = 1
+	keyParamID        int64 = 2
+	keyParamAlgorithm int64 = 3
+	keyParamPublic    int64 = -1
+	keyParamPrivate   int64 = -2
+)
+
+//Key is an AKP COSE_Key. The private key is the seed given to KeyGen, 32 bytes for ML-DSA and 64 bytes for ML-KEM,
+//Seed is nil for public keys.
+type Key struct {
+	Algorithm int64
+	KeyID     []byte
+	PublicKey []byte
+	Seed      []byte
+}
+
+func newDilithium(alg int64) *dilithium.Dilithium {
+	switch alg {
+	case AlgMLDSA44:
+		return dilithium.NewMLDSA44()
+	case AlgMLDSA65:
+		return dilithium.NewMLDSA65()
+	case AlgMLDSA87:
+		return dilithium.NewMLDSA87()
+	}
+	return nil
+}
+
+func newKEM(alg int64) *kyber.Kyber {
+	switch alg {
+	case AlgMLKEM512:
+		return kyber.NewMLKEM512()
+	case AlgMLKEM768:
+		return kyber.NewMLKEM768()
+	case AlgMLKEM1024:
+		return kyber.NewMLKEM1024()
+	}
+	return nil
+}
+
+//keyGen returns the key generation of an algorithm and the sizes of its public keys and seeds
+func keyGen(alg int64) (func([]byte) ([]byte, []byte), int, int) {
+	if d := newDilithium(alg); d != nil {
+		return d.KeyGen, d.SIZEPK(), dilithium.SEEDBYTES
+	}
+	if k := newKEM(alg); k != nil {
+		return k.KeyGen, k.SIZEPK(), kyber.SEEDBYTES + kyber.SIZEZ
+	}
+	return nil, 0, 0
+}
+
+//GenerateKey returns a new private key of a signature or key establishment algorithm, with the seed read from rand
+//(crypto/rand if nil)
+func GenerateKey(alg int64, random io.Reader) (*Key, error) {
+	gen, _, seedSize := keyGen(alg)
+	if gen == nil {
+		return nil, errors.New("cose: unknown algorithm")
+	}
+	seed := make([]byte, seedSize)
+	if _, err := io.ReadFull(randutil.Reader(random), seed); err != nil {
+		return nil, err
+	}
+	pk, _ := gen(seed)
+	return &Key{Algorithm: alg, PublicKey: pk, Seed: seed}, nil
+}
+
+//Public returns the public part of the key
+func (k *Key) Public() *Key {
+	return &Key{Algorithm: k.Algorithm, KeyID: k.KeyID, PublicKey: k.PublicKey}
+}
+
+//check verifies the length of the key and that the seed matches the public key
+func (k *Key) check() error {
+	gen, pkSize, seedSize := keyGen(k.Algorithm)
+	if gen == nil {
+		return errors.New("cose: unknown algorithm")
+	}
+	if len(k.PublicKey) != pkSize {
+		return errors.New("cose: invalid public key length")
+	}
+	if k.Seed != nil {
+		if len(k.Seed) != seedSize {
+			return errors.New("cose: invalid private key length")
+		}
+		if pk, _ := gen(k.Seed); !bytes.Equal(pk, k.PublicKey) {
+			return errors.New("cose: private key does not match the public key")
+		}
+	}
+	return nil
+}
+
+//privateKey expands the seed into the private key of the dilithium or kyber package
+func (k *Key) privateKey() ([]byte, error) {
+	if k.Seed == nil {
+		return nil, errors.New("cose: not a private key")
+	}
+	if err := k.check(); err != nil {
+		return nil, err
+	}
+	gen, _, _ := keyGen(k.Algorithm)
+	_, sk := gen(k.Seed)
+	return sk, nil
+}
+
+//Marshal returns the COSE_Key encoding of the key, including the seed of private keys
+func (k *Key) Marshal() ([]byte, error) {
+	if err := k.check(); err != nil {
+		return nil, err
+	}
+	m := map[int64]interface{}{
+		keyParamType:      KeyTypeAKP,
+		keyParamAlgorithm: k.Algorithm,
+		keyParamPublic:    k.PublicKey,
+	}
+	if k.KeyID != nil {
+		m[keyParamID] = k.KeyID
+	}
+	if k.Seed != nil {
+		m[keyParamPrivate] = k.Seed
+	}
+	return cbor.Marshal(m)
+}
+
+//ParseKey decodes a COSE_Key and checks that its seed, if any, generates its public key
+func ParseKey(data []byte) (*Key, error) {
+	v, err := cbor.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("cose: malformed key")
+	}
+	if kty, ok := m[keyParamType].(int64); !ok || kty != KeyTypeAKP {
+		return nil, errors.New("cose: unsupported key type")
+	}
+	k := &Key{}
+	alg, ok1 := m[keyParamAlgorithm].(int64)
+	pk, ok2 := m[keyParamPublic].([]byte)
+	ok3 := true
+	k.Algorithm, k.PublicKey = alg, pk
+	if kid, present := m[keyParamID]; present {
+		k.KeyID, ok3 = kid.([]byte)
+	}
+	if seed, present := m[keyParamPrivate]; present {
+		if k.Seed, ok = seed.([]byte); !ok {
+			return nil, errors.New("cose: malformed private key")
+		}
+	}
+	if !ok1 || !ok2 || !ok3 {
+		return nil, errors.New("cose: malformed key")
+	}
+	if err := k.check(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
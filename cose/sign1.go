@@ -0,0 +1,150 @@
+package cose
+
+import (
+	"errors"
+
+	"github.com/kudelskisecurity/crystals-go/cose/cbor"
+)
+
+//SignOptions are the options of Sign1
+type SignOptions struct {
+	//ContentType is added to the protected header if not nil, as an integer or a text string
+	ContentType interface{}
+	//ExternalAAD is authenticated but not included in the message
+	ExternalAAD []byte
+	//Detached leaves the payload out of the message
+	Detached bool
+}
+
+//VerifyOptions are the options of VerifySign1
+type VerifyOptions struct {
+	ExternalAAD []byte
+	//Payload is the payload of detached messages
+	Payload []byte
+}
+
+//sigStructure returns the Sig_structure signed by a COSE_Sign1 message
+func sigStructure(protected, externalAAD, payload []byte) ([]byte, error) {
+	if externalAAD == nil {
+		externalAAD = []byte{}
+	}
+	return cbor.Marshal([]interface{}{"Signature1", protected, externalAAD, payload})
+}
+
+//Sign1 returns a tagged COSE_Sign1 message of the payload signed with an ML-DSA key. The algorithm is in the
+//protected header and the key ID, if any, in the unprotected header.
+func Sign1(payload []byte, key *Key, opts *SignOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &SignOptions{}
+	}
+	d := newDilithium(key.Algorithm)
+	if d == nil {
+		return nil, errors.New("cose: not a signing key")
+	}
+	sk, err := key.privateKey()
+	if err != nil {
+		return nil, err
+	}
+	headers := map[int64]interface{}{HeaderAlgorithm: key.Algorithm}
+	switch opts.ContentType.(type) {
+	case nil:
+	case int, int64, uint64, string:
+		headers[HeaderContentType] = opts.ContentType
+	default:
+		return nil, errors.New("cose: invalid content type")
+	}
+	protected, err := cbor.Marshal(headers)
+	if err != nil {
+		return nil, err
+	}
+	unprotected := map[int64]interface{}{}
+	if key.KeyID != nil {
+		unprotected[HeaderKeyID] = key.KeyID
+	}
+	if payload == nil {
+		payload = []byte{}
+	}
+	tbs, err := sigStructure(protected, opts.ExternalAAD, payload)
+	if err != nil {
+		return nil, err
+	}
+	sig := d.Sign(sk, tbs)
+	if sig == nil {
+		return nil, errors.New("cose: signature failed")
+	}
+	var content interface{} = payload
+	if opts.Detached {
+		content = nil
+	}
+	return cbor.Marshal(cbor.Tag{Number: TagSign1, Content: []interface{}{protected, unprotected, content, sig}})
+}
+
+//VerifySign1 checks a COSE_Sign1 message, tagged or not, with an ML-DSA public key and returns its payload
+func VerifySign1(msg []byte, key *Key, opts *VerifyOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+	d := newDilithium(key.Algorithm)
+	if d == nil || len(key.PublicKey) != d.SIZEPK() {
+		return nil, errors.New("cose: not a signature verification key")
+	}
+	protected, encoded, _, rest, err := parseMessage(msg, TagSign1, 4)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAlgorithm(protected, key); err != nil {
+		return nil, err
+	}
+	sig, ok := rest[1].([]byte)
+	if !ok {
+		return nil, errors.New("cose: malformed signature")
+	}
+	var payload []byte
+	switch p := rest[0].(type) {
+	case []byte:
+		payload = p
+	case nil:
+		if opts.Payload == nil {
+			return nil, errors.New("cose: detached payload missing")
+		}
+		payload = opts.Payload
+	default:
+		return nil, errors.New("cose: malformed payload")
+	}
+	tbs, err := sigStructure(encoded, opts.ExternalAAD, payload)
+	if err != nil {
+		return nil, err
+	}
+	if !d.Verify(key.PublicKey, tbs, sig) {
+		return nil, errors.New("cose: invalid signature")
+	}
+	return payload, nil
+}
+
+//MessageKeyID returns the key ID of the unprotected header of a COSE_Sign1 or COSE_Encrypt0 message, to look up the
+//verification or decryption key. It is nil if absent.
+func MessageKeyID(msg []byte) ([]byte, error) {
+	v, err := cbor.Unmarshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := v.(cbor.Tag); ok && (t.Number == TagSign1 || t.Number == TagEncrypt0) {
+		v = t.Content
+	}
+	a, ok := v.([]interface{})
+	if !ok || len(a) < 2 {
+		return nil, errors.New("cose: malformed message")
+	}
+	unprotected, ok := a[1].(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("cose: malformed message headers")
+	}
+	kid, present := unprotected[HeaderKeyID]
+	if !present {
+		return nil, nil
+	}
+	if b, ok := kid.([]byte); ok {
+		return b, nil
+	}
+	return nil, errors.New("cose: malformed key ID")
+}
@@ -3,6 +3,7 @@ package dilithium
 import (
 	"bytes"
 	"crypto/rand"
+	"crypto/sha512"
 	"crypto/subtle"
 
 	"golang.org/x/crypto/sha3"
@@ -18,20 +19,24 @@ func (d *Dilithium) KeyGen(seed []byte) ([]byte, []byte) {
 		rand.Read(seed)
 	}
 
-	var tr, rho, key [SEEDBYTES]byte
-	var rhoprime [2 * SEEDBYTES]byte
+	var rho, key [SEEDBYTES]byte
+	var tr, rhoprime [2 * SEEDBYTES]byte
+
+	K := d.params.K
+	L := d.params.L
+	ETA := d.params.ETA
 
 	state := sha3.NewShake256()
 	state.Write(seed)
+	if d.params.FIPS204 {
+		//domain separation of the parameter sets
+		state.Write([]byte{byte(K), byte(L)})
+	}
 	state.Read(rho[:])
 	state.Read(rhoprime[:])
 	state.Read(key[:])
 	state.Reset()
 
-	K := d.params.K
-	L := d.params.L
-	ETA := d.params.ETA
-
 	Ahat := expandSeed(rho, K, L)
 
 	s1 := make(Vec, L)
@@ -57,7 +62,7 @@ func (d *Dilithium) KeyGen(seed []byte) ([]byte, []byte) {
 		t1[i], t0[i] = polyPower2Round(t[i])
 	}
 	state.Write(append(rho[:], packT1(t1, K)...))
-	state.Read(tr[:])
+	state.Read(tr[:d.trBytes()])
 
 	return d.PackPK(PublicKey{T1: t1, Rho: rho}), d.PackSK(PrivateKey{Rho: rho, Key: key, Tr: tr, S1: s1, S2: s2, T0: t0})
 }
@@ -66,7 +71,46 @@ func (d *Dilithium) KeyGen(seed []byte) ([]byte, []byte) {
 //The signing key must be given as packed byte array.
 //The message should also be a byte array.
 //The returned signature is packed into a byte array. If an error occurs during the signature process, a nil signature is returned.
+//ML-DSA instances produce pure ML-DSA signatures with an empty context.
 func (d *Dilithium) Sign(packedSK, msg []byte) []byte {
+	if d.params.FIPS204 {
+		return d.sign(packedSK, []byte{0, 0}, msg)
+	}
+	return d.sign(packedSK, nil, msg)
+}
+
+//SignWithContext produces a pure ML-DSA signature on msg with a context string of at most 255 bytes.
+//It returns nil for round 3 Dilithium instances, which do not support contexts.
+func (d *Dilithium) SignWithContext(packedSK, msg, ctx []byte) []byte {
+	if !d.params.FIPS204 || len(ctx) > 255 {
+		println("Contexts are only supported by ML-DSA, up to 255 bytes.")
+		return nil
+	}
+	return d.sign(packedSK, append([]byte{0, byte(len(ctx))}, ctx...), msg)
+}
+
+//oidSHA512 is the DER encoded object identifier of SHA-512, 2.16.840.1.101.3.4.2.3, in HashML-DSA messages
+var oidSHA512 = []byte{0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03}
+
+//SignPrehashed produces a HashML-DSA signature with SHA-512 (FIPS 204, section 5.4) and a context string of at most 255 bytes.
+//digest is the SHA-512 hash of the message, which can so be hashed as it is read instead of being held in memory.
+//It returns nil for round 3 Dilithium instances and for digests that are not 64 bytes long.
+func (d *Dilithium) SignPrehashed(packedSK, digest, ctx []byte) []byte {
+	if !d.params.FIPS204 || len(ctx) > 255 || len(digest) != sha512.Size {
+		println("Prehashed signatures are only supported by ML-DSA, of SHA-512 digests and with contexts up to 255 bytes.")
+		return nil
+	}
+	return d.sign(packedSK, prehashPrefix(ctx), digest)
+}
+
+//prehashPrefix returns the domain separator, context and hash function identifier of HashML-DSA messages
+func prehashPrefix(ctx []byte) []byte {
+	prefix := append([]byte{1, byte(len(ctx))}, ctx...)
+	return append(prefix, oidSHA512...)
+}
+
+//sign signs prefix||msg, where prefix is the domain separator and context of ML-DSA
+func (d *Dilithium) sign(packedSK, prefix, msg []byte) []byte {
 	if len(packedSK) != d.SIZESK() {
 		println("Cannot sign with this key.")
 		return nil
@@ -80,18 +124,32 @@ func (d *Dilithium) Sign(packedSK, msg []byte) []byte {
 
 	var mu [2 * SEEDBYTES]byte
 	state := sha3.NewShake256()
-	state.Write(sk.Tr[:])
+	state.Write(sk.Tr[:d.trBytes()])
+	state.Write(prefix)
 	state.Write(msg)
 	state.Read(mu[:])
 	state.Reset()
 
 	var rhoP, rhoPRand [2 * SEEDBYTES]byte
-	state.Write(append(sk.Key[:], mu[:]...))
-	state.Read(rhoP[:])
-	state.Reset()
-
-	rand.Read(rhoPRand[:])
-	subtle.ConstantTimeCopy(d.params.RANDOMIZED, rhoP[:], rhoPRand[:])
+	if d.params.FIPS204 {
+		//rho'' = H(K || rnd || mu), with rnd all zero for deterministic signatures
+		var rnd [SEEDBYTES]byte
+		if d.params.RANDOMIZED == 1 {
+			rand.Read(rnd[:])
+		}
+		state.Write(sk.Key[:])
+		state.Write(rnd[:])
+		state.Write(mu[:])
+		state.Read(rhoP[:])
+		state.Reset()
+	} else {
+		state.Write(append(sk.Key[:], mu[:]...))
+		state.Read(rhoP[:])
+		state.Reset()
+
+		rand.Read(rhoPRand[:])
+		subtle.ConstantTimeCopy(d.params.RANDOMIZED, rhoP[:], rhoPRand[:])
+	}
 
 	s1hat := sk.S1.copy()
 	s2hat := sk.S2.copy()
@@ -127,21 +185,24 @@ rej:
 		w1[i], w0[i] = polyDecompose(w[i], d.params.GAMMA2)
 	}
 
-	var hc, zero [SEEDBYTES]byte
+	hc := make([]byte, d.params.CTILDE)
 	state.Write(mu[:])
 	state.Write(packW1(w1, K, d.params.POLYSIZEW1, d.params.GAMMA2))
-	state.Read(hc[:])
+	state.Read(hc)
 	state.Reset()
 
-	state.Write(mu[:])
-	state.Write(packW1(w0, K, d.params.POLYSIZEW1, d.params.GAMMA2))
-	state.Read(zero[:])
-	if bytes.Equal(zero[:], hc[:]) {
-		return nil
+	if !d.params.FIPS204 {
+		var zero [SEEDBYTES]byte
+		state.Write(mu[:])
+		state.Write(packW1(w0, K, d.params.POLYSIZEW1, d.params.GAMMA2))
+		state.Read(zero[:])
+		if bytes.Equal(zero[:], hc) {
+			return nil
+		}
+		state.Reset()
 	}
-	state.Reset()
 
-	c = challenge(hc[:], d.params.T)
+	c = challenge(hc, d.params.T)
 
 	chat := c
 	chat.ntt()
@@ -185,7 +246,7 @@ rej:
 	if n > d.params.OMEGA {
 		goto rej
 	}
-	return d.PackSig(z, h, hc[:])
+	return d.PackSig(z, h, hc)
 }
 
 //Verify uses the verification key to verify a signature given a msg.
@@ -193,7 +254,33 @@ rej:
 //The message should be a byte array.
 //The result of the verificatino is returned as a boolean, true is the verificatino succeeded, false otherwise.
 //If an error occurs during the verification, a false is returned.
+//ML-DSA instances verify pure ML-DSA signatures with an empty context.
 func (d *Dilithium) Verify(packedPK, msg, sig []byte) bool {
+	if d.params.FIPS204 {
+		return d.verify(packedPK, []byte{0, 0}, msg, sig)
+	}
+	return d.verify(packedPK, nil, msg, sig)
+}
+
+//VerifyWithContext verifies a pure ML-DSA signature on msg with a context string of at most 255 bytes.
+//It returns false for round 3 Dilithium instances.
+func (d *Dilithium) VerifyWithContext(packedPK, msg, sig, ctx []byte) bool {
+	if !d.params.FIPS204 || len(ctx) > 255 {
+		return false
+	}
+	return d.verify(packedPK, append([]byte{0, byte(len(ctx))}, ctx...), msg, sig)
+}
+
+//VerifyPrehashed verifies a HashML-DSA signature with SHA-512 of a message whose SHA-512 hash is digest, with a context
+//string of at most 255 bytes. It returns false for round 3 Dilithium instances.
+func (d *Dilithium) VerifyPrehashed(packedPK, digest, sig, ctx []byte) bool {
+	if !d.params.FIPS204 || len(ctx) > 255 || len(digest) != sha512.Size {
+		return false
+	}
+	return d.verify(packedPK, prehashPrefix(ctx), digest, sig)
+}
+
+func (d *Dilithium) verify(packedPK, prefix, msg, sig []byte) bool {
 	if len(sig) != d.SIZESIG() || len(packedPK) != d.SIZEPK() {
 		return false
 	}
@@ -206,14 +293,14 @@ func (d *Dilithium) Verify(packedPK, msg, sig []byte) bool {
 
 	c := challenge(hc[:], d.params.T)
 	Ahat := expandSeed(pk.Rho, K, L)
-	var tr [SEEDBYTES]byte
-	var mu [2 * SEEDBYTES]byte
+	var tr, mu [2 * SEEDBYTES]byte
 	state := sha3.NewShake256()
 	state.Write(append(pk.Rho[:], packT1(pk.T1, K)...))
-	state.Read(tr[:])
+	state.Read(tr[:d.trBytes()])
 	state.Reset()
 
-	state.Write(tr[:])
+	state.Write(tr[:d.trBytes()])
+	state.Write(prefix)
 	state.Write(msg)
 	state.Read(mu[:])
 	state.Reset()
@@ -240,10 +327,10 @@ func (d *Dilithium) Verify(packedPK, msg, sig []byte) bool {
 		w1[i].addQ()
 		w1[i] = polyUseHint(w1[i], h[i], d.params.GAMMA2)
 	}
-	var hc2 [SEEDBYTES]byte
+	hc2 := make([]byte, d.params.CTILDE)
 	state.Write(mu[:])
 	state.Write(packW1(w1, K, d.params.POLYSIZEW1, d.params.GAMMA2))
-	state.Read(hc2[:])
+	state.Read(hc2)
 
-	return z.vecIsBelow(d.params.GAMMA1-d.params.BETA, L) && bytes.Equal(hc, hc2[:]) && h.sum(K) <= d.params.OMEGA
+	return z.vecIsBelow(d.params.GAMMA1-d.params.BETA, L) && bytes.Equal(hc, hc2) && h.sum(K) <= d.params.OMEGA
 }
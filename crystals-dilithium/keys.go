@@ -14,8 +14,16 @@ type PrivateKey struct {
 	S2  Vec //K
 	Rho [SEEDBYTES]byte
 	Key [SEEDBYTES]byte
-	Tr  [SEEDBYTES]byte
-	T0  Vec //K
+	Tr  [2 * SEEDBYTES]byte //only the first SEEDBYTES bytes are used by round 3 Dilithium
+	T0  Vec                 //K
+}
+
+//trBytes returns the length of tr, the hash of the public key
+func (d *Dilithium) trBytes() int {
+	if d.params.FIPS204 {
+		return 2 * SEEDBYTES
+	}
+	return SEEDBYTES
 }
 
 //SIZEPK returns the size in bytes of the public key of a dilithium instance
@@ -57,8 +65,8 @@ func (d *Dilithium) PackSK(sk PrivateKey) []byte {
 	id += SEEDBYTES
 	subtle.ConstantTimeCopy(1, packedSK[id:id+SEEDBYTES], sk.Key[:])
 	id += SEEDBYTES
-	subtle.ConstantTimeCopy(1, packedSK[id:id+SEEDBYTES], sk.Tr[:])
-	id += SEEDBYTES
+	subtle.ConstantTimeCopy(1, packedSK[id:id+d.trBytes()], sk.Tr[:d.trBytes()])
+	id += d.trBytes()
 	L := d.params.L
 	ETA := d.params.ETA
 	POLYSIZES := d.params.POLYSIZES
@@ -79,8 +87,8 @@ func (d *Dilithium) UnpackSK(packedSK []byte) PrivateKey {
 	id += SEEDBYTES
 	subtle.ConstantTimeCopy(1, sk.Key[:], packedSK[id:id+SEEDBYTES])
 	id += SEEDBYTES
-	subtle.ConstantTimeCopy(1, sk.Tr[:], packedSK[id:id+SEEDBYTES])
-	id += SEEDBYTES
+	subtle.ConstantTimeCopy(1, sk.Tr[:d.trBytes()], packedSK[id:id+d.trBytes()])
+	id += d.trBytes()
 	L := d.params.L
 	ETA := d.params.ETA
 	POLYSIZES := d.params.POLYSIZES
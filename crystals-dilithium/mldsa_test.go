@@ -0,0 +1,130 @@
+package dilithium
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/sha3"
+)
+
+func TestMLDSAVectors(t *testing.T) {
+	f, err := os.Open("testdata/MLDSA_vectors.rsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var d *Dilithium
+	var pk, sk, msg, ctx []byte
+	r := bufio.NewScanner(f)
+	for r.Scan() {
+		fields := strings.Split(r.Text(), " = ")
+		if len(fields) != 2 {
+			continue
+		}
+		val, _ := hex.DecodeString(fields[1])
+		switch fields[0] {
+		case "name":
+			switch fields[1] {
+			case "ML-DSA-44":
+				d = NewMLDSA44(false)
+			case "ML-DSA-65":
+				d = NewMLDSA65(false)
+			case "ML-DSA-87":
+				d = NewMLDSA87(false)
+			}
+		case "seed":
+			pk, sk = d.KeyGen(val)
+		case "pkhash":
+			h := sha3.Sum256(pk)
+			if !bytes.Equal(h[:], val) {
+				t.Fatalf("%s: pk mismatch", d.Name)
+			}
+		case "msg":
+			msg = val
+		case "ctx":
+			ctx = val
+		case "sighash":
+			sig := d.SignWithContext(sk, msg, ctx)
+			h := sha3.Sum256(sig)
+			if !bytes.Equal(h[:], val) {
+				t.Fatalf("%s: signature mismatch", d.Name)
+			}
+			if !d.VerifyWithContext(pk, msg, sig, ctx) {
+				t.Fatalf("%s: signature rejected", d.Name)
+			}
+		}
+	}
+}
+
+func TestMLDSA(t *testing.T) {
+	for _, d := range []*Dilithium{NewMLDSA44(), NewMLDSA65(), NewMLDSA87()} {
+		if !d.IsMLDSA() || NewDilithium3().IsMLDSA() {
+			t.Fatal("unexpected IsMLDSA")
+		}
+		pk, sk := d.KeyGen(nil)
+		msg := []byte("message")
+		sig := d.Sign(sk, msg)
+		if len(sig) != d.SIZESIG() || !d.Verify(pk, msg, sig) {
+			t.Fatal(d.Name, "signature rejected")
+		}
+		//Sign uses the empty context
+		if !d.VerifyWithContext(pk, msg, sig, nil) || d.VerifyWithContext(pk, msg, sig, []byte("ctx")) {
+			t.Fatal(d.Name, "unexpected context handling")
+		}
+		if d.SignWithContext(sk, msg, make([]byte, 256)) != nil {
+			t.Fatal(d.Name, "context longer than 255 bytes accepted")
+		}
+		sig[len(sig)/2] ^= 1
+		if d.Verify(pk, msg, sig) {
+			t.Fatal(d.Name, "modified signature accepted")
+		}
+	}
+	//the same seed gives different keys for round 3 Dilithium and ML-DSA
+	seed := make([]byte, SEEDBYTES)
+	pk2, _ := NewDilithium2().KeyGen(seed)
+	pk44, _ := NewMLDSA44().KeyGen(seed)
+	if bytes.Equal(pk2, pk44) {
+		t.Fatal("ML-DSA keys are not domain separated")
+	}
+	if NewDilithium2().SignWithContext(make([]byte, Dilihtium2SizeSK), nil, nil) != nil {
+		t.Fatal("round 3 Dilithium signed with a context")
+	}
+}
+
+//TestPrehashed checks HashML-DSA with SHA-512 against deterministic signatures of the message representative computed
+//by the ML-DSA external mu signing of the Go standard library
+func TestPrehashed(t *testing.T) {
+	seed := bytes.Repeat([]byte{7}, SEEDBYTES)
+	digest := sha512.Sum512([]byte("a large file"))
+	ctx := []byte("ctx")
+	for d, want := range map[*Dilithium]string{
+		NewMLDSA44(false): "b89666209b4abed96f9dd7f375158c1a442dd69d8da344bdaa5f1306f52429bc",
+		NewMLDSA65(false): "a582d9dc4a90c8540fa80ecc493acde5ff151da0b2ea47c50f069a64b9476621",
+		NewMLDSA87(false): "07594d2bb35a04dc0284185448a38d6fe17526ccd70e6a1ac12b796fa6c22a1d",
+	} {
+		pk, sk := d.KeyGen(seed)
+		sig := d.SignPrehashed(sk, digest[:], ctx)
+		if h := sha256.Sum256(sig); hex.EncodeToString(h[:]) != want {
+			t.Fatal(d.Name, "unexpected signature")
+		}
+		if !d.VerifyPrehashed(pk, digest[:], sig, ctx) {
+			t.Fatal(d.Name, "signature rejected")
+		}
+		//HashML-DSA and pure ML-DSA signatures are domain separated
+		if d.Verify(pk, digest[:], sig) || d.VerifyPrehashed(pk, digest[:], d.SignWithContext(sk, digest[:], ctx), ctx) {
+			t.Fatal(d.Name, "pure and prehashed signatures are not domain separated")
+		}
+		if d.VerifyPrehashed(pk, digest[:], sig, nil) || d.SignPrehashed(sk, digest[:32], ctx) != nil {
+			t.Fatal(d.Name, "unexpected context or digest handling")
+		}
+	}
+	if NewDilithium2().SignPrehashed(make([]byte, Dilihtium2SizeSK), digest[:], nil) != nil {
+		t.Fatal("round 3 Dilithium signed a digest")
+	}
+}
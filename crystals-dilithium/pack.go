@@ -301,10 +301,11 @@ func (d *Dilithium) PackSig(z Vec, h Vec, hc []byte) []byte {
 	L := d.params.L
 	OMEGA := d.params.OMEGA
 	POLYSIZEZ := d.params.POLYSIZEZ
+	CTILDE := d.params.CTILDE
 	sigP := make([]byte, d.params.SIZESIG)
-	copy(sigP[:32], hc[:])
-	copy(sigP[32:], packZ(z, L, POLYSIZEZ, d.params.GAMMA1))
-	copy(sigP[32+L*POLYSIZEZ:], packH(h, K, OMEGA))
+	copy(sigP[:CTILDE], hc[:])
+	copy(sigP[CTILDE:], packZ(z, L, POLYSIZEZ, d.params.GAMMA1))
+	copy(sigP[CTILDE+L*POLYSIZEZ:], packH(h, K, OMEGA))
 	return sigP[:]
 }
 
@@ -317,9 +318,9 @@ func (d *Dilithium) UnpackSig(sig []byte) (Vec, Vec, []byte) {
 	}
 	OMEGA := d.params.OMEGA
 	POLYSIZEZ := d.params.POLYSIZEZ
-	id := 32
+	id := d.params.CTILDE
 	z := unpackZ(sig[id:], L, POLYSIZEZ, d.params.GAMMA1)
 	id += L * POLYSIZEZ
 	h := unpackH(sig[id:], K, OMEGA)
-	return z, h, sig[:32]
+	return z, h, sig[:d.params.CTILDE]
 }
@@ -26,6 +26,13 @@ const (
 	Dilithium5SizePK  = 2592
 	Dilihtium5SizeSK  = 4864
 	Dilithium5SizeSig = 4595
+
+	MLDSA44SizeSK  = 2560
+	MLDSA44SizeSig = 2420
+	MLDSA65SizeSK  = 4032
+	MLDSA65SizeSig = 3309
+	MLDSA87SizeSK  = 4896
+	MLDSA87SizeSig = 4627
 )
 
 //Dilithium struct defines the internal parameters to be used given a security level
@@ -51,6 +58,8 @@ type parameters struct {
 	SIZESK     int //= SIZEZ + 32 + SIZEPK + K*POLYSIZE
 	SIZESIG    int
 	RANDOMIZED int //deterministic or randomized signature
+	FIPS204    bool
+	CTILDE     int //length of the commitment hash, 32 bytes in round 3
 }
 
 //NewDilithium2 defines a dilithium instance with a light security level. The signature is randomized expect if a false boolean is given as argument.
@@ -77,6 +86,7 @@ func NewDilithium2(randomized ...bool) *Dilithium {
 			SIZEPK:     32 + 4*polySizeT1,
 			SIZESK:     32 + 32 + 32 + 4*polySizeT0 + (4+4)*96,
 			SIZESIG:    32 + 4*576 + 4 + 80,
+			CTILDE:     32,
 		}}
 }
 
@@ -104,6 +114,7 @@ func NewDilithium3(randomized ...bool) *Dilithium {
 			SIZEPK:     32 + 6*polySizeT1,
 			SIZESK:     32 + 32 + 32 + 6*polySizeT0 + (5+6)*128,
 			SIZESIG:    32 + 5*640 + 6 + 55,
+			CTILDE:     32,
 		}}
 }
 
@@ -131,9 +142,43 @@ func NewDilithium5(randomized ...bool) *Dilithium {
 			SIZEPK:     32 + 8*polySizeT1,
 			SIZESK:     32 + 32 + 32 + 8*polySizeT0 + (8+7)*96,
 			SIZESIG:    32 + 7*640 + 8 + 75,
+			CTILDE:     32,
 		}}
 }
 
+//mldsa turns a round 3 instance into its FIPS 204 counterpart: tr is 64 bytes long and the commitment hash ctilde bytes
+func mldsa(d *Dilithium, name string, ctilde int) *Dilithium {
+	d.Name = name
+	d.params.FIPS204 = true
+	d.params.SIZESK += SEEDBYTES
+	d.params.SIZESIG += ctilde - d.params.CTILDE
+	d.params.CTILDE = ctilde
+	return d
+}
+
+//NewMLDSA44 defines an ML-DSA instance (FIPS 204) with a light security level. The signature is hedged except if a false boolean is given as argument.
+//It shares its parameters with Dilithium2 but derives keys, message representatives and challenges as specified in the standard.
+func NewMLDSA44(randomized ...bool) *Dilithium {
+	return mldsa(NewDilithium2(randomized...), "ML-DSA-44", 32)
+}
+
+//NewMLDSA65 defines an ML-DSA instance (FIPS 204) with a medium security level. The signature is hedged except if a false boolean is given as argument.
+//It shares its parameters with Dilithium3 but derives keys, message representatives and challenges as specified in the standard.
+func NewMLDSA65(randomized ...bool) *Dilithium {
+	return mldsa(NewDilithium3(randomized...), "ML-DSA-65", 48)
+}
+
+//NewMLDSA87 defines an ML-DSA instance (FIPS 204) with a very high security level. The signature is hedged except if a false boolean is given as argument.
+//It shares its parameters with Dilithium5 but derives keys, message representatives and challenges as specified in the standard.
+func NewMLDSA87(randomized ...bool) *Dilithium {
+	return mldsa(NewDilithium5(randomized...), "ML-DSA-87", 64)
+}
+
+//IsMLDSA returns true if the instance follows FIPS 204 (ML-DSA) rather than round 3 Dilithium.
+func (d *Dilithium) IsMLDSA() bool {
+	return d.params.FIPS204
+}
+
 //NewDilithiumUnsafe is a skeleton function to be used for research purposes when wanting to use a dilithium instance with parameters that differ from the recommended ones.
 func NewDilithiumUnsafe(q, d, tau, gamma1, gamma2, k, l, eta, omega int) *Dilithium {
 	return &Dilithium{
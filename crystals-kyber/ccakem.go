@@ -24,19 +24,28 @@ func (k *Kyber) KeyGen(seed []byte) ([]byte, []byte) {
 //A 32 byte long seed can be given as argument (coins). If a nil seed is given, the seed is generated using Go crypto's random number generator.
 //The shared secret and ciphertext returned are packed into byte arrays.
 //If an error occurs during the encaps process, nil arrays are returned.
+//For ML-KEM instances, the coins are used as the message m of FIPS 203 and the public key must pass the modulus check.
 func (k *Kyber) Encaps(packedPK, coins []byte) ([]byte, []byte) {
 	if len(packedPK) != k.SIZEPK() {
 		println("Public key does not have the correct size.")
 		return nil, nil
 	}
+	if k.params.FIPS203 && !k.checkPK(packedPK) {
+		println("Public key is not correctly encoded.")
+		return nil, nil
+	}
 	if coins == nil || len(coins) != SEEDBYTES {
 		coins = make([]byte, SEEDBYTES)
 		rand.Read(coins[:])
 	}
 	var m, ss [32]byte
 	hState := sha3.New256()
-	hState.Write(coins[:])
-	copy(m[:], hState.Sum(nil))
+	if k.params.FIPS203 {
+		copy(m[:], coins)
+	} else {
+		hState.Write(coins[:])
+		copy(m[:], hState.Sum(nil))
+	}
 
 	hpk := make([]byte, 32)
 	hState.Reset()
@@ -51,6 +60,10 @@ func (k *Kyber) Encaps(packedPK, coins []byte) ([]byte, []byte) {
 	copy(kc[:32], kr[:32])
 
 	c := k.Encrypt(packedPK, m[:], kr[32:])
+	if k.params.FIPS203 {
+		copy(ss[:], kr[:32])
+		return c[:], ss[:]
+	}
 
 	hState.Reset()
 	hState.Write(c[:])
@@ -88,8 +101,18 @@ func (k *Kyber) Decaps(packedSK, c []byte) []byte {
 	copy(kc[:], kr[:32])
 
 	c2 := k.Encrypt(sk.Pk, m, kr[32:])
+	if k.params.FIPS203 {
+		var ss, ssBar [32]byte
+		jState := sha3.NewShake256()
+		jState.Write(sk.Z[:])
+		jState.Write(c)
+		jState.Read(ssBar[:])
+		copy(ss[:], kr[:32])
+		subtle.ConstantTimeCopy(1-subtle.ConstantTimeCompare(c, c2), ss[:], ssBar[:])
+		return ss[:]
+	}
 	hState.Reset()
-	hState.Write(c2[:])
+	hState.Write(c[:])
 	copy(kc[32:], hState.Sum(nil))
 
 	subtle.ConstantTimeCopy(1-subtle.ConstantTimeCompare(c, c2), kc[:32], sk.Z[:])
@@ -1,10 +1,16 @@
 package kyber
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"os"
+	"strings"
 	"testing"
+
+	"golang.org/x/crypto/sha3"
 )
 
 func TestKEMSuite(t *testing.T) {
@@ -19,6 +25,23 @@ func TestKEMSuite(t *testing.T) {
 	testBadSize(t, NewKyber512())
 	testBadSize(t, NewKyber768())
 	testBadSize(t, NewKyber1024())
+
+	testKeyGenKEMRep(t, NewMLKEM512())
+	testKeyGenKEMRep(t, NewMLKEM768())
+	testKeyGenKEMRep(t, NewMLKEM1024())
+
+	testDecaps(t, NewMLKEM512())
+	testDecaps(t, NewMLKEM768())
+	testDecaps(t, NewMLKEM1024())
+
+	testBadSize(t, NewMLKEM512())
+	testBadSize(t, NewMLKEM768())
+	testBadSize(t, NewMLKEM1024())
+
+	testRejection(t, NewKyber768())
+	testRejection(t, NewMLKEM512())
+	testRejection(t, NewMLKEM768())
+	testRejection(t, NewMLKEM1024())
 }
 
 func testKeyGenKEMRep(t *testing.T, k *Kyber) {
@@ -60,3 +83,104 @@ func testBadSize(t *testing.T, k *Kyber) {
 		t.Fatal("Decaps should not work with empty inputs.")
 	}
 }
+
+func testRejection(t *testing.T, k *Kyber) {
+	seed := make([]byte, 64)
+	rand.Read(seed)
+	pk, sk := k.KeyGen(seed)
+	c, ss := k.Encaps(pk, nil)
+	c[0] ^= 1
+	ss2 := k.Decaps(sk, c)
+	if bytes.Equal(ss, ss2) {
+		t.Fatal("Decaps accepted a modified ciphertext")
+	}
+	//the rejection key is derived from z, which is not part of the public key
+	_, sk2 := k.KeyGen(append(seed[:32:32], make([]byte, 32)...))
+	if bytes.Equal(ss2, k.Decaps(sk2, c)) {
+		t.Fatal("Implicit rejection does not depend on z")
+	}
+}
+
+func TestMLKEMEncapsBadKey(t *testing.T) {
+	k := NewMLKEM768()
+	pk, _ := k.KeyGen(nil)
+	pk[0], pk[1] = 0xff, 0xff //first coefficient becomes 4095 > q
+	if c, ss := k.Encaps(pk, nil); c != nil || ss != nil {
+		t.Fatal("Encaps should reject a public key failing the modulus check.")
+	}
+}
+
+func TestMLKEMVectors(t *testing.T) {
+	f, err := os.Open("testdata/MLKEM_vectors.rsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var k *Kyber
+	var pk, sk, ct, ss []byte
+	r := bufio.NewScanner(f)
+	r.Buffer(nil, 1<<16)
+	for r.Scan() {
+		fields := strings.Split(r.Text(), " = ")
+		if len(fields) != 2 {
+			continue
+		}
+		val, _ := hex.DecodeString(fields[1])
+		switch fields[0] {
+		case "name":
+			switch fields[1] {
+			case "ML-KEM-512":
+				k = NewMLKEM512()
+			case "ML-KEM-768":
+				k = NewMLKEM768()
+			case "ML-KEM-1024":
+				k = NewMLKEM1024()
+			}
+		case "seed":
+			pk, sk = k.KeyGen(val)
+		case "pkhash":
+			h := sha3.Sum256(pk)
+			if !bytes.Equal(h[:], val) {
+				t.Fatalf("%s: pk mismatch", k.Name)
+			}
+		case "ct":
+			ct = val
+		case "ss":
+			ss = k.Decaps(sk, ct)
+			if !bytes.Equal(ss, val) {
+				t.Fatalf("%s: ss mismatch", k.Name)
+			}
+		case "rejss":
+			ct[0] ^= 0xff
+			if !bytes.Equal(k.Decaps(sk, ct), val) {
+				t.Fatalf("%s: implicit rejection mismatch", k.Name)
+			}
+		}
+	}
+}
+
+//TestImplicitRejection checks the shared secret of round 3 Kyber for an invalid ciphertext, KDF(z || H(c)), against
+//the reference implementation (vectors computed with CIRCL). The key pair is generated from the seed of bytes 0 to 63
+//and the ciphertext is encapsulated with coins of bytes 1, then its first bit flipped.
+func TestImplicitRejection(t *testing.T) {
+	for _, v := range []struct {
+		k  *Kyber
+		ss string
+	}{
+		{NewKyber512(), "d391f260ca80c233327ab2b27199e8a927adaa5eb90d3eeede20799e0c3819d9"},
+		{NewKyber768(), "e5e8a0909813492acfc6bf67970a288649fb2f4a28380505035e690711c2631a"},
+		{NewKyber1024(), "b06e01420a109d5b8ba543a630e33900e3c313736f88db2820315ef9149fd5a3"},
+	} {
+		seed := make([]byte, 64)
+		for i := range seed {
+			seed[i] = byte(i)
+		}
+		pk, sk := v.k.KeyGen(seed)
+		c, ss := v.k.Encaps(pk, bytes.Repeat([]byte{1}, 32))
+		c[0] ^= 1
+		ss2 := v.k.Decaps(sk, c)
+		if hex.EncodeToString(ss2) != v.ss || bytes.Equal(ss, ss2) {
+			t.Fatalf("unexpected shared secret for an invalid ciphertext %x", ss2)
+		}
+	}
+}
@@ -21,6 +21,9 @@ func (k *Kyber) PKEKeyGen(seed []byte) ([]byte, []byte) {
 	var rho, sseed [SEEDBYTES]byte
 	state := sha3.New512()
 	state.Write(seed)
+	if k.params.FIPS203 {
+		state.Write([]byte{byte(K)}) //domain separation of FIPS 203
+	}
 	hash := state.Sum(nil)
 	copy(rho[:], hash[:32])
 	copy(sseed[:], hash[32:])
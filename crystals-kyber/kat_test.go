@@ -10,6 +10,8 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+
+	"golang.org/x/crypto/sha3"
 )
 
 //helpers (see NIST's PQCgenKAT.c)
@@ -199,3 +201,58 @@ func testKAT(t *testing.T, k *Kyber) {
 		}
 	}
 }
+
+//TestKATImplicitRejection checks the implicit rejection of round 3 Kyber with the keys of the round 3 KAT files. z is
+//the second 32 bytes drawn from the DRBG seeded with the seed of a vector, and must be the last 32 bytes of the
+//private key. The KAT ciphertexts are all valid: with one bit flipped, the shared secret must be KDF(z || H(c)).
+func TestKATImplicitRejection(t *testing.T) {
+	for _, k := range []*Kyber{NewKyber512(), NewKyber768(), NewKyber1024()} {
+		katfile, err := os.Open(fmt.Sprintf("testdata/PQCkemKAT_%d.rsp", k.params.SIZESK))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := bufio.NewScanner(katfile)
+		r.Buffer(nil, 1<<16)
+		var z, sk, ct []byte
+		vectors := 0
+		for r.Scan() {
+			fields := strings.Split(r.Text(), " = ")
+			if len(fields) != 2 {
+				continue
+			}
+			val, _ := hex.DecodeString(fields[1])
+			switch fields[0] {
+			case "seed":
+				var seed [48]byte
+				copy(seed[:], val)
+				g := randombyteInit(&seed)
+				z = make([]byte, 32)
+				g.randombytes(z)
+				g.randombytes(z)
+			case "sk":
+				sk = val
+			case "ct":
+				ct = val
+			case "ss":
+				if !bytes.Equal(k.UnpackSK(sk).Z, z) {
+					t.Fatal(k.Name, "z is not read from the end of the private key")
+				}
+				if !bytes.Equal(k.Decaps(sk, ct), val) {
+					t.Fatal(k.Name, "shared secret mismatch")
+				}
+				ct[0] ^= 1
+				h := sha3.Sum256(ct)
+				want := make([]byte, 32)
+				sha3.ShakeSum256(want, append(append([]byte{}, z...), h[:]...))
+				if !bytes.Equal(k.Decaps(sk, ct), want) {
+					t.Fatal(k.Name, "unexpected shared secret for an invalid ciphertext")
+				}
+				vectors++
+			}
+		}
+		katfile.Close()
+		if vectors == 0 {
+			t.Fatal(k.Name, "no KAT vector")
+		}
+	}
+}
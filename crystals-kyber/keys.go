@@ -103,5 +103,11 @@ func (k *Kyber) UnpackSK(psk []byte) *PrivateKey {
 	}
 	SIZEPKESK := k.params.SIZEPKESK
 	SIZEPK := k.params.SIZEPK
-	return &PrivateKey{Z: psk[SIZEPKESK+SIZEPK : SIZEPKESK+SIZEPK+32], SkP: psk[:SIZEPKESK], Pk: psk[SIZEPKESK : SIZEPKESK+SIZEPK]}
+	return &PrivateKey{Z: psk[SIZEPKESK+SIZEPK+32:], SkP: psk[:SIZEPKESK], Pk: psk[SIZEPKESK : SIZEPKESK+SIZEPK]}
+}
+
+//checkPK performs the modulus check of FIPS 203 on a packed public key: every coefficient must be reduced mod q
+func (k *Kyber) checkPK(packedPK []byte) bool {
+	t := packedPK[:k.params.K*polysize]
+	return subtle.ConstantTimeCompare(pack(unpack(t, k.params.K), k.params.K), t) == 1
 }
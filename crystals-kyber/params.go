@@ -45,6 +45,7 @@ type parameters struct {
 	SIZESK    int //= SIZEZ + 32 + SIZEPK + K*POLYSIZE
 	SIZEPKESK int //= K * POLYSIZE
 	SIZEC     int
+	FIPS203   bool //ML-KEM as standardized in FIPS 203 instead of round 3 Kyber
 }
 
 //NewKyber512 defines a kyber instance with a light security level.
@@ -95,6 +96,38 @@ func NewKyber1024() *Kyber {
 		}}
 }
 
+//NewMLKEM512 defines an ML-KEM instance (FIPS 203) with a light security level.
+//It shares its parameters and sizes with Kyber512 but derives keys and shared secrets as specified in the standard.
+func NewMLKEM512() *Kyber {
+	k := NewKyber512()
+	k.Name = "ML-KEM-512"
+	k.params.FIPS203 = true
+	return k
+}
+
+//NewMLKEM768 defines an ML-KEM instance (FIPS 203) with a medium security level.
+//It shares its parameters and sizes with Kyber768 but derives keys and shared secrets as specified in the standard.
+func NewMLKEM768() *Kyber {
+	k := NewKyber768()
+	k.Name = "ML-KEM-768"
+	k.params.FIPS203 = true
+	return k
+}
+
+//NewMLKEM1024 defines an ML-KEM instance (FIPS 203) with a very high security level.
+//It shares its parameters and sizes with Kyber1024 but derives keys and shared secrets as specified in the standard.
+func NewMLKEM1024() *Kyber {
+	k := NewKyber1024()
+	k.Name = "ML-KEM-1024"
+	k.params.FIPS203 = true
+	return k
+}
+
+//IsMLKEM returns true if the instance follows FIPS 203 (ML-KEM) rather than round 3 Kyber.
+func (k *Kyber) IsMLKEM() bool {
+	return k.params.FIPS203
+}
+
 //NewKyberUnsafe is a skeleton function to be used for research purposes when wanting to use a kyber instance with parameters that differ from the recommended ones.
 func NewKyberUnsafe(n, k, q, eta1, et2, du, dv int) *Kyber {
 	return &Kyber{
@@ -3,6 +3,7 @@ module github.com/kudelskisecurity/crystals-go
 go 1.16
 
 require (
+	filippo.io/edwards25519 v1.0.0
 	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
 	golang.org/x/sys v0.0.0-20210119212857-b64e53b001e4 // indirect
 )
@@ -0,0 +1,118 @@
+//Package cli runs the command line tools of this module: each tool is a program made of commands with their own
+//flags, selected by the first argument.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+//Program is a command line tool
+type Program struct {
+	Name string
+	//Synopsis follows the command in the usage message, "[flags]" if empty
+	Synopsis string
+	//Commands are listed in this order by the usage message
+	Commands []Subcommand
+}
+
+//Subcommand is a command of a program, run with its flag set and the standard streams
+type Subcommand struct {
+	Name    string
+	Summary string
+	Run     func(*Command) error
+}
+
+//Command holds the flags, the arguments and the streams of the command being run
+type Command struct {
+	*flag.FlagSet
+	Stdin  io.Reader
+	Stdout io.Writer
+	args   []string
+}
+
+//usage returns the usage message of the program, listing its commands
+func (p *Program) usage() string {
+	synopsis := p.Synopsis
+	if synopsis == "" {
+		synopsis = "[flags]"
+	}
+	width := 0
+	for _, s := range p.Commands {
+		if len(s.Name) > width {
+			width = len(s.Name)
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "usage: %s <command> %s\n\ncommands:\n", p.Name, synopsis)
+	for _, s := range p.Commands {
+		fmt.Fprintf(&b, "  %-*s  %s\n", width, s.Name, s.Summary)
+	}
+	fmt.Fprintf(&b, "\nRun %s <command> -h for the flags of a command.\n", p.Name)
+	return b.String()
+}
+
+//Run runs the command named by the first argument with the remaining arguments. Without arguments, the usage
+//message is printed to stderr and flag.ErrHelp returned.
+func (p *Program) Run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, p.usage())
+		return flag.ErrHelp
+	}
+	for _, s := range p.Commands {
+		if s.Name == args[0] {
+			c := &Command{FlagSet: flag.NewFlagSet(s.Name, flag.ContinueOnError), Stdin: stdin, Stdout: stdout, args: args[1:]}
+			c.SetOutput(stderr)
+			return s.Run(c)
+		}
+	}
+	fmt.Fprint(stderr, p.usage())
+	return errors.New("unknown command " + args[0])
+}
+
+//Main runs the program with the arguments of the process and exits. The exit status is 0 on success, 1 for the
+//failure error, or for any error if failure is nil, and 2 for other errors. Errors are printed to stderr, except
+//flag.ErrHelp whose usage message already was.
+func (p *Program) Main(failure error) {
+	err := p.Run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	if err == nil {
+		return
+	}
+	if err != flag.ErrHelp {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", p.Name, err)
+	}
+	if failure == nil || err == failure {
+		os.Exit(1)
+	}
+	os.Exit(2)
+}
+
+//ParseArgs parses the flags and checks that nargs positional arguments follow them, or any number if nargs is
+//negative
+func (c *Command) ParseArgs(nargs int) error {
+	if err := c.Parse(c.args); err != nil {
+		return err
+	}
+	switch {
+	case nargs < 0:
+	case c.NArg() > nargs:
+		return errors.New("unexpected argument " + c.Arg(nargs))
+	case c.NArg() < nargs:
+		return errors.New("missing argument")
+	}
+	return nil
+}
+
+//Required checks that flags holding file names were set
+func Required(names map[string]*string) error {
+	for name, value := range names {
+		if *value == "" {
+			return errors.New("missing -" + name)
+		}
+	}
+	return nil
+}
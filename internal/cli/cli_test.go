@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var program = &Program{Name: "test", Commands: []Subcommand{
+	{Name: "echo", Summary: "print the arguments", Run: echo},
+	{Name: "copy-in", Summary: "copy stdin to stdout", Run: copyIn},
+}}
+
+func echo(c *Command) error {
+	out := c.String("out", "", "required flag")
+	if err := c.ParseArgs(-1); err != nil {
+		return err
+	}
+	if err := Required(map[string]*string{"out": out}); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.Stdout, *out, strings.Join(c.Args(), " "))
+	return nil
+}
+
+func copyIn(c *Command) error {
+	if err := c.ParseArgs(1); err != nil {
+		return err
+	}
+	_, err := c.Stdout.(*bytes.Buffer).ReadFrom(c.Stdin)
+	return err
+}
+
+func run(args ...string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	err := program.Run(args, strings.NewReader("input"), &stdout, &stderr)
+	return stdout.String(), stderr.String(), err
+}
+
+func TestUsage(t *testing.T) {
+	const usage = `usage: test <command> [flags]
+
+commands:
+  echo     print the arguments
+  copy-in  copy stdin to stdout
+
+Run test <command> -h for the flags of a command.
+`
+	if _, stderr, err := run(); err != flag.ErrHelp || stderr != usage {
+		t.Fatalf("unexpected usage %q, %v", stderr, err)
+	}
+	if _, stderr, err := run("unknown"); err == nil || stderr != usage {
+		t.Fatal("unknown command accepted")
+	}
+	if _, stderr, err := run("echo", "-h"); err != flag.ErrHelp || !strings.Contains(stderr, "-out") {
+		t.Fatal("flags of the command not printed")
+	}
+}
+
+func TestArgs(t *testing.T) {
+	if stdout, _, err := run("echo", "-out", "a", "b", "c"); err != nil || stdout != "a b c\n" {
+		t.Fatal("unexpected output", stdout, err)
+	}
+	if _, _, err := run("echo", "b"); err == nil || err.Error() != "missing -out" {
+		t.Fatal("missing flag accepted", err)
+	}
+	if stdout, _, err := run("copy-in", "x"); err != nil || stdout != "input" {
+		t.Fatal("unexpected output", stdout, err)
+	}
+	for _, args := range [][]string{{"copy-in"}, {"copy-in", "x", "y"}, {"copy-in", "-unknown", "x"}} {
+		if _, _, err := run(args...); err == nil || errors.Is(err, flag.ErrHelp) {
+			t.Fatal("invalid arguments accepted", args)
+		}
+	}
+}
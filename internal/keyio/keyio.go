@@ -0,0 +1,147 @@
+//Package keyio reads and writes the keys, ciphertexts and signatures handled by the command line tools of this
+//module, as raw bytes, hex, base64 or PEM, from and to files or the standard streams.
+package keyio
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+//Formats
+const (
+	Raw    = "raw"
+	Hex    = "hex"
+	Base64 = "base64"
+	PEM    = "pem"
+	//Auto detects the format when decoding
+	Auto = "auto"
+)
+
+//Encode encodes data in a format, with the PEM block type used by PEM. Text formats end with a newline.
+func Encode(data []byte, format, pemType string) ([]byte, error) {
+	switch format {
+	case Raw:
+		return data, nil
+	case Hex:
+		return []byte(hex.EncodeToString(data) + "\n"), nil
+	case Base64:
+		return []byte(base64.StdEncoding.EncodeToString(data) + "\n"), nil
+	case PEM:
+		return pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: data}), nil
+	}
+	return nil, errors.New("unknown format " + format + ", expected raw, hex, base64 or pem")
+}
+
+//Decode decodes data in a format, or in the detected format if Auto. A PEM block must have the given type.
+func Decode(data []byte, format, pemType string) ([]byte, error) {
+	text := strings.Join(strings.Fields(string(data)), "")
+	if format == Auto {
+		switch {
+		case bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN ")):
+			format = PEM
+		case isHex(text):
+			format = Hex
+		case isBase64(text):
+			format = Base64
+		default:
+			format = Raw
+		}
+	}
+	switch format {
+	case Raw:
+		return data, nil
+	case Hex:
+		return hex.DecodeString(text)
+	case Base64:
+		return base64.StdEncoding.DecodeString(text)
+	case PEM:
+		b, _ := pem.Decode(data)
+		if b == nil {
+			return nil, errors.New("no PEM block found")
+		}
+		if b.Type != pemType {
+			return nil, errors.New("unexpected PEM block " + b.Type + ", expected " + pemType)
+		}
+		return b.Bytes, nil
+	}
+	return nil, errors.New("unknown format " + format + ", expected raw, hex, base64, pem or auto")
+}
+
+func isHex(s string) bool {
+	if len(s) == 0 || len(s)%2 != 0 {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func isBase64(s string) bool {
+	_, err := base64.StdEncoding.DecodeString(s)
+	return len(s) > 0 && err == nil
+}
+
+//Read returns the content of a file, or of stdin if the path is "-"
+func Read(path string, stdin io.Reader) ([]byte, error) {
+	if path == "-" {
+		return ioutil.ReadAll(stdin)
+	}
+	return ioutil.ReadFile(path)
+}
+
+//Write writes data to a file, or to stdout if the path is "-". Private files are only readable by their owner.
+func Write(path string, data []byte, private bool, stdout io.Writer) error {
+	if path == "-" {
+		_, err := stdout.Write(data)
+		return err
+	}
+	perm := os.FileMode(0644)
+	if private {
+		perm = 0600
+	}
+	return ioutil.WriteFile(path, data, perm)
+}
+
+//ReadPassphrase returns the first line of a file holding a passphrase, without its line ending
+func ReadPassphrase(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data = data[:i]
+	}
+	data = bytes.TrimSuffix(data, []byte("\r"))
+	if len(data) == 0 {
+		return nil, errors.New("empty passphrase in " + path)
+	}
+	return data, nil
+}
+
+//ReadDecoded reads a file, or stdin if the path is "-", and decodes it
+func ReadDecoded(path string, stdin io.Reader, format, pemType string) ([]byte, error) {
+	data, err := Read(path, stdin)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(data, format, pemType)
+}
+
+//WriteEncoded encodes data and writes it to a file, or to stdout if the path is "-"
+func WriteEncoded(path string, data []byte, format, pemType string, private bool, stdout io.Writer) error {
+	encoded, err := Encode(data, format, pemType)
+	if err != nil {
+		return err
+	}
+	return Write(path, encoded, private, stdout)
+}
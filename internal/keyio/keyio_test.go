@@ -0,0 +1,47 @@
+package keyio
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	data := []byte{0, 1, 2, 0xfe, 0xff, 'k', 'e', 'y'}
+	for _, format := range []string{Raw, Hex, Base64, PEM} {
+		encoded, err := Encode(data, format, "TEST KEY")
+		if err != nil {
+			t.Fatal(format, err)
+		}
+		for _, f := range []string{format, Auto} {
+			decoded, err := Decode(encoded, f, "TEST KEY")
+			if err != nil || !bytes.Equal(decoded, data) {
+				t.Fatal(format, f, "round trip failed", err)
+			}
+		}
+	}
+	encoded, _ := Encode(data, PEM, "OTHER KEY")
+	if _, err := Decode(encoded, Auto, "TEST KEY"); err == nil {
+		t.Fatal("unexpected PEM type accepted")
+	}
+	if _, err := Encode(data, "der", ""); err == nil {
+		t.Fatal("unknown format accepted")
+	}
+	//wrapped text is accepted
+	if decoded, err := Decode([]byte("0001\n02feff\n6b6579\n"), Auto, ""); err != nil || !bytes.Equal(decoded, data) {
+		t.Fatal("wrapped hex rejected", err)
+	}
+}
+
+func TestReadPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	for content, want := range map[string]string{"secret\r\nignored\n": "secret", "pass phrase": "pass phrase", "\nsecret": ""} {
+		path := filepath.Join(dir, "passphrase")
+		ioutil.WriteFile(path, []byte(content), 0600)
+		got, err := ReadPassphrase(path)
+		if string(got) != want || (err != nil) != (want == "") {
+			t.Fatalf("unexpected passphrase %q for %q: %v", got, content, err)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package keywrap
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func fromHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+//RFC 3394, Sections 4.1 and 4.6
+func TestKeyWrap(t *testing.T) {
+	for _, v := range []struct{ kek, key, wrapped string }{
+		{"000102030405060708090a0b0c0d0e0f", "00112233445566778899aabbccddeeff", "1fa68b0a8112b447aef34bd8fb5a7b829d3e862371d2cfe5"},
+		{"000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "00112233445566778899aabbccddeeff000102030405060708090a0b0c0d0e0f",
+			"28c9f404c4b810f4cbccb35cfb87f8263f5786e2d80ed326cbc7f0e71a99f43bfb988b9b7a02dd21"},
+	} {
+		wrapped, err := Wrap(fromHex(v.kek), fromHex(v.key))
+		if err != nil || !bytes.Equal(wrapped, fromHex(v.wrapped)) {
+			t.Fatal("unexpected wrapped key", err)
+		}
+		key, err := Unwrap(fromHex(v.kek), wrapped)
+		if err != nil || !bytes.Equal(key, fromHex(v.key)) {
+			t.Fatal("unwrap failed", err)
+		}
+		wrapped[3] ^= 1
+		if _, err := Unwrap(fromHex(v.kek), wrapped); err == nil {
+			t.Fatal("modified wrapped key accepted")
+		}
+	}
+}
@@ -0,0 +1,196 @@
+//Package ocb implements the OCB authenticated encryption mode of RFC 7253 with 128-bit tags, used by the OpenPGP
+//messages of this module.
+package ocb
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+	"math/bits"
+)
+
+const (
+	blockSize = 16
+	tagSize   = 16
+)
+
+type ocb struct {
+	block     cipher.Block
+	nonceSize int
+	//lStar, lDollar and l are the L_*, L_$ and L_i values of the key
+	lStar   [blockSize]byte
+	lDollar [blockSize]byte
+	l       [64][blockSize]byte
+}
+
+//New returns OCB with 128-bit tags and nonces of nonceSize bytes, from 1 to 15, for a 128-bit block cipher
+func New(block cipher.Block, nonceSize int) (cipher.AEAD, error) {
+	if block.BlockSize() != blockSize {
+		return nil, errors.New("ocb: block size must be 128 bits")
+	}
+	if nonceSize < 1 || nonceSize > 15 {
+		return nil, errors.New("ocb: invalid nonce size")
+	}
+	o := &ocb{block: block, nonceSize: nonceSize}
+	block.Encrypt(o.lStar[:], o.lStar[:])
+	o.lDollar = double(o.lStar)
+	o.l[0] = double(o.lDollar)
+	for i := 1; i < len(o.l); i++ {
+		o.l[i] = double(o.l[i-1])
+	}
+	return o, nil
+}
+
+func (o *ocb) NonceSize() int {
+	return o.nonceSize
+}
+
+func (o *ocb) Overhead() int {
+	return tagSize
+}
+
+//double multiplies a block by x in GF(2^128)
+func double(b [blockSize]byte) [blockSize]byte {
+	var d [blockSize]byte
+	carry := b[0] >> 7
+	for i := 0; i < blockSize-1; i++ {
+		d[i] = b[i]<<1 | b[i+1]>>7
+	}
+	d[blockSize-1] = b[blockSize-1]<<1 ^ 0x87&-carry
+	return d
+}
+
+func xor(dst *[blockSize]byte, src []byte) {
+	for i := range src {
+		dst[i] ^= src[i]
+	}
+}
+
+//initialOffset returns Offset_0 of a nonce
+func (o *ocb) initialOffset(nonce []byte) [blockSize]byte {
+	var n [blockSize]byte
+	copy(n[blockSize-len(nonce):], nonce)
+	//the tag length modulo 128 is zero
+	n[blockSize-len(nonce)-1] |= 1
+	bottom := uint(n[blockSize-1] & 0x3f)
+	n[blockSize-1] &^= 0x3f
+	var stretch [blockSize + 9]byte
+	o.block.Encrypt(stretch[:blockSize], n[:])
+	for i := 0; i < 8; i++ {
+		stretch[blockSize+i] = stretch[i] ^ stretch[i+1]
+	}
+	var offset [blockSize]byte
+	shift, rem := bottom/8, bottom%8
+	for i := range offset {
+		offset[i] = stretch[uint(i)+shift]<<rem | stretch[uint(i)+shift+1]>>(8-rem)
+	}
+	return offset
+}
+
+//hash is the HASH function of the additional data
+func (o *ocb) hash(data []byte) [blockSize]byte {
+	var sum, offset, b [blockSize]byte
+	i := 1
+	for ; len(data) >= blockSize; i++ {
+		xor(&offset, o.l[bits.TrailingZeros(uint(i))][:])
+		b = offset
+		xor(&b, data[:blockSize])
+		o.block.Encrypt(b[:], b[:])
+		xor(&sum, b[:])
+		data = data[blockSize:]
+	}
+	if len(data) > 0 {
+		xor(&offset, o.lStar[:])
+		b = offset
+		xor(&b, data)
+		b[len(data)] ^= 0x80
+		o.block.Encrypt(b[:], b[:])
+		xor(&sum, b[:])
+	}
+	return sum
+}
+
+//crypt encrypts or decrypts src to dst and returns the tag
+func (o *ocb) crypt(encrypt bool, dst, nonce, src, additionalData []byte) [blockSize]byte {
+	offset := o.initialOffset(nonce)
+	var checksum, b [blockSize]byte
+	i := 1
+	for ; len(src) >= blockSize; i++ {
+		xor(&offset, o.l[bits.TrailingZeros(uint(i))][:])
+		b = offset
+		xor(&b, src[:blockSize])
+		if encrypt {
+			xor(&checksum, src[:blockSize])
+			o.block.Encrypt(b[:], b[:])
+		} else {
+			o.block.Decrypt(b[:], b[:])
+		}
+		xor(&b, offset[:])
+		if !encrypt {
+			xor(&checksum, b[:])
+		}
+		copy(dst, b[:])
+		src, dst = src[blockSize:], dst[blockSize:]
+	}
+	if len(src) > 0 {
+		xor(&offset, o.lStar[:])
+		var pad [blockSize]byte
+		o.block.Encrypt(pad[:], offset[:])
+		if encrypt {
+			xor(&checksum, src)
+		}
+		for j := range src {
+			dst[j] = src[j] ^ pad[j]
+		}
+		if !encrypt {
+			xor(&checksum, dst[:len(src)])
+		}
+		checksum[len(src)] ^= 0x80
+	}
+	xor(&checksum, offset[:])
+	xor(&checksum, o.lDollar[:])
+	o.block.Encrypt(checksum[:], checksum[:])
+	h := o.hash(additionalData)
+	xor(&checksum, h[:])
+	return checksum
+}
+
+//sliceForAppend extends in by n bytes and returns the whole slice and the extension
+func sliceForAppend(in []byte, n int) ([]byte, []byte) {
+	total := len(in) + n
+	if cap(in) >= total {
+		return in[:total], in[len(in):total]
+	}
+	out := make([]byte, total)
+	copy(out, in)
+	return out, out[len(in):]
+}
+
+func (o *ocb) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != o.nonceSize {
+		panic("ocb: incorrect nonce length")
+	}
+	ret, out := sliceForAppend(dst, len(plaintext)+tagSize)
+	tag := o.crypt(true, out, nonce, plaintext, additionalData)
+	copy(out[len(plaintext):], tag[:])
+	return ret
+}
+
+func (o *ocb) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != o.nonceSize {
+		panic("ocb: incorrect nonce length")
+	}
+	if len(ciphertext) < tagSize {
+		return nil, errors.New("ocb: message authentication failed")
+	}
+	n := len(ciphertext) - tagSize
+	ret, out := sliceForAppend(dst, n)
+	tag := o.crypt(false, out, nonce, ciphertext[:n], additionalData)
+	if subtle.ConstantTimeCompare(tag[:], ciphertext[n:]) != 1 {
+		for i := range out {
+			out[i] = 0
+		}
+		return nil, errors.New("ocb: message authentication failed")
+	}
+	return ret, nil
+}
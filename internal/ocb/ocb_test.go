@@ -0,0 +1,112 @@
+package ocb
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+)
+
+func fromHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func mustNew(t *testing.T, key []byte, nonceSize int) *ocb {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := New(block, nonceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aead.(*ocb)
+}
+
+//RFC 7253, Appendix A: the associated data and plaintext are prefixes of 00 01 02 ... and the nonce ends with the
+//index of the vector
+func TestVectors(t *testing.T) {
+	o := mustNew(t, fromHex("000102030405060708090a0b0c0d0e0f"), 12)
+	counting := make([]byte, 40)
+	for i := range counting {
+		counting[i] = byte(i)
+	}
+	for i, v := range []struct {
+		aLen, pLen int
+		ciphertext string
+	}{
+		{0, 0, "785407bfffc8ad9edcc5520ac9111ee6"},
+		{8, 8, "6820b3657b6f615a5725bda0d3b4eb3a257c9af1f8f03009"},
+		{8, 0, "81017f8203f081277152fade694a0a00"},
+		{0, 8, "45dd69f8f5aae72414054cd1f35d82760b2cd00d2f99bfa9"},
+		{16, 16, "571d535b60b277188be5147170a9a22c3ad7a4ff3835b8c5701c1ccec8fc3358"},
+		{16, 0, "8cf761b6902ef764462ad86498ca6b97"},
+		{0, 16, "5ce88ec2e0692706a915c00aeb8b2396f40e1c743f52436bdf06d8fa1eca343d"},
+		{24, 24, "1ca2207308c87c010756104d8840ce1952f09673a448a122c92c62241051f57356d7f3c90bb0e07f"},
+		{24, 0, "6dc225a071fc1b9f7c69f93b0f1e10de"},
+		{0, 24, "221bd0de7fa6fe993eccd769460a0af2d6cded0c395b1c3ce725f32494b9f914d85c0b1eb38357ff"},
+		{32, 32, "bd6f6c496201c69296c11efd138a467abd3c707924b964deaffc40319af5a48540fbba186c5553c68ad9f592a79a4240"},
+		{32, 0, "fe80690bee8a485d11f32965bc9d2a32"},
+		{0, 32, "2942bfc773bda23cabc6acfd9bfd5835bd300f0973792ef46040c53f1432bcdfb5e1dde3bc18a5f840b52e653444d5df"},
+		{40, 40, "d5ca91748410c1751ff8a2f618255b68a0a12e093ff454606e59f9c1d0ddc54b65e8628e568bad7aed07ba06a4a69483a7035490c5769e60"},
+		{40, 0, "c5cd9d1850c141e358649994ee701b68"},
+		{0, 40, "4412923493c57d5de0d700f753cce0d1d2d95060122e9f15a5ddbfc5787e50b5cc55ee507bcb084e479ad363ac366b95a98ca5f3000b1479"},
+	} {
+		nonce := append(fromHex("bbaa998877665544332211"), byte(i))
+		ad, plaintext := counting[:v.aLen], counting[:v.pLen]
+		ciphertext := o.Seal(nil, nonce, plaintext, ad)
+		if !bytes.Equal(ciphertext, fromHex(v.ciphertext)) {
+			t.Fatal(i, "unexpected ciphertext")
+		}
+		got, err := o.Open(nil, nonce, ciphertext, ad)
+		if err != nil || !bytes.Equal(got, plaintext) {
+			t.Fatal(i, "decryption failed", err)
+		}
+		ciphertext[len(ciphertext)-1-i] ^= 1
+		if _, err := o.Open(nil, nonce, ciphertext, ad); err == nil {
+			t.Fatal(i, "modified ciphertext accepted")
+		}
+	}
+}
+
+//RFC 7253, Appendix A: the iterated test of AEAD_AES_128_OCB_TAGLEN128
+func TestIterated(t *testing.T) {
+	key := make([]byte, 16)
+	key[15] = 128
+	o := mustNew(t, key, 12)
+	nonce := func(n int) []byte {
+		return []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, byte(n >> 8), byte(n)}
+	}
+	var c []byte
+	for i := 0; i < 128; i++ {
+		s := make([]byte, i)
+		c = o.Seal(c, nonce(3*i+1), s, s)
+		c = o.Seal(c, nonce(3*i+2), s, nil)
+		c = o.Seal(c, nonce(3*i+3), nil, s)
+	}
+	if tag := o.Seal(nil, nonce(385), nil, c); !bytes.Equal(tag, fromHex("67e944d23256c5e0b6c61fa22fdf1ea2")) {
+		t.Fatal("unexpected tag")
+	}
+}
+
+func TestInPlace(t *testing.T) {
+	o := mustNew(t, make([]byte, 32), 15)
+	nonce := make([]byte, 15)
+	plaintext := bytes.Repeat([]byte("in place"), 9)
+	buf := append([]byte{}, plaintext...)
+	sealed := o.Seal(buf[:0], nonce, buf, nil)
+	if !bytes.Equal(sealed, o.Seal(nil, nonce, plaintext, nil)) {
+		t.Fatal("in place encryption differs")
+	}
+	opened, err := o.Open(sealed[:0], nonce, sealed, nil)
+	if err != nil || !bytes.Equal(opened, plaintext) {
+		t.Fatal("in place decryption failed", err)
+	}
+	if _, err := New(o.block, 16); err == nil {
+		t.Fatal("16 byte nonce accepted")
+	}
+}
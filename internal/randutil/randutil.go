@@ -0,0 +1,16 @@
+//Package randutil selects the source of randomness of the packages of this module, which all accept an optional
+//io.Reader for deterministic tests.
+package randutil
+
+import (
+	"crypto/rand"
+	"io"
+)
+
+//Reader returns r, or crypto/rand if r is nil
+func Reader(r io.Reader) io.Reader {
+	if r == nil {
+		return rand.Reader
+	}
+	return r
+}
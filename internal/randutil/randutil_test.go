@@ -0,0 +1,17 @@
+package randutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	if Reader(nil) != rand.Reader {
+		t.Fatal("nil reader not replaced by crypto/rand")
+	}
+	r := bytes.NewReader(nil)
+	if Reader(r) != r {
+		t.Fatal("reader replaced")
+	}
+}
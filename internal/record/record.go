@@ -0,0 +1,439 @@
+//Package record implements the record layer shared by the transport protocols of this module. It follows the
+//TLS 1.3 record protocol: records carry a content type and a length, encrypted records use ChaCha20-Poly1305 with a
+//per-record nonce derived from a sequence number, traffic keys are derived from secrets with HKDF-SHA256 and updated
+//with key_update messages, and the connection is closed with a close_notify alert.
+package record
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+//Content types
+const (
+	TypeAlert           uint8 = 21
+	TypeHandshake       uint8 = 22
+	TypeApplicationData uint8 = 23
+)
+
+//Handshake message types handled by the record layer
+const (
+	typeKeyUpdate uint8 = 24
+)
+
+//Alert descriptions
+const (
+	AlertCloseNotify    uint8 = 0
+	AlertUnexpected     uint8 = 10
+	AlertBadRecordMAC   uint8 = 20
+	AlertHandshake      uint8 = 40
+	AlertBadCertificate uint8 = 42
+	AlertDecodeError    uint8 = 50
+	AlertDecryptError   uint8 = 51
+	AlertInternalError  uint8 = 80
+	AlertCertRequired   uint8 = 116
+)
+
+const (
+	alertLevelWarning    uint8 = 1
+	alertLevelFatal      uint8 = 2
+	recordHeaderLen            = 3
+	tagSize                    = 16
+	maxCiphertext              = MaxPlaintext + 256
+	defaultRecordsPerKey       = 1 << 24
+	alertTimeout               = time.Second
+)
+
+//MaxPlaintext is the maximum size of the content of a record
+const MaxPlaintext = 1 << 14
+
+//AlertError is the error returned after receiving or sending a fatal alert
+type AlertError uint8
+
+func (e AlertError) Error() string {
+	switch uint8(e) {
+	case AlertCloseNotify:
+		return "record: close notify"
+	case AlertUnexpected:
+		return "record: unexpected message"
+	case AlertBadRecordMAC:
+		return "record: bad record MAC"
+	case AlertHandshake:
+		return "record: handshake failure"
+	case AlertBadCertificate:
+		return "record: bad certificate"
+	case AlertDecodeError:
+		return "record: decode error"
+	case AlertDecryptError:
+		return "record: decrypt error"
+	case AlertCertRequired:
+		return "record: certificate required"
+	}
+	return "record: internal error"
+}
+
+//ExpandLabel is HKDF-Expand-Label of TLS 1.3 with SHA-256, with the given label prefix instead of "tls13 "
+func ExpandLabel(prefix string, secret []byte, label string, context []byte, length int) []byte {
+	full := prefix + label
+	info := make([]byte, 0, 4+len(full)+len(context))
+	info = append(info, byte(length>>8), byte(length), byte(len(full)))
+	info = append(info, full...)
+	info = append(info, byte(len(context)))
+	info = append(info, context...)
+	out := make([]byte, length)
+	io.ReadFull(hkdf.Expand(sha256.New, secret, info), out)
+	return out
+}
+
+//Extract is HKDF-Extract with SHA-256
+func Extract(salt, ikm []byte) []byte {
+	if salt == nil {
+		salt = make([]byte, sha256.Size)
+	}
+	if ikm == nil {
+		ikm = make([]byte, sha256.Size)
+	}
+	return hkdf.Extract(sha256.New, ikm, salt)
+}
+
+//FinishedMAC computes the Finished verify data of TLS 1.3 for a traffic secret and transcript hash
+func FinishedMAC(prefix string, secret, transcriptHash []byte) []byte {
+	h := hmac.New(sha256.New, ExpandLabel(prefix, secret, "finished", nil, sha256.Size))
+	h.Write(transcriptHash)
+	return h.Sum(nil)
+}
+
+//halfConn is one direction of the connection
+type halfConn struct {
+	sync.Mutex
+	aead   cipher.AEAD
+	secret []byte
+	iv     []byte
+	seq    uint64
+	limit  uint64
+	err    error
+	alert  uint8 //fatal alert to send once the lock is released
+}
+
+func (hc *halfConn) setSecret(prefix string, secret []byte) {
+	hc.secret = secret
+	hc.aead, _ = chacha20poly1305.New(ExpandLabel(prefix, secret, "key", nil, chacha20poly1305.KeySize))
+	hc.iv = ExpandLabel(prefix, secret, "iv", nil, chacha20poly1305.NonceSize)
+	hc.seq = 0
+}
+
+func (hc *halfConn) nonce() []byte {
+	n := append([]byte{}, hc.iv...)
+	for i := 0; i < 8; i++ {
+		n[len(n)-1-i] ^= byte(hc.seq >> (8 * i))
+	}
+	return n
+}
+
+//Conn is a record layer over a net.Conn. Reads and writes can be done concurrently.
+type Conn struct {
+	conn   net.Conn
+	prefix string
+	in     halfConn
+	out    halfConn
+	input  []byte //application data received but not read yet
+
+	//keyUpdatePending is set by Read when the peer asks for a key update, which is answered before the next record
+	//written. It is accessed atomically so that Read never waits for a blocked Write.
+	keyUpdatePending uint32
+
+	closeOnce sync.Once
+}
+
+//New returns a record layer over conn. prefix is the label prefix of the key derivations, which separates the
+//protocols using this layer. Records are unencrypted until keys are set.
+func New(conn net.Conn, prefix string) *Conn {
+	c := &Conn{conn: conn, prefix: prefix}
+	c.out.limit = defaultRecordsPerKey
+	return c
+}
+
+//SetRecordsPerKey sets after how many records the sending key is updated, 2^24 by default
+func (c *Conn) SetRecordsPerKey(n uint64) {
+	c.out.Lock()
+	c.out.limit = n
+	c.out.Unlock()
+}
+
+//SetReadSecret sets the traffic secret of the incoming records
+func (c *Conn) SetReadSecret(secret []byte) {
+	c.in.Lock()
+	c.in.setSecret(c.prefix, secret)
+	c.in.Unlock()
+}
+
+//SetWriteSecret sets the traffic secret of the outgoing records
+func (c *Conn) SetWriteSecret(secret []byte) {
+	c.out.Lock()
+	c.out.setSecret(c.prefix, secret)
+	c.out.Unlock()
+}
+
+//NetConn returns the underlying connection
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+//writeRecordLocked encrypts and sends one record, c.out must be locked
+func (c *Conn) writeRecordLocked(typ uint8, data []byte) error {
+	if c.out.err != nil {
+		return c.out.err
+	}
+	if len(data) > MaxPlaintext {
+		return errors.New("record: record too large")
+	}
+	var rec []byte
+	if c.out.aead == nil {
+		rec = append([]byte{typ, byte(len(data) >> 8), byte(len(data))}, data...)
+	} else {
+		if c.out.seq == ^uint64(0) {
+			return errors.New("record: sequence number exhausted")
+		}
+		n := len(data) + 1 + tagSize
+		rec = make([]byte, recordHeaderLen, recordHeaderLen+n)
+		rec[0], rec[1], rec[2] = TypeApplicationData, byte(n>>8), byte(n)
+		inner := append(append(make([]byte, 0, len(data)+1), data...), typ)
+		rec = c.out.aead.Seal(rec, c.out.nonce(), inner, rec[:recordHeaderLen])
+		c.out.seq++
+	}
+	if _, err := c.conn.Write(rec); err != nil {
+		c.out.err = err
+		return err
+	}
+	return nil
+}
+
+//WriteRecord sends data as a single record of the given type
+func (c *Conn) WriteRecord(typ uint8, data []byte) error {
+	c.out.Lock()
+	defer c.out.Unlock()
+	return c.writeRecordLocked(typ, data)
+}
+
+//updateWriteKeyLocked sends a key_update message and switches to the next sending secret, c.out must be locked
+func (c *Conn) updateWriteKeyLocked(requestUpdate bool) error {
+	req := byte(0)
+	if requestUpdate {
+		req = 1
+	}
+	//this update answers the requests received so far
+	atomic.StoreUint32(&c.keyUpdatePending, 0)
+	if err := c.writeRecordLocked(TypeHandshake, []byte{typeKeyUpdate, 0, 0, 1, req}); err != nil {
+		return err
+	}
+	c.out.setSecret(c.prefix, ExpandLabel(c.prefix, c.out.secret, "traffic upd", nil, sha256.Size))
+	return nil
+}
+
+//UpdateKeys updates the sending key and asks the peer to update its own
+func (c *Conn) UpdateKeys() error {
+	c.out.Lock()
+	defer c.out.Unlock()
+	if c.out.aead == nil {
+		return errors.New("record: no traffic keys")
+	}
+	return c.updateWriteKeyLocked(true)
+}
+
+//ReadRecord reads and decrypts the next record
+func (c *Conn) ReadRecord() (uint8, []byte, error) {
+	c.in.Lock()
+	defer c.unlockIn()
+	return c.readRecordLocked()
+}
+
+//unlockIn unlocks c.in, then sends the fatal alert recorded by fatalLocked, if any
+func (c *Conn) unlockIn() {
+	alert := c.in.alert
+	c.in.alert = 0
+	c.in.Unlock()
+	if alert != 0 {
+		c.SendAlert(alert)
+	}
+}
+
+func (c *Conn) readRecordLocked() (uint8, []byte, error) {
+	if c.in.err != nil {
+		return 0, nil, c.in.err
+	}
+	var hdr [recordHeaderLen]byte
+	if _, err := io.ReadFull(c.conn, hdr[:]); err != nil {
+		if err == io.EOF && c.in.aead != nil {
+			//only a close_notify alert ends a protected stream
+			err = io.ErrUnexpectedEOF
+		}
+		c.in.err = err
+		return 0, nil, err
+	}
+	n := int(binary.BigEndian.Uint16(hdr[1:]))
+	if n > maxCiphertext {
+		return 0, nil, c.fatalLocked(AlertDecodeError)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(c.conn, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		c.in.err = err
+		return 0, nil, err
+	}
+	if c.in.aead == nil {
+		if hdr[0] == TypeApplicationData || n > MaxPlaintext {
+			return 0, nil, c.fatalLocked(AlertUnexpected)
+		}
+		return hdr[0], data, nil
+	}
+
+	if hdr[0] != TypeApplicationData || c.in.seq == ^uint64(0) {
+		return 0, nil, c.fatalLocked(AlertUnexpected)
+	}
+	plain, err := c.in.aead.Open(data[:0], c.in.nonce(), data, hdr[:])
+	if err != nil {
+		return 0, nil, c.fatalLocked(AlertBadRecordMAC)
+	}
+	c.in.seq++
+	//strip the zero padding and recover the content type
+	i := len(plain) - 1
+	for i >= 0 && plain[i] == 0 {
+		i--
+	}
+	if i < 0 || i > MaxPlaintext {
+		return 0, nil, c.fatalLocked(AlertUnexpected)
+	}
+	return plain[i], plain[:i], nil
+}
+
+//fatalLocked records a fatal error on the read side, c.in must be locked. The matching alert is sent by unlockIn, as
+//the writer may be blocked on a peer that is itself blocked writing to us.
+func (c *Conn) fatalLocked(alert uint8) error {
+	err := AlertError(alert)
+	c.in.err = err
+	c.in.alert = alert
+	return err
+}
+
+//SendAlert sends a fatal alert, or a warning close_notify, and prevents any further write
+func (c *Conn) SendAlert(alert uint8) error {
+	level := alertLevelFatal
+	if alert == AlertCloseNotify {
+		level = alertLevelWarning
+	} else {
+		//the connection is unusable after a fatal alert, do not block on a peer that is not reading, neither to send
+		//the alert nor to wait for a pending write
+		c.conn.SetWriteDeadline(time.Now().Add(alertTimeout))
+	}
+	c.out.Lock()
+	defer c.out.Unlock()
+	err := c.writeRecordLocked(TypeAlert, []byte{level, alert})
+	if c.out.err == nil {
+		c.out.err = AlertError(alert)
+		if alert == AlertCloseNotify {
+			c.out.err = errors.New("record: write after close")
+		}
+	}
+	return err
+}
+
+//Read reads application data. Handshake records received after the handshake must be key_update messages, and
+//a close_notify alert ends the stream with io.EOF.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.in.Lock()
+	defer c.unlockIn()
+	for len(c.input) == 0 {
+		typ, data, err := c.readRecordLocked()
+		if err != nil {
+			return 0, err
+		}
+		switch typ {
+		case TypeApplicationData:
+			c.input = data
+		case TypeAlert:
+			if len(data) != 2 {
+				return 0, c.fatalLocked(AlertDecodeError)
+			}
+			if data[1] == AlertCloseNotify {
+				c.in.err = io.EOF
+			} else {
+				c.in.err = AlertError(data[1])
+			}
+			return 0, c.in.err
+		case TypeHandshake:
+			if len(data) != 5 || data[0] != typeKeyUpdate || data[1] != 0 || data[2] != 0 || data[3] != 1 || data[4] > 1 {
+				return 0, c.fatalLocked(AlertUnexpected)
+			}
+			c.in.setSecret(c.prefix, ExpandLabel(c.prefix, c.in.secret, "traffic upd", nil, sha256.Size))
+			if data[4] == 1 {
+				//answer on the next write, the writer may be blocked on the peer reading
+				atomic.StoreUint32(&c.keyUpdatePending, 1)
+			}
+		default:
+			return 0, c.fatalLocked(AlertUnexpected)
+		}
+	}
+	n := copy(b, c.input)
+	c.input = c.input[n:]
+	return n, nil
+}
+
+//Write sends application data, split into records of at most MaxPlaintext bytes. The sending key is updated when the
+//peer asked for it or after the configured number of records.
+func (c *Conn) Write(b []byte) (int, error) {
+	c.out.Lock()
+	defer c.out.Unlock()
+	n := 0
+	for len(b) > 0 {
+		if atomic.LoadUint32(&c.keyUpdatePending) == 1 || c.out.seq >= c.out.limit {
+			if err := c.updateWriteKeyLocked(false); err != nil {
+				return n, err
+			}
+		}
+		chunk := b
+		if len(chunk) > MaxPlaintext {
+			chunk = chunk[:MaxPlaintext]
+		}
+		if err := c.writeRecordLocked(TypeApplicationData, chunk); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		b = b[len(chunk):]
+	}
+	return n, nil
+}
+
+//CloseWrite sends a close_notify alert, after which no data can be written
+func (c *Conn) CloseWrite() error {
+	return c.SendAlert(AlertCloseNotify)
+}
+
+//Close sends a close_notify alert, if the connection is still writable, and closes the underlying connection
+func (c *Conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.out.Lock()
+		writable := c.out.err == nil
+		c.out.Unlock()
+		if writable {
+			//do not block forever on a peer that stopped reading
+			c.conn.SetWriteDeadline(time.Now().Add(5 * alertTimeout))
+			c.CloseWrite()
+		}
+		err = c.conn.Close()
+	})
+	return err
+}
@@ -0,0 +1,154 @@
+package record
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//pair returns two record layers connected by net.Pipe, with keys set in both directions
+func pair() (*Conn, *Conn) {
+	a, b := net.Pipe()
+	ca, cb := New(a, "test "), New(b, "test ")
+	s1, s2 := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	ca.SetWriteSecret(s1)
+	cb.SetReadSecret(s1)
+	cb.SetWriteSecret(s2)
+	ca.SetReadSecret(s2)
+	return ca, cb
+}
+
+func TestRecords(t *testing.T) {
+	ca, cb := pair()
+	ca.SetRecordsPerKey(2)
+	msg := make([]byte, 5*MaxPlaintext+7)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	go func() {
+		ca.Write(msg)
+		ca.UpdateKeys()
+		ca.Write([]byte("end"))
+		ca.Close()
+	}()
+	got, err := ioutil.ReadAll(cb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, append(msg, "end"...)) {
+		t.Fatal("data mismatch")
+	}
+	//the peer asked for a key update, the answer precedes the next record
+	if atomic.LoadUint32(&cb.keyUpdatePending) == 0 {
+		t.Fatal("key update request ignored")
+	}
+}
+
+//Both ends write more than the connection buffers while key updates requested by the peer are being received: the
+//readers must keep draining the connection while the writers are blocked
+func TestConcurrentKeyUpdates(t *testing.T) {
+	ca, cb := pair()
+	msg := make([]byte, 64*MaxPlaintext)
+	errs := make(chan error, 4)
+	for _, c := range []*Conn{ca, cb} {
+		c := c
+		go func() {
+			_, err := c.Write(msg)
+			if err == nil {
+				err = c.UpdateKeys()
+			}
+			if err == nil {
+				_, err = c.Write(msg)
+			}
+			errs <- err
+		}()
+		go func() {
+			_, err := io.ReadFull(c, make([]byte, 2*len(msg)))
+			errs <- err
+		}()
+	}
+	timeout := time.After(10 * time.Second)
+	for i := 0; i < 4; i++ {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-timeout:
+			t.Fatal("deadlock between readers and writers")
+		}
+	}
+}
+
+//A fatal error while the writer is blocked on a peer that is not reading must not block the reader
+func TestFatalErrorDuringWrite(t *testing.T) {
+	a, b := net.Pipe()
+	ca := New(a, "test ")
+	ca.SetReadSecret(make([]byte, 32))
+	ca.SetWriteSecret(make([]byte, 32))
+	go ca.Write(make([]byte, MaxPlaintext))
+	//wait for the writer to block on the pipe, then send an unencrypted record
+	time.Sleep(10 * time.Millisecond)
+	go b.Write([]byte{TypeHandshake, 0, 1, 0})
+	done := make(chan error, 1)
+	go func() {
+		_, err := ca.Read(make([]byte, 10))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != AlertError(AlertUnexpected) {
+			t.Fatal("unexpected error", err)
+		}
+	case <-time.After(5 * alertTimeout):
+		t.Fatal("reader blocked by the writer")
+	}
+	a.Close()
+	b.Close()
+}
+
+func TestTampering(t *testing.T) {
+	a, b := net.Pipe()
+	ca := New(a, "test ")
+	secret := make([]byte, 32)
+	ca.SetWriteSecret(secret)
+	go ca.Write([]byte("hello"))
+	rec := make([]byte, recordHeaderLen+5+1+tagSize)
+	if _, err := io.ReadFull(b, rec); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range rec {
+		bad := append([]byte{}, rec...)
+		bad[i] ^= 1
+		x, y := net.Pipe()
+		cy := New(y, "test ")
+		cy.SetReadSecret(secret)
+		go func() {
+			x.Write(bad)
+			x.Close()
+		}()
+		if _, err := cy.Read(make([]byte, 10)); err == nil {
+			t.Fatalf("tampered byte %d accepted", i)
+		}
+		x.Close()
+		y.Close()
+	}
+}
+
+func TestExpandLabel(t *testing.T) {
+	//RFC 8448, simple 1-RTT handshake: derivation of the early secret "derived" value
+	early := Extract(nil, nil)
+	emptyHash := []byte{0xe3, 0xb0, 0xc4, 0x42, 0x98, 0xfc, 0x1c, 0x14, 0x9a, 0xfb, 0xf4, 0xc8, 0x99, 0x6f, 0xb9, 0x24,
+		0x27, 0xae, 0x41, 0xe4, 0x64, 0x9b, 0x93, 0x4c, 0xa4, 0x95, 0x99, 0x1b, 0x78, 0x52, 0xb8, 0x55}
+	derived := ExpandLabel("tls13 ", early, "derived", emptyHash, 32)
+	expected := []byte{0x6f, 0x26, 0x15, 0xa1, 0x08, 0xc7, 0x02, 0xc5, 0x67, 0x8f, 0x54, 0xfc, 0x9d, 0xba, 0xb6, 0x97,
+		0x16, 0xc0, 0x76, 0x18, 0x9c, 0x48, 0x25, 0x0c, 0xeb, 0xea, 0xc3, 0x57, 0x6c, 0x36, 0x11, 0xba}
+	if !bytes.Equal(derived, expected) {
+		t.Fatalf("unexpected derived secret %x", derived)
+	}
+}
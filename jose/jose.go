@@ -0,0 +1,70 @@
+//Package jose implements JSON Web Signatures (RFC 7515) with ML-DSA and round 3 Dilithium, JSON Web Encryption
+//(RFC 7516) with ML-KEM and JSON Web Keys (RFC 7517) for both, without depending on a general purpose JOSE library.
+//
+//Keys use the AKP (Algorithm Key Pair) key type of the JOSE ML-DSA draft: the public key in "pub" and the 32-byte
+//key generation seed in "priv". The algorithm names are "ML-DSA-44", "ML-DSA-65" and "ML-DSA-87". Round 3 Dilithium
+//uses the experimental names "CRYDI2", "CRYDI3" and "CRYDI5" of the first COSE drafts, which other implementations
+//are unlikely to recognize.
+//
+//JWE follows the JOSE ML-KEM draft: the ML-KEM ciphertext is carried in the "ek" header parameter and the shared
+//secret goes through the Concat KDF of ECDH-ES. ML-KEM keys are AKP keys too, with the 64-byte seed (d || z) as
+//private key. The content is encrypted with A256GCM, and only the compact serialization is supported.
+package jose
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+)
+
+//Algorithm names of signatures
+const (
+	MLDSA44    = "ML-DSA-44"
+	MLDSA65    = "ML-DSA-65"
+	MLDSA87    = "ML-DSA-87"
+	Dilithium2 = "CRYDI2"
+	Dilithium3 = "CRYDI3"
+	Dilithium5 = "CRYDI5"
+)
+
+var signatureAlgorithms = map[string]func(...bool) *dilithium.Dilithium{
+	MLDSA44:    dilithium.NewMLDSA44,
+	MLDSA65:    dilithium.NewMLDSA65,
+	MLDSA87:    dilithium.NewMLDSA87,
+	Dilithium2: dilithium.NewDilithium2,
+	Dilithium3: dilithium.NewDilithium3,
+	Dilithium5: dilithium.NewDilithium5,
+}
+
+//Header is the JOSE header of a signature or encryption. Only the protected header is used: unprotected headers of
+//the JSON serialization are ignored, except for looking up keys by their ID.
+type Header struct {
+	Algorithm   string   `json:"alg"`
+	KeyID       string   `json:"kid,omitempty"`
+	Type        string   `json:"typ,omitempty"`
+	ContentType string   `json:"cty,omitempty"`
+	Critical    []string `json:"crit,omitempty"`
+	//Encryption, EncapsulatedKey and the base64url encoded agreement party infos are only used by JWE
+	Encryption      string `json:"enc,omitempty"`
+	EncapsulatedKey string `json:"ek,omitempty"`
+	PartyUInfo      string `json:"apu,omitempty"`
+	PartyVInfo      string `json:"apv,omitempty"`
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+//decode decodes unpadded base64url, rejecting non-canonical encodings
+func decode(s string) ([]byte, error) {
+	if strings.ContainsAny(s, "=\r\n") {
+		return nil, errors.New("jose: invalid base64url encoding")
+	}
+	b, err := base64.RawURLEncoding.Strict().DecodeString(s)
+	if err != nil {
+		return nil, errors.New("jose: invalid base64url encoding")
+	}
+	return b, nil
+}
@@ -0,0 +1,254 @@
+package jose
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJWK(t *testing.T) {
+	algs := []string{MLKEM512, MLKEM768A192KW}
+	for alg := range signatureAlgorithms {
+		algs = append(algs, alg)
+	}
+	for _, alg := range algs {
+		key, err := GenerateKey(alg, nil)
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		key.KeyID = "key-1"
+		data, err := json.Marshal(key)
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		var parsed JWK
+		if err := json.Unmarshal(data, &parsed); err != nil {
+			t.Fatal(alg, err)
+		}
+		if parsed.Algorithm != alg || parsed.KeyID != "key-1" || !bytes.Equal(parsed.PublicKey, key.PublicKey) ||
+			!bytes.Equal(parsed.Seed, key.Seed) {
+			t.Fatal(alg, "key changed by encoding")
+		}
+		data, _ = json.Marshal(key.Public())
+		if strings.Contains(string(data), "priv") {
+			t.Fatal(alg, "public key with private part")
+		}
+		if err := json.Unmarshal(data, &parsed); err != nil || parsed.IsPrivate() {
+			t.Fatal(alg, "public key not decoded", err)
+		}
+	}
+}
+
+func TestJWKErrors(t *testing.T) {
+	key, _ := GenerateKey(MLDSA44, nil)
+	other, _ := GenerateKey(MLDSA44, nil)
+	for name, k := range map[string]*JWK{
+		"mismatched seed": {Algorithm: MLDSA44, PublicKey: key.PublicKey, Seed: other.Seed},
+		"wrong algorithm": {Algorithm: MLDSA65, PublicKey: key.PublicKey},
+		"unknown":         {Algorithm: "RS256", PublicKey: key.PublicKey},
+		"short seed":      {Algorithm: MLDSA44, PublicKey: key.PublicKey, Seed: key.Seed[1:]},
+	} {
+		if _, err := json.Marshal(k); err == nil {
+			t.Fatal(name, "invalid key encoded")
+		}
+	}
+	for _, data := range []string{
+		`{"kty":"OKP","alg":"ML-DSA-44","pub":"` + encode(key.PublicKey) + `"}`,
+		`{"kty":"AKP","alg":"ML-DSA-44","pub":"` + encode(key.PublicKey) + `="}`,
+		`{"kty":"AKP","alg":"ML-DSA-44","pub":"` + encode(key.PublicKey) + `","priv":"` + encode(other.Seed) + `"}`,
+	} {
+		var k JWK
+		if err := json.Unmarshal([]byte(data), &k); err == nil {
+			t.Fatal("invalid key decoded", data)
+		}
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	key, _ := GenerateKey(MLDSA65, nil)
+	t1, err := key.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the thumbprint ignores the key ID and the private part
+	key.KeyID = "kid"
+	t2, _ := key.Public().Thumbprint()
+	if !bytes.Equal(t1, t2) || len(t1) != 32 {
+		t.Fatal("unexpected thumbprint")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	payload := []byte(`{"iss":"gateway","sub":"alice"}`)
+	for alg := range signatureAlgorithms {
+		key, _ := GenerateKey(alg, nil)
+		key.KeyID = "k1"
+		token, err := Sign(payload, key, &Header{Type: "JWT"})
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		got, h, err := Verify(token, key.Public())
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		if !bytes.Equal(got, payload) || h.Algorithm != alg || h.KeyID != "k1" || h.Type != "JWT" {
+			t.Fatal(alg, "unexpected payload or header")
+		}
+		parts := strings.Split(token, ".")
+		forged := parts[0] + "." + encode([]byte(`{"iss":"gateway","sub":"mallory"}`)) + "." + parts[2]
+		if _, _, err := Verify(forged, key.Public()); err == nil {
+			t.Fatal(alg, "modified payload accepted")
+		}
+	}
+}
+
+func TestCompactErrors(t *testing.T) {
+	key44, _ := GenerateKey(MLDSA44, nil)
+	key65, _ := GenerateKey(MLDSA65, nil)
+	if _, err := Sign(nil, key44.Public(), nil); err == nil {
+		t.Fatal("signed with a public key")
+	}
+	if _, err := Sign(nil, key44, &Header{Algorithm: MLDSA65}); err == nil {
+		t.Fatal("signed with another algorithm")
+	}
+	if _, err := Sign(nil, key44, &Header{Critical: []string{"b64"}}); err == nil {
+		t.Fatal("signed with critical parameters")
+	}
+	token, _ := Sign([]byte("payload"), key44, nil)
+	if _, _, err := Verify(token, key65.Public()); err == nil {
+		t.Fatal("verified with a key of another algorithm")
+	}
+	//a header naming another algorithm than the key is rejected before the signature is checked
+	parts := strings.Split(token, ".")
+	h, _ := json.Marshal(Header{Algorithm: MLDSA65})
+	if _, _, err := Verify(encode(h)+"."+parts[1]+"."+parts[2], key44.Public()); err == nil {
+		t.Fatal("algorithm substitution accepted")
+	}
+	h, _ = json.Marshal(Header{Algorithm: MLDSA44, Critical: []string{"exp"}})
+	if _, _, err := Verify(encode(h)+"."+parts[1]+"."+parts[2], key44.Public()); err == nil {
+		t.Fatal("unknown critical parameter accepted")
+	}
+	if _, _, err := Verify(token+".", key44.Public()); err == nil {
+		t.Fatal("malformed token accepted")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	payload := []byte("firmware manifest")
+	key44, _ := GenerateKey(MLDSA44, nil)
+	key87, _ := GenerateKey(MLDSA87, nil)
+	key87b, _ := GenerateKey(MLDSA87, nil)
+	key44.KeyID, key87.KeyID, key87b.KeyID = "a", "b", "c"
+	data, err := SignJSON(payload, key44, key87)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []*JWK{key44, key87} {
+		got, h, err := VerifyJSON(data, key.Public())
+		if err != nil {
+			t.Fatal(key.Algorithm, err)
+		}
+		if !bytes.Equal(got, payload) || h.KeyID != key.KeyID {
+			t.Fatal(key.Algorithm, "unexpected payload or header")
+		}
+	}
+	if _, _, err := VerifyJSON(data, key87b.Public()); err == nil {
+		t.Fatal("verified with a key that did not sign")
+	}
+
+	//flattened serialization of the first signature
+	var general struct {
+		Payload    string
+		Signatures []jsonSignature
+	}
+	if err := json.Unmarshal(data, &general); err != nil {
+		t.Fatal(err)
+	}
+	flattened, _ := json.Marshal(jsonJWS{Payload: general.Payload, jsonSignature: general.Signatures[0]})
+	if _, _, err := VerifyJSON(flattened, key44.Public()); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := VerifyJSON(flattened, key87.Public()); err == nil {
+		t.Fatal("flattened signature verified with another key")
+	}
+	//the same signature in compact form
+	s := general.Signatures[0]
+	if _, _, err := Verify(s.Protected+"."+general.Payload+"."+s.Signature, key44.Public()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//RFC 7518, Appendix C
+func TestConcatKDF(t *testing.T) {
+	z := []byte{158, 86, 217, 29, 129, 113, 53, 211, 114, 131, 66, 131, 191, 132, 38, 156, 251, 49, 110, 163, 218, 128, 106,
+		72, 246, 218, 167, 121, 140, 254, 144, 196}
+	if key := concatKDF(z, "A128GCM", []byte("Alice"), []byte("Bob"), 16); encode(key) != "VqqN6vgjbSBcIijNcacQGg" {
+		t.Fatal("unexpected derived key", encode(key))
+	}
+}
+
+func TestJWE(t *testing.T) {
+	plaintext := []byte(`{"sub":"alice","scope":"admin"}`)
+	for alg := range kemAlgorithms {
+		key, err := GenerateKey(alg, nil)
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		key.KeyID = "recipient"
+		token, err := Encrypt(plaintext, key.Public(), &Header{Type: "JWT", PartyUInfo: encode([]byte("gateway"))})
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		parts := strings.Split(token, ".")
+		if direct := kemAlgorithms[alg].wrapSize == 0; direct != (parts[1] == "") {
+			t.Fatal(alg, "unexpected encrypted key")
+		}
+		got, h, err := Decrypt(token, key)
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		if !bytes.Equal(got, plaintext) || h.Algorithm != alg || h.Encryption != A256GCM || h.KeyID != "recipient" {
+			t.Fatal(alg, "unexpected plaintext or header")
+		}
+		if _, _, err := Decrypt(token, key.Public()); err == nil {
+			t.Fatal(alg, "decrypted with a public key")
+		}
+		other, _ := GenerateKey(alg, nil)
+		if _, _, err := Decrypt(token, other); err == nil {
+			t.Fatal(alg, "decrypted with another key")
+		}
+		for i := range parts {
+			tampered := append([]string{}, parts...)
+			if tampered[i] == "" {
+				continue
+			}
+			b, _ := decode(tampered[i])
+			b[len(b)-1] ^= 1
+			tampered[i] = encode(b)
+			if _, _, err := Decrypt(strings.Join(tampered, "."), key); err == nil {
+				t.Fatal(alg, "modified part", i, "accepted")
+			}
+		}
+	}
+}
+
+func TestJWEErrors(t *testing.T) {
+	kem, _ := GenerateKey(MLKEM768, nil)
+	sig, _ := GenerateKey(MLDSA65, nil)
+	if _, err := Encrypt(nil, sig, nil); err == nil {
+		t.Fatal("encrypted to a signature key")
+	}
+	if _, err := Encrypt(nil, kem, &Header{Encryption: "A128CBC-HS256"}); err == nil {
+		t.Fatal("unsupported content encryption accepted")
+	}
+	if _, err := Sign(nil, kem, nil); err == nil {
+		t.Fatal("signed with a key management key")
+	}
+	token, _ := Encrypt([]byte("claims"), kem, nil)
+	wrap, _ := GenerateKey(MLKEM768A192KW, nil)
+	wrap.PublicKey, wrap.Seed = kem.PublicKey, kem.Seed
+	if _, _, err := Decrypt(token, wrap); err == nil {
+		t.Fatal("decrypted with another algorithm")
+	}
+}
@@ -0,0 +1,235 @@
+package jose
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/internal/keywrap"
+)
+
+//Algorithm names of key management. With the direct algorithms the content encryption key is derived from the shared
+//secret of ML-KEM, with the key wrap ones it is random and wrapped with AES key wrap under the derived key.
+const (
+	MLKEM512        = "MLKEM512"
+	MLKEM768        = "MLKEM768"
+	MLKEM1024       = "MLKEM1024"
+	MLKEM512A128KW  = "MLKEM512+A128KW"
+	MLKEM768A192KW  = "MLKEM768+A192KW"
+	MLKEM1024A256KW = "MLKEM1024+A256KW"
+)
+
+//A256GCM is the only content encryption algorithm
+const A256GCM = "A256GCM"
+
+const (
+	cekSize   = 32
+	nonceSize = 12
+	tagSize   = 16
+)
+
+//kemAlgorithms gives the ML-KEM instance and the key wrap key size, zero for direct key agreement
+var kemAlgorithms = map[string]struct {
+	newKEM   func() *kyber.Kyber
+	wrapSize int
+}{
+	MLKEM512:        {kyber.NewMLKEM512, 0},
+	MLKEM768:        {kyber.NewMLKEM768, 0},
+	MLKEM1024:       {kyber.NewMLKEM1024, 0},
+	MLKEM512A128KW:  {kyber.NewMLKEM512, 16},
+	MLKEM768A192KW:  {kyber.NewMLKEM768, 24},
+	MLKEM1024A256KW: {kyber.NewMLKEM1024, 32},
+}
+
+func newKEM(alg string) *kyber.Kyber {
+	if a, ok := kemAlgorithms[alg]; ok {
+		return a.newKEM()
+	}
+	return nil
+}
+
+//concatKDF is the key derivation of ECDH-ES (RFC 7518, Section 4.6.2) with the ML-KEM shared secret as Z
+func concatKDF(z []byte, alg string, apu, apv []byte, size int) []byte {
+	var out []byte
+	for counter := uint32(1); len(out) < size; counter++ {
+		h := sha256.New()
+		binary.Write(h, binary.BigEndian, counter)
+		h.Write(z)
+		for _, field := range [][]byte{[]byte(alg), apu, apv} {
+			binary.Write(h, binary.BigEndian, uint32(len(field)))
+			h.Write(field)
+		}
+		binary.Write(h, binary.BigEndian, uint32(8*size))
+		out = h.Sum(out)
+	}
+	return out[:size]
+}
+
+//deriveKey returns the content encryption key of the direct algorithms, or the key wrapping key
+func deriveKey(alg string, ss []byte, h *Header) ([]byte, error) {
+	apu, err := decodeOptional(h.PartyUInfo)
+	if err != nil {
+		return nil, err
+	}
+	apv, err := decodeOptional(h.PartyVInfo)
+	if err != nil {
+		return nil, err
+	}
+	if size := kemAlgorithms[alg].wrapSize; size != 0 {
+		return concatKDF(ss, alg, apu, apv, size), nil
+	}
+	return concatKDF(ss, h.Encryption, apu, apv, cekSize), nil
+}
+
+func decodeOptional(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return decode(s)
+}
+
+//Encrypt returns the compact serialization of a JWE of the plaintext for the ML-KEM public key. The header may be
+//nil, its algorithm and key ID default to those of the key. The encapsulated key is added to the header as "ek".
+func Encrypt(plaintext []byte, key *JWK, header *Header) (string, error) {
+	k := newKEM(key.Algorithm)
+	if k == nil {
+		return "", errors.New("jose: not a key management key")
+	}
+	if err := key.check(); err != nil {
+		return "", err
+	}
+	h := Header{}
+	if header != nil {
+		h = *header
+	}
+	if h.Algorithm == "" {
+		h.Algorithm = key.Algorithm
+	}
+	if h.Encryption == "" {
+		h.Encryption = A256GCM
+	}
+	if h.KeyID == "" {
+		h.KeyID = key.KeyID
+	}
+	switch {
+	case h.Algorithm != key.Algorithm:
+		return "", errors.New("jose: header algorithm does not match the key")
+	case h.Encryption != A256GCM:
+		return "", errors.New("jose: unsupported content encryption " + h.Encryption)
+	case len(h.Critical) != 0:
+		return "", errors.New("jose: critical header parameters are not supported")
+	}
+
+	ct, ss := k.Encaps(key.PublicKey, nil)
+	if ss == nil {
+		return "", errors.New("jose: encapsulation failed")
+	}
+	h.EncapsulatedKey = encode(ct)
+	derived, err := deriveKey(h.Algorithm, ss, &h)
+	if err != nil {
+		return "", err
+	}
+	cek, encryptedKey := derived, []byte(nil)
+	if kemAlgorithms[h.Algorithm].wrapSize != 0 {
+		cek = make([]byte, cekSize)
+		if _, err := io.ReadFull(rand.Reader, cek); err != nil {
+			return "", err
+		}
+		if encryptedKey, err = keywrap.Wrap(derived, cek); err != nil {
+			return "", err
+		}
+	}
+	protected, err := marshalHeader(&h)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newGCM(cek)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nil, nonce, plaintext, []byte(protected))
+	ciphertext, tag := sealed[:len(plaintext)], sealed[len(plaintext):]
+	return strings.Join([]string{protected, encode(encryptedKey), encode(nonce), encode(ciphertext), encode(tag)}, "."), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//Decrypt decrypts a JWE in compact serialization with the ML-KEM private key and returns the plaintext and the
+//protected header
+func Decrypt(token string, key *JWK) ([]byte, *Header, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, nil, errors.New("jose: malformed compact serialization")
+	}
+	h, err := parseHeader(parts[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if h.Algorithm != key.Algorithm {
+		return nil, nil, errors.New("jose: algorithm does not match the key")
+	}
+	if h.Encryption != A256GCM {
+		return nil, nil, errors.New("jose: unsupported content encryption " + h.Encryption)
+	}
+	k, sk, err := key.decapsulationKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	fields := make([][]byte, 4)
+	for i := range fields {
+		if fields[i], err = decode(parts[i+1]); err != nil {
+			return nil, nil, err
+		}
+	}
+	encryptedKey, nonce, ciphertext, tag := fields[0], fields[1], fields[2], fields[3]
+	ct, err := decode(h.EncapsulatedKey)
+	if err != nil || len(ct) != k.SIZEC() {
+		return nil, nil, errors.New("jose: invalid encapsulated key")
+	}
+	if len(nonce) != nonceSize || len(tag) != tagSize {
+		return nil, nil, errors.New("jose: invalid initialization vector or authentication tag")
+	}
+	ss := k.Decaps(sk, ct)
+	if ss == nil {
+		return nil, nil, errors.New("jose: decapsulation failed")
+	}
+	cek, err := deriveKey(h.Algorithm, ss, h)
+	if err != nil {
+		return nil, nil, err
+	}
+	if kemAlgorithms[h.Algorithm].wrapSize != 0 {
+		if cek, err = keywrap.Unwrap(cek, encryptedKey); err != nil {
+			return nil, nil, errors.New("jose: decryption failed")
+		}
+		if len(cek) != cekSize {
+			return nil, nil, errors.New("jose: invalid content encryption key")
+		}
+	} else if len(encryptedKey) != 0 {
+		return nil, nil, errors.New("jose: unexpected encrypted key with direct key agreement")
+	}
+	aead, err := newGCM(cek)
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, err := aead.Open(nil, nonce, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return nil, nil, errors.New("jose: decryption failed")
+	}
+	return plaintext, h, nil
+}
@@ -0,0 +1,182 @@
+package jose
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/internal/randutil"
+)
+
+//KeyTypeAKP is the key type of ML-DSA, Dilithium and ML-KEM keys
+const KeyTypeAKP = "AKP"
+
+//JWK is an AKP key. Seed is nil for public keys.
+type JWK struct {
+	Algorithm string
+	KeyID     string
+	PublicKey []byte
+	Seed      []byte
+}
+
+type rawJWK struct {
+	KeyType   string `json:"kty"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid,omitempty"`
+	Public    string `json:"pub"`
+	Private   string `json:"priv,omitempty"`
+}
+
+//keyAlgorithm describes the keys of an algorithm: the private key is the seed given to KeyGen, 32 bytes for ML-DSA
+//and Dilithium, 64 bytes (d || z) for ML-KEM
+type keyAlgorithm struct {
+	publicKeySize int
+	seedSize      int
+	keyGen        func(seed []byte) ([]byte, []byte)
+}
+
+func lookupKeyAlgorithm(alg string) *keyAlgorithm {
+	if d := newDilithium(alg); d != nil {
+		return &keyAlgorithm{d.SIZEPK(), dilithium.SEEDBYTES, d.KeyGen}
+	}
+	if k := newKEM(alg); k != nil {
+		return &keyAlgorithm{k.SIZEPK(), kyber.SEEDBYTES + kyber.SIZEZ, k.KeyGen}
+	}
+	return nil
+}
+
+//GenerateKey returns a new private key of a signature or key management algorithm, with the seed read from rand
+//(crypto/rand if nil)
+func GenerateKey(alg string, rand io.Reader) (*JWK, error) {
+	a := lookupKeyAlgorithm(alg)
+	if a == nil {
+		return nil, errors.New("jose: unknown algorithm " + alg)
+	}
+	seed := make([]byte, a.seedSize)
+	if _, err := io.ReadFull(randutil.Reader(rand), seed); err != nil {
+		return nil, err
+	}
+	pk, _ := a.keyGen(seed)
+	return &JWK{Algorithm: alg, PublicKey: pk, Seed: seed}, nil
+}
+
+func newDilithium(alg string) *dilithium.Dilithium {
+	if f, ok := signatureAlgorithms[alg]; ok {
+		return f()
+	}
+	return nil
+}
+
+//Public returns the public part of the key
+func (k *JWK) Public() *JWK {
+	return &JWK{Algorithm: k.Algorithm, KeyID: k.KeyID, PublicKey: k.PublicKey}
+}
+
+//IsPrivate reports whether the key holds the private seed
+func (k *JWK) IsPrivate() bool {
+	return k.Seed != nil
+}
+
+//check verifies the length of the key and that the seed matches the public key
+func (k *JWK) check() error {
+	a := lookupKeyAlgorithm(k.Algorithm)
+	if a == nil {
+		return errors.New("jose: unknown algorithm " + k.Algorithm)
+	}
+	if len(k.PublicKey) != a.publicKeySize {
+		return errors.New("jose: invalid public key length")
+	}
+	if k.Seed != nil {
+		if len(k.Seed) != a.seedSize {
+			return errors.New("jose: invalid private key length")
+		}
+		if pk, _ := a.keyGen(k.Seed); !bytes.Equal(pk, k.PublicKey) {
+			return errors.New("jose: private key does not match the public key")
+		}
+	}
+	return nil
+}
+
+//signingKey expands the seed into the private key of the dilithium package
+func (k *JWK) signingKey() (*dilithium.Dilithium, []byte, error) {
+	d := newDilithium(k.Algorithm)
+	if d == nil {
+		return nil, nil, errors.New("jose: not a signing key")
+	}
+	if k.Seed == nil {
+		return nil, nil, errors.New("jose: not a private key")
+	}
+	if err := k.check(); err != nil {
+		return nil, nil, err
+	}
+	_, sk := d.KeyGen(k.Seed)
+	return d, sk, nil
+}
+
+//decapsulationKey expands the seed into the private key of the kyber package
+func (k *JWK) decapsulationKey() (*kyber.Kyber, []byte, error) {
+	kem := newKEM(k.Algorithm)
+	if kem == nil {
+		return nil, nil, errors.New("jose: not a key management key")
+	}
+	if k.Seed == nil {
+		return nil, nil, errors.New("jose: not a private key")
+	}
+	if err := k.check(); err != nil {
+		return nil, nil, err
+	}
+	_, sk := kem.KeyGen(k.Seed)
+	return kem, sk, nil
+}
+
+//MarshalJSON encodes the key, including the seed of private keys
+func (k *JWK) MarshalJSON() ([]byte, error) {
+	if err := k.check(); err != nil {
+		return nil, err
+	}
+	raw := rawJWK{KeyType: KeyTypeAKP, Algorithm: k.Algorithm, KeyID: k.KeyID, Public: encode(k.PublicKey)}
+	if k.Seed != nil {
+		raw.Private = encode(k.Seed)
+	}
+	return json.Marshal(raw)
+}
+
+//UnmarshalJSON decodes an AKP key and checks that its seed, if any, generates its public key
+func (k *JWK) UnmarshalJSON(data []byte) error {
+	var raw rawJWK
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.KeyType != KeyTypeAKP {
+		return errors.New("jose: unsupported key type " + raw.KeyType)
+	}
+	pk, err := decode(raw.Public)
+	if err != nil {
+		return err
+	}
+	key := JWK{Algorithm: raw.Algorithm, KeyID: raw.KeyID, PublicKey: pk}
+	if raw.Private != "" {
+		if key.Seed, err = decode(raw.Private); err != nil {
+			return err
+		}
+	}
+	if err := key.check(); err != nil {
+		return err
+	}
+	*k = key
+	return nil
+}
+
+//Thumbprint returns the RFC 7638 SHA-256 thumbprint of the key, computed over its alg, kty and pub members
+func (k *JWK) Thumbprint() ([]byte, error) {
+	if err := k.check(); err != nil {
+		return nil, err
+	}
+	//members in lexicographic order, the values need no escaping
+	h := sha256.Sum256([]byte(`{"alg":"` + k.Algorithm + `","kty":"` + KeyTypeAKP + `","pub":"` + encode(k.PublicKey) + `"}`))
+	return h[:], nil
+}
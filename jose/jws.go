@@ -0,0 +1,196 @@
+package jose
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+//protectedHeader returns the encoded header of a signature by key, filling in the algorithm and key ID
+func protectedHeader(key *JWK, header *Header) (string, error) {
+	h := Header{}
+	if header != nil {
+		h = *header
+	}
+	if h.Algorithm == "" {
+		h.Algorithm = key.Algorithm
+	}
+	if h.Algorithm != key.Algorithm {
+		return "", errors.New("jose: header algorithm does not match the key")
+	}
+	if h.KeyID == "" {
+		h.KeyID = key.KeyID
+	}
+	if len(h.Critical) != 0 {
+		return "", errors.New("jose: critical header parameters are not supported")
+	}
+	return marshalHeader(&h)
+}
+
+//marshalHeader returns the base64url encoding of a protected header
+func marshalHeader(h *Header) (string, error) {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+	return encode(b), nil
+}
+
+//parseHeader decodes a protected header, rejecting unknown critical parameters
+func parseHeader(encoded string) (*Header, error) {
+	b, err := decode(encoded)
+	if err != nil {
+		return nil, err
+	}
+	var h Header
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, errors.New("jose: malformed header")
+	}
+	if h.Critical != nil {
+		return nil, errors.New("jose: unsupported critical header parameters")
+	}
+	return &h, nil
+}
+
+//sign signs the signing input of a protected header and payload, both already base64url encoded
+func sign(key *JWK, protected, payload string) (string, error) {
+	d, sk, err := key.signingKey()
+	if err != nil {
+		return "", err
+	}
+	sig := d.Sign(sk, []byte(protected+"."+payload))
+	if sig == nil {
+		return "", errors.New("jose: signature failed")
+	}
+	return encode(sig), nil
+}
+
+//verify checks a signature against the key, after checking that the header names the algorithm of the key
+func verify(key *JWK, h *Header, protected, payload, signature string) error {
+	if h.Algorithm != key.Algorithm {
+		return errors.New("jose: algorithm does not match the key")
+	}
+	d := newDilithium(key.Algorithm)
+	if d == nil || len(key.PublicKey) != d.SIZEPK() {
+		return errors.New("jose: invalid key")
+	}
+	sig, err := decode(signature)
+	if err != nil {
+		return err
+	}
+	if !d.Verify(key.PublicKey, []byte(protected+"."+payload), sig) {
+		return errors.New("jose: invalid signature")
+	}
+	return nil
+}
+
+//Sign returns the compact serialization of a JWS of the payload. The header may be nil, its algorithm and key ID
+//default to those of the key.
+func Sign(payload []byte, key *JWK, header *Header) (string, error) {
+	protected, err := protectedHeader(key, header)
+	if err != nil {
+		return "", err
+	}
+	encodedPayload := encode(payload)
+	sig, err := sign(key, protected, encodedPayload)
+	if err != nil {
+		return "", err
+	}
+	return protected + "." + encodedPayload + "." + sig, nil
+}
+
+//Verify checks a JWS in compact serialization and returns its payload and protected header
+func Verify(token string, key *JWK) ([]byte, *Header, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, errors.New("jose: malformed compact serialization")
+	}
+	h, err := parseHeader(parts[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := verify(key, h, parts[0], parts[1], parts[2]); err != nil {
+		return nil, nil, err
+	}
+	payload, err := decode(parts[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	return payload, h, nil
+}
+
+type jsonSignature struct {
+	Protected string  `json:"protected"`
+	Header    *Header `json:"header,omitempty"`
+	Signature string  `json:"signature"`
+}
+
+//jsonJWS holds both the general and the flattened JSON serializations
+type jsonJWS struct {
+	Payload    string          `json:"payload"`
+	Signatures []jsonSignature `json:"signatures,omitempty"`
+	jsonSignature
+}
+
+//SignJSON returns the general JSON serialization of a JWS of the payload with one signature per key
+func SignJSON(payload []byte, keys ...*JWK) ([]byte, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("jose: no signing keys")
+	}
+	jws := struct {
+		Payload    string          `json:"payload"`
+		Signatures []jsonSignature `json:"signatures"`
+	}{Payload: encode(payload)}
+	for _, key := range keys {
+		protected, err := protectedHeader(key, nil)
+		if err != nil {
+			return nil, err
+		}
+		s := jsonSignature{Protected: protected}
+		if s.Signature, err = sign(key, s.Protected, jws.Payload); err != nil {
+			return nil, err
+		}
+		jws.Signatures = append(jws.Signatures, s)
+	}
+	return json.Marshal(jws)
+}
+
+//VerifyJSON checks a JWS in general or flattened JSON serialization and returns its payload and the protected header
+//of the signature made by the key. Signatures are matched to the key by key ID when both have one, the other
+//signatures of the JWS are not checked.
+func VerifyJSON(data []byte, key *JWK) ([]byte, *Header, error) {
+	var jws jsonJWS
+	if err := json.Unmarshal(data, &jws); err != nil {
+		return nil, nil, errors.New("jose: malformed JSON serialization")
+	}
+	signatures := jws.Signatures
+	if jws.Signature != "" {
+		if len(signatures) != 0 {
+			return nil, nil, errors.New("jose: mixed general and flattened JSON serialization")
+		}
+		signatures = []jsonSignature{jws.jsonSignature}
+	}
+	err := errors.New("jose: no signature by the key")
+	for _, s := range signatures {
+		h, herr := parseHeader(s.Protected)
+		if herr != nil {
+			return nil, nil, herr
+		}
+		kid := h.KeyID
+		if kid == "" && s.Header != nil {
+			kid = s.Header.KeyID
+		}
+		if h.Algorithm != key.Algorithm || (kid != "" && key.KeyID != "" && kid != key.KeyID) {
+			continue
+		}
+		if err = verify(key, h, s.Protected, jws.Payload, s.Signature); err != nil {
+			continue
+		}
+		payload, err := decode(jws.Payload)
+		if err != nil {
+			return nil, nil, err
+		}
+		return payload, h, nil
+	}
+	return nil, nil, err
+}
@@ -0,0 +1,130 @@
+package kemtls
+
+import (
+	"errors"
+	"time"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+//certificateContext separates certificate signatures from other uses of the CA key
+const certificateContext = "KEMTLS certificate\x00"
+
+const certificateVersion = 1
+
+//Certificate binds a server name to a static Kyber public key. It is signed directly by a Dilithium CA key, there are
+//no intermediate certificates.
+type Certificate struct {
+	Subject   string
+	KEM       string //name of the Kyber instance, for example "Kyber768"
+	PublicKey []byte
+	NotBefore time.Time
+	NotAfter  time.Time
+	//Signature is the CA signature of the other fields, set by SignCertificate and ParseCertificate
+	Signature []byte
+}
+
+//tbs returns the encoding of the signed fields
+func (c *Certificate) tbs() ([]byte, error) {
+	var b cryptobyte.Builder
+	b.AddUint8(certificateVersion)
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes([]byte(c.Subject))
+	})
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes([]byte(c.KEM))
+	})
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(c.PublicKey)
+	})
+	addTime(&b, c.NotBefore)
+	addTime(&b, c.NotAfter)
+	return b.Bytes()
+}
+
+//Times are encoded as 64-bit Unix times
+func addTime(b *cryptobyte.Builder, t time.Time) {
+	u := uint64(t.Unix())
+	b.AddUint32(uint32(u >> 32))
+	b.AddUint32(uint32(u))
+}
+
+func readTime(s *cryptobyte.String, t *time.Time) bool {
+	var hi, lo uint32
+	if !s.ReadUint32(&hi) || !s.ReadUint32(&lo) {
+		return false
+	}
+	*t = time.Unix(int64(uint64(hi)<<32|uint64(lo)), 0)
+	return true
+}
+
+//SignCertificate signs the fields of tmpl, except Signature, with the Dilithium private key of the CA and returns the
+//encoded certificate
+func SignCertificate(d *dilithium.Dilithium, caPrivateKey []byte, tmpl *Certificate) ([]byte, error) {
+	tbs, err := tmpl.tbs()
+	if err != nil {
+		return nil, errors.New("kemtls: certificate fields too long")
+	}
+	sig := d.Sign(caPrivateKey, append([]byte(certificateContext), tbs...))
+	if sig == nil {
+		return nil, errors.New("kemtls: failed to sign the certificate")
+	}
+	var b cryptobyte.Builder
+	b.AddBytes(tbs)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(sig)
+	})
+	return b.Bytes()
+}
+
+//ParseCertificate decodes a certificate without checking its signature
+func ParseCertificate(data []byte) (*Certificate, error) {
+	s := cryptobyte.String(data)
+	var version uint8
+	var subject, kem, pk, sig cryptobyte.String
+	var notBefore, notAfter time.Time
+	if !s.ReadUint8(&version) || version != certificateVersion ||
+		!s.ReadUint8LengthPrefixed(&subject) ||
+		!s.ReadUint8LengthPrefixed(&kem) ||
+		!s.ReadUint16LengthPrefixed(&pk) ||
+		!readTime(&s, &notBefore) ||
+		!readTime(&s, &notAfter) ||
+		!s.ReadUint16LengthPrefixed(&sig) ||
+		!s.Empty() {
+		return nil, errors.New("kemtls: malformed certificate")
+	}
+	return &Certificate{
+		Subject:   string(subject),
+		KEM:       string(kem),
+		PublicKey: append([]byte{}, pk...),
+		NotBefore: notBefore,
+		NotAfter:  notAfter,
+		Signature: append([]byte{}, sig...),
+	}, nil
+}
+
+//Verify checks that the certificate is signed by one of the CA keys, valid at time now and issued for name
+func (c *Certificate) Verify(d *dilithium.Dilithium, roots [][]byte, name string, now time.Time) error {
+	tbs, err := c.tbs()
+	if err != nil {
+		return errors.New("kemtls: malformed certificate")
+	}
+	signed := false
+	for _, root := range roots {
+		if d.Verify(root, append([]byte(certificateContext), tbs...), c.Signature) {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return errors.New("kemtls: certificate signed by an unknown authority")
+	}
+	if now.Before(c.NotBefore) || now.After(c.NotAfter) {
+		return errors.New("kemtls: certificate expired or not yet valid")
+	}
+	if c.Subject != name {
+		return errors.New("kemtls: certificate is not valid for " + name)
+	}
+	return nil
+}
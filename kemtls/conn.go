@@ -0,0 +1,201 @@
+//Package kemtls implements a prototype of KEMTLS (Schwabe, Stebila, Wiggers, https://eprint.iacr.org/2020/534), a
+//variant of the TLS 1.3 handshake where the server authenticates with a static Kyber key instead of a signature.
+//
+//The client sends an ephemeral Kyber public key in its ClientHello and the server answers with an encapsulation to it
+//and with its certificate, which carries a static Kyber public key signed by a Dilithium CA. The client then
+//encapsulates to the certified key in a ClientKemCiphertext message; only the owner of the static private key can
+//derive the keys that follow, which authenticates the server implicitly. The key schedule and the transcript hash are
+//those of the paper, with SHA-256 and the "tls13 " labels, and records are protected with ChaCha20-Poly1305.
+//
+//As in the paper, the client can send application data right after its Finished message, before receiving the
+//Finished message of the server, which is read on the first Read. Client authentication, extensions and resumption
+//are not implemented.
+package kemtls
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/internal/randutil"
+	"github.com/kudelskisecurity/crystals-go/internal/record"
+)
+
+//Config configures a client or a server. It must not be modified once passed to Client or Server.
+type Config struct {
+	//KEM is used for the ephemeral and the static keys, NewKyber768() if nil. Both sides must use the same one.
+	KEM *kyber.Kyber
+	//Dilithium is the signature scheme of the CA, NewDilithium3() if nil
+	Dilithium *dilithium.Dilithium
+	//Certificate is the encoded certificate of servers, and PrivateKey the Kyber private key matching it
+	Certificate []byte
+	PrivateKey  []byte
+	//RootKeys are the Dilithium public keys of the CAs trusted by clients
+	RootKeys [][]byte
+	//ServerName is the subject clients expect in the server certificate
+	ServerName string
+	//Time returns the current time to check certificates, time.Now if nil
+	Time func() time.Time
+	//Rand is the source of the hello randoms, the ephemeral key seeds and the encapsulation coins, crypto/rand if nil
+	Rand io.Reader
+}
+
+func (c *Config) kem() *kyber.Kyber {
+	if c.KEM == nil {
+		return kyber.NewKyber768()
+	}
+	return c.KEM
+}
+
+func (c *Config) dilithium() *dilithium.Dilithium {
+	if c.Dilithium == nil {
+		return dilithium.NewDilithium3()
+	}
+	return c.Dilithium
+}
+
+func (c *Config) now() time.Time {
+	if c.Time == nil {
+		return time.Now()
+	}
+	return c.Time()
+}
+
+func (c *Config) rand() io.Reader {
+	return randutil.Reader(c.Rand)
+}
+
+//Conn is a KEMTLS connection. It implements net.Conn; the handshake runs on the first Read or Write, or on an explicit
+//call to Handshake.
+type Conn struct {
+	conn     net.Conn
+	config   *Config
+	isClient bool
+	rec      *record.Conn
+
+	handshakeMutex sync.Mutex
+	handshakeErr   error
+	handshakeDone  bool
+	peerCert       *Certificate
+
+	//serverFinished is set on clients until the Finished message of the server has been read
+	finishedMutex  sync.Mutex
+	serverFinished *pendingFinished
+	finishedErr    error
+}
+
+//Client returns a new client side connection over conn
+func Client(conn net.Conn, config *Config) *Conn {
+	return &Conn{conn: conn, config: config, isClient: true, rec: record.New(conn, labelPrefix)}
+}
+
+//Server returns a new server side connection over conn
+func Server(conn net.Conn, config *Config) *Conn {
+	return &Conn{conn: conn, config: config, rec: record.New(conn, labelPrefix)}
+}
+
+//Handshake runs the handshake if it has not been run yet. On clients, it returns once the ClientFinished message is
+//sent, and the server is authenticated when its Finished message is read.
+func (c *Conn) Handshake() error {
+	c.handshakeMutex.Lock()
+	defer c.handshakeMutex.Unlock()
+	if c.handshakeDone || c.handshakeErr != nil {
+		return c.handshakeErr
+	}
+	if c.isClient {
+		c.handshakeErr = c.clientHandshake()
+	} else {
+		c.handshakeErr = c.serverHandshake()
+	}
+	c.handshakeDone = c.handshakeErr == nil
+	return c.handshakeErr
+}
+
+//ConfirmHandshake reads the Finished message of the server, if it has not been read yet. Once it returns nil, the
+//server has proven the possession of the private key of its certificate.
+func (c *Conn) ConfirmHandshake() error {
+	if err := c.Handshake(); err != nil {
+		return err
+	}
+	c.finishedMutex.Lock()
+	defer c.finishedMutex.Unlock()
+	if c.serverFinished != nil {
+		c.finishedErr = c.readServerFinished(c.serverFinished)
+		c.serverFinished = nil
+	}
+	return c.finishedErr
+}
+
+//PeerCertificate returns the certificate of the server on clients, nil on servers
+func (c *Conn) PeerCertificate() *Certificate {
+	c.handshakeMutex.Lock()
+	defer c.handshakeMutex.Unlock()
+	return c.peerCert
+}
+
+//Read reads application data, running the handshake first if needed
+func (c *Conn) Read(b []byte) (int, error) {
+	if err := c.ConfirmHandshake(); err != nil {
+		return 0, err
+	}
+	return c.rec.Read(b)
+}
+
+//Write writes application data, running the handshake first if needed. Clients can write before the Finished message
+//of the server has been received.
+func (c *Conn) Write(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	return c.rec.Write(b)
+}
+
+//UpdateKeys updates the sending key and asks the peer to update its own
+func (c *Conn) UpdateKeys() error {
+	if err := c.Handshake(); err != nil {
+		return err
+	}
+	return c.rec.UpdateKeys()
+}
+
+//Close sends a close_notify alert if the handshake is complete and closes the connection
+func (c *Conn) Close() error {
+	c.handshakeMutex.Lock()
+	done := c.handshakeDone
+	c.handshakeMutex.Unlock()
+	if !done {
+		return c.conn.Close()
+	}
+	return c.rec.Close()
+}
+
+//LocalAddr returns the local network address
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+//RemoteAddr returns the remote network address
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+//SetDeadline sets the read and write deadlines of the underlying connection
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+//SetReadDeadline sets the read deadline of the underlying connection
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+//SetWriteDeadline sets the write deadline of the underlying connection
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+var errNoCertificate = errors.New("kemtls: servers need a certificate and a private key")
@@ -0,0 +1,294 @@
+package kemtls
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/internal/record"
+)
+
+const labelPrefix = "tls13 "
+
+const protocolVersion = 1
+
+//Handshake message types. ClientKemCiphertext has no TLS code point, a private use value is taken.
+const (
+	typeClientHello         uint8 = 1
+	typeServerHello         uint8 = 2
+	typeCertificate         uint8 = 11
+	typeFinished            uint8 = 20
+	typeClientKemCiphertext uint8 = 254
+)
+
+var kemIDs = map[string]uint8{
+	"Kyber512": 1, "Kyber768": 2, "Kyber1024": 3,
+	"ML-KEM-512": 4, "ML-KEM-768": 5, "ML-KEM-1024": 6,
+}
+
+//handshakeError is sent to the peer as an alert before being returned
+type handshakeError struct {
+	msg string
+}
+
+func (e *handshakeError) Error() string {
+	return "kemtls: " + e.msg
+}
+
+func (c *Conn) fail(alert uint8, msg string) error {
+	c.rec.SendAlert(alert)
+	return &handshakeError{msg: msg}
+}
+
+//transcript is the running hash of the handshake messages
+type transcript struct {
+	h hash.Hash
+}
+
+func (t *transcript) add(msg []byte) {
+	t.h.Write(msg)
+}
+
+func (t *transcript) sum() []byte {
+	return t.h.Sum(nil)
+}
+
+func (c *Conn) writeHandshake(t *transcript, typ uint8, body []byte) error {
+	n := len(body)
+	msg := append([]byte{typ, byte(n >> 16), byte(n >> 8), byte(n)}, body...)
+	t.add(msg)
+	return c.rec.WriteRecord(record.TypeHandshake, msg)
+}
+
+//expectHandshake reads a handshake message of the given type, which must fit in one record, and adds it to the
+//transcript
+func (c *Conn) expectHandshake(t *transcript, typ uint8) ([]byte, error) {
+	rt, data, err := c.rec.ReadRecord()
+	if err != nil {
+		return nil, err
+	}
+	if rt == record.TypeAlert && len(data) == 2 {
+		return nil, record.AlertError(data[1])
+	}
+	if rt != record.TypeHandshake || len(data) < 4 || data[0] != typ {
+		return nil, c.fail(record.AlertUnexpected, "unexpected message")
+	}
+	if int(data[1])<<16|int(data[2])<<8|int(data[3]) != len(data)-4 {
+		return nil, c.fail(record.AlertDecodeError, "malformed handshake message")
+	}
+	t.add(data)
+	return data[4:], nil
+}
+
+//deriveSecret is Derive-Secret of TLS 1.3 with SHA-256
+func deriveSecret(secret []byte, label string, transcriptHash []byte) []byte {
+	return record.ExpandLabel(labelPrefix, secret, label, transcriptHash, sha256.Size)
+}
+
+func emptyHash() []byte {
+	h := sha256.Sum256(nil)
+	return h[:]
+}
+
+//handshakeSecrets computes the handshake stage of the KEMTLS key schedule from the ephemeral shared secret:
+//HS = HKDF.Extract(dES, ss_e) and the client and server handshake traffic secrets
+func handshakeSecrets(sse, transcriptHash []byte) (hs, chts, shts []byte) {
+	es := record.Extract(nil, nil)
+	hs = record.Extract(deriveSecret(es, "derived", emptyHash()), sse)
+	return hs, deriveSecret(hs, "c hs traffic", transcriptHash), deriveSecret(hs, "s hs traffic", transcriptHash)
+}
+
+//authenticatedSecrets computes the authenticated handshake stage from the static shared secret:
+//AHS = HKDF.Extract(dHS, ss_s), the authenticated handshake traffic secrets and MS = HKDF.Extract(dAHS, 0)
+func authenticatedSecrets(hs, sss, transcriptHash []byte) (cahts, sahts, ms []byte) {
+	ahs := record.Extract(deriveSecret(hs, "derived", emptyHash()), sss)
+	ms = record.Extract(deriveSecret(ahs, "derived", emptyHash()), nil)
+	return deriveSecret(ahs, "c ahs traffic", transcriptHash), deriveSecret(ahs, "s ahs traffic", transcriptHash), ms
+}
+
+//finishedMAC computes HMAC(fk, transcript hash) with fk = HKDF.Expand(MS, label, ∅)
+func finishedMAC(ms []byte, label string, transcriptHash []byte) []byte {
+	h := hmac.New(sha256.New, deriveSecret(ms, label, emptyHash()))
+	h.Write(transcriptHash)
+	return h.Sum(nil)
+}
+
+//pendingFinished holds the state a client needs to check the Finished message of the server
+type pendingFinished struct {
+	t  *transcript
+	ms []byte
+}
+
+func (c *Conn) clientHandshake() error {
+	if len(c.config.RootKeys) == 0 {
+		return errors.New("kemtls: clients need root keys")
+	}
+	k := c.config.kem()
+	kemID, ok := kemIDs[k.Name]
+	if !ok {
+		return errors.New("kemtls: unsupported KEM " + k.Name)
+	}
+	t := &transcript{h: sha256.New()}
+
+	//ClientHello: version, random, KEM identifier and ephemeral public key
+	hello := make([]byte, 34, 34+k.SIZEPK())
+	hello[0] = protocolVersion
+	if _, err := io.ReadFull(c.config.rand(), hello[1:33]); err != nil {
+		return err
+	}
+	hello[33] = kemID
+	seed := make([]byte, 2*kyber.SEEDBYTES)
+	if _, err := io.ReadFull(c.config.rand(), seed); err != nil {
+		return err
+	}
+	pke, ske := k.KeyGen(seed)
+	if err := c.writeHandshake(t, typeClientHello, append(hello, pke...)); err != nil {
+		return err
+	}
+
+	//ServerHello: random and encapsulation to the ephemeral key
+	sh, err := c.expectHandshake(t, typeServerHello)
+	if err != nil {
+		return err
+	}
+	if len(sh) != 32+k.SIZEC() {
+		return c.fail(record.AlertDecodeError, "malformed ServerHello")
+	}
+	hs, chts, shts := handshakeSecrets(k.Decaps(ske, sh[32:]), t.sum())
+	c.rec.SetReadSecret(shts)
+	c.rec.SetWriteSecret(chts)
+
+	certBytes, err := c.expectHandshake(t, typeCertificate)
+	if err != nil {
+		return err
+	}
+	cert, err := ParseCertificate(certBytes)
+	if err != nil {
+		return c.fail(record.AlertBadCertificate, "malformed certificate")
+	}
+	if err := cert.Verify(c.config.dilithium(), c.config.RootKeys, c.config.ServerName, c.config.now()); err != nil {
+		c.rec.SendAlert(record.AlertBadCertificate)
+		return err
+	}
+	if cert.KEM != k.Name || len(cert.PublicKey) != k.SIZEPK() {
+		return c.fail(record.AlertBadCertificate, "certificate key does not match the KEM")
+	}
+
+	//ClientKemCiphertext: encapsulation to the certified static key
+	coins := make([]byte, kyber.SEEDBYTES)
+	if _, err := io.ReadFull(c.config.rand(), coins); err != nil {
+		return err
+	}
+	cts, sss := k.Encaps(cert.PublicKey, coins)
+	if cts == nil {
+		return c.fail(record.AlertBadCertificate, "invalid certificate key")
+	}
+	if err := c.writeHandshake(t, typeClientKemCiphertext, cts); err != nil {
+		return err
+	}
+	cahts, sahts, ms := authenticatedSecrets(hs, sss, t.sum())
+	c.rec.SetReadSecret(sahts)
+	c.rec.SetWriteSecret(cahts)
+
+	if err := c.writeHandshake(t, typeFinished, finishedMAC(ms, "c finished", t.sum())); err != nil {
+		return err
+	}
+	c.rec.SetWriteSecret(deriveSecret(ms, "c ap traffic", t.sum()))
+	c.peerCert = cert
+	c.serverFinished = &pendingFinished{t: t, ms: ms}
+	return nil
+}
+
+//readServerFinished checks the Finished message of the server and switches to the server application secret
+func (c *Conn) readServerFinished(p *pendingFinished) error {
+	expected := finishedMAC(p.ms, "s finished", p.t.sum())
+	sf, err := c.expectHandshake(p.t, typeFinished)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(sf, expected) {
+		return c.fail(record.AlertDecryptError, "invalid server Finished message")
+	}
+	c.rec.SetReadSecret(deriveSecret(p.ms, "s ap traffic", p.t.sum()))
+	return nil
+}
+
+func (c *Conn) serverHandshake() error {
+	if len(c.config.Certificate) == 0 || len(c.config.PrivateKey) == 0 {
+		return errNoCertificate
+	}
+	k := c.config.kem()
+	kemID, ok := kemIDs[k.Name]
+	if !ok {
+		return errors.New("kemtls: unsupported KEM " + k.Name)
+	}
+	if len(c.config.PrivateKey) != k.SIZESK() {
+		return errors.New("kemtls: private key does not match the KEM")
+	}
+	t := &transcript{h: sha256.New()}
+
+	ch, err := c.expectHandshake(t, typeClientHello)
+	if err != nil {
+		return err
+	}
+	if len(ch) < 34 || ch[0] != protocolVersion {
+		return c.fail(record.AlertDecodeError, "malformed ClientHello")
+	}
+	if ch[33] != kemID {
+		return c.fail(record.AlertHandshake, "client uses another KEM")
+	}
+	if len(ch) != 34+k.SIZEPK() {
+		return c.fail(record.AlertDecodeError, "malformed ClientHello")
+	}
+	hello := make([]byte, 32, 32+k.SIZEC())
+	if _, err := io.ReadFull(c.config.rand(), hello); err != nil {
+		return err
+	}
+	coins := make([]byte, kyber.SEEDBYTES)
+	if _, err := io.ReadFull(c.config.rand(), coins); err != nil {
+		return err
+	}
+	cte, sse := k.Encaps(ch[34:], coins)
+	if cte == nil {
+		return c.fail(record.AlertHandshake, "invalid client key share")
+	}
+	if err := c.writeHandshake(t, typeServerHello, append(hello, cte...)); err != nil {
+		return err
+	}
+	hs, chts, shts := handshakeSecrets(sse, t.sum())
+	c.rec.SetReadSecret(chts)
+	c.rec.SetWriteSecret(shts)
+
+	if err := c.writeHandshake(t, typeCertificate, c.config.Certificate); err != nil {
+		return err
+	}
+	cts, err := c.expectHandshake(t, typeClientKemCiphertext)
+	if err != nil {
+		return err
+	}
+	if len(cts) != k.SIZEC() {
+		return c.fail(record.AlertDecodeError, "malformed ClientKemCiphertext")
+	}
+	cahts, sahts, ms := authenticatedSecrets(hs, k.Decaps(c.config.PrivateKey, cts), t.sum())
+	c.rec.SetReadSecret(cahts)
+	c.rec.SetWriteSecret(sahts)
+
+	expected := finishedMAC(ms, "c finished", t.sum())
+	cf, err := c.expectHandshake(t, typeFinished)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(cf, expected) {
+		return c.fail(record.AlertDecryptError, "invalid client Finished message")
+	}
+	c.rec.SetReadSecret(deriveSecret(ms, "c ap traffic", t.sum()))
+
+	if err := c.writeHandshake(t, typeFinished, finishedMAC(ms, "s finished", t.sum())); err != nil {
+		return err
+	}
+	c.rec.SetWriteSecret(deriveSecret(ms, "s ap traffic", t.sum()))
+	return nil
+}
@@ -0,0 +1,190 @@
+package kemtls
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+)
+
+//tcpPipe returns the two ends of a loopback TCP connection. Unlike net.Pipe, it buffers the Finished message of the
+//server while the client writes.
+func tcpPipe(t *testing.T) (net.Conn, net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen on loopback:", err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn)
+	go func() {
+		conn, _ := l.Accept()
+		accepted <- conn
+	}()
+	a, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := <-accepted
+	if b == nil {
+		t.Fatal("accept failed")
+	}
+	return a, b
+}
+
+type pki struct {
+	d        *dilithium.Dilithium
+	caPK     []byte
+	caSK     []byte
+	cert     []byte
+	serverSK []byte
+}
+
+func newPKI(t *testing.T, k *kyber.Kyber, name string, notAfter time.Time) *pki {
+	d := dilithium.NewDilithium3()
+	caPK, caSK := d.KeyGen(nil)
+	pk, sk := k.KeyGen(nil)
+	cert, err := SignCertificate(d, caSK, &Certificate{
+		Subject:   name,
+		KEM:       k.Name,
+		PublicKey: pk,
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  notAfter,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &pki{d: d, caPK: caPK, caSK: caSK, cert: cert, serverSK: sk}
+}
+
+func connect(t *testing.T, cc, sc *Config) (*Conn, *Conn, error, error) {
+	a, b := tcpPipe(t)
+	client, server := Client(a, cc), Server(b, sc)
+	errs := make(chan error, 1)
+	go func() {
+		err := server.Handshake()
+		if err != nil {
+			b.Close()
+		}
+		errs <- err
+	}()
+	cerr := client.Handshake()
+	if cerr == nil {
+		cerr = client.ConfirmHandshake()
+	}
+	if cerr != nil {
+		a.Close()
+	}
+	return client, server, cerr, <-errs
+}
+
+func TestHandshake(t *testing.T) {
+	for _, k := range []*kyber.Kyber{kyber.NewKyber512(), kyber.NewKyber768(), kyber.NewMLKEM1024()} {
+		p := newPKI(t, k, "server.example", time.Now().Add(time.Hour))
+		sc := &Config{KEM: k, Certificate: p.cert, PrivateKey: p.serverSK}
+		cc := &Config{KEM: k, RootKeys: [][]byte{p.caPK}, ServerName: "server.example"}
+		client, server, cerr, serr := connect(t, cc, sc)
+		if cerr != nil || serr != nil {
+			t.Fatal(k.Name, cerr, serr)
+		}
+		if client.PeerCertificate().Subject != "server.example" {
+			t.Fatal("unexpected peer certificate")
+		}
+		go func() {
+			io.Copy(server, server)
+			server.Close()
+		}()
+		client.Write([]byte("hello"))
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(client, buf); err != nil || string(buf) != "hello" {
+			t.Fatal("echo failed", err)
+		}
+		client.Close()
+	}
+}
+
+func TestEarlyData(t *testing.T) {
+	k := kyber.NewKyber768()
+	p := newPKI(t, k, "server.example", time.Now().Add(time.Hour))
+	a, b := tcpPipe(t)
+	client := Client(a, &Config{RootKeys: [][]byte{p.caPK}, ServerName: "server.example"})
+	server := Server(b, &Config{Certificate: p.cert, PrivateKey: p.serverSK})
+	go func() {
+		buf := make([]byte, 7)
+		io.ReadFull(server, buf)
+		server.Write(buf)
+	}()
+	//the client writes before the Finished message of the server is read
+	if _, err := client.Write([]byte("request")); err != nil {
+		t.Fatal(err)
+	}
+	if client.serverFinished == nil {
+		t.Fatal("server Finished read before the first Read")
+	}
+	buf := make([]byte, 7)
+	if _, err := io.ReadFull(client, buf); err != nil || string(buf) != "request" {
+		t.Fatal("echo failed", err)
+	}
+}
+
+func TestCertificateChecks(t *testing.T) {
+	k := kyber.NewKyber768()
+	p := newPKI(t, k, "server.example", time.Now().Add(time.Hour))
+	other := newPKI(t, k, "server.example", time.Now().Add(time.Hour))
+	sc := &Config{Certificate: p.cert, PrivateKey: p.serverSK}
+
+	for name, cc := range map[string]*Config{
+		"unknown CA":   {RootKeys: [][]byte{other.caPK}, ServerName: "server.example"},
+		"wrong name":   {RootKeys: [][]byte{p.caPK}, ServerName: "other.example"},
+		"expired":      {RootKeys: [][]byte{p.caPK}, ServerName: "server.example", Time: func() time.Time { return time.Now().Add(2 * time.Hour) }},
+		"no root keys": {ServerName: "server.example"},
+	} {
+		if _, _, cerr, _ := connect(t, cc, sc); cerr == nil {
+			t.Fatalf("%s: handshake succeeded", name)
+		}
+	}
+
+	//a server that holds the certificate but not the private key fails the implicit authentication
+	impostor := &Config{Certificate: p.cert, PrivateKey: other.serverSK}
+	cc := &Config{RootKeys: [][]byte{p.caPK}, ServerName: "server.example"}
+	if _, _, cerr, serr := connect(t, cc, impostor); cerr == nil && serr == nil {
+		t.Fatal("impostor server accepted")
+	}
+}
+
+func TestCertificateEncoding(t *testing.T) {
+	k := kyber.NewKyber512()
+	p := newPKI(t, k, "server.example", time.Now().Add(time.Hour))
+	cert, err := ParseCertificate(p.cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Verify(p.d, [][]byte{p.caPK}, "server.example", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	cert.PublicKey[0] ^= 1
+	if err := cert.Verify(p.d, [][]byte{p.caPK}, "server.example", time.Now()); err == nil {
+		t.Fatal("modified certificate accepted")
+	}
+	if _, err := ParseCertificate(p.cert[:len(p.cert)-1]); err == nil {
+		t.Fatal("truncated certificate accepted")
+	}
+}
+
+func TestKeySchedule(t *testing.T) {
+	//both sides derive the same secrets, and each stage depends on its shared secret
+	th := bytes.Repeat([]byte{1}, 32)
+	hs1, c1, s1 := handshakeSecrets([]byte("ss_e"), th)
+	hs2, c2, _ := handshakeSecrets([]byte("ss_e'"), th)
+	if bytes.Equal(hs1, hs2) || bytes.Equal(c1, c2) || bytes.Equal(c1, s1) {
+		t.Fatal("handshake secrets do not depend on their inputs")
+	}
+	ca1, sa1, ms1 := authenticatedSecrets(hs1, []byte("ss_s"), th)
+	ca2, _, ms2 := authenticatedSecrets(hs1, []byte("ss_s'"), th)
+	if bytes.Equal(ca1, ca2) || bytes.Equal(ms1, ms2) || bytes.Equal(ca1, sa1) {
+		t.Fatal("authenticated secrets do not depend on their inputs")
+	}
+}
@@ -0,0 +1,519 @@
+//Package keyfile stores private keys of the dilithium and kyber packages encrypted with a password. The key, either
+//its seed or its expanded form as returned by KeyGen and PackSK, is encrypted with an AEAD under a key derived from
+//the password with Argon2id or scrypt. Keys can also be written and read as PKCS #8 EncryptedPrivateKeyInfo (PBES2),
+//for interoperability with OpenSSL and other libraries, when the scheme has a PKCS #8 format.
+//
+//An encrypted key file is a PEM block of type "PQ ENCRYPTED PRIVATE KEY" holding the following fields, integers being
+//big endian:
+//
+//	magic       "PQKF"
+//	version     1 byte, 1
+//	scheme      length (1 byte) and name of the parameter set, e.g. "ML-DSA-65" or "Kyber768"
+//	form        1 byte, 1 for a seed, 2 for an expanded private key
+//	kdf         1 byte, then its parameters:
+//	            1 for scrypt: log2 of N (1 byte), r and p (4 bytes each)
+//	            2 for Argon2id: passes and memory in KiB (4 bytes each), threads (1 byte)
+//	salt        length (1 byte) and salt
+//	aead        1 byte, 1 for ChaCha20-Poly1305, 2 for AES-256-GCM
+//	nonce       12 bytes
+//	ciphertext  the encrypted key and the 16-byte tag
+//
+//The 32-byte AEAD key is derived from the password and the salt, and all the fields before the ciphertext are the
+//additional data, so that the parameters cannot be changed without detection. A new version number is assigned to any
+//change of the layout.
+package keyfile
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/kudelskisecurity/crystals-go/cms"
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/internal/randutil"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+//PEM block types of the encrypted key files and of PKCS #8 encrypted keys
+const (
+	PEMType      = "PQ ENCRYPTED PRIVATE KEY"
+	PKCS8PEMType = "ENCRYPTED PRIVATE KEY"
+)
+
+const (
+	magic     = "PQKF"
+	version   = 1
+	saltSize  = 16
+	nonceSize = 12
+	keySize   = 32
+
+	formSeed     = 1
+	formExpanded = 2
+
+	//maxMemory and maxWork bound the memory and the work (memory times passes for Argon2id, 128 N r p for scrypt) of
+	//the key derivation when decrypting
+	maxMemory = 1 << 32
+	maxWork   = 1 << 36
+)
+
+//ErrIncorrectPassword is returned when a key does not decrypt, because of a wrong password or a corrupted file
+var ErrIncorrectPassword = errors.New("keyfile: incorrect password or corrupted key")
+
+//KDF is a password-based key derivation function
+type KDF byte
+
+const (
+	Scrypt   KDF = 1
+	Argon2id KDF = 2
+)
+
+func (f KDF) String() string {
+	switch f {
+	case Scrypt:
+		return "scrypt"
+	case Argon2id:
+		return "argon2id"
+	}
+	return fmt.Sprintf("KDF(%d)", byte(f))
+}
+
+//Cipher is an AEAD encrypting the key
+type Cipher byte
+
+const (
+	ChaCha20Poly1305 Cipher = 1
+	AES256GCM        Cipher = 2
+)
+
+func (c Cipher) String() string {
+	switch c {
+	case ChaCha20Poly1305:
+		return "chacha20-poly1305"
+	case AES256GCM:
+		return "aes-256-gcm"
+	}
+	return fmt.Sprintf("Cipher(%d)", byte(c))
+}
+
+//Params are the key derivation function, its cost and the cipher of an encrypted key. The zero values select
+//Argon2id with 3 passes over 64 MiB and 4 threads, the second recommended option of RFC 9106, or scrypt with
+//N = 2^15, r = 8 and p = 1, and ChaCha20-Poly1305.
+type Params struct {
+	KDF KDF
+	//Argon2id cost
+	Time    uint32
+	Memory  uint32 //in KiB
+	Threads uint8
+	//scrypt cost, N being 2^LogN
+	LogN uint8
+	R, P uint32
+
+	Cipher Cipher
+}
+
+//withDefaults returns the parameters with their zero values replaced by the defaults, and the other KDF ones cleared
+func (p *Params) withDefaults() Params {
+	var q Params
+	if p != nil {
+		q = *p
+	}
+	if q.KDF == 0 {
+		q.KDF = Argon2id
+	}
+	if q.KDF == Argon2id {
+		q.LogN, q.R, q.P = 0, 0, 0
+		if q.Time == 0 {
+			q.Time = 3
+		}
+		if q.Memory == 0 {
+			q.Memory = 64 * 1024
+		}
+		if q.Threads == 0 {
+			q.Threads = 4
+		}
+	} else {
+		q.Time, q.Memory, q.Threads = 0, 0, 0
+		if q.LogN == 0 {
+			q.LogN = 15
+		}
+		if q.R == 0 {
+			q.R = 8
+		}
+		if q.P == 0 {
+			q.P = 1
+		}
+	}
+	if q.Cipher == 0 {
+		q.Cipher = ChaCha20Poly1305
+	}
+	return q
+}
+
+//check rejects unknown algorithms and costs above maxMemory or maxWork
+func (p *Params) check() error {
+	switch p.KDF {
+	case Argon2id:
+		if p.Time == 0 || p.Threads == 0 || p.Memory < 8*uint32(p.Threads) || uint64(p.Memory)*1024 > maxMemory ||
+			uint64(p.Memory)*1024*uint64(p.Time) > maxWork {
+			return errors.New("keyfile: unsupported Argon2id parameters")
+		}
+	case Scrypt:
+		if p.LogN == 0 || p.LogN > 32 || p.R == 0 || p.P == 0 || uint64(p.R)*uint64(p.P) >= 1<<30 ||
+			128*uint64(p.R) > maxMemory>>p.LogN || 128*uint64(p.R)*uint64(p.P) > maxWork>>p.LogN {
+			return errors.New("keyfile: unsupported scrypt parameters")
+		}
+	default:
+		return errors.New("keyfile: unsupported key derivation function")
+	}
+	if p.Cipher != ChaCha20Poly1305 && p.Cipher != AES256GCM {
+		return errors.New("keyfile: unsupported cipher")
+	}
+	return nil
+}
+
+func (p *Params) deriveKey(password, salt []byte) ([]byte, error) {
+	if p.KDF == Argon2id {
+		return argon2.IDKey(password, salt, p.Time, p.Memory, p.Threads, keySize), nil
+	}
+	return scrypt.Key(password, salt, 1<<p.LogN, int(p.R), int(p.P), keySize)
+}
+
+func (p *Params) aead(key []byte) cipher.AEAD {
+	if p.Cipher == AES256GCM {
+		block, _ := aes.NewCipher(key)
+		aead, _ := cipher.NewGCM(block)
+		return aead
+	}
+	aead, _ := chacha20poly1305.New(key)
+	return aead
+}
+
+//Key is a private key of the dilithium or kyber package: its seed, or its expanded form if the seed is unknown
+type Key struct {
+	//Scheme is the Name of the parameter set, e.g. "ML-DSA-65", "Dilithium3", "ML-KEM-768" or "Kyber768"
+	Scheme     string
+	Seed       []byte
+	PrivateKey []byte
+}
+
+var schemes = []struct {
+	name string
+	sig  func(...bool) *dilithium.Dilithium
+	kem  func() *kyber.Kyber
+}{
+	{name: "ML-DSA-44", sig: dilithium.NewMLDSA44},
+	{name: "ML-DSA-65", sig: dilithium.NewMLDSA65},
+	{name: "ML-DSA-87", sig: dilithium.NewMLDSA87},
+	{name: "Dilithium2", sig: dilithium.NewDilithium2},
+	{name: "Dilithium3", sig: dilithium.NewDilithium3},
+	{name: "Dilithium5", sig: dilithium.NewDilithium5},
+	{name: "ML-KEM-512", kem: kyber.NewMLKEM512},
+	{name: "ML-KEM-768", kem: kyber.NewMLKEM768},
+	{name: "ML-KEM-1024", kem: kyber.NewMLKEM1024},
+	{name: "Kyber512", kem: kyber.NewKyber512},
+	{name: "Kyber768", kem: kyber.NewKyber768},
+	{name: "Kyber1024", kem: kyber.NewKyber1024},
+}
+
+//Dilithium returns an instance of the scheme of a signature key, nil for a KEM key or an unknown scheme
+func (k *Key) Dilithium() *dilithium.Dilithium {
+	for _, s := range schemes {
+		if s.name == k.Scheme && s.sig != nil {
+			return s.sig()
+		}
+	}
+	return nil
+}
+
+//Kyber returns an instance of the scheme of a KEM key, nil for a signature key or an unknown scheme
+func (k *Key) Kyber() *kyber.Kyber {
+	for _, s := range schemes {
+		if s.name == k.Scheme && s.kem != nil {
+			return s.kem()
+		}
+	}
+	return nil
+}
+
+//form returns the form and the bytes of a key after checking their size
+func (k *Key) form() (byte, []byte, error) {
+	var seedSize, skSize int
+	if d := k.Dilithium(); d != nil {
+		seedSize, skSize = dilithium.SEEDBYTES, d.SIZESK()
+	} else if kem := k.Kyber(); kem != nil {
+		seedSize, skSize = kyber.SEEDBYTES+kyber.SIZEZ, kem.SIZESK()
+	} else {
+		return 0, nil, errors.New("keyfile: unknown scheme " + k.Scheme)
+	}
+	switch {
+	case k.Seed != nil && len(k.Seed) == seedSize:
+		return formSeed, k.Seed, nil
+	case k.Seed == nil && len(k.PrivateKey) == skSize:
+		return formExpanded, k.PrivateKey, nil
+	}
+	return 0, nil, errors.New("keyfile: invalid " + k.Scheme + " private key length")
+}
+
+//Header is the unencrypted part of an encrypted key file
+type Header struct {
+	Version int
+	Scheme  string
+	//Seed is true if the file holds a seed, false for an expanded private key
+	Seed   bool
+	Params Params
+	salt   []byte
+	nonce  []byte
+	//ad is the encoding of the header, authenticated by the AEAD
+	ad []byte
+}
+
+func (h *Header) marshal() []byte {
+	b := append([]byte(magic), version, byte(len(h.Scheme)))
+	b = append(b, h.Scheme...)
+	if h.Seed {
+		b = append(b, formSeed)
+	} else {
+		b = append(b, formExpanded)
+	}
+	p := &h.Params
+	b = append(b, byte(p.KDF))
+	var n [4]byte
+	if p.KDF == Argon2id {
+		binary.BigEndian.PutUint32(n[:], p.Time)
+		b = append(b, n[:]...)
+		binary.BigEndian.PutUint32(n[:], p.Memory)
+		b = append(b, n[:]...)
+		b = append(b, p.Threads)
+	} else {
+		b = append(b, p.LogN)
+		binary.BigEndian.PutUint32(n[:], p.R)
+		b = append(b, n[:]...)
+		binary.BigEndian.PutUint32(n[:], p.P)
+		b = append(b, n[:]...)
+	}
+	b = append(b, byte(len(h.salt)))
+	b = append(b, h.salt...)
+	b = append(b, byte(p.Cipher))
+	return append(b, h.nonce...)
+}
+
+//reader reads the fields of a header, setting ok to false at the first truncated field
+type reader struct {
+	b  []byte
+	ok bool
+}
+
+func (r *reader) bytes(n int) []byte {
+	if !r.ok || len(r.b) < n {
+		r.ok = false
+		return nil
+	}
+	v := r.b[:n:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+//parse decodes an encrypted key file in binary form and returns its header and ciphertext
+func parse(data []byte) (*Header, []byte, error) {
+	r := &reader{b: data, ok: true}
+	if string(r.bytes(len(magic))) != magic {
+		return nil, nil, errors.New("keyfile: not an encrypted key file")
+	}
+	h := &Header{Version: int(r.byte())}
+	if r.ok && h.Version != version {
+		return nil, nil, fmt.Errorf("keyfile: unsupported version %d", h.Version)
+	}
+	h.Scheme = string(r.bytes(int(r.byte())))
+	switch r.byte() {
+	case formSeed:
+		h.Seed = true
+	case formExpanded:
+	default:
+		r.ok = false
+	}
+	p := &h.Params
+	p.KDF = KDF(r.byte())
+	switch p.KDF {
+	case Argon2id:
+		p.Time, p.Memory, p.Threads = r.uint32(), r.uint32(), r.byte()
+	case Scrypt:
+		p.LogN, p.R, p.P = r.byte(), r.uint32(), r.uint32()
+	}
+	h.salt = r.bytes(int(r.byte()))
+	p.Cipher = Cipher(r.byte())
+	h.nonce = r.bytes(nonceSize)
+	if !r.ok {
+		return nil, nil, errors.New("keyfile: malformed encrypted key file")
+	}
+	if err := p.check(); err != nil {
+		return nil, nil, err
+	}
+	h.ad = data[:len(data)-len(r.b)]
+	return h, r.b, nil
+}
+
+//Encrypt encrypts a private key with a password and returns the encrypted key file, in PEM. params may be nil for the
+//defaults, and random defaults to crypto/rand.
+func Encrypt(k *Key, password []byte, params *Params, random io.Reader) ([]byte, error) {
+	random = randutil.Reader(random)
+	if len(password) == 0 {
+		return nil, errors.New("keyfile: empty password")
+	}
+	form, key, err := k.form()
+	if err != nil {
+		return nil, err
+	}
+	h := &Header{Scheme: k.Scheme, Seed: form == formSeed, Params: params.withDefaults()}
+	if err := h.Params.check(); err != nil {
+		return nil, err
+	}
+	h.salt = make([]byte, saltSize)
+	h.nonce = make([]byte, nonceSize)
+	if _, err := io.ReadFull(random, h.salt); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(random, h.nonce); err != nil {
+		return nil, err
+	}
+	aeadKey, err := h.Params.deriveKey(password, h.salt)
+	if err != nil {
+		return nil, err
+	}
+	ad := h.marshal()
+	b := h.Params.aead(aeadKey).Seal(ad, h.nonce, key, ad)
+	return pem.EncodeToMemory(&pem.Block{Type: PEMType, Bytes: b}), nil
+}
+
+//ParseHeader returns the header of an encrypted key file, in PEM or binary form, without decrypting it
+func ParseHeader(data []byte) (*Header, error) {
+	if b, _ := pem.Decode(data); b != nil {
+		if b.Type != PEMType {
+			return nil, errors.New("keyfile: unexpected PEM block " + b.Type)
+		}
+		data = b.Bytes
+	}
+	h, _, err := parse(data)
+	return h, err
+}
+
+//Decrypt decrypts a private key with a password. data is an encrypted key file, in PEM or binary form, or a PKCS #8
+//EncryptedPrivateKeyInfo of an ML-DSA or ML-KEM key, in PEM or DER. A PKCS #8 key holding both the seed and the
+//expanded key is returned with its seed only. ErrIncorrectPassword is returned for a wrong password.
+func Decrypt(data, password []byte) (*Key, error) {
+	if b, _ := pem.Decode(data); b != nil {
+		switch b.Type {
+		case PEMType:
+		case PKCS8PEMType:
+			return decryptPKCS8(b.Bytes, password)
+		default:
+			return nil, errors.New("keyfile: unexpected PEM block " + b.Type)
+		}
+		data = b.Bytes
+	}
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return decryptPKCS8(data, password)
+	}
+	h, ciphertext, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+	aeadKey, err := h.Params.deriveKey(password, h.salt)
+	if err != nil {
+		return nil, err
+	}
+	key, err := h.Params.aead(aeadKey).Open(nil, h.nonce, ciphertext, h.ad)
+	if err != nil {
+		return nil, ErrIncorrectPassword
+	}
+	k := &Key{Scheme: h.Scheme}
+	if h.Seed {
+		k.Seed = key
+	} else {
+		k.PrivateKey = key
+	}
+	if _, _, err := k.form(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+//EncryptPKCS8 encrypts an ML-DSA or ML-KEM private key with a password and returns a PKCS #8 EncryptedPrivateKeyInfo
+//in PEM, as cms.EncryptPrivateKeyInfo does with PBKDF2-HMAC-SHA256 and AES-256-CBC. iterations is the PBKDF2
+//iteration count, cms.DefaultPBKDF2Iterations if 0. Round 3 Dilithium and Kyber keys have no PKCS #8 format.
+func EncryptPKCS8(k *Key, password []byte, iterations int, random io.Reader) ([]byte, error) {
+	if len(password) == 0 {
+		return nil, errors.New("keyfile: empty password")
+	}
+	form, key, err := k.form()
+	if err != nil {
+		return nil, err
+	}
+	var seed, sk []byte
+	if form == formSeed {
+		seed = key
+	} else {
+		sk = key
+	}
+	var der []byte
+	if d := k.Dilithium(); d != nil {
+		der, err = cms.MarshalDilithiumPrivateKey(d, seed, sk)
+	} else {
+		der, err = cms.MarshalKEMPrivateKey(k.Kyber(), seed, sk)
+	}
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := cms.EncryptPrivateKeyInfo(der, password, iterations, random)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PKCS8PEMType, Bytes: encrypted}), nil
+}
+
+func decryptPKCS8(der, password []byte) (*Key, error) {
+	info, err := cms.DecryptPrivateKeyInfo(der, password)
+	if err == cms.ErrIncorrectPassword {
+		return nil, ErrIncorrectPassword
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d, seed, sk, err := cms.ParseDilithiumPrivateKey(info); err == nil {
+		return newKey(d.Name, seed, sk), nil
+	}
+	kem, seed, sk, err := cms.ParseKEMPrivateKey(info)
+	if err != nil {
+		return nil, errors.New("keyfile: not an ML-DSA or ML-KEM private key")
+	}
+	return newKey(kem.Name, seed, sk), nil
+}
+
+//newKey returns the key of a seed, or of an expanded key if seed is nil
+func newKey(scheme string, seed, sk []byte) *Key {
+	if seed != nil {
+		return &Key{Scheme: scheme, Seed: seed}
+	}
+	return &Key{Scheme: scheme, PrivateKey: sk}
+}
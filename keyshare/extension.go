@@ -0,0 +1,96 @@
+package keyshare
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+//KeyShareEntry is an entry of the key_share extension (RFC 8446, Section 4.2.8). Groups other than the hybrid ones are
+//kept as they are, so that the other entries of a captured ClientHello can be inspected.
+type KeyShareEntry struct {
+	Group       Group
+	KeyExchange []byte
+}
+
+func addEntry(b *cryptobyte.Builder, e KeyShareEntry) {
+	b.AddUint16(uint16(e.Group))
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(e.KeyExchange)
+	})
+}
+
+//readEntry reads an entry and checks the length of the share if the group is a hybrid one
+func readEntry(s *cryptobyte.String, e *KeyShareEntry, size func(Group) int) bool {
+	var group uint16
+	var share cryptobyte.String
+	if !s.ReadUint16(&group) || !s.ReadUint16LengthPrefixed(&share) || len(share) == 0 {
+		return false
+	}
+	e.Group = Group(group)
+	e.KeyExchange = append([]byte{}, share...)
+	if n := size(e.Group); n != 0 && n != len(share) {
+		return false
+	}
+	return true
+}
+
+//MarshalClientKeyShares encodes the body of the key_share extension of a ClientHello: a list of entries prefixed by its
+//16-bit length
+func MarshalClientKeyShares(entries []KeyShareEntry) ([]byte, error) {
+	var b cryptobyte.Builder
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, e := range entries {
+			addEntry(b, e)
+		}
+	})
+	out, err := b.Bytes()
+	if err != nil {
+		return nil, errors.New("keyshare: key shares too long")
+	}
+	return out, nil
+}
+
+//ParseClientKeyShares decodes the body of the key_share extension of a ClientHello. A group must not appear twice.
+func ParseClientKeyShares(data []byte) ([]KeyShareEntry, error) {
+	s := cryptobyte.String(data)
+	var list cryptobyte.String
+	if !s.ReadUint16LengthPrefixed(&list) || !s.Empty() {
+		return nil, errors.New("keyshare: malformed client key shares")
+	}
+	var entries []KeyShareEntry
+	seen := make(map[Group]bool)
+	for !list.Empty() {
+		var e KeyShareEntry
+		if !readEntry(&list, &e, Group.ClientShareSize) {
+			return nil, errors.New("keyshare: malformed client key shares")
+		}
+		if seen[e.Group] {
+			return nil, errors.New("keyshare: duplicate group " + e.Group.String())
+		}
+		seen[e.Group] = true
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+//MarshalServerKeyShare encodes the body of the key_share extension of a ServerHello: a single entry
+func MarshalServerKeyShare(e KeyShareEntry) ([]byte, error) {
+	var b cryptobyte.Builder
+	addEntry(&b, e)
+	out, err := b.Bytes()
+	if err != nil {
+		return nil, errors.New("keyshare: key share too long")
+	}
+	return out, nil
+}
+
+//ParseServerKeyShare decodes the body of the key_share extension of a ServerHello
+func ParseServerKeyShare(data []byte) (KeyShareEntry, error) {
+	s := cryptobyte.String(data)
+	var e KeyShareEntry
+	if !readEntry(&s, &e, Group.ServerShareSize) || !s.Empty() {
+		return KeyShareEntry{}, errors.New("keyshare: malformed server key share")
+	}
+	return e, nil
+}
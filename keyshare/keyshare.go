@@ -0,0 +1,284 @@
+//Package keyshare builds and parses the TLS 1.3 key_share payloads of the hybrid ML-KEM groups of
+//draft-ietf-tls-ecdhe-mlkem: X25519MLKEM768, SecP256r1MLKEM768 and SecP384r1MLKEM1024.
+//
+//The components are concatenated without length prefixes, in an order that depends on the group:
+//
+//	group               client share       server share       shared secret
+//	X25519MLKEM768      ek(1184) || x(32)  ct(1088) || x(32)  ss_mlkem(32) || ss_x25519(32)
+//	SecP256r1MLKEM768   P(65) || ek(1184)  P(65) || ct(1088)  ss_ecdh(32) || ss_mlkem(32)
+//	SecP384r1MLKEM1024  P(97) || ek(1568)  P(97) || ct(1568)  ss_ecdh(48) || ss_mlkem(32)
+//
+//where P is an uncompressed NIST curve point and ss_ecdh its x-coordinate after the Diffie-Hellman operation.
+package keyshare
+
+import (
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/internal/randutil"
+	"golang.org/x/crypto/curve25519"
+)
+
+//Group is a TLS NamedGroup code point
+type Group uint16
+
+//Hybrid groups of draft-ietf-tls-ecdhe-mlkem
+const (
+	SecP256r1MLKEM768  Group = 0x11eb
+	X25519MLKEM768     Group = 0x11ec
+	SecP384r1MLKEM1024 Group = 0x11ed
+)
+
+func (g Group) String() string {
+	switch g {
+	case SecP256r1MLKEM768:
+		return "SecP256r1MLKEM768"
+	case X25519MLKEM768:
+		return "X25519MLKEM768"
+	case SecP384r1MLKEM1024:
+		return "SecP384r1MLKEM1024"
+	}
+	return fmt.Sprintf("Group(0x%04x)", uint16(g))
+}
+
+//params describes the components of a group
+type params struct {
+	kem       *kyber.Kyber
+	curve     elliptic.Curve //nil for X25519
+	ecdhSize  int            //size of the encoded ECDH public key
+	mlkemLast bool           //the ECDH component comes first
+}
+
+func (g Group) params() (*params, error) {
+	switch g {
+	case X25519MLKEM768:
+		return &params{kem: kyber.NewMLKEM768(), ecdhSize: curve25519.PointSize}, nil
+	case SecP256r1MLKEM768:
+		return &params{kem: kyber.NewMLKEM768(), curve: elliptic.P256(), ecdhSize: 65, mlkemLast: true}, nil
+	case SecP384r1MLKEM1024:
+		return &params{kem: kyber.NewMLKEM1024(), curve: elliptic.P384(), ecdhSize: 97, mlkemLast: true}, nil
+	}
+	return nil, errors.New("keyshare: unsupported group " + g.String())
+}
+
+//ClientShareSize returns the size of the key_exchange field of the client KeyShareEntry
+func (g Group) ClientShareSize() int {
+	p, err := g.params()
+	if err != nil {
+		return 0
+	}
+	return p.ecdhSize + p.kem.SIZEPK()
+}
+
+//ServerShareSize returns the size of the key_exchange field of the server KeyShareEntry
+func (g Group) ServerShareSize() int {
+	p, err := g.params()
+	if err != nil {
+		return 0
+	}
+	return p.ecdhSize + p.kem.SIZEC()
+}
+
+//SharedSecretSize returns the size of the concatenated shared secret
+func (g Group) SharedSecretSize() int {
+	p, err := g.params()
+	if err != nil {
+		return 0
+	}
+	if p.curve == nil {
+		return 64
+	}
+	return (p.curve.Params().BitSize+7)/8 + 32
+}
+
+//concat orders an ECDH component and an ML-KEM component of the group
+func (p *params) concat(ecdh, mlkem []byte) []byte {
+	if p.mlkemLast {
+		return append(append([]byte{}, ecdh...), mlkem...)
+	}
+	return append(append([]byte{}, mlkem...), ecdh...)
+}
+
+//split separates a share into its ECDH and ML-KEM components
+func (p *params) split(share []byte) ([]byte, []byte) {
+	if p.mlkemLast {
+		return share[:p.ecdhSize], share[p.ecdhSize:]
+	}
+	return share[len(share)-p.ecdhSize:], share[:len(share)-p.ecdhSize]
+}
+
+//ParseClientShare checks the length of a client share and returns its ECDH public key and ML-KEM encapsulation key
+func ParseClientShare(g Group, share []byte) ([]byte, []byte, error) {
+	p, err := g.params()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(share) != g.ClientShareSize() {
+		return nil, nil, errors.New("keyshare: invalid client share length for " + g.String())
+	}
+	ecdh, ek := p.split(share)
+	return ecdh, ek, nil
+}
+
+//ParseServerShare checks the length of a server share and returns its ECDH public key and ML-KEM ciphertext
+func ParseServerShare(g Group, share []byte) ([]byte, []byte, error) {
+	p, err := g.params()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(share) != g.ServerShareSize() {
+		return nil, nil, errors.New("keyshare: invalid server share length for " + g.String())
+	}
+	ecdh, ct := p.split(share)
+	return ecdh, ct, nil
+}
+
+//ClientKey is the private state of a client between the ClientHello and the ServerHello
+type ClientKey struct {
+	group    Group
+	p        *params
+	ecdhPriv []byte
+	kemSK    []byte
+	share    []byte
+}
+
+//GenerateClientKey creates the ephemeral keys of a client share, reading randomness from rand (crypto/rand if nil)
+func GenerateClientKey(g Group, rand io.Reader) (*ClientKey, error) {
+	p, err := g.params()
+	if err != nil {
+		return nil, err
+	}
+	rand = randutil.Reader(rand)
+	priv, err := p.generateECDH(rand)
+	if err != nil {
+		return nil, err
+	}
+	seed := make([]byte, 2*kyber.SEEDBYTES)
+	if _, err := io.ReadFull(rand, seed); err != nil {
+		return nil, err
+	}
+	return newClientKey(g, p, priv, seed)
+}
+
+func newClientKey(g Group, p *params, ecdhPriv, seed []byte) (*ClientKey, error) {
+	pub, err := p.ecdhPublic(ecdhPriv)
+	if err != nil {
+		return nil, err
+	}
+	ek, sk := p.kem.KeyGen(seed)
+	return &ClientKey{group: g, p: p, ecdhPriv: ecdhPriv, kemSK: sk, share: p.concat(pub, ek)}, nil
+}
+
+//Group returns the group of the key
+func (k *ClientKey) Group() Group {
+	return k.group
+}
+
+//Share returns the key_exchange field of the client KeyShareEntry
+func (k *ClientKey) Share() []byte {
+	return append([]byte{}, k.share...)
+}
+
+//SharedSecret processes the server share and returns the shared secret
+func (k *ClientKey) SharedSecret(serverShare []byte) ([]byte, error) {
+	peer, ct, err := ParseServerShare(k.group, serverShare)
+	if err != nil {
+		return nil, err
+	}
+	ecdhSS, err := k.p.ecdh(k.ecdhPriv, peer)
+	if err != nil {
+		return nil, err
+	}
+	return k.p.concat(ecdhSS, k.p.kem.Decaps(k.kemSK, ct)), nil
+}
+
+//ServerShare processes a client share and returns the server share and the shared secret, reading randomness from
+//rand (crypto/rand if nil)
+func ServerShare(g Group, clientShare []byte, rand io.Reader) ([]byte, []byte, error) {
+	p, err := g.params()
+	if err != nil {
+		return nil, nil, err
+	}
+	rand = randutil.Reader(rand)
+	priv, err := p.generateECDH(rand)
+	if err != nil {
+		return nil, nil, err
+	}
+	coins := make([]byte, kyber.SEEDBYTES)
+	if _, err := io.ReadFull(rand, coins); err != nil {
+		return nil, nil, err
+	}
+	return serverShare(g, p, clientShare, priv, coins)
+}
+
+func serverShare(g Group, p *params, clientShare, ecdhPriv, coins []byte) ([]byte, []byte, error) {
+	peer, ek, err := ParseClientShare(g, clientShare)
+	if err != nil {
+		return nil, nil, err
+	}
+	ecdhSS, err := p.ecdh(ecdhPriv, peer)
+	if err != nil {
+		return nil, nil, err
+	}
+	pub, err := p.ecdhPublic(ecdhPriv)
+	if err != nil {
+		return nil, nil, err
+	}
+	ct, kemSS := p.kem.Encaps(ek, coins)
+	if ct == nil {
+		return nil, nil, errors.New("keyshare: invalid ML-KEM encapsulation key")
+	}
+	return p.concat(pub, ct), p.concat(ecdhSS, kemSS), nil
+}
+
+//generateECDH returns a random private key: 32 bytes for X25519, a scalar in [1, n-1] for NIST curves
+func (p *params) generateECDH(rand io.Reader) ([]byte, error) {
+	if p.curve == nil {
+		priv := make([]byte, curve25519.ScalarSize)
+		if _, err := io.ReadFull(rand, priv); err != nil {
+			return nil, err
+		}
+		return priv, nil
+	}
+	priv, _, _, err := elliptic.GenerateKey(p.curve, rand)
+	return priv, err
+}
+
+func (p *params) ecdhPublic(priv []byte) ([]byte, error) {
+	if p.curve == nil {
+		return curve25519.X25519(priv, curve25519.Basepoint)
+	}
+	x, y := p.curve.ScalarBaseMult(priv)
+	return elliptic.Marshal(p.curve, x, y), nil
+}
+
+//ecdh computes the Diffie-Hellman shared secret, rejecting invalid points and an all-zero X25519 output
+func (p *params) ecdh(priv, peer []byte) ([]byte, error) {
+	if p.curve == nil {
+		ss, err := curve25519.X25519(priv, peer)
+		if err != nil {
+			return nil, errors.New("keyshare: invalid X25519 public key")
+		}
+		return ss, nil
+	}
+	x, y := elliptic.Unmarshal(p.curve, peer)
+	if x == nil {
+		return nil, errors.New("keyshare: invalid ECDH public key")
+	}
+	sx, sy := p.curve.ScalarMult(x, y, priv)
+	if sx.Sign() == 0 && sy.Sign() == 0 {
+		return nil, errors.New("keyshare: invalid ECDH shared secret")
+	}
+	return fixedBytes(sx, (p.curve.Params().BitSize+7)/8), nil
+}
+
+func fixedBytes(x *big.Int, size int) []byte {
+	out := make([]byte, size)
+	b := x.Bytes()
+	copy(out[size-len(b):], b)
+	return out
+}
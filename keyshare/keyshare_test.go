@@ -0,0 +1,149 @@
+package keyshare
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var groups = []Group{X25519MLKEM768, SecP256r1MLKEM768, SecP384r1MLKEM1024}
+
+//The vectors in testdata are "key: hex" lines, one file per group. They were produced with the crypto/ecdh and
+//crypto/mlkem packages of the Go standard library, following the order of crypto/tls.
+func TestVectors(t *testing.T) {
+	for _, g := range groups {
+		t.Run(g.String(), func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join("testdata", g.String()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			v := map[string][]byte{}
+			for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+				kv := strings.SplitN(line, ": ", 2)
+				if b, err := hex.DecodeString(kv[1]); err == nil {
+					v[kv[0]] = b
+				}
+			}
+			p, _ := g.params()
+			ck, err := newClientKey(g, p, v["client ecdh"], v["mlkem seed"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(ck.Share(), v["client share"]) {
+				t.Fatal("client share mismatch")
+			}
+			ss, secret, err := serverShare(g, p, ck.Share(), v["server ecdh"], v["mlkem coins"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(ss, v["server share"]) || !bytes.Equal(secret, v["shared secret"]) {
+				t.Fatal("server share mismatch")
+			}
+			secret, err = ck.SharedSecret(ss)
+			if err != nil || !bytes.Equal(secret, v["shared secret"]) {
+				t.Fatal("client shared secret mismatch", err)
+			}
+		})
+	}
+}
+
+func TestSizes(t *testing.T) {
+	for _, c := range []struct {
+		g                      Group
+		client, server, secret int
+	}{
+		{X25519MLKEM768, 1216, 1120, 64},
+		{SecP256r1MLKEM768, 1249, 1153, 64},
+		{SecP384r1MLKEM1024, 1665, 1665, 80},
+	} {
+		if c.g.ClientShareSize() != c.client || c.g.ServerShareSize() != c.server || c.g.SharedSecretSize() != c.secret {
+			t.Fatal("unexpected sizes for", c.g)
+		}
+		ck, err := GenerateClientKey(c.g, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ss, secret, err := ServerShare(c.g, ck.Share(), nil)
+		if err != nil || len(ss) != c.server || len(secret) != c.secret {
+			t.Fatal("unexpected server share", err)
+		}
+		if _, err := ck.SharedSecret(ss[:len(ss)-1]); err == nil {
+			t.Fatal("truncated server share accepted")
+		}
+	}
+	if Group(0x001d).ClientShareSize() != 0 {
+		t.Fatal("size returned for a non-hybrid group")
+	}
+	if _, err := GenerateClientKey(Group(0x001d), nil); err == nil {
+		t.Fatal("non-hybrid group accepted")
+	}
+}
+
+func TestInvalidPoints(t *testing.T) {
+	for _, g := range groups {
+		ck, err := GenerateClientKey(g, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, _ := g.params()
+		share := ck.Share()
+		ecdh, _, _ := ParseClientShare(g, share)
+		//X25519 low-order point 0, or a NIST point off the curve
+		for i := range ecdh {
+			ecdh[i] = 0
+		}
+		if p.curve != nil {
+			ecdh[0] = 4
+		}
+		if _, _, err := ServerShare(g, share, nil); err == nil {
+			t.Fatal(g, "invalid ECDH share accepted")
+		}
+	}
+}
+
+func TestExtension(t *testing.T) {
+	ck, err := GenerateClientKey(X25519MLKEM768, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x25519 := KeyShareEntry{Group: 0x001d, KeyExchange: make([]byte, 32)}
+	entries := []KeyShareEntry{{Group: X25519MLKEM768, KeyExchange: ck.Share()}, x25519}
+	data, err := MarshalClientKeyShares(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseClientKeyShares(data)
+	if err != nil || len(parsed) != 2 || parsed[0].Group != X25519MLKEM768 || !bytes.Equal(parsed[0].KeyExchange, ck.Share()) {
+		t.Fatal("client key shares do not round trip", err)
+	}
+	dup, _ := MarshalClientKeyShares(append(entries, x25519))
+	if _, err := ParseClientKeyShares(dup); err == nil {
+		t.Fatal("duplicate group accepted")
+	}
+	short, _ := MarshalClientKeyShares([]KeyShareEntry{{Group: X25519MLKEM768, KeyExchange: ck.Share()[1:]}})
+	if _, err := ParseClientKeyShares(short); err == nil {
+		t.Fatal("short hybrid share accepted")
+	}
+
+	ss, _, err := ServerShare(X25519MLKEM768, ck.Share(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = MarshalServerKeyShare(KeyShareEntry{Group: X25519MLKEM768, KeyExchange: ss})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != 0x11 || data[1] != 0xec || int(data[2])<<8|int(data[3]) != 1120 {
+		t.Fatal("unexpected server key share header")
+	}
+	e, err := ParseServerKeyShare(data)
+	if err != nil || !bytes.Equal(e.KeyExchange, ss) {
+		t.Fatal("server key share does not round trip", err)
+	}
+	if _, err := ParseServerKeyShare(append(data, 0)); err == nil {
+		t.Fatal("trailing data accepted")
+	}
+}
@@ -0,0 +1,317 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kudelskisecurity/crystals-go/keyfile"
+)
+
+//Backend stores the keys of a Store and their metadata. The keys it is given and returns are checked by the Store,
+//which serializes its calls. The metadata returned is owned by the caller.
+type Backend interface {
+	//Create stores a new key, or returns ErrExists if a key has the same ID
+	Create(info *KeyInfo, key *keyfile.Key) error
+	//Update replaces the metadata of a key
+	Update(info *KeyInfo) error
+	//Get returns the metadata of a key, or ErrNotFound
+	Get(id string) (*KeyInfo, error)
+	//List returns the metadata of all the keys, in any order
+	List() ([]*KeyInfo, error)
+	//Key returns the private key of a key, or ErrNotFound
+	Key(id string) (*keyfile.Key, error)
+	//Delete deletes a key and its metadata, or returns ErrNotFound
+	Delete(id string) error
+}
+
+//wipeKey overwrites a private key
+func wipeKey(k *keyfile.Key) {
+	wipe(k.Seed)
+	wipe(k.PrivateKey)
+}
+
+type memoryEntry struct {
+	info *KeyInfo
+	key  *keyfile.Key
+}
+
+//MemoryBackend is a Backend in memory, for tests and short lived keys
+type MemoryBackend struct {
+	entries map[string]*memoryEntry
+}
+
+//NewMemoryBackend returns an empty MemoryBackend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{entries: make(map[string]*memoryEntry)}
+}
+
+//Create implements Backend
+func (b *MemoryBackend) Create(info *KeyInfo, key *keyfile.Key) error {
+	if b.entries[info.ID] != nil {
+		return ErrExists
+	}
+	b.entries[info.ID] = &memoryEntry{info: info.copy(), key: key}
+	return nil
+}
+
+//Update implements Backend
+func (b *MemoryBackend) Update(info *KeyInfo) error {
+	e := b.entries[info.ID]
+	if e == nil {
+		return ErrNotFound
+	}
+	e.info = info.copy()
+	return nil
+}
+
+//Get implements Backend
+func (b *MemoryBackend) Get(id string) (*KeyInfo, error) {
+	e := b.entries[id]
+	if e == nil {
+		return nil, ErrNotFound
+	}
+	return e.info.copy(), nil
+}
+
+//List implements Backend
+func (b *MemoryBackend) List() ([]*KeyInfo, error) {
+	keys := make([]*KeyInfo, 0, len(b.entries))
+	for _, e := range b.entries {
+		keys = append(keys, e.info.copy())
+	}
+	return keys, nil
+}
+
+//Key implements Backend
+func (b *MemoryBackend) Key(id string) (*keyfile.Key, error) {
+	e := b.entries[id]
+	if e == nil {
+		return nil, ErrNotFound
+	}
+	return e.key, nil
+}
+
+//Delete implements Backend, overwriting the private key
+func (b *MemoryBackend) Delete(id string) error {
+	e := b.entries[id]
+	if e == nil {
+		return ErrNotFound
+	}
+	wipeKey(e.key)
+	delete(b.entries, id)
+	return nil
+}
+
+//FileBackend is a Backend in a directory, with two files per key named after its ID: the metadata in JSON, id.json,
+//and the private key encrypted with a password in the format of the keyfile package, id.key. The metadata is not
+//encrypted nor authenticated and is only protected by the permissions of the directory. Private keys are kept in
+//memory once decrypted, until Close.
+type FileBackend struct {
+	dir      string
+	password []byte
+	params   *keyfile.Params
+	keys     map[string]*keyfile.Key
+}
+
+//OpenFileBackend opens a directory of keys, created if needed, whose private keys are encrypted with a password and
+//the key derivation parameters of the keyfile package, the defaults if params is nil. The password is checked
+//against a key of the directory, if any, and keyfile.ErrIncorrectPassword returned if it does not decrypt it.
+func OpenFileBackend(dir string, password []byte, params *keyfile.Params) (*FileBackend, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	b := &FileBackend{dir: dir, password: append([]byte{}, password...), params: params, keys: make(map[string]*keyfile.Key)}
+	ids, err := b.ids()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) != 0 {
+		if _, err := b.Key(ids[0]); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+//Close overwrites the password and the private keys kept in memory. The backend is no longer usable.
+func (b *FileBackend) Close() error {
+	for id, k := range b.keys {
+		wipeKey(k)
+		delete(b.keys, id)
+	}
+	wipe(b.password)
+	b.password = nil
+	return nil
+}
+
+//path returns the path of a file of a key, after checking that the ID is the hex encoding of 16 bytes
+func (b *FileBackend) path(id, ext string) (string, error) {
+	if raw, err := hex.DecodeString(id); err != nil || len(raw) != 16 || hex.EncodeToString(raw) != id {
+		return "", ErrNotFound
+	}
+	return filepath.Join(b.dir, id+ext), nil
+}
+
+//ids returns the IDs of the keys with metadata
+func (b *FileBackend) ids() ([]string, error) {
+	files, err := ioutil.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, f := range files {
+		if id := strings.TrimSuffix(f.Name(), ".json"); id != f.Name() {
+			if _, err := b.path(id, ""); err == nil {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+//writeFile replaces a file atomically, with permissions 0600
+func (b *FileBackend) writeFile(path string, data []byte) error {
+	f, err := ioutil.TempFile(b.dir, "tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+//Create implements Backend. The private key is written before the metadata, so that a key is only listed once
+//stored.
+func (b *FileBackend) Create(info *KeyInfo, key *keyfile.Key) error {
+	path, err := b.path(info.ID, ".json")
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return ErrExists
+	}
+	encrypted, err := keyfile.Encrypt(key, b.password, b.params, nil)
+	if err != nil {
+		return err
+	}
+	keyPath, _ := b.path(info.ID, ".key")
+	if err := b.writeFile(keyPath, encrypted); err != nil {
+		return err
+	}
+	if err := b.Update(info); err != nil {
+		return err
+	}
+	b.keys[info.ID] = key
+	return nil
+}
+
+//Update implements Backend
+func (b *FileBackend) Update(info *KeyInfo) error {
+	path, err := b.path(info.ID, ".json")
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(info, "", "\t")
+	if err != nil {
+		return err
+	}
+	return b.writeFile(path, append(data, '\n'))
+}
+
+//Get implements Backend
+func (b *FileBackend) Get(id string) (*KeyInfo, error) {
+	path, err := b.path(id, ".json")
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var info KeyInfo
+	if err := json.Unmarshal(data, &info); err != nil || info.ID != id {
+		return nil, errors.New("keystore: malformed metadata " + path)
+	}
+	return &info, nil
+}
+
+//List implements Backend
+func (b *FileBackend) List() ([]*KeyInfo, error) {
+	ids, err := b.ids()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*KeyInfo, len(ids))
+	for i, id := range ids {
+		if keys[i], err = b.Get(id); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+//Key implements Backend, decrypting the private key on its first use
+func (b *FileBackend) Key(id string) (*keyfile.Key, error) {
+	if k := b.keys[id]; k != nil {
+		return k, nil
+	}
+	path, err := b.path(id, ".key")
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	k, err := keyfile.Decrypt(data, b.password)
+	if err != nil {
+		return nil, err
+	}
+	b.keys[id] = k
+	return k, nil
+}
+
+//Delete implements Backend. The metadata is removed first, so that a key is no longer listed even if its private
+//key cannot be removed.
+func (b *FileBackend) Delete(id string) error {
+	path, err := b.path(id, ".json")
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); os.IsNotExist(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	if k := b.keys[id]; k != nil {
+		wipeKey(k)
+		delete(b.keys, id)
+	}
+	keyPath, _ := b.path(id, ".key")
+	if err := os.Remove(keyPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
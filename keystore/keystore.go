@@ -0,0 +1,458 @@
+//Package keystore manages many Kyber, ML-KEM, Dilithium and ML-DSA keys: it generates and imports them, lists them
+//with their metadata, rotates, revokes and deletes them, and signs and decapsulates with them, so that the callers
+//never handle the private keys once they are in the store.
+//
+//Keys are identified by the hex encoding of the first 16 bytes of the SHA-256 hash of their public key. A Store keeps
+//the keys in a Backend: in memory, or in a directory where every private key is encrypted with a password in the
+//format of the keyfile package.
+//
+//A rotated key is replaced by a new key of the same scheme, usage, lifetime and labels. It no longer signs, but it
+//still decapsulates the ciphertexts sent to it until it expires or is revoked. Revoked and expired keys are kept with
+//their metadata, and refuse every operation, until they are deleted.
+package keystore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/internal/randutil"
+	"github.com/kudelskisecurity/crystals-go/keyfile"
+	"golang.org/x/crypto/sha3"
+)
+
+//Errors of the operations of a keystore
+var (
+	ErrNotFound = errors.New("keystore: key not found")
+	ErrExists   = errors.New("keystore: key already in the store")
+	ErrRevoked  = errors.New("keystore: key revoked")
+	ErrExpired  = errors.New("keystore: key expired")
+	ErrRotated  = errors.New("keystore: key rotated")
+	ErrUsage    = errors.New("keystore: operation not allowed by the usage of the key")
+)
+
+//Usage is the operation a key is used for, given by its scheme
+type Usage string
+
+const (
+	UsageSign        Usage = "sign"
+	UsageDecapsulate Usage = "decapsulate"
+)
+
+//KeyInfo is the public part and the metadata of a key
+type KeyInfo struct {
+	ID        string    `json:"id"`
+	Scheme    string    `json:"scheme"`
+	Usage     Usage     `json:"usage"`
+	PublicKey []byte    `json:"public_key"`
+	Created   time.Time `json:"created"`
+	//Expires is zero for a key that does not expire
+	Expires time.Time `json:"expires"`
+	//Revoked is the time of the revocation, zero for a key that is not revoked
+	Revoked time.Time `json:"revoked"`
+	//Replaces and ReplacedBy are the IDs of the previous and of the next key of a rotation
+	Replaces   string            `json:"replaces,omitempty"`
+	ReplacedBy string            `json:"replaced_by,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+//copy returns a deep copy of the metadata
+func (k *KeyInfo) copy() *KeyInfo {
+	c := *k
+	c.PublicKey = append([]byte{}, k.PublicKey...)
+	if k.Labels != nil {
+		c.Labels = make(map[string]string, len(k.Labels))
+		for name, value := range k.Labels {
+			c.Labels[name] = value
+		}
+	}
+	return &c
+}
+
+//Expired reports whether the key is expired at the given time
+func (k *KeyInfo) Expired(now time.Time) bool {
+	return !k.Expires.IsZero() && !now.Before(k.Expires)
+}
+
+//KeyID returns the ID of a public key
+func KeyID(pk []byte) string {
+	h := sha256.Sum256(pk)
+	return hex.EncodeToString(h[:16])
+}
+
+//Options are the metadata of a new key
+type Options struct {
+	//Lifetime is the duration after which the key expires, never if 0
+	Lifetime time.Duration
+	Labels   map[string]string
+	//Rand is the source of the seeds of generated keys, crypto/rand if nil
+	Rand io.Reader
+}
+
+//Keystore is the interface of the key stores. Keys are named by their ID.
+type Keystore interface {
+	//Generate generates a key of a scheme, e.g. "ML-DSA-65" or "ML-KEM-768"
+	Generate(scheme string, opts *Options) (*KeyInfo, error)
+	//Import adds a private key, with its public key if it cannot be derived from the private key
+	Import(key *keyfile.Key, pk []byte, opts *Options) (*KeyInfo, error)
+	//List returns the keys, the oldest first
+	List() ([]*KeyInfo, error)
+	Get(id string) (*KeyInfo, error)
+	//Rotate replaces a key with a new one, with the same metadata as the previous key if opts is nil
+	Rotate(id string, opts *Options) (*KeyInfo, error)
+	Revoke(id string) error
+	//Delete deletes a key and its metadata
+	Delete(id string) error
+	//Sign signs a message with a signature key, with an ML-DSA context if not empty
+	Sign(id string, message, context []byte) ([]byte, error)
+	//Decapsulate returns the shared secret of a ciphertext sent to a KEM key
+	Decapsulate(id string, ciphertext []byte) ([]byte, error)
+}
+
+//Store is a Keystore keeping its keys in a Backend. It is safe for concurrent use.
+type Store struct {
+	mu      sync.Mutex
+	backend Backend
+	now     func() time.Time
+}
+
+var _ Keystore = (*Store)(nil)
+
+//New returns a Store keeping its keys in a backend
+func New(backend Backend) *Store {
+	return &Store{backend: backend, now: time.Now}
+}
+
+//Generate implements Keystore
+func (s *Store) Generate(scheme string, opts *Options) (*KeyInfo, error) {
+	return s.generate(scheme, opts, "")
+}
+
+//generate generates a key replacing the key of ID replaces, if not empty
+func (s *Store) generate(scheme string, opts *Options, replaces string) (*KeyInfo, error) {
+	key := &keyfile.Key{Scheme: scheme}
+	seedSize := dilithium.SEEDBYTES
+	if key.Kyber() != nil {
+		seedSize = kyber.SEEDBYTES + kyber.SIZEZ
+	} else if key.Dilithium() == nil {
+		return nil, errors.New("keystore: unknown scheme " + scheme)
+	}
+	var random io.Reader
+	if opts != nil {
+		random = opts.Rand
+	}
+	key.Seed = make([]byte, seedSize)
+	if _, err := io.ReadFull(randutil.Reader(random), key.Seed); err != nil {
+		return nil, err
+	}
+	return s.add(key, nil, opts, replaces)
+}
+
+//Import implements Keystore. pk is only needed for an expanded ML-DSA or Dilithium private key, and checked against
+//the private key if given. The key is copied.
+func (s *Store) Import(key *keyfile.Key, pk []byte, opts *Options) (*KeyInfo, error) {
+	k := &keyfile.Key{Scheme: key.Scheme}
+	if key.Seed != nil {
+		k.Seed = append([]byte{}, key.Seed...)
+	} else {
+		k.PrivateKey = append([]byte{}, key.PrivateKey...)
+	}
+	return s.add(k, pk, opts, "")
+}
+
+//add checks a private key, derives its public key and stores it with its metadata
+func (s *Store) add(key *keyfile.Key, pk []byte, opts *Options, replaces string) (*KeyInfo, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if opts.Lifetime < 0 {
+		return nil, errors.New("keystore: negative lifetime")
+	}
+	public, usage, err := publicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if pk != nil && public != nil && !bytes.Equal(pk, public) {
+		return nil, errors.New("keystore: the public key does not match the private key")
+	}
+	if public == nil {
+		if pk == nil {
+			return nil, errors.New("keystore: the public key of an expanded " + key.Scheme + " private key is required")
+		}
+		if err := checkDilithiumPair(key.Dilithium(), pk, key.PrivateKey); err != nil {
+			return nil, err
+		}
+		public = append([]byte{}, pk...)
+	}
+	info := &KeyInfo{
+		ID:        KeyID(public),
+		Scheme:    key.Scheme,
+		Usage:     usage,
+		PublicKey: public,
+		Created:   s.now().UTC(),
+		Replaces:  replaces,
+	}
+	if opts.Lifetime != 0 {
+		info.Expires = info.Created.Add(opts.Lifetime)
+	}
+	if opts.Labels != nil {
+		info.Labels = (&KeyInfo{Labels: opts.Labels}).copy().Labels
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.backend.Create(info.copy(), key); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+//publicKey returns the public key of a private key, nil for an expanded signature key, and its usage
+func publicKey(key *keyfile.Key) ([]byte, Usage, error) {
+	if d := key.Dilithium(); d != nil {
+		switch {
+		case key.Seed != nil && len(key.Seed) == dilithium.SEEDBYTES:
+			pk, _ := d.KeyGen(key.Seed)
+			return pk, UsageSign, nil
+		case key.Seed == nil && len(key.PrivateKey) == d.SIZESK():
+			return nil, UsageSign, nil
+		}
+		return nil, "", errors.New("keystore: invalid " + key.Scheme + " private key length")
+	}
+	k := key.Kyber()
+	if k == nil {
+		return nil, "", errors.New("keystore: unknown scheme " + key.Scheme)
+	}
+	switch {
+	case key.Seed != nil && len(key.Seed) == kyber.SEEDBYTES+kyber.SIZEZ:
+		pk, _ := k.KeyGen(key.Seed)
+		return pk, UsageDecapsulate, nil
+	case key.Seed == nil && len(key.PrivateKey) == k.SIZESK():
+		//the private key holds the public key and its hash
+		if subtle.ConstantTimeCompare(k.PackSK(k.UnpackSK(key.PrivateKey)), key.PrivateKey) != 1 {
+			return nil, "", errors.New("keystore: inconsistent " + key.Scheme + " private key")
+		}
+		return append([]byte{}, k.UnpackSK(key.PrivateKey).Pk...), UsageDecapsulate, nil
+	}
+	return nil, "", errors.New("keystore: invalid " + key.Scheme + " private key length")
+}
+
+//checkDilithiumPair checks that an expanded private key holds the seed rho and the hash tr of a public key
+func checkDilithiumPair(d *dilithium.Dilithium, pk, sk []byte) error {
+	if len(pk) != d.SIZEPK() {
+		return errors.New("keystore: invalid public key length")
+	}
+	unpacked := d.UnpackSK(sk)
+	tr := make([]byte, 32)
+	if d.IsMLDSA() {
+		tr = make([]byte, 64)
+	}
+	sha3.ShakeSum256(tr, pk)
+	if !bytes.Equal(unpacked.Rho[:], pk[:dilithium.SEEDBYTES]) || subtle.ConstantTimeCompare(tr, unpacked.Tr[:len(tr)]) != 1 {
+		return errors.New("keystore: the private key does not match the public key")
+	}
+	return nil
+}
+
+//checkKey checks that a private key is the key of its metadata, which a backend could have mixed up with another
+func checkKey(info *KeyInfo, key *keyfile.Key) error {
+	mismatch := errors.New("keystore: the private key of " + info.ID + " does not match its metadata")
+	if key.Scheme != info.Scheme {
+		return mismatch
+	}
+	public, usage, err := publicKey(key)
+	if err != nil {
+		return err
+	}
+	if usage != info.Usage || KeyID(info.PublicKey) != info.ID {
+		return mismatch
+	}
+	if public == nil {
+		if checkDilithiumPair(key.Dilithium(), info.PublicKey, key.PrivateKey) != nil {
+			return mismatch
+		}
+	} else if !bytes.Equal(public, info.PublicKey) {
+		return mismatch
+	}
+	return nil
+}
+
+//List implements Keystore
+func (s *Store) List() ([]*KeyInfo, error) {
+	s.mu.Lock()
+	keys, err := s.backend.List()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].Created.Equal(keys[j].Created) {
+			return keys[i].Created.Before(keys[j].Created)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+//Get implements Keystore
+func (s *Store) Get(id string) (*KeyInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.backend.Get(id)
+}
+
+//Rotate implements Keystore. Expired keys may be rotated, revoked and already rotated keys may not.
+func (s *Store) Rotate(id string, opts *Options) (*KeyInfo, error) {
+	old, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &Options{Labels: old.Labels}
+		if !old.Expires.IsZero() {
+			opts.Lifetime = old.Expires.Sub(old.Created)
+		}
+	}
+	if !old.Revoked.IsZero() {
+		return nil, ErrRevoked
+	}
+	if old.ReplacedBy != "" {
+		return nil, ErrRotated
+	}
+	info, err := s.generate(old.Scheme, opts, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	//the previous key may have been rotated, revoked or deleted meanwhile
+	if old, err = s.backend.Get(id); err == nil && (!old.Revoked.IsZero() || old.ReplacedBy != "") {
+		err = errors.New("keystore: key changed during its rotation")
+	}
+	if err == nil {
+		old.ReplacedBy = info.ID
+		err = s.backend.Update(old)
+	}
+	if err != nil {
+		s.backend.Delete(info.ID)
+		return nil, err
+	}
+	return info, nil
+}
+
+//Revoke implements Keystore. Revoking a revoked key keeps the time of the first revocation.
+func (s *Store) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, err := s.backend.Get(id)
+	if err != nil || !info.Revoked.IsZero() {
+		return err
+	}
+	info.Revoked = s.now().UTC()
+	return s.backend.Update(info)
+}
+
+//Delete implements Keystore
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.backend.Delete(id)
+}
+
+//privateKey returns the metadata and a copy of the private key of a key usable for an operation, to be wiped after
+//use
+func (s *Store) privateKey(id string, usage Usage) (*KeyInfo, *keyfile.Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, err := s.backend.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case info.Usage != usage:
+		return nil, nil, ErrUsage
+	case !info.Revoked.IsZero():
+		return nil, nil, ErrRevoked
+	case info.Expired(s.now()):
+		return nil, nil, ErrExpired
+	case info.ReplacedBy != "" && usage == UsageSign:
+		return nil, nil, ErrRotated
+	}
+	key, err := s.backend.Key(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkKey(info, key); err != nil {
+		return nil, nil, err
+	}
+	k := &keyfile.Key{Scheme: key.Scheme}
+	if key.Seed != nil {
+		k.Seed = append([]byte{}, key.Seed...)
+	} else {
+		k.PrivateKey = append([]byte{}, key.PrivateKey...)
+	}
+	return info, k, nil
+}
+
+//Sign implements Keystore. Signatures are hedged. Contexts are only supported by ML-DSA keys.
+func (s *Store) Sign(id string, message, context []byte) ([]byte, error) {
+	info, key, err := s.privateKey(id, UsageSign)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeKey(key)
+	d := key.Dilithium()
+	if d == nil {
+		return nil, ErrUsage
+	}
+	if len(context) != 0 && !d.IsMLDSA() || len(context) > 255 {
+		return nil, errors.New("keystore: context not supported by " + info.Scheme + " keys")
+	}
+	sk := key.PrivateKey
+	if key.Seed != nil {
+		_, sk = d.KeyGen(key.Seed)
+		defer wipe(sk)
+	}
+	if d.IsMLDSA() {
+		return d.SignWithContext(sk, message, context), nil
+	}
+	return d.Sign(sk, message), nil
+}
+
+//Decapsulate implements Keystore. Rotated keys still decapsulate until they expire or are revoked.
+func (s *Store) Decapsulate(id string, ciphertext []byte) ([]byte, error) {
+	_, key, err := s.privateKey(id, UsageDecapsulate)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeKey(key)
+	k := key.Kyber()
+	if k == nil {
+		return nil, ErrUsage
+	}
+	if len(ciphertext) != k.SIZEC() {
+		return nil, errors.New("keystore: invalid ciphertext length")
+	}
+	sk := key.PrivateKey
+	if key.Seed != nil {
+		_, sk = k.KeyGen(key.Seed)
+		defer wipe(sk)
+	}
+	return k.Decaps(sk, ciphertext), nil
+}
+
+//wipe overwrites a private key
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
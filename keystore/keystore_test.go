@@ -0,0 +1,295 @@
+package keystore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/keyfile"
+)
+
+var password = []byte("correct-horse")
+
+//cheap are low cost key derivation parameters for the tests
+var cheap = &keyfile.Params{Time: 1, Memory: 64, Threads: 1}
+
+//backends returns a Store of every backend
+func backends(t *testing.T) map[string]*Store {
+	b, err := OpenFileBackend(filepath.Join(t.TempDir(), "keys"), password, cheap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]*Store{"memory": New(NewMemoryBackend()), "file": New(b)}
+}
+
+func TestKeystore(t *testing.T) {
+	for name, s := range backends(t) {
+		sig, err := s.Generate("ML-DSA-44", &Options{Lifetime: time.Hour, Labels: map[string]string{"env": "test"}})
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		kem, err := s.Generate("ML-KEM-512", nil)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if sig.ID != KeyID(sig.PublicKey) || sig.Usage != UsageSign || kem.Usage != UsageDecapsulate ||
+			!sig.Expires.Equal(sig.Created.Add(time.Hour)) || !kem.Expires.IsZero() {
+			t.Fatal(name, "unexpected metadata", sig, kem)
+		}
+		if _, err := s.Generate("Falcon-512", nil); err == nil {
+			t.Fatal(name, "unknown scheme generated")
+		}
+
+		keys, err := s.List()
+		if err != nil || len(keys) != 2 {
+			t.Fatal(name, "unexpected keys", keys, err)
+		}
+		if info, err := s.Get(sig.ID); err != nil || info.Labels["env"] != "test" || !bytes.Equal(info.PublicKey, sig.PublicKey) {
+			t.Fatal(name, "unexpected key", info, err)
+		}
+		if _, err := s.Get(KeyID(nil)); err != ErrNotFound {
+			t.Fatal(name, "missing key found", err)
+		}
+		if _, err := s.Get("../keys"); err != ErrNotFound {
+			t.Fatal(name, "invalid ID found", err)
+		}
+
+		d := dilithium.NewMLDSA44()
+		message, context := []byte("message"), []byte("context")
+		signature, err := s.Sign(sig.ID, message, context)
+		if err != nil || !d.VerifyWithContext(sig.PublicKey, message, signature, context) {
+			t.Fatal(name, "signature not verified", err)
+		}
+		if _, err := s.Sign(sig.ID, message, make([]byte, 256)); err == nil {
+			t.Fatal(name, "context too long accepted")
+		}
+		k := kyber.NewMLKEM512()
+		c, ss := k.Encaps(kem.PublicKey, nil)
+		if ss2, err := s.Decapsulate(kem.ID, c); err != nil || !bytes.Equal(ss, ss2) {
+			t.Fatal(name, "shared secret not decapsulated", err)
+		}
+		if _, err := s.Decapsulate(kem.ID, c[1:]); err == nil {
+			t.Fatal(name, "short ciphertext decapsulated")
+		}
+		if _, err := s.Sign(kem.ID, message, nil); err != ErrUsage {
+			t.Fatal(name, "KEM key signed", err)
+		}
+		if _, err := s.Decapsulate(sig.ID, c); err != ErrUsage {
+			t.Fatal(name, "signature key decapsulated", err)
+		}
+
+		if err := s.Delete(kem.ID); err != nil {
+			t.Fatal(name, err)
+		}
+		if _, err := s.Decapsulate(kem.ID, c); err != ErrNotFound {
+			t.Fatal(name, "deleted key decapsulated", err)
+		}
+		if err := s.Delete(kem.ID); err != ErrNotFound {
+			t.Fatal(name, "deleted key deleted", err)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	seed := bytes.Repeat([]byte{1}, dilithium.SEEDBYTES)
+	d := dilithium.NewMLDSA65()
+	pk, sk := d.KeyGen(seed)
+	k := kyber.NewMLKEM768()
+	ek, dk := k.KeyGen(bytes.Repeat([]byte{2}, kyber.SEEDBYTES+kyber.SIZEZ))
+	for name, s := range backends(t) {
+		info, err := s.Import(&keyfile.Key{Scheme: "ML-DSA-65", Seed: seed}, nil, nil)
+		if err != nil || !bytes.Equal(info.PublicKey, pk) {
+			t.Fatal(name, "seed not imported", err)
+		}
+		if _, err := s.Import(&keyfile.Key{Scheme: "ML-DSA-65", PrivateKey: sk}, pk, nil); err != ErrExists {
+			t.Fatal(name, "key imported twice", err)
+		}
+		s.Delete(info.ID)
+		if _, err := s.Import(&keyfile.Key{Scheme: "ML-DSA-65", PrivateKey: sk}, nil, nil); err == nil {
+			t.Fatal(name, "expanded key imported without its public key")
+		}
+		other, _ := d.KeyGen(bytes.Repeat([]byte{3}, dilithium.SEEDBYTES))
+		if _, err := s.Import(&keyfile.Key{Scheme: "ML-DSA-65", PrivateKey: sk}, other, nil); err == nil {
+			t.Fatal(name, "expanded key imported with another public key")
+		}
+		if info, err = s.Import(&keyfile.Key{Scheme: "ML-DSA-65", PrivateKey: sk}, pk, nil); err != nil || info.ID != KeyID(pk) {
+			t.Fatal(name, "expanded key not imported", err)
+		}
+		if signature, err := s.Sign(info.ID, []byte("message"), nil); err != nil || !d.Verify(pk, []byte("message"), signature) {
+			t.Fatal(name, "signature of an imported key not verified", err)
+		}
+
+		if info, err = s.Import(&keyfile.Key{Scheme: "ML-KEM-768", PrivateKey: dk}, nil, nil); err != nil || !bytes.Equal(info.PublicKey, ek) {
+			t.Fatal(name, "expanded KEM key not imported", err)
+		}
+		c, ss := k.Encaps(ek, nil)
+		if ss2, err := s.Decapsulate(info.ID, c); err != nil || !bytes.Equal(ss, ss2) {
+			t.Fatal(name, "shared secret of an imported key not decapsulated", err)
+		}
+		if _, err := s.Import(&keyfile.Key{Scheme: "ML-KEM-768", PrivateKey: dk[1:]}, nil, nil); err == nil {
+			t.Fatal(name, "truncated key imported")
+		}
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	for name, s := range backends(t) {
+		now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		s.now = func() time.Time { return now }
+		sig, _ := s.Generate("Dilithium2", &Options{Lifetime: 24 * time.Hour, Labels: map[string]string{"env": "test"}})
+		kem, _ := s.Generate("ML-KEM-1024", nil)
+
+		now = now.Add(time.Hour)
+		next, err := s.Rotate(sig.ID, nil)
+		if err != nil || next.Scheme != "Dilithium2" || next.Replaces != sig.ID || next.Labels["env"] != "test" ||
+			!next.Expires.Equal(now.Add(24*time.Hour)) {
+			t.Fatal(name, "unexpected rotated key", next, err)
+		}
+		if old, _ := s.Get(sig.ID); old.ReplacedBy != next.ID {
+			t.Fatal(name, "rotation not recorded", old)
+		}
+		if _, err := s.Sign(sig.ID, []byte("message"), nil); err != ErrRotated {
+			t.Fatal(name, "rotated key signed", err)
+		}
+		if _, err := s.Rotate(sig.ID, nil); err != ErrRotated {
+			t.Fatal(name, "rotated key rotated", err)
+		}
+		if _, err := s.Sign(next.ID, []byte("message"), nil); err != nil {
+			t.Fatal(name, err)
+		}
+		if _, err := s.Sign(next.ID, []byte("message"), []byte("context")); err == nil {
+			t.Fatal(name, "context accepted by a round 3 key")
+		}
+
+		nextKEM, err := s.Rotate(kem.ID, &Options{Lifetime: time.Hour})
+		if err != nil || !nextKEM.Expires.Equal(now.Add(time.Hour)) {
+			t.Fatal(name, "unexpected rotated KEM key", nextKEM, err)
+		}
+		c, ss := kyber.NewMLKEM1024().Encaps(kem.PublicKey, nil)
+		if ss2, err := s.Decapsulate(kem.ID, c); err != nil || !bytes.Equal(ss, ss2) {
+			t.Fatal(name, "rotated KEM key not decapsulated", err)
+		}
+
+		if err := s.Revoke(kem.ID); err != nil {
+			t.Fatal(name, err)
+		}
+		revoked, _ := s.Get(kem.ID)
+		now = now.Add(time.Hour)
+		if err := s.Revoke(kem.ID); err != nil {
+			t.Fatal(name, err)
+		}
+		if info, _ := s.Get(kem.ID); !info.Revoked.Equal(revoked.Revoked) {
+			t.Fatal(name, "revocation time changed", info.Revoked, revoked.Revoked)
+		}
+		if _, err := s.Decapsulate(kem.ID, c); err != ErrRevoked {
+			t.Fatal(name, "revoked key decapsulated", err)
+		}
+
+		if _, err := s.Decapsulate(nextKEM.ID, c); err != ErrExpired {
+			t.Fatal(name, "expired key decapsulated", err)
+		}
+		now = now.Add(24 * time.Hour)
+		if _, err := s.Sign(next.ID, []byte("message"), nil); err != ErrExpired {
+			t.Fatal(name, "expired key signed", err)
+		}
+
+		keys, _ := s.List()
+		if len(keys) != 4 || keys[0].ID > keys[1].ID || keys[2].ID > keys[3].ID || !keys[1].Created.Before(keys[2].Created) {
+			t.Fatal(name, "keys not listed the oldest first", keys)
+		}
+	}
+}
+
+func TestFileBackend(t *testing.T) {
+	dir := t.TempDir()
+	b, err := OpenFileBackend(dir, password, cheap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(b)
+	info, _ := s.Generate("ML-DSA-87", &Options{Labels: map[string]string{"owner": "ci"}})
+	for _, ext := range []string{".json", ".key"} {
+		fi, err := os.Stat(filepath.Join(dir, info.ID+ext))
+		if err != nil || fi.Mode().Perm() != 0600 {
+			t.Fatal("unexpected key file", ext, err)
+		}
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(dir, info.ID+".key"))
+	if h, err := keyfile.ParseHeader(data); err != nil || !h.Seed || h.Scheme != "ML-DSA-87" {
+		t.Fatal("unexpected encrypted key", h, err)
+	}
+	b.Close()
+
+	if _, err := OpenFileBackend(dir, []byte("battery-staple"), cheap); err != keyfile.ErrIncorrectPassword {
+		t.Fatal("directory opened with a wrong password", err)
+	}
+	b, err = OpenFileBackend(dir, password, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = New(b)
+	info2, err := s.Get(info.ID)
+	if err != nil || info2.Labels["owner"] != "ci" || !info2.Created.Equal(info.Created) {
+		t.Fatal("metadata not persisted", info2, err)
+	}
+	signature, err := s.Sign(info.ID, []byte("message"), nil)
+	if err != nil || !dilithium.NewMLDSA87().Verify(info.PublicKey, []byte("message"), signature) {
+		t.Fatal("signature of a reopened store not verified", err)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, info.ID+".json"), []byte("{}"), 0600)
+	if _, err := s.Get(info.ID); err == nil {
+		t.Fatal("malformed metadata accepted")
+	}
+	if err := s.Delete(info.ID); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Fatal("files left after deletion", len(files))
+	}
+}
+
+//a private key swapped with the key of another ID, of the same scheme or not, is not used
+func TestSwappedKeys(t *testing.T) {
+	dir := t.TempDir()
+	b, err := OpenFileBackend(dir, password, cheap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(b)
+	seed, _ := s.Generate("ML-DSA-65", nil)
+	other, _ := s.Generate("ML-DSA-65", nil)
+	kem, _ := s.Generate("ML-KEM-768", nil)
+	pk, sk := dilithium.NewMLDSA65().KeyGen(bytes.Repeat([]byte{4}, dilithium.SEEDBYTES))
+	expanded, err := s.Import(&keyfile.Key{Scheme: "ML-DSA-65", PrivateKey: sk}, pk, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+
+	keys := make(map[string][]byte)
+	for _, info := range []*KeyInfo{seed, other, kem, expanded} {
+		keys[info.ID], _ = ioutil.ReadFile(filepath.Join(dir, info.ID+".key"))
+	}
+	for id, from := range map[string]string{seed.ID: other.ID, other.ID: expanded.ID, expanded.ID: kem.ID, kem.ID: expanded.ID} {
+		ioutil.WriteFile(filepath.Join(dir, id+".key"), keys[from], 0600)
+	}
+	if b, err = OpenFileBackend(dir, password, cheap); err != nil {
+		t.Fatal(err)
+	}
+	s = New(b)
+	for _, info := range []*KeyInfo{seed, other, expanded} {
+		if _, err := s.Sign(info.ID, []byte("message"), nil); err == nil {
+			t.Fatal("swapped key used to sign")
+		}
+	}
+	c, _ := kyber.NewMLKEM768().Encaps(kem.PublicKey, nil)
+	if _, err := s.Decapsulate(kem.ID, c); err == nil {
+		t.Fatal("swapped key used to decapsulate")
+	}
+}
@@ -0,0 +1,205 @@
+package minisign
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//Entry is a file of a manifest: its slash-separated path relative to the directory and its SHA-256 hash
+type Entry struct {
+	Path string
+	Hash [sha256.Size]byte
+}
+
+//Manifest lists the files of a directory, sorted by path. It is encoded in the format of sha256sum, so that the files
+//can also be checked with sha256sum -c once the signature of the manifest is verified.
+type Manifest struct {
+	Entries []Entry
+}
+
+//validPath reports whether a manifest path is relative, clean and needs no escaping in sha256sum files
+func validPath(p string) bool {
+	return p != "" && p == path.Clean(p) && !path.IsAbs(p) && p != ".." && !strings.HasPrefix(p, "../") &&
+		!strings.ContainsAny(p, "\\\n\r")
+}
+
+func hashFile(name string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	f, err := os.Open(name)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+//HashDirectory returns the manifest of the regular files under dir, except those whose path relative to dir is
+//excluded, such as the manifest and its signature. Symbolic links and other special files are rejected.
+func HashDirectory(dir string, exclude ...string) (*Manifest, error) {
+	excluded := make(map[string]bool)
+	for _, p := range exclude {
+		excluded[filepath.ToSlash(filepath.Clean(p))] = true
+	}
+	m := &Manifest{}
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if excluded[rel] {
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return errors.New("minisign: " + rel + " is not a regular file")
+		}
+		if !validPath(rel) {
+			return errors.New("minisign: unsupported file name " + rel)
+		}
+		hash, err := hashFile(name)
+		if err != nil {
+			return err
+		}
+		m.Entries = append(m.Entries, Entry{rel, hash})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(m.Entries, func(i, j int) bool { return m.Entries[i].Path < m.Entries[j].Path })
+	return m, nil
+}
+
+//Marshal returns the manifest, one "<hash>  <path>" line per file
+func (m *Manifest) Marshal() []byte {
+	var b bytes.Buffer
+	for _, e := range m.Entries {
+		b.WriteString(hex.EncodeToString(e.Hash[:]) + "  " + e.Path + "\n")
+	}
+	return b.Bytes()
+}
+
+//ParseManifest decodes a manifest. Paths must be relative and appear once.
+func ParseManifest(data []byte) (*Manifest, error) {
+	m := &Manifest{}
+	if len(data) == 0 {
+		return m, nil
+	}
+	seen := make(map[string]bool)
+	for _, line := range splitLines(data) {
+		if len(line) < 2*sha256.Size+3 || line[2*sha256.Size] != ' ' || line[2*sha256.Size+1] != ' ' && line[2*sha256.Size+1] != '*' {
+			return nil, errors.New("minisign: malformed manifest line")
+		}
+		var e Entry
+		if _, err := hex.Decode(e.Hash[:], []byte(line[:2*sha256.Size])); err != nil {
+			return nil, errors.New("minisign: malformed manifest line")
+		}
+		e.Path = line[2*sha256.Size+2:]
+		if !validPath(e.Path) || seen[e.Path] {
+			return nil, errors.New("minisign: invalid manifest path " + e.Path)
+		}
+		seen[e.Path] = true
+		m.Entries = append(m.Entries, e)
+	}
+	sort.Slice(m.Entries, func(i, j int) bool { return m.Entries[i].Path < m.Entries[j].Path })
+	return m, nil
+}
+
+//CheckError lists the differences between a directory and its manifest
+type CheckError struct {
+	Missing  []string
+	Modified []string
+	Unlisted []string
+}
+
+func (e *CheckError) Error() string {
+	var parts []string
+	for _, d := range []struct {
+		what  string
+		paths []string
+	}{{"missing", e.Missing}, {"modified", e.Modified}, {"not in the manifest", e.Unlisted}} {
+		if len(d.paths) != 0 {
+			parts = append(parts, d.what+": "+strings.Join(d.paths, ", "))
+		}
+	}
+	return "minisign: directory does not match the manifest, " + strings.Join(parts, "; ")
+}
+
+//Check hashes the files under dir, except the excluded ones, and returns a *CheckError if they differ from the
+//manifest
+func (m *Manifest) Check(dir string, exclude ...string) error {
+	current, err := HashDirectory(dir, exclude...)
+	if err != nil {
+		return err
+	}
+	hashes := make(map[string][sha256.Size]byte)
+	for _, e := range current.Entries {
+		hashes[e.Path] = e.Hash
+	}
+	ce := &CheckError{}
+	for _, e := range m.Entries {
+		hash, ok := hashes[e.Path]
+		switch {
+		case !ok:
+			ce.Missing = append(ce.Missing, e.Path)
+		case hash != e.Hash:
+			ce.Modified = append(ce.Modified, e.Path)
+		}
+		delete(hashes, e.Path)
+	}
+	for _, e := range current.Entries {
+		if _, ok := hashes[e.Path]; ok {
+			ce.Unlisted = append(ce.Unlisted, e.Path)
+		}
+	}
+	if ce.Missing != nil || ce.Modified != nil || ce.Unlisted != nil {
+		return ce
+	}
+	return nil
+}
+
+//SignDirectory returns the manifest of dir, except the excluded files, and its prehashed signature
+func (k *PrivateKey) SignDirectory(dir string, untrustedComment, trustedComment string, exclude ...string) ([]byte, *Signature, error) {
+	m, err := HashDirectory(dir, exclude...)
+	if err != nil {
+		return nil, nil, err
+	}
+	manifest := m.Marshal()
+	sig, err := k.Sign(bytes.NewReader(manifest), true, untrustedComment, trustedComment)
+	if err != nil {
+		return nil, nil, err
+	}
+	return manifest, sig, nil
+}
+
+//VerifyDirectory verifies the signature of a manifest, then checks every file under dir against it. The excluded
+//files are ignored.
+func (k *PublicKey) VerifyDirectory(dir string, manifest []byte, sig *Signature, exclude ...string) (*Manifest, error) {
+	if err := k.Verify(bytes.NewReader(manifest), sig); err != nil {
+		return nil, err
+	}
+	m, err := ParseManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+	return m, m.Check(dir, exclude...)
+}
@@ -0,0 +1,347 @@
+//Package minisign implements the file formats of minisign and signify with ML-DSA and round 3 Dilithium keys in place
+//of Ed25519: public keys, unencrypted secret keys and detached signatures with an untrusted comment, a trusted comment
+//and a global signature over the signature and the trusted comment. It also signs directories, through a manifest of
+//the SHA-256 hashes of their files signed once.
+//
+//The files keep the layout of minisign, with an algorithm identifier of two bytes naming the parameter set: "M4",
+//"M6" and "M8" for ML-DSA-44, ML-DSA-65 and ML-DSA-87, "D2", "D3" and "D5" for round 3 Dilithium. The marking of
+//prehashed signatures differs from minisign: there, keys and signatures of the file itself are "Ed" and signatures of
+//the BLAKE2b-512 hash of the file "ED", with the second letter in upper case. The second character is a digit here,
+//so a signature of the hash, the default of minisign, keeps the identifier of the key, and a signature of the file
+//itself has its first letter in lower case, as in "m6". Key IDs are the first 8 bytes of the BLAKE2b-256 hash of the
+//public key. minisign and signify do not know these algorithms.
+package minisign
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	"github.com/kudelskisecurity/crystals-go/internal/randutil"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	untrustedPrefix = "untrusted comment: "
+	trustedPrefix   = "trusted comment: "
+	//maxComment is the longest comment accepted, as in minisign
+	maxComment = 1024
+)
+
+//ErrInvalidSignature is returned by Verify when the signature or the global signature is invalid
+var ErrInvalidSignature = errors.New("minisign: invalid signature")
+
+var algorithms = []struct {
+	id           string
+	newDilithium func(...bool) *dilithium.Dilithium
+}{
+	{"M4", dilithium.NewMLDSA44},
+	{"M6", dilithium.NewMLDSA65},
+	{"M8", dilithium.NewMLDSA87},
+	{"D2", dilithium.NewDilithium2},
+	{"D3", dilithium.NewDilithium3},
+	{"D5", dilithium.NewDilithium5},
+}
+
+func algorithmID(d *dilithium.Dilithium) (string, error) {
+	for _, a := range algorithms {
+		if a.newDilithium().Name == d.Name {
+			return a.id, nil
+		}
+	}
+	return "", errors.New("minisign: unsupported parameter set " + d.Name)
+}
+
+func algorithmByID(id string) *dilithium.Dilithium {
+	for _, a := range algorithms {
+		if a.id == id {
+			return a.newDilithium()
+		}
+	}
+	return nil
+}
+
+//PublicKey is a public key and its ID
+type PublicKey struct {
+	Dilithium *dilithium.Dilithium
+	ID        [8]byte
+	Key       []byte
+}
+
+//PrivateKey is a key pair. Its seed is stored in secret key files.
+type PrivateKey struct {
+	PublicKey
+	seed []byte
+	sk   []byte
+}
+
+//keyID returns the first 8 bytes of the BLAKE2b-256 hash of a public key
+func keyID(pk []byte) [8]byte {
+	var id [8]byte
+	h := blake2b.Sum256(pk)
+	copy(id[:], h[:])
+	return id
+}
+
+//NewKeyFromSeed returns the key pair generated from a 32-byte seed
+func NewKeyFromSeed(d *dilithium.Dilithium, seed []byte) (*PrivateKey, error) {
+	if _, err := algorithmID(d); err != nil {
+		return nil, err
+	}
+	if len(seed) != dilithium.SEEDBYTES {
+		return nil, errors.New("minisign: invalid seed length")
+	}
+	pk, sk := d.KeyGen(seed)
+	return &PrivateKey{PublicKey{d, keyID(pk), pk}, append([]byte{}, seed...), sk}, nil
+}
+
+//GenerateKey returns a new key pair, with the seed read from rand (crypto/rand if nil)
+func GenerateKey(d *dilithium.Dilithium, rand io.Reader) (*PrivateKey, error) {
+	seed := make([]byte, dilithium.SEEDBYTES)
+	if _, err := io.ReadFull(randutil.Reader(rand), seed); err != nil {
+		return nil, err
+	}
+	return NewKeyFromSeed(d, seed)
+}
+
+//KeyIDString returns the key ID as printed by minisign: the hexadecimal little-endian integer
+func (k *PublicKey) KeyIDString() string {
+	return fmt.Sprintf("%016X", binary.LittleEndian.Uint64(k.ID[:]))
+}
+
+//checkComment rejects comments spanning several lines or too long
+func checkComment(comment string) error {
+	if strings.ContainsAny(comment, "\r\n") || len(comment) > maxComment {
+		return errors.New("minisign: invalid comment")
+	}
+	return nil
+}
+
+//encodeFile returns the two lines of a key or signature file
+func encodeFile(comment string, data []byte) []byte {
+	return []byte(untrustedPrefix + comment + "\n" + base64.StdEncoding.EncodeToString(data) + "\n")
+}
+
+//splitLines returns the lines of a file without their line endings, and without a final empty line
+func splitLines(data []byte) []string {
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+	return lines
+}
+
+//decodeFile returns the untrusted comment and the decoded data of the first two lines of a key or signature file
+func decodeFile(lines []string, what string) (string, []byte, error) {
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], untrustedPrefix) {
+		return "", nil, errors.New("minisign: malformed " + what)
+	}
+	data, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil {
+		return "", nil, errors.New("minisign: malformed " + what)
+	}
+	return strings.TrimPrefix(lines[0], untrustedPrefix), data, nil
+}
+
+//MarshalPublicKey returns the public key file: the untrusted comment and the algorithm, key ID and public key
+func (k *PublicKey) MarshalPublicKey() []byte {
+	id, _ := algorithmID(k.Dilithium)
+	return encodeFile("minisign public key "+k.KeyIDString(), append(append([]byte(id), k.ID[:]...), k.Key...))
+}
+
+//ParsePublicKey decodes a public key file, or its base64 line alone
+func ParsePublicKey(data []byte) (*PublicKey, error) {
+	lines := splitLines(bytes.TrimSpace(data))
+	if len(lines) == 1 {
+		lines = []string{untrustedPrefix, lines[0]}
+	}
+	_, b, err := decodeFile(lines, "public key")
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 10 {
+		return nil, errors.New("minisign: malformed public key")
+	}
+	d := algorithmByID(string(b[:2]))
+	if d == nil {
+		return nil, errors.New("minisign: unsupported algorithm " + fmt.Sprintf("%q", b[:2]))
+	}
+	k := &PublicKey{Dilithium: d, Key: b[10:]}
+	copy(k.ID[:], b[2:10])
+	if len(k.Key) != d.SIZEPK() {
+		return nil, errors.New("minisign: invalid public key length")
+	}
+	if k.ID != keyID(k.Key) {
+		return nil, errors.New("minisign: key ID does not match the public key")
+	}
+	return k, nil
+}
+
+//The secret key file of minisign holds the algorithm, the key derivation and checksum algorithms, the scrypt salt and
+//limits, then the key ID, the secret key and a checksum, encrypted if a key derivation algorithm is set. Here the
+//secret key is the seed, and keys are never encrypted.
+const (
+	kdfNone         = "\x00\x00"
+	checksumBLAKE2b = "B2"
+	kdfSize         = 32 + 8 + 8
+)
+
+//checksum returns the BLAKE2b-256 hash of the algorithm, key ID and seed
+func (k *PrivateKey) checksum() []byte {
+	id, _ := algorithmID(k.Dilithium)
+	h, _ := blake2b.New256(nil)
+	h.Write([]byte(id))
+	h.Write(k.ID[:])
+	h.Write(k.seed)
+	return h.Sum(nil)
+}
+
+//MarshalPrivateKey returns the unencrypted secret key file
+func (k *PrivateKey) MarshalPrivateKey() []byte {
+	id, _ := algorithmID(k.Dilithium)
+	b := append([]byte(id+kdfNone+checksumBLAKE2b), make([]byte, kdfSize)...)
+	b = append(append(append(b, k.ID[:]...), k.seed...), k.checksum()...)
+	return encodeFile("minisign secret key", b)
+}
+
+//ParsePrivateKey decodes an unencrypted secret key file
+func ParsePrivateKey(data []byte) (*PrivateKey, error) {
+	_, b, err := decodeFile(splitLines(bytes.TrimSpace(data)), "secret key")
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 6+kdfSize+8+dilithium.SEEDBYTES+blake2b.Size256 || string(b[4:6]) != checksumBLAKE2b {
+		return nil, errors.New("minisign: malformed secret key")
+	}
+	if string(b[2:4]) != kdfNone {
+		return nil, errors.New("minisign: encrypted secret keys are not supported")
+	}
+	d := algorithmByID(string(b[:2]))
+	if d == nil {
+		return nil, errors.New("minisign: unsupported algorithm " + fmt.Sprintf("%q", b[:2]))
+	}
+	keyNum := b[6+kdfSize:]
+	k, err := NewKeyFromSeed(d, keyNum[8:8+dilithium.SEEDBYTES])
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(keyNum[:8], k.ID[:]) || subtle.ConstantTimeCompare(keyNum[8+dilithium.SEEDBYTES:], k.checksum()) != 1 {
+		return nil, errors.New("minisign: secret key checksum mismatch")
+	}
+	return k, nil
+}
+
+//Signature is a decoded signature file
+type Signature struct {
+	//Algorithm is the algorithm identifier, with its first letter in lower case for signatures of the file rather
+	//than of its hash, unlike the second letter of minisign
+	Algorithm        string
+	KeyID            [8]byte
+	Signature        []byte
+	UntrustedComment string
+	TrustedComment   string
+	GlobalSignature  []byte
+}
+
+//Prehashed reports whether the signature is over the BLAKE2b-512 hash of the file
+func (s *Signature) Prehashed() bool {
+	return s.Algorithm == strings.ToUpper(s.Algorithm)
+}
+
+//message returns what is signed: the BLAKE2b-512 hash of the file, or the file itself
+func message(r io.Reader, prehashed bool) ([]byte, error) {
+	if !prehashed {
+		return ioutil.ReadAll(r)
+	}
+	h, _ := blake2b.New512(nil)
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+//Sign signs the content of r, or its BLAKE2b-512 hash if prehashed so that large files are streamed, and returns
+//the signature with its comments. Dilithium signatures are randomized or deterministic depending on the instance of
+//the key.
+func (k *PrivateKey) Sign(r io.Reader, prehashed bool, untrustedComment, trustedComment string) (*Signature, error) {
+	if err := checkComment(untrustedComment); err != nil {
+		return nil, err
+	}
+	if err := checkComment(trustedComment); err != nil {
+		return nil, err
+	}
+	msg, err := message(r, prehashed)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := algorithmID(k.Dilithium)
+	if !prehashed {
+		id = strings.ToLower(id[:1]) + id[1:]
+	}
+	sig := &Signature{Algorithm: id, KeyID: k.ID, UntrustedComment: untrustedComment, TrustedComment: trustedComment}
+	if sig.Signature = k.Dilithium.Sign(k.sk, msg); sig.Signature == nil {
+		return nil, errors.New("minisign: signature failed")
+	}
+	if sig.GlobalSignature = k.Dilithium.Sign(k.sk, sig.globalMessage()); sig.GlobalSignature == nil {
+		return nil, errors.New("minisign: signature failed")
+	}
+	return sig, nil
+}
+
+//globalMessage returns the message of the global signature: the signature and the trusted comment
+func (s *Signature) globalMessage() []byte {
+	return append(append([]byte{}, s.Signature...), s.TrustedComment...)
+}
+
+//Marshal returns the signature file
+func (s *Signature) Marshal() []byte {
+	b := encodeFile(s.UntrustedComment, append(append([]byte(s.Algorithm), s.KeyID[:]...), s.Signature...))
+	b = append(b, trustedPrefix+s.TrustedComment+"\n"...)
+	return append(b, base64.StdEncoding.EncodeToString(s.GlobalSignature)+"\n"...)
+}
+
+//ParseSignature decodes a signature file
+func ParseSignature(data []byte) (*Signature, error) {
+	lines := splitLines(data)
+	comment, b, err := decodeFile(lines, "signature")
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) != 4 || len(b) < 10 || !strings.HasPrefix(lines[2], trustedPrefix) {
+		return nil, errors.New("minisign: malformed signature")
+	}
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil {
+		return nil, errors.New("minisign: malformed signature")
+	}
+	s := &Signature{Algorithm: string(b[:2]), Signature: b[10:], UntrustedComment: comment,
+		TrustedComment: strings.TrimPrefix(lines[2], trustedPrefix), GlobalSignature: global}
+	copy(s.KeyID[:], b[2:10])
+	return s, nil
+}
+
+//Verify checks a signature of the content of r and its global signature, which authenticates the trusted comment
+func (k *PublicKey) Verify(r io.Reader, sig *Signature) error {
+	id, _ := algorithmID(k.Dilithium)
+	if strings.ToUpper(sig.Algorithm) != id {
+		return errors.New("minisign: signature algorithm " + fmt.Sprintf("%q", sig.Algorithm) + " does not match the key")
+	}
+	if sig.KeyID != k.ID {
+		return fmt.Errorf("minisign: signature made with key %016X, not %s", binary.LittleEndian.Uint64(sig.KeyID[:]), k.KeyIDString())
+	}
+	msg, err := message(r, sig.Prehashed())
+	if err != nil {
+		return err
+	}
+	if !k.Dilithium.Verify(k.Key, msg, sig.Signature) || !k.Dilithium.Verify(k.Key, sig.globalMessage(), sig.GlobalSignature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
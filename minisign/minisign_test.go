@@ -0,0 +1,121 @@
+package minisign
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+)
+
+func TestKeys(t *testing.T) {
+	k, err := GenerateKey(dilithium.NewMLDSA44(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := k.MarshalPublicKey()
+	if !strings.HasPrefix(string(pub), "untrusted comment: minisign public key "+k.KeyIDString()+"\nTT") {
+		t.Fatal("unexpected public key file", string(pub))
+	}
+	pk, err := ParsePublicKey(pub)
+	if err != nil || pk.ID != k.ID || !bytes.Equal(pk.Key, k.Key) {
+		t.Fatal("public key does not round trip", err)
+	}
+	if _, err := ParsePublicKey(bytes.SplitN(pub, []byte("\n"), 2)[1]); err != nil {
+		t.Fatal("base64 line alone rejected", err)
+	}
+	k2, err := ParsePrivateKey(k.MarshalPrivateKey())
+	if err != nil || k2.ID != k.ID || !bytes.Equal(k2.sk, k.sk) {
+		t.Fatal("secret key does not round trip", err)
+	}
+
+	sec := k.MarshalPrivateKey()
+	lines := bytes.Split(sec, []byte("\n"))
+	b := make([]byte, len(lines[1]))
+	copy(b, lines[1])
+	b[len(b)-10] ^= 1
+	if _, err := ParsePrivateKey(append(append(lines[0], '\n'), b...)); err == nil {
+		t.Fatal("corrupted secret key accepted")
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	k, _ := NewKeyFromSeed(dilithium.NewMLDSA65(), bytes.Repeat([]byte{1}, 32))
+	msg := bytes.Repeat([]byte("release\n"), 10000)
+	for _, prehashed := range []bool{true, false} {
+		sig, err := k.Sign(bytes.NewReader(msg), prehashed, "signature from minisign secret key", "timestamp:0\tfile:release.tar.gz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id := map[bool]string{true: "M6", false: "m6"}[prehashed]; sig.Prehashed() != prehashed || sig.Algorithm != id {
+			t.Fatal("unexpected algorithm", sig.Algorithm)
+		}
+		parsed, err := ParseSignature(sig.Marshal())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := k.Verify(bytes.NewReader(msg), parsed); err != nil {
+			t.Fatal(err)
+		}
+		if err := k.Verify(bytes.NewReader(msg[1:]), parsed); err != ErrInvalidSignature {
+			t.Fatal("signature of another message accepted", err)
+		}
+		parsed.TrustedComment = "timestamp:1\tfile:release.tar.gz"
+		if err := k.Verify(bytes.NewReader(msg), parsed); err != ErrInvalidSignature {
+			t.Fatal("modified trusted comment accepted", err)
+		}
+	}
+	other, _ := GenerateKey(dilithium.NewMLDSA65(), nil)
+	sig, _ := k.Sign(bytes.NewReader(msg), true, "", "")
+	if err := other.Verify(bytes.NewReader(msg), sig); err == nil || err == ErrInvalidSignature {
+		t.Fatal("signature of another key ID checked", err)
+	}
+	if _, err := k.Sign(bytes.NewReader(msg), true, "", "two\nlines"); err == nil {
+		t.Fatal("multi-line comment accepted")
+	}
+}
+
+func TestDirectory(t *testing.T) {
+	k, _ := GenerateKey(dilithium.NewDilithium3(), nil)
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "bin"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "README"), []byte("readme\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "bin", "tool"), []byte("binary"), 0755)
+	manifest, sig, err := k.SignDirectory(dir, "", "release 1.0", "MANIFEST", "MANIFEST.minisig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(manifest), "  README\n") || !strings.Contains(string(manifest), "  bin/tool\n") {
+		t.Fatal("unexpected manifest", string(manifest))
+	}
+	ioutil.WriteFile(filepath.Join(dir, "MANIFEST"), manifest, 0644)
+	m, err := k.VerifyDirectory(dir, manifest, sig, "MANIFEST")
+	if err != nil || len(m.Entries) != 2 {
+		t.Fatal(err)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "README"), []byte("modified\n"), 0644)
+	os.Remove(filepath.Join(dir, "bin", "tool"))
+	ioutil.WriteFile(filepath.Join(dir, "extra"), nil, 0644)
+	_, err = k.VerifyDirectory(dir, manifest, sig, "MANIFEST")
+	ce, ok := err.(*CheckError)
+	if !ok || len(ce.Missing) != 1 || len(ce.Modified) != 1 || len(ce.Unlisted) != 1 || ce.Unlisted[0] != "extra" {
+		t.Fatal("unexpected check result", err)
+	}
+	if _, err := k.VerifyDirectory(dir, append(manifest, manifest[:70]...), sig, "MANIFEST"); err != ErrInvalidSignature {
+		t.Fatal("modified manifest accepted", err)
+	}
+	for _, bad := range []string{
+		strings.Repeat("00", 32) + "  ../etc/passwd\n",
+		strings.Repeat("00", 32) + "  /etc/passwd\n",
+		strings.Repeat("00", 32) + "  a\n" + strings.Repeat("11", 32) + "  a\n",
+		"00  a\n",
+	} {
+		if _, err := ParseManifest([]byte(bad)); err == nil {
+			t.Fatal("invalid manifest accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+//Package noise implements the Noise protocol framework (https://noiseprotocol.org/noise.html) with the KEM-based
+//handshake patterns of PQNoise, where Diffie-Hellman is replaced by Kyber encapsulations. The cipher is
+//ChaCha20-Poly1305 and the hash function BLAKE2s or SHA-256.
+//
+//Pre-shared keys and the fallback modifier are not supported.
+package noise
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/internal/randutil"
+)
+
+//MaxMessageSize is the maximum size in bytes of a Noise message
+const MaxMessageSize = 65535
+
+//Keypair is a Kyber key pair
+type Keypair struct {
+	Public  []byte
+	Private []byte
+}
+
+//GenerateKeypair creates a static key pair for the KEM, reading the seed from rand (crypto/rand if nil)
+func GenerateKeypair(k *kyber.Kyber, rand io.Reader) (Keypair, error) {
+	seed := make([]byte, 2*kyber.SEEDBYTES)
+	if _, err := io.ReadFull(randutil.Reader(rand), seed); err != nil {
+		return Keypair{}, err
+	}
+	pk, sk := k.KeyGen(seed)
+	return Keypair{Public: pk, Private: sk}, nil
+}
+
+//Config describes one side of a handshake
+type Config struct {
+	Pattern   HandshakePattern
+	Initiator bool
+	//KEM is the Kyber instance of all keys, NewKyber768() if nil
+	KEM  *kyber.Kyber
+	Hash HashFunc
+	//Prologue is data both parties must agree on, authenticated by the handshake
+	Prologue []byte
+	//StaticKeypair is the local static key pair, required by patterns that use it
+	StaticKeypair Keypair
+	//PeerStatic is the static public key of the peer, required by patterns where it is known in advance
+	PeerStatic []byte
+	//Rand is the source of the ephemeral keys and of the encapsulations, crypto/rand if nil
+	Rand io.Reader
+}
+
+func (c *Config) kem() *kyber.Kyber {
+	if c.KEM == nil {
+		return kyber.NewKyber768()
+	}
+	return c.KEM
+}
+
+//ProtocolName returns the Noise protocol name, for instance Noise_pqXX_Kyber768_ChaChaPoly_BLAKE2s
+func (c *Config) ProtocolName() string {
+	kem := strings.Replace(c.kem().Name, "-", "", -1)
+	return "Noise_" + c.Pattern.Name + "_" + kem + "_ChaChaPoly_" + c.Hash.name()
+}
+
+var (
+	//ErrHandshakeComplete is returned when a message is written or read after the end of the handshake
+	ErrHandshakeComplete = errors.New("noise: handshake is complete")
+	errOutOfTurn         = errors.New("noise: message out of turn")
+	errShortMessage      = errors.New("noise: message too short")
+	errMessageSize       = errors.New("noise: message too long")
+)
+
+//HandshakeState runs one side of a handshake
+type HandshakeState struct {
+	ss        *symmetricState
+	kem       *kyber.Kyber
+	rand      io.Reader
+	s         Keypair
+	e         Keypair
+	rs        []byte
+	re        []byte
+	initiator bool
+	messages  [][]Token
+	msgIdx    int
+	send      *CipherState
+	recv      *CipherState
+}
+
+//NewHandshakeState initializes a handshake. It fails if a key required by the pattern is missing.
+func NewHandshakeState(c *Config) (*HandshakeState, error) {
+	hs := &HandshakeState{
+		ss:        newSymmetricState(c.Hash, c.ProtocolName()),
+		kem:       c.kem(),
+		rand:      randutil.Reader(c.Rand),
+		s:         c.StaticKeypair,
+		rs:        c.PeerStatic,
+		initiator: c.Initiator,
+		messages:  c.Pattern.Messages,
+	}
+	if len(hs.messages) == 0 {
+		return nil, errors.New("noise: empty handshake pattern")
+	}
+	if hs.s.Public != nil && (len(hs.s.Public) != hs.kem.SIZEPK() || len(hs.s.Private) != hs.kem.SIZESK()) {
+		return nil, errors.New("noise: invalid static key pair")
+	}
+	if hs.rs != nil && len(hs.rs) != hs.kem.SIZEPK() {
+		return nil, errors.New("noise: invalid peer static key")
+	}
+
+	//a party needs its static key pair if it sends s or is the target of skem
+	for i, msg := range hs.messages {
+		local := (i%2 == 0) == hs.initiator
+		for _, t := range msg {
+			if (t == TokenS && local || t == TokenSKEM && !local) && hs.s.Public == nil {
+				return nil, errors.New("noise: the pattern requires a local static key pair")
+			}
+		}
+	}
+
+	hs.ss.mixHash(c.Prologue)
+	for _, pre := range []struct {
+		tokens []Token
+		local  bool
+	}{
+		{c.Pattern.InitiatorPreMessages, hs.initiator},
+		{c.Pattern.ResponderPreMessages, !hs.initiator},
+	} {
+		for _, t := range pre.tokens {
+			if t != TokenS {
+				return nil, errors.New("noise: unsupported pre-message token")
+			}
+			if pre.local {
+				if hs.s.Public == nil {
+					return nil, errors.New("noise: the pattern requires a local static key pair")
+				}
+				hs.ss.mixHash(hs.s.Public)
+			} else {
+				if hs.rs == nil {
+					return nil, errors.New("noise: the pattern requires the peer static key")
+				}
+				hs.ss.mixHash(hs.rs)
+			}
+		}
+	}
+	return hs, nil
+}
+
+//encaps encapsulates to pk and mixes the shared secret into the chaining key
+func (hs *HandshakeState) encaps(pk []byte) ([]byte, []byte, error) {
+	coins := make([]byte, kyber.SEEDBYTES)
+	if _, err := io.ReadFull(hs.rand, coins); err != nil {
+		return nil, nil, err
+	}
+	ct, ss := hs.kem.Encaps(pk, coins)
+	if ct == nil {
+		return nil, nil, errors.New("noise: invalid peer public key")
+	}
+	return ct, ss, nil
+}
+
+//WriteMessage returns the next handshake message, carrying payload. After the last message, the transport cipher
+//states are available from CipherStates.
+func (hs *HandshakeState) WriteMessage(payload []byte) ([]byte, error) {
+	if hs.msgIdx >= len(hs.messages) {
+		return nil, ErrHandshakeComplete
+	}
+	if (hs.msgIdx%2 == 0) != hs.initiator {
+		return nil, errOutOfTurn
+	}
+	var out []byte
+	var err error
+	for _, t := range hs.messages[hs.msgIdx] {
+		switch t {
+		case TokenE:
+			if hs.e, err = GenerateKeypair(hs.kem, hs.rand); err != nil {
+				return nil, err
+			}
+			out = append(out, hs.e.Public...)
+			hs.ss.mixHash(hs.e.Public)
+		case TokenS:
+			if out, err = hs.ss.encryptAndHash(out, hs.s.Public); err != nil {
+				return nil, err
+			}
+		case TokenEKEM:
+			ct, ss, err := hs.encaps(hs.re)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, ct...)
+			hs.ss.mixHash(ct)
+			hs.ss.mixKey(ss)
+		case TokenSKEM:
+			ct, ss, err := hs.encaps(hs.rs)
+			if err != nil {
+				return nil, err
+			}
+			if out, err = hs.ss.encryptAndHash(out, ct); err != nil {
+				return nil, err
+			}
+			hs.ss.mixKey(ss)
+		}
+	}
+	if out, err = hs.ss.encryptAndHash(out, payload); err != nil {
+		return nil, err
+	}
+	if len(out) > MaxMessageSize {
+		return nil, errMessageSize
+	}
+	hs.next()
+	return out, nil
+}
+
+//ReadMessage processes the next handshake message from the peer and returns its payload
+func (hs *HandshakeState) ReadMessage(msg []byte) ([]byte, error) {
+	if hs.msgIdx >= len(hs.messages) {
+		return nil, ErrHandshakeComplete
+	}
+	if (hs.msgIdx%2 == 0) == hs.initiator {
+		return nil, errOutOfTurn
+	}
+	if len(msg) > MaxMessageSize {
+		return nil, errMessageSize
+	}
+	//the state is only updated once the whole message is authentic
+	ss := *hs.ss
+	re, rs := hs.re, hs.rs
+	read := func(n int) ([]byte, error) {
+		if ss.cs.HasKey() {
+			n += tagSize
+		}
+		if len(msg) < n {
+			return nil, errShortMessage
+		}
+		b := msg[:n]
+		msg = msg[n:]
+		return b, nil
+	}
+	for _, t := range hs.messages[hs.msgIdx] {
+		switch t {
+		case TokenE:
+			if len(msg) < hs.kem.SIZEPK() {
+				return nil, errShortMessage
+			}
+			re = append([]byte{}, msg[:hs.kem.SIZEPK()]...)
+			msg = msg[hs.kem.SIZEPK():]
+			ss.mixHash(re)
+		case TokenS:
+			b, err := read(hs.kem.SIZEPK())
+			if err != nil {
+				return nil, err
+			}
+			if rs, err = ss.decryptAndHash(b); err != nil {
+				return nil, err
+			}
+		case TokenEKEM:
+			if len(msg) < hs.kem.SIZEC() {
+				return nil, errShortMessage
+			}
+			ct := msg[:hs.kem.SIZEC()]
+			msg = msg[hs.kem.SIZEC():]
+			ss.mixHash(ct)
+			ss.mixKey(hs.kem.Decaps(hs.e.Private, ct))
+		case TokenSKEM:
+			b, err := read(hs.kem.SIZEC())
+			if err != nil {
+				return nil, err
+			}
+			ct, err := ss.decryptAndHash(b)
+			if err != nil {
+				return nil, err
+			}
+			ss.mixKey(hs.kem.Decaps(hs.s.Private, ct))
+		}
+	}
+	payload, err := ss.decryptAndHash(msg)
+	if err != nil {
+		return nil, err
+	}
+	*hs.ss = ss
+	hs.re, hs.rs = re, rs
+	hs.next()
+	return payload, nil
+}
+
+func (hs *HandshakeState) next() {
+	hs.msgIdx++
+	if hs.msgIdx == len(hs.messages) {
+		c1, c2 := hs.ss.split()
+		if hs.initiator {
+			hs.send, hs.recv = c1, c2
+		} else {
+			hs.send, hs.recv = c2, c1
+		}
+		hs.e = Keypair{}
+	}
+}
+
+//Complete reports whether all the handshake messages have been written or read
+func (hs *HandshakeState) Complete() bool {
+	return hs.send != nil
+}
+
+//CipherStates returns the cipher states used to send and receive transport messages, nil before the handshake is
+//complete
+func (hs *HandshakeState) CipherStates() (send, recv *CipherState) {
+	return hs.send, hs.recv
+}
+
+//HandshakeHash returns h, which identifies the handshake and can be used for channel binding once it is complete
+func (hs *HandshakeState) HandshakeHash() []byte {
+	return append([]byte{}, hs.ss.h...)
+}
+
+//PeerStatic returns the static public key of the peer, nil if it is not known yet
+func (hs *HandshakeState) PeerStatic() []byte {
+	return append([]byte(nil), hs.rs...)
+}
@@ -0,0 +1,238 @@
+package noise
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"io"
+	"net"
+	"testing"
+
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+//configs returns the initiator and responder configurations of a pattern, with all the keys it needs
+func configs(t *testing.T, p HandshakePattern, k *kyber.Kyber, h HashFunc) (*Config, *Config) {
+	si, _ := GenerateKeypair(k, nil)
+	sr, _ := GenerateKeypair(k, nil)
+	ci := &Config{Pattern: p, Initiator: true, KEM: k, Hash: h, Prologue: []byte("test"), StaticKeypair: si}
+	cr := &Config{Pattern: p, KEM: k, Hash: h, Prologue: []byte("test"), StaticKeypair: sr}
+	if len(p.ResponderPreMessages) > 0 {
+		ci.PeerStatic = sr.Public
+	}
+	if len(p.InitiatorPreMessages) > 0 {
+		cr.PeerStatic = si.Public
+	}
+	return ci, cr
+}
+
+func handshake(t *testing.T, ci, cr *Config) (*HandshakeState, *HandshakeState) {
+	hi, err := NewHandshakeState(ci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hr, err := NewHandshakeState(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, r := hi, hr
+	for i := 0; !hi.Complete(); i++ {
+		payload := []byte{byte(i)}
+		msg, err := w.WriteMessage(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := r.ReadMessage(msg)
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if !bytes.Equal(out, payload) {
+			t.Fatal("payload mismatch")
+		}
+		w, r = r, w
+	}
+	if !hr.Complete() {
+		t.Fatal("responder did not complete")
+	}
+	return hi, hr
+}
+
+func TestPatterns(t *testing.T) {
+	for _, p := range []HandshakePattern{PatternPQNN, PatternPQNK, PatternPQXX, PatternPQIK} {
+		for _, h := range []HashFunc{BLAKE2s, SHA256} {
+			for _, k := range []*kyber.Kyber{kyber.NewKyber512(), kyber.NewMLKEM768()} {
+				ci, cr := configs(t, p, k, h)
+				t.Run(ci.ProtocolName(), func(t *testing.T) {
+					hi, hr := handshake(t, ci, cr)
+					if !bytes.Equal(hi.HandshakeHash(), hr.HandshakeHash()) {
+						t.Fatal("handshake hashes differ")
+					}
+					si, ri := hi.CipherStates()
+					sr, rr := hr.CipherStates()
+					for _, pair := range [][2]*CipherState{{si, rr}, {sr, ri}} {
+						ct, _ := pair[0].Encrypt(nil, nil, []byte("transport"))
+						pt, err := pair[1].Decrypt(nil, nil, ct)
+						if err != nil || string(pt) != "transport" {
+							t.Fatal("transport message failed")
+						}
+					}
+					if p.Name == "pqXX" || p.Name == "pqIK" {
+						if !bytes.Equal(hr.PeerStatic(), ci.StaticKeypair.Public) {
+							t.Fatal("responder did not learn the initiator static key")
+						}
+					}
+					if p.Name != "pqNN" && !bytes.Equal(hi.PeerStatic(), cr.StaticKeypair.Public) {
+						t.Fatal("initiator did not learn the responder static key")
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestWrongKeys(t *testing.T) {
+	k := kyber.NewKyber768()
+	ci, cr := configs(t, PatternPQNK, k, BLAKE2s)
+	//the initiator expects another responder
+	other, _ := GenerateKeypair(k, nil)
+	ci.PeerStatic = other.Public
+	hi, _ := NewHandshakeState(ci)
+	hr, _ := NewHandshakeState(cr)
+	msg, _ := hi.WriteMessage(nil)
+	if _, err := hr.ReadMessage(msg); err == nil {
+		t.Fatal("message for another responder accepted")
+	}
+
+	ci, cr = configs(t, PatternPQXX, k, BLAKE2s)
+	cr.Prologue = []byte("other")
+	hi, _ = NewHandshakeState(ci)
+	hr, _ = NewHandshakeState(cr)
+	msg, _ = hi.WriteMessage(nil)
+	hr.ReadMessage(msg)
+	msg, _ = hr.WriteMessage(nil)
+	if _, err := hi.ReadMessage(msg); err == nil {
+		t.Fatal("prologue mismatch not detected")
+	}
+
+	if _, err := NewHandshakeState(&Config{Pattern: PatternPQNK, Initiator: true}); err == nil {
+		t.Fatal("missing peer static key not detected")
+	}
+	if _, err := NewHandshakeState(&Config{Pattern: PatternPQXX}); err == nil {
+		t.Fatal("missing static key pair not detected")
+	}
+}
+
+func TestTamperedMessage(t *testing.T) {
+	ci, cr := configs(t, PatternPQXX, kyber.NewKyber768(), SHA256)
+	hi, _ := NewHandshakeState(ci)
+	hr, _ := NewHandshakeState(cr)
+	msg, _ := hi.WriteMessage(nil)
+	hr.ReadMessage(msg)
+	msg, _ = hr.WriteMessage([]byte("payload"))
+	for _, i := range []int{0, len(msg) / 2, len(msg) - 1} {
+		bad := append([]byte{}, msg...)
+		bad[i] ^= 1
+		if _, err := hi.ReadMessage(bad); err == nil {
+			t.Fatalf("tampered byte %d accepted", i)
+		}
+	}
+	if _, err := hi.ReadMessage(msg[:len(msg)-1]); err == nil {
+		t.Fatal("truncated message accepted")
+	}
+	//failed reads leave the state untouched
+	if _, err := hi.ReadMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hi.ReadMessage(msg); err != errOutOfTurn {
+		t.Fatal("expected an out of turn error")
+	}
+}
+
+func TestCipherState(t *testing.T) {
+	key := make([]byte, 32)
+	key[0] = 1
+	c := newCipherState(key)
+	aead, _ := chacha20poly1305.New(key)
+	for n := byte(0); n < 3; n++ {
+		ct, _ := c.Encrypt(nil, []byte("ad"), []byte("msg"))
+		iv := make([]byte, 12)
+		iv[4] = n
+		if !bytes.Equal(ct, aead.Seal(nil, iv, []byte("msg"), []byte("ad"))) {
+			t.Fatal("unexpected nonce encoding")
+		}
+	}
+
+	c.Rekey()
+	iv := bytes.Repeat([]byte{0xff}, 12)
+	iv[0], iv[1], iv[2], iv[3] = 0, 0, 0, 0
+	newKey := aead.Seal(nil, iv, make([]byte, 32), nil)[:32]
+	if !bytes.Equal(c.k, newKey) || c.n != 3 {
+		t.Fatal("unexpected rekey")
+	}
+
+	c.n = 1<<64 - 1
+	if _, err := c.Encrypt(nil, nil, nil); err != ErrNonceExhausted {
+		t.Fatal("nonce exhaustion not detected")
+	}
+}
+
+func TestHKDF(t *testing.T) {
+	ck, ikm := []byte("chaining key"), []byte("input key material")
+	mac := func(key []byte, data ...byte) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write(data)
+		return h.Sum(nil)
+	}
+	temp := mac(ck, ikm...)
+	o1 := mac(temp, 1)
+	o2 := mac(temp, append(o1, 2)...)
+	a, b := SHA256.hkdf2(ck, ikm)
+	if !bytes.Equal(a, o1) || !bytes.Equal(b, o2) {
+		t.Fatal("HKDF does not follow the Noise definition")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	ci, cr := configs(t, PatternPQIK, kyber.NewKyber768(), BLAKE2s)
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	type result struct {
+		tr  *Transport
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		tr, err := Handshake(b, cr)
+		done <- result{tr, err}
+	}()
+	ti, err := Handshake(a, ci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := <-done
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	tr := res.tr
+	if !bytes.Equal(ti.HandshakeHash(), tr.HandshakeHash()) {
+		t.Fatal("handshake hashes differ")
+	}
+
+	data := make([]byte, 3*MaxMessageSize)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	go func() {
+		ti.Write(data)
+	}()
+	got := make([]byte, len(data))
+	if _, err := io.ReadFull(tr, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("transport data mismatch")
+	}
+}
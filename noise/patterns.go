@@ -0,0 +1,70 @@
+package noise
+
+//Token is a handshake pattern token
+type Token int
+
+const (
+	//TokenE sends a fresh ephemeral KEM public key
+	TokenE Token = iota
+	//TokenS sends the static KEM public key, encrypted once a key has been mixed in
+	TokenS
+	//TokenEKEM encapsulates to the ephemeral public key of the peer and mixes the shared secret into the key
+	TokenEKEM
+	//TokenSKEM encapsulates to the static public key of the peer, sends the encrypted ciphertext and mixes the shared
+	//secret into the key
+	TokenSKEM
+)
+
+//HandshakePattern describes the messages of a handshake
+type HandshakePattern struct {
+	Name string
+	//InitiatorPreMessages and ResponderPreMessages list the keys known to the peer before the handshake, only TokenS
+	//is allowed
+	InitiatorPreMessages []Token
+	ResponderPreMessages []Token
+	//Messages alternate between the initiator and the responder, starting with the initiator
+	Messages [][]Token
+}
+
+//The KEM-based patterns of PQNoise (https://eprint.iacr.org/2022/539). In the names, the first letter is about the
+//static key of the initiator and the second about the static key of the responder: N for none, K for known to the
+//peer in advance, X for transmitted during the handshake.
+var (
+	//PatternPQNN has no authentication
+	PatternPQNN = HandshakePattern{
+		Name: "pqNN",
+		Messages: [][]Token{
+			{TokenE},
+			{TokenEKEM},
+		},
+	}
+	//PatternPQNK authenticates the responder, whose static key the initiator knows
+	PatternPQNK = HandshakePattern{
+		Name:                 "pqNK",
+		ResponderPreMessages: []Token{TokenS},
+		Messages: [][]Token{
+			{TokenSKEM, TokenE},
+			{TokenEKEM},
+		},
+	}
+	//PatternPQXX authenticates both parties, which exchange their static keys
+	PatternPQXX = HandshakePattern{
+		Name: "pqXX",
+		Messages: [][]Token{
+			{TokenE},
+			{TokenEKEM, TokenS},
+			{TokenSKEM, TokenS},
+			{TokenSKEM},
+		},
+	}
+	//PatternPQIK authenticates both parties; the initiator knows the static key of the responder and sends its own in
+	//the first message
+	PatternPQIK = HandshakePattern{
+		Name:                 "pqIK",
+		ResponderPreMessages: []Token{TokenS},
+		Messages: [][]Token{
+			{TokenSKEM, TokenE, TokenS},
+			{TokenEKEM, TokenSKEM},
+		},
+	}
+)
@@ -0,0 +1,193 @@
+package noise
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+	"math"
+
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+//HashFunc selects the hash function of the cipher suite
+type HashFunc int
+
+const (
+	//BLAKE2s is the default hash function
+	BLAKE2s HashFunc = iota
+	//SHA256 is SHA-256
+	SHA256
+)
+
+//hashLen is HASHLEN, 32 bytes for both hash functions
+const hashLen = 32
+
+//tagSize is the size of the ChaCha20-Poly1305 authentication tag
+const tagSize = 16
+
+func (h HashFunc) name() string {
+	if h == SHA256 {
+		return "SHA256"
+	}
+	return "BLAKE2s"
+}
+
+func (h HashFunc) new() hash.Hash {
+	if h == SHA256 {
+		return sha256.New()
+	}
+	b, _ := blake2s.New256(nil)
+	return b
+}
+
+func (h HashFunc) sum(data ...[]byte) []byte {
+	d := h.new()
+	for _, b := range data {
+		d.Write(b)
+	}
+	return d.Sum(nil)
+}
+
+//hkdf2 returns the two outputs of HKDF(ck, ikm) as defined by Noise, which is HKDF with the chaining key as salt and
+//an empty info
+func (h HashFunc) hkdf2(ck, ikm []byte) ([]byte, []byte) {
+	out := make([]byte, 2*hashLen)
+	io.ReadFull(hkdf.New(h.new, ikm, ck, nil), out)
+	return out[:hashLen], out[hashLen:]
+}
+
+var (
+	//ErrNonceExhausted is returned once 2^64-1 messages have been encrypted with a CipherState
+	ErrNonceExhausted = errors.New("noise: nonce exhausted")
+	errDecrypt        = errors.New("noise: message authentication failed")
+)
+
+//CipherState encrypts and decrypts messages with a key k and a counter nonce n
+type CipherState struct {
+	aead cipher.AEAD
+	k    []byte
+	n    uint64
+}
+
+func newCipherState(k []byte) *CipherState {
+	c := &CipherState{}
+	c.initializeKey(k)
+	return c
+}
+
+func (c *CipherState) initializeKey(k []byte) {
+	c.k = append([]byte{}, k...)
+	c.aead, _ = chacha20poly1305.New(c.k)
+	c.n = 0
+}
+
+//HasKey reports whether the CipherState has a key. Without a key, messages are left unencrypted.
+func (c *CipherState) HasKey() bool {
+	return c.aead != nil
+}
+
+func nonce(n uint64) []byte {
+	var iv [chacha20poly1305.NonceSize]byte
+	binary.LittleEndian.PutUint64(iv[4:], n)
+	return iv[:]
+}
+
+//Encrypt appends the encryption of plaintext with associated data ad to out
+func (c *CipherState) Encrypt(out, ad, plaintext []byte) ([]byte, error) {
+	if !c.HasKey() {
+		return append(out, plaintext...), nil
+	}
+	if c.n == math.MaxUint64 {
+		return nil, ErrNonceExhausted
+	}
+	out = c.aead.Seal(out, nonce(c.n), plaintext, ad)
+	c.n++
+	return out, nil
+}
+
+//Decrypt appends the decryption of ciphertext with associated data ad to out. The nonce is only incremented when the
+//ciphertext is authentic.
+func (c *CipherState) Decrypt(out, ad, ciphertext []byte) ([]byte, error) {
+	if !c.HasKey() {
+		return append(out, ciphertext...), nil
+	}
+	if c.n == math.MaxUint64 {
+		return nil, ErrNonceExhausted
+	}
+	out, err := c.aead.Open(out, nonce(c.n), ciphertext, ad)
+	if err != nil {
+		return nil, errDecrypt
+	}
+	c.n++
+	return out, nil
+}
+
+//Rekey replaces the key by the encryption of 32 zero bytes with the maximum nonce, keeping the nonce counter
+func (c *CipherState) Rekey() {
+	if !c.HasKey() {
+		return
+	}
+	k := c.aead.Seal(nil, nonce(math.MaxUint64), make([]byte, 32), nil)
+	n := c.n
+	c.initializeKey(k[:32])
+	c.n = n
+}
+
+//symmetricState holds the chaining key and handshake hash of a handshake
+type symmetricState struct {
+	hash HashFunc
+	cs   CipherState
+	ck   []byte
+	h    []byte
+}
+
+func newSymmetricState(hash HashFunc, protocolName string) *symmetricState {
+	s := &symmetricState{hash: hash}
+	if len(protocolName) <= hashLen {
+		s.h = make([]byte, hashLen)
+		copy(s.h, protocolName)
+	} else {
+		s.h = hash.sum([]byte(protocolName))
+	}
+	s.ck = append([]byte{}, s.h...)
+	return s
+}
+
+func (s *symmetricState) mixKey(ikm []byte) {
+	ck, k := s.hash.hkdf2(s.ck, ikm)
+	s.ck = ck
+	s.cs.initializeKey(k)
+}
+
+func (s *symmetricState) mixHash(data []byte) {
+	s.h = s.hash.sum(s.h, data)
+}
+
+func (s *symmetricState) encryptAndHash(out, plaintext []byte) ([]byte, error) {
+	start := len(out)
+	out, err := s.cs.Encrypt(out, s.h, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	s.mixHash(out[start:])
+	return out, nil
+}
+
+func (s *symmetricState) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	plaintext, err := s.cs.Decrypt(nil, s.h, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	s.mixHash(ciphertext)
+	return plaintext, nil
+}
+
+func (s *symmetricState) split() (*CipherState, *CipherState) {
+	k1, k2 := s.hash.hkdf2(s.ck, nil)
+	return newCipherState(k1), newCipherState(k2)
+}
@@ -0,0 +1,131 @@
+package noise
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+//Over a stream, every Noise message is preceded by its length as a 2-byte big-endian integer.
+
+func writeFrame(w io.Writer, msg []byte) error {
+	frame := make([]byte, 2, 2+len(msg))
+	binary.BigEndian.PutUint16(frame, uint16(len(msg)))
+	_, err := w.Write(append(frame, msg...))
+	return err
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var l [2]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(l[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+//Transport is an encrypted stream established by a handshake. Each Write is sent as one or more transport messages
+//and Read returns the decrypted data in order. It is not safe for concurrent use by multiple readers or multiple writers.
+type Transport struct {
+	rw            io.ReadWriter
+	send          *CipherState
+	recv          *CipherState
+	handshakeHash []byte
+	peerStatic    []byte
+	buf           []byte
+}
+
+//Handshake runs the handshake described by c over rw, with empty payloads, and returns the resulting transport
+func Handshake(rw io.ReadWriter, c *Config) (*Transport, error) {
+	hs, err := NewHandshakeState(c)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; !hs.Complete(); i++ {
+		if (i%2 == 0) == c.Initiator {
+			msg, err := hs.WriteMessage(nil)
+			if err != nil {
+				return nil, err
+			}
+			if err := writeFrame(rw, msg); err != nil {
+				return nil, err
+			}
+		} else {
+			msg, err := readFrame(rw)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := hs.ReadMessage(msg); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return NewTransport(rw, hs), nil
+}
+
+//NewTransport returns the transport over rw of a complete handshake
+func NewTransport(rw io.ReadWriter, hs *HandshakeState) *Transport {
+	send, recv := hs.CipherStates()
+	return &Transport{
+		rw:            rw,
+		send:          send,
+		recv:          recv,
+		handshakeHash: hs.HandshakeHash(),
+		peerStatic:    hs.PeerStatic(),
+	}
+}
+
+//maxPlaintext is the largest plaintext that fits in a transport message
+const maxPlaintext = MaxMessageSize - tagSize
+
+//Write encrypts and sends p
+func (t *Transport) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > maxPlaintext {
+			chunk = chunk[:maxPlaintext]
+		}
+		msg, err := t.send.Encrypt(nil, nil, chunk)
+		if err != nil {
+			return n, err
+		}
+		if err := writeFrame(t.rw, msg); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+//Read receives and decrypts data into p
+func (t *Transport) Read(p []byte) (int, error) {
+	for len(t.buf) == 0 {
+		msg, err := readFrame(t.rw)
+		if err != nil {
+			return 0, err
+		}
+		if t.buf, err = t.recv.Decrypt(msg[:0], nil, msg); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, t.buf)
+	t.buf = t.buf[n:]
+	return n, nil
+}
+
+//HandshakeHash returns the hash of the handshake, identical for both parties
+func (t *Transport) HandshakeHash() []byte {
+	return append([]byte{}, t.handshakeHash...)
+}
+
+//PeerStatic returns the static public key of the peer, nil if the pattern does not authenticate it
+func (t *Transport) PeerStatic() []byte {
+	return append([]byte(nil), t.peerStatic...)
+}
@@ -0,0 +1,496 @@
+//Package note implements the signed note format of the Go checksum database (golang.org/x/mod/sumdb/note) with ML-DSA
+//and round 3 Dilithium keys. A note is a text followed by a blank line and one line per signature:
+//
+//	— <key name> <base64(key hash || signature)>
+//
+//The key hash is the first 4 bytes, big-endian, of SHA-256(key name || "\n" || algorithm || public key), where
+//algorithm is a byte identifying the signature scheme. Verifier keys are encoded as
+//"<name>+<hex key hash>+<base64(algorithm || public key)>" and signer keys as
+//"PRIVATE+KEY+<name>+<hex key hash>+<base64(algorithm || seed)>", the seed being the 32 bytes given to KeyGen.
+//
+//Besides Ed25519 (1), the only algorithm of x/mod, keys use the following identifiers, private to this package until
+//identifiers are assigned: 0x11, 0x12 and 0x13 for ML-DSA-44, ML-DSA-65 and ML-DSA-87, 0x21, 0x22 and 0x23 for
+//Dilithium2, Dilithium3 and Dilithium5. Notes signed with Ed25519 and Dilithium keys can be opened by x/mod, which
+//reports the Dilithium signatures as unverified.
+package note
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	"github.com/kudelskisecurity/crystals-go/internal/randutil"
+)
+
+//algEd25519 is the algorithm identifier of Ed25519 keys in x/mod
+const algEd25519 = 1
+
+var algorithms = []struct {
+	id           byte
+	newDilithium func(...bool) *dilithium.Dilithium
+}{
+	{0x11, dilithium.NewMLDSA44},
+	{0x12, dilithium.NewMLDSA65},
+	{0x13, dilithium.NewMLDSA87},
+	{0x21, dilithium.NewDilithium2},
+	{0x22, dilithium.NewDilithium3},
+	{0x23, dilithium.NewDilithium5},
+}
+
+func algorithmID(d *dilithium.Dilithium) (byte, error) {
+	for _, a := range algorithms {
+		if a.newDilithium().Name == d.Name {
+			return a.id, nil
+		}
+	}
+	return 0, errors.New("note: unsupported parameter set " + d.Name)
+}
+
+func algorithmByID(id byte) *dilithium.Dilithium {
+	for _, a := range algorithms {
+		if a.id == id {
+			return a.newDilithium()
+		}
+	}
+	return nil
+}
+
+//Verifier verifies the signatures of a key
+type Verifier interface {
+	//Name returns the name of the key
+	Name() string
+	//KeyHash returns the key hash
+	KeyHash() uint32
+	//Verify reports whether sig is a valid signature of msg
+	Verify(msg, sig []byte) bool
+}
+
+//Signer signs messages with a key
+type Signer interface {
+	//Name returns the name of the key
+	Name() string
+	//KeyHash returns the key hash
+	KeyHash() uint32
+	//Sign returns a signature of msg
+	Sign(msg []byte) ([]byte, error)
+}
+
+//keyHash returns the key hash of an encoded public key, algorithm identifier included
+func keyHash(name string, key []byte) uint32 {
+	h := sha256.New()
+	h.Write([]byte(name + "\n"))
+	h.Write(key)
+	return binary.BigEndian.Uint32(h.Sum(nil))
+}
+
+//isValidName reports whether a key name is valid: not empty, valid UTF-8, without spaces or '+'
+func isValidName(name string) bool {
+	return name != "" && utf8.ValidString(name) && strings.IndexFunc(name, unicode.IsSpace) < 0 && !strings.Contains(name, "+")
+}
+
+var (
+	errVerifierKey   = errors.New("note: malformed verifier key")
+	errSignerKey     = errors.New("note: malformed signer key")
+	errAlgorithm     = errors.New("note: unknown key algorithm")
+	errKeyHash       = errors.New("note: key hash does not match the key")
+	errInvalidName   = errors.New("note: invalid key name")
+	errMalformed     = errors.New("note: malformed note")
+	errInvalidSigner = errors.New("note: invalid signer")
+	errMismatched    = errors.New("note: verifier name or hash does not match the signature")
+)
+
+//parseKey splits "<name>+<hex key hash>+<base64 key>" into its fields
+func parseKey(s string) (name string, hash uint32, key []byte, ok bool) {
+	fields := strings.SplitN(s, "+", 3)
+	if len(fields) != 3 || len(fields[1]) != 8 || !isValidName(fields[0]) {
+		return "", 0, nil, false
+	}
+	h, err := strconv.ParseUint(fields[1], 16, 32)
+	if err != nil {
+		return "", 0, nil, false
+	}
+	key, err = base64.StdEncoding.DecodeString(fields[2])
+	if err != nil || len(key) == 0 {
+		return "", 0, nil, false
+	}
+	return fields[0], uint32(h), key, true
+}
+
+func encodeKey(name string, hash uint32, key []byte) string {
+	return fmt.Sprintf("%s+%08x+%s", name, hash, base64.StdEncoding.EncodeToString(key))
+}
+
+//verifier is a Verifier of a decoded verifier key
+type verifier struct {
+	name   string
+	hash   uint32
+	verify func(msg, sig []byte) bool
+}
+
+func (v *verifier) Name() string                { return v.name }
+func (v *verifier) KeyHash() uint32             { return v.hash }
+func (v *verifier) Verify(msg, sig []byte) bool { return v.verify(msg, sig) }
+
+//NewVerifier decodes a verifier key of a Dilithium or Ed25519 key
+func NewVerifier(vkey string) (Verifier, error) {
+	name, hash, key, ok := parseKey(vkey)
+	if !ok {
+		return nil, errVerifierKey
+	}
+	if keyHash(name, key) != hash {
+		return nil, errKeyHash
+	}
+	v := &verifier{name: name, hash: hash}
+	alg, pk := key[0], key[1:]
+	if alg == algEd25519 {
+		if len(pk) != ed25519.PublicKeySize {
+			return nil, errVerifierKey
+		}
+		v.verify = func(msg, sig []byte) bool { return ed25519.Verify(pk, msg, sig) }
+		return v, nil
+	}
+	d := algorithmByID(alg)
+	if d == nil {
+		return nil, errAlgorithm
+	}
+	if len(pk) != d.SIZEPK() {
+		return nil, errVerifierKey
+	}
+	v.verify = func(msg, sig []byte) bool { return len(sig) == d.SIZESIG() && d.Verify(pk, msg, sig) }
+	return v, nil
+}
+
+//NewVerifierKey returns the verifier key of a packed Dilithium public key
+func NewVerifierKey(d *dilithium.Dilithium, name string, pk []byte) (string, error) {
+	if !isValidName(name) {
+		return "", errInvalidName
+	}
+	alg, err := algorithmID(d)
+	if err != nil {
+		return "", err
+	}
+	if len(pk) != d.SIZEPK() {
+		return "", fmt.Errorf("note: invalid public key size %d, expected %d", len(pk), d.SIZEPK())
+	}
+	key := append([]byte{alg}, pk...)
+	return encodeKey(name, keyHash(name, key), key), nil
+}
+
+//signer is a Signer of a decoded signer key
+type signer struct {
+	name string
+	hash uint32
+	sign func(msg []byte) []byte
+}
+
+func (s *signer) Name() string                    { return s.name }
+func (s *signer) KeyHash() uint32                 { return s.hash }
+func (s *signer) Sign(msg []byte) ([]byte, error) { return s.sign(msg), nil }
+
+//NewSigner decodes a signer key of a Dilithium or Ed25519 key. Dilithium signatures are hedged.
+func NewSigner(skey string) (Signer, error) {
+	if !strings.HasPrefix(skey, "PRIVATE+KEY+") {
+		return nil, errSignerKey
+	}
+	name, hash, key, ok := parseKey(strings.TrimPrefix(skey, "PRIVATE+KEY+"))
+	if !ok {
+		return nil, errSignerKey
+	}
+	s := &signer{name: name, hash: hash}
+	alg, seed := key[0], key[1:]
+	var pk []byte
+	if alg == algEd25519 {
+		if len(seed) != ed25519.SeedSize {
+			return nil, errSignerKey
+		}
+		sk := ed25519.NewKeyFromSeed(seed)
+		pk = sk.Public().(ed25519.PublicKey)
+		s.sign = func(msg []byte) []byte { return ed25519.Sign(sk, msg) }
+	} else {
+		d := algorithmByID(alg)
+		if d == nil {
+			return nil, errAlgorithm
+		}
+		if len(seed) != dilithium.SEEDBYTES {
+			return nil, errSignerKey
+		}
+		var sk []byte
+		pk, sk = d.KeyGen(seed)
+		s.sign = func(msg []byte) []byte { return d.Sign(sk, msg) }
+	}
+	if keyHash(name, append([]byte{alg}, pk...)) != hash {
+		return nil, errKeyHash
+	}
+	return s, nil
+}
+
+//GenerateKey generates a Dilithium key for the given name and returns its signer key, to be kept secret, and its
+//verifier key. If rand is nil, crypto/rand is used.
+func GenerateKey(d *dilithium.Dilithium, rand io.Reader, name string) (skey, vkey string, err error) {
+	seed := make([]byte, dilithium.SEEDBYTES)
+	if _, err := io.ReadFull(randutil.Reader(rand), seed); err != nil {
+		return "", "", err
+	}
+	if !isValidName(name) {
+		return "", "", errInvalidName
+	}
+	alg, err := algorithmID(d)
+	if err != nil {
+		return "", "", err
+	}
+	pk, _ := d.KeyGen(seed)
+	hash := keyHash(name, append([]byte{alg}, pk...))
+	return "PRIVATE+KEY+" + encodeKey(name, hash, append([]byte{alg}, seed...)), encodeKey(name, hash, append([]byte{alg}, pk...)), nil
+}
+
+//Verifiers finds the verifiers of the signatures of a note
+type Verifiers interface {
+	//Verifier returns the verifier of the key with the given name and key hash, or an *UnknownVerifierError
+	Verifier(name string, hash uint32) (Verifier, error)
+}
+
+//UnknownVerifierError is returned by Verifiers for unknown keys. Open records the signatures of unknown keys as
+//unverified.
+type UnknownVerifierError struct {
+	Name    string
+	KeyHash uint32
+}
+
+func (e *UnknownVerifierError) Error() string {
+	return fmt.Sprintf("note: unknown key %s+%08x", e.Name, e.KeyHash)
+}
+
+//AmbiguousVerifierError is returned by the Verifiers of VerifierList when several verifiers have the same name and
+//key hash
+type AmbiguousVerifierError struct {
+	Name    string
+	KeyHash uint32
+}
+
+func (e *AmbiguousVerifierError) Error() string {
+	return fmt.Sprintf("note: ambiguous key %s+%08x", e.Name, e.KeyHash)
+}
+
+type nameHash struct {
+	name string
+	hash uint32
+}
+
+type verifierMap map[nameHash][]Verifier
+
+func (m verifierMap) Verifier(name string, hash uint32) (Verifier, error) {
+	v := m[nameHash{name, hash}]
+	switch len(v) {
+	case 0:
+		return nil, &UnknownVerifierError{name, hash}
+	case 1:
+		return v[0], nil
+	default:
+		return nil, &AmbiguousVerifierError{name, hash}
+	}
+}
+
+//VerifierList returns the Verifiers of a list of verifiers
+func VerifierList(list ...Verifier) Verifiers {
+	m := make(verifierMap)
+	for _, v := range list {
+		k := nameHash{v.Name(), v.KeyHash()}
+		m[k] = append(m[k], v)
+	}
+	return m
+}
+
+//ParseVerifierList decodes verifier keys, one per line. Empty lines and lines starting with '#' are ignored.
+func ParseVerifierList(data []byte) (Verifiers, error) {
+	var list []Verifier
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		v, err := NewVerifier(line)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return VerifierList(list...), nil
+}
+
+//Note is the text of a note and its signatures
+type Note struct {
+	//Text ends with a newline
+	Text string
+	//Sigs are the verified signatures
+	Sigs []Signature
+	//UnverifiedSigs are the signatures of unknown keys
+	UnverifiedSigs []Signature
+}
+
+//Signature is a signature line of a note
+type Signature struct {
+	Name string
+	Hash uint32
+	//Base64 is the encoded key hash and signature
+	Base64 string
+}
+
+//UnverifiedNoteError is returned by Open when no signature of a well-formed note is of a known key
+type UnverifiedNoteError struct {
+	Note *Note
+}
+
+func (e *UnverifiedNoteError) Error() string {
+	return "note: no verifiable signature"
+}
+
+//InvalidSignatureError is returned by Open when the signature of a known key is invalid
+type InvalidSignatureError struct {
+	Name string
+	Hash uint32
+}
+
+func (e *InvalidSignatureError) Error() string {
+	return fmt.Sprintf("note: invalid signature for key %s+%08x", e.Name, e.Hash)
+}
+
+const (
+	sigPrefix = "— "
+	//maxSignatures is the largest number of signature lines parsed by Open
+	maxSignatures = 100
+)
+
+//validText reports whether a text is valid UTF-8 without control characters other than newlines
+func validText(text []byte) bool {
+	for len(text) > 0 {
+		r, size := utf8.DecodeRune(text)
+		if r < 0x20 && r != '\n' || r == utf8.RuneError && size == 1 {
+			return false
+		}
+		text = text[size:]
+	}
+	return true
+}
+
+//Open parses a signed note and verifies the signatures of the known keys. Signatures of keys unknown to known are
+//kept in UnverifiedSigs, an invalid signature of a known key returns an *InvalidSignatureError and a note without
+//any verified signature an *UnverifiedNoteError holding the note.
+func Open(msg []byte, known Verifiers) (*Note, error) {
+	if known == nil {
+		known = VerifierList()
+	}
+	if !validText(msg) {
+		return nil, errMalformed
+	}
+	split := bytes.LastIndex(msg, []byte("\n\n"))
+	if split < 0 {
+		return nil, errMalformed
+	}
+	text, sigs := msg[:split+1], msg[split+2:]
+	if len(sigs) == 0 || sigs[len(sigs)-1] != '\n' {
+		return nil, errMalformed
+	}
+	n := &Note{Text: string(text)}
+	lines := strings.Split(string(sigs[:len(sigs)-1]), "\n")
+	if len(lines) > maxSignatures {
+		return nil, errMalformed
+	}
+	seen := make(map[nameHash]bool)
+	seenUnverified := make(map[string]bool)
+	for _, line := range lines {
+		if !strings.HasPrefix(line, sigPrefix) {
+			return nil, errMalformed
+		}
+		line = line[len(sigPrefix):]
+		name, b64 := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			name, b64 = line[:i], line[i+1:]
+		}
+		sig, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil || !isValidName(name) || len(sig) < 5 {
+			return nil, errMalformed
+		}
+		hash := binary.BigEndian.Uint32(sig)
+		sig = sig[4:]
+
+		v, err := known.Verifier(name, hash)
+		if _, ok := err.(*UnknownVerifierError); ok {
+			if !seenUnverified[line] {
+				seenUnverified[line] = true
+				n.UnverifiedSigs = append(n.UnverifiedSigs, Signature{name, hash, b64})
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if v.Name() != name || v.KeyHash() != hash {
+			return nil, errMismatched
+		}
+		if seen[nameHash{name, hash}] {
+			continue
+		}
+		seen[nameHash{name, hash}] = true
+		if !v.Verify(text, sig) {
+			return nil, &InvalidSignatureError{name, hash}
+		}
+		n.Sigs = append(n.Sigs, Signature{name, hash, b64})
+	}
+	if len(n.Sigs) == 0 {
+		return nil, &UnverifiedNoteError{n}
+	}
+	return n, nil
+}
+
+//Sign signs the text of a note with the signers and returns the signed note. The signatures of n.Sigs and
+//n.UnverifiedSigs come first, except those of the signers' keys which are replaced.
+func Sign(n *Note, signers ...Signer) ([]byte, error) {
+	if !strings.HasSuffix(n.Text, "\n") || !validText([]byte(n.Text)) {
+		return nil, errMalformed
+	}
+	var sigs bytes.Buffer
+	replaced := make(map[nameHash]bool)
+	for _, s := range signers {
+		name, hash := s.Name(), s.KeyHash()
+		if !isValidName(name) {
+			return nil, errInvalidSigner
+		}
+		replaced[nameHash{name, hash}] = true
+		sig, err := s.Sign([]byte(n.Text))
+		if err != nil {
+			return nil, err
+		}
+		line := make([]byte, 4, 4+len(sig))
+		binary.BigEndian.PutUint32(line, hash)
+		sigs.WriteString(sigPrefix + name + " " + base64.StdEncoding.EncodeToString(append(line, sig...)) + "\n")
+	}
+
+	b := bytes.NewBufferString(n.Text + "\n")
+	for _, list := range [][]Signature{n.Sigs, n.UnverifiedSigs} {
+		for _, sig := range list {
+			if !isValidName(sig.Name) {
+				return nil, errMalformed
+			}
+			if replaced[nameHash{sig.Name, sig.Hash}] {
+				continue
+			}
+			raw, err := base64.StdEncoding.DecodeString(sig.Base64)
+			if err != nil || len(raw) < 5 || binary.BigEndian.Uint32(raw) != sig.Hash {
+				return nil, errMalformed
+			}
+			b.WriteString(sigPrefix + sig.Name + " " + sig.Base64 + "\n")
+		}
+	}
+	b.Write(sigs.Bytes())
+	return b.Bytes(), nil
+}
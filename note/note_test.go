@@ -0,0 +1,169 @@
+package note
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+)
+
+const text = "If you think cryptography is the answer to your problem,\nthen you don't know what your problem is.\n"
+
+//Ed25519 keys and signature of the tests of golang.org/x/mod/sumdb/note
+const (
+	peterVKey = "PeterNeumann+c74f20a3+ARpc2QcUPDhMQegwxbzhKqiBfsVkmqq/LDE4izWy10TW"
+	peterSKey = "PRIVATE+KEY+PeterNeumann+c74f20a3+AYEKFALVFGyNhPJEMzD1QIDr+Y7hfZx09iUvxdXHKDFz"
+	peterSig  = "— PeterNeumann x08go/ZJkuBS9UG/SffcvIAQxVBtiFupLLr8pAcElZInNIuGUgYN1FFYC2pZSNXgKvqfqdngotpRZb6KE6RyyBwJnAM=\n"
+)
+
+func TestEd25519(t *testing.T) {
+	signer, err := NewSigner(peterSKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := Sign(&Note{Text: text}, signer)
+	if err != nil || string(msg) != text+"\n"+peterSig {
+		t.Fatal("unexpected signed note", string(msg), err)
+	}
+	v, err := NewVerifier(peterVKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := Open(msg, VerifierList(v)); err != nil || n.Text != text || len(n.Sigs) != 1 || n.Sigs[0].Hash != 0xc74f20a3 {
+		t.Fatal("note not opened", err)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	for _, d := range []*dilithium.Dilithium{dilithium.NewMLDSA44(), dilithium.NewMLDSA65(), dilithium.NewMLDSA87(),
+		dilithium.NewDilithium2(), dilithium.NewDilithium3(), dilithium.NewDilithium5()} {
+		skey, vkey, err := GenerateKey(d, nil, "log.example.com/"+d.Name)
+		if err != nil {
+			t.Fatal(d.Name, err)
+		}
+		signer, err := NewSigner(skey)
+		if err != nil {
+			t.Fatal(d.Name, err)
+		}
+		v, err := NewVerifier(vkey)
+		if err != nil {
+			t.Fatal(d.Name, err)
+		}
+		if v.Name() != signer.Name() || v.KeyHash() != signer.KeyHash() || !strings.HasPrefix(skey, "PRIVATE+KEY+"+v.Name()+"+") {
+			t.Fatal(d.Name, "signer and verifier keys differ")
+		}
+		sig, _ := signer.Sign([]byte(text))
+		if !v.Verify([]byte(text), sig) || v.Verify([]byte(text[1:]), sig) {
+			t.Fatal(d.Name, "unexpected verification")
+		}
+	}
+
+	d := dilithium.NewMLDSA44()
+	pk, _ := d.KeyGen(nil)
+	vkey, err := NewVerifierKey(d, "log", pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewVerifierKey(d, "log", pk[1:]); err == nil {
+		t.Fatal("short public key accepted")
+	}
+	if _, err := NewVerifierKey(d, "log name", pk); err == nil {
+		t.Fatal("invalid name accepted")
+	}
+	if _, err := NewVerifierKey(dilithium.NewDilithiumUnsafe(0, 0, 0, 0, 0, 0, 0, 0, 0), "log", pk); err == nil {
+		t.Fatal("custom parameter set accepted")
+	}
+	for _, bad := range []string{
+		"other" + vkey[3:],
+		strings.Replace(vkey, "+", "+0", 1),
+		vkey[:len(vkey)-8] + "AAAAAAAA",
+		"log+00000000+",
+		strings.Replace(peterVKey, "+ARpc", "+AhRpc", 1),
+	} {
+		if _, err := NewVerifier(bad); err == nil {
+			t.Fatal("malformed verifier key accepted", bad)
+		}
+	}
+	if _, err := NewSigner(strings.TrimPrefix(peterSKey, "PRIVATE+")); err == nil {
+		t.Fatal("malformed signer key accepted")
+	}
+	if _, err := NewSigner(strings.Replace(peterSKey, "c74f20a3", "c74f20a4", 1)); err != errKeyHash {
+		t.Fatal("signer key with a wrong hash accepted", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	skey, vkey, _ := GenerateKey(dilithium.NewMLDSA65(), nil, "log.example.com")
+	signer, _ := NewSigner(skey)
+	v, _ := NewVerifier(vkey)
+	peterSigner, _ := NewSigner(peterSKey)
+	peter, _ := NewVerifier(peterVKey)
+
+	msg, err := Sign(&Note{Text: text}, signer, peterSigner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := Open(msg, VerifierList(v, peter))
+	if err != nil || len(n.Sigs) != 2 || len(n.UnverifiedSigs) != 0 {
+		t.Fatal("note not opened", err)
+	}
+	n, err = Open(msg, VerifierList(v))
+	if err != nil || len(n.Sigs) != 1 || n.Sigs[0].Name != "log.example.com" || len(n.UnverifiedSigs) != 1 {
+		t.Fatal("unexpected signatures", err)
+	}
+
+	//a witness adds its signature, replacing its previous one
+	cosigned, err := Sign(n, peterSigner)
+	if err != nil || !bytes.Equal(cosigned, msg) {
+		t.Fatal("unexpected cosigned note", err)
+	}
+
+	_, err = Open(msg, VerifierList(peter, peter))
+	if _, ok := err.(*AmbiguousVerifierError); !ok {
+		t.Fatal("ambiguous verifiers accepted", err)
+	}
+	_, err = Open(msg, nil)
+	if e, ok := err.(*UnverifiedNoteError); !ok || len(e.Note.UnverifiedSigs) != 2 {
+		t.Fatal("note without a known key opened", err)
+	}
+	tampered := bytes.Replace(msg, []byte("problem"), []byte("program"), 1)
+	if _, err = Open(tampered, VerifierList(v)); err == nil || err.Error() != (&InvalidSignatureError{v.Name(), v.KeyHash()}).Error() {
+		t.Fatal("tampered note opened", err)
+	}
+
+	for _, bad := range []string{
+		text + peterSig,
+		text + "\n" + peterSig[:len(peterSig)-1],
+		text + "\n" + strings.TrimPrefix(peterSig, "— "),
+		"\x01" + text + "\n" + peterSig,
+		text + "\n" + strings.Repeat(peterSig, 101),
+	} {
+		if _, err := Open([]byte(bad), VerifierList(peter)); err != errMalformed {
+			t.Fatal("malformed note opened", err)
+		}
+	}
+	if _, err := Sign(&Note{Text: "no newline"}, signer); err == nil {
+		t.Fatal("text without a final newline signed")
+	}
+	if _, err := Sign(&Note{Text: text, Sigs: []Signature{{"PeterNeumann", 0xc74f20a3, "BADHASH="}}}); err == nil {
+		t.Fatal("signature with a wrong hash kept")
+	}
+}
+
+func TestParseVerifierList(t *testing.T) {
+	_, vkey, _ := GenerateKey(dilithium.NewMLDSA87(), nil, "log.example.com")
+	list, err := ParseVerifierList([]byte("# witnesses\n" + peterVKey + "\n\n" + vkey + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := list.Verifier("PeterNeumann", 0xc74f20a3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := list.Verifier("PeterNeumann", 0); err == nil {
+		t.Fatal("unknown key found")
+	}
+	if _, err := ParseVerifierList([]byte(peterVKey + "x\n")); err == nil {
+		t.Fatal("malformed list accepted")
+	}
+}
@@ -0,0 +1,386 @@
+package openpgp
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/internal/keywrap"
+	"github.com/kudelskisecurity/crystals-go/internal/ocb"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	pkeskVersion = 6
+	seipdVersion = 2
+)
+
+//Symmetric and AEAD algorithms
+const (
+	cipherAES128 = 7
+	cipherAES192 = 8
+	cipherAES256 = 9
+	aeadOCB      = 2
+	aeadGCM      = 3
+)
+
+//chunkSizeOctet gives chunks of 2^(6+12) = 256 KiB
+const chunkSizeOctet = 12
+
+//kdfDomain is the domain separation string of the key combiner of the draft
+const kdfDomain = "OpenPGPCompositeKDFv1"
+
+var errNotRecipient = errors.New("openpgp: session key encrypted to another key")
+
+//combine is the key combiner of the draft: SHA3-256 of both shared secrets, the X25519 ciphertext and public key,
+//the algorithm and the domain separation string followed by its length
+func combine(mlkemSS, ecdhSS, ecdhCT, ecdhPK []byte, alg byte) []byte {
+	h := sha3.New256()
+	h.Write(mlkemSS)
+	h.Write(ecdhSS)
+	h.Write(ecdhCT)
+	h.Write(ecdhPK)
+	h.Write([]byte{alg})
+	h.Write([]byte(kdfDomain))
+	h.Write([]byte{byte(len(kdfDomain))})
+	return h.Sum(nil)
+}
+
+//x25519KEK is the key encryption key of RFC 9580 for X25519 keys: HKDF-SHA256 of the ephemeral and recipient public
+//keys followed by the shared secret
+func x25519KEK(ecdhCT, ecdhPK, ecdhSS []byte) ([]byte, error) {
+	kek := make([]byte, 16)
+	ikm := append(append(append([]byte{}, ecdhCT...), ecdhPK...), ecdhSS...)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, nil, []byte("OpenPGP X25519")), kek); err != nil {
+		return nil, err
+	}
+	return kek, nil
+}
+
+//encapsulate returns the X25519 ephemeral public key, the ML-KEM ciphertext and the key encryption key for an
+//ML-KEM-768+X25519 key. The ML-KEM ciphertext is nil for an X25519 key.
+func encapsulate(rand io.Reader, k *Key) ([]byte, []byte, []byte, error) {
+	eph := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand, eph); err != nil {
+		return nil, nil, nil, err
+	}
+	ecdhCT, err := curve25519.X25519(eph, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ecdhPK := k.PublicKey[:curve25519.PointSize]
+	ecdhSS, err := curve25519.X25519(eph, ecdhPK)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if k.Algorithm == PubKeyAlgoX25519 {
+		kek, err := x25519KEK(ecdhCT, ecdhPK, ecdhSS)
+		return ecdhCT, nil, kek, err
+	}
+	mlkemCT, mlkemSS := kyber.NewMLKEM768().Encaps(k.PublicKey[curve25519.PointSize:], nil)
+	if mlkemSS == nil {
+		return nil, nil, nil, errors.New("openpgp: encapsulation failed")
+	}
+	return ecdhCT, mlkemCT, combine(mlkemSS, ecdhSS, ecdhCT, ecdhPK, k.Algorithm), nil
+}
+
+//decapsulate returns the key encryption key of the ciphertexts for a secret ML-KEM-768+X25519 or X25519 key
+func decapsulate(k *Key, ecdhCT, mlkemCT []byte) ([]byte, error) {
+	ecdhSS, err := curve25519.X25519(k.PrivateKey[:curve25519.ScalarSize], ecdhCT)
+	if err != nil {
+		return nil, err
+	}
+	if k.Algorithm == PubKeyAlgoX25519 {
+		return x25519KEK(ecdhCT, k.PublicKey, ecdhSS)
+	}
+	mlkem := kyber.NewMLKEM768()
+	_, sk := mlkem.KeyGen(k.PrivateKey[curve25519.ScalarSize:])
+	mlkemSS := mlkem.Decaps(sk, mlkemCT)
+	if mlkemSS == nil {
+		return nil, errors.New("openpgp: decapsulation failed")
+	}
+	return combine(mlkemSS, ecdhSS, ecdhCT, k.PublicKey[:curve25519.PointSize], k.Algorithm), nil
+}
+
+//encryptSessionKey returns the body of a v6 public-key encrypted session key packet for the subkey
+func encryptSessionKey(rand io.Reader, k *Key, sessionKey []byte) ([]byte, error) {
+	ecdhCT, mlkemCT, kek, err := encapsulate(rand, k)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := keywrap.Wrap(kek, sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	b := append([]byte{pkeskVersion, 1 + 32, keyVersion}, k.Fingerprint()...)
+	b = append(append(append(b, k.Algorithm), ecdhCT...), mlkemCT...)
+	return append(append(b, byte(len(wrapped))), wrapped...), nil
+}
+
+//decryptSessionKey recovers the session key of a v6 public-key encrypted session key packet. It returns
+//errNotRecipient if the packet is for another key.
+func decryptSessionKey(k *Key, body []byte) ([]byte, error) {
+	if len(body) < 2 || body[0] != pkeskVersion || len(body) < 3+int(body[1]) {
+		return nil, errNotRecipient
+	}
+	if n := int(body[1]); n != 0 && (n != 1+32 || body[2] != keyVersion || !bytes.Equal(body[3:2+n], k.Fingerprint())) {
+		return nil, errNotRecipient
+	}
+	body = body[2+int(body[1]):]
+	if body[0] != k.Algorithm {
+		return nil, errNotRecipient
+	}
+	body = body[1:]
+	ctSize := 0
+	if k.Algorithm == PubKeyAlgoMLKEM768X25519 {
+		ctSize = kyber.NewMLKEM768().SIZEC()
+	}
+	if len(body) < curve25519.PointSize+ctSize+1 || int(body[curve25519.PointSize+ctSize]) != len(body)-curve25519.PointSize-ctSize-1 {
+		return nil, errors.New("openpgp: malformed encrypted session key")
+	}
+	kek, err := decapsulate(k, body[:curve25519.PointSize], body[curve25519.PointSize:curve25519.PointSize+ctSize])
+	if err != nil {
+		return nil, err
+	}
+	sessionKey, err := keywrap.Unwrap(kek, body[curve25519.PointSize+ctSize+1:])
+	if err != nil {
+		return nil, errors.New("openpgp: session key decryption failed")
+	}
+	return sessionKey, nil
+}
+
+//newAEAD derives the message key and IV of an encrypted data packet from the session key, with HKDF-SHA256 whose info
+//is the packet header. The IV is the nonce without the 8 bytes of the chunk index.
+func newAEAD(sessionKey, salt, header []byte) (cipher.AEAD, []byte, error) {
+	keySize := map[byte]int{cipherAES128: 16, cipherAES192: 24, cipherAES256: 32}[header[2]]
+	nonceSize := map[byte]int{aeadOCB: 15, aeadGCM: 12}[header[3]]
+	if keySize == 0 || nonceSize == 0 {
+		return nil, nil, errors.New("openpgp: unsupported encryption algorithm")
+	}
+	if len(sessionKey) != keySize {
+		return nil, nil, errors.New("openpgp: invalid session key size")
+	}
+	r := hkdf.New(sha256.New, sessionKey, salt, header)
+	key := make([]byte, keySize)
+	iv := make([]byte, nonceSize-8)
+	if _, err := io.ReadFull(r, key); err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.ReadFull(r, iv); err != nil {
+		return nil, nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	var aead cipher.AEAD
+	if header[3] == aeadOCB {
+		aead, err = ocb.New(block, nonceSize)
+	} else {
+		aead, err = cipher.NewGCM(block)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, iv, nil
+}
+
+//chunkNonce returns the nonce of a chunk: the IV followed by the chunk index
+func chunkNonce(iv []byte, i uint64) []byte {
+	nonce := make([]byte, len(iv)+8)
+	copy(nonce, iv)
+	binary.BigEndian.PutUint64(nonce[len(iv):], i)
+	return nonce
+}
+
+//finalAAD returns the additional data of the final authentication tag: the header followed by the plaintext size
+func finalAAD(header []byte, size int) []byte {
+	aad := make([]byte, len(header)+8)
+	copy(aad, header)
+	binary.BigEndian.PutUint64(aad[len(header):], uint64(size))
+	return aad
+}
+
+//encryptData returns the body of a version 2 encrypted data packet of the plaintext with AES-256-GCM
+func encryptData(rand io.Reader, sessionKey, plaintext []byte) ([]byte, error) {
+	header := []byte{0xc0 | tagSEIPD, seipdVersion, cipherAES256, aeadGCM, chunkSizeOctet}
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand, salt); err != nil {
+		return nil, err
+	}
+	aead, iv, err := newAEAD(sessionKey, salt, header)
+	if err != nil {
+		return nil, err
+	}
+	out := append(append([]byte{}, header[1:]...), salt...)
+	chunkSize := 1 << (chunkSizeOctet + 6)
+	i := uint64(0)
+	for off := 0; off < len(plaintext); off += chunkSize {
+		end := off + chunkSize
+		if end > len(plaintext) {
+			end = len(plaintext)
+		}
+		out = aead.Seal(out, chunkNonce(iv, i), plaintext[off:end], header)
+		i++
+	}
+	return aead.Seal(out, chunkNonce(iv, i), nil, finalAAD(header, len(plaintext))), nil
+}
+
+//decryptData decrypts the body of a version 2 encrypted data packet and checks every chunk and the final tag
+func decryptData(sessionKey, body []byte) ([]byte, error) {
+	if len(body) < 4 || body[0] != seipdVersion {
+		return nil, errors.New("openpgp: unsupported encrypted data version")
+	}
+	if body[3] > 16 || len(body) < 4+32+16 {
+		return nil, errors.New("openpgp: malformed encrypted data")
+	}
+	header := append([]byte{0xc0 | tagSEIPD}, body[:4]...)
+	aead, iv, err := newAEAD(sessionKey, body[4:36], header)
+	if err != nil {
+		return nil, err
+	}
+	data := body[36:]
+	chunkSize := 1<<(body[3]+6) + aead.Overhead()
+	var plaintext []byte
+	i := uint64(0)
+	for len(data) > aead.Overhead() {
+		n := chunkSize
+		if n > len(data)-aead.Overhead() {
+			n = len(data) - aead.Overhead()
+		}
+		if n <= aead.Overhead() {
+			return nil, errors.New("openpgp: malformed encrypted data")
+		}
+		if plaintext, err = aead.Open(plaintext, chunkNonce(iv, i), data[:n], header); err != nil {
+			return nil, errors.New("openpgp: decryption failed")
+		}
+		data = data[n:]
+		i++
+	}
+	if len(data) != aead.Overhead() {
+		return nil, errors.New("openpgp: malformed encrypted data")
+	}
+	if _, err := aead.Open(nil, chunkNonce(iv, i), data, finalAAD(header, len(plaintext))); err != nil {
+		return nil, errors.New("openpgp: decryption failed")
+	}
+	return plaintext, nil
+}
+
+//readLiteral returns the content of the literal data packet of a decrypted message
+func readLiteral(data []byte) ([]byte, error) {
+	var content []byte
+	for len(data) > 0 {
+		tag, body, rest, err := readPacket(data)
+		if err != nil {
+			return nil, err
+		}
+		data = rest
+		switch tag {
+		case tagLiteralData:
+			if content != nil {
+				return nil, errors.New("openpgp: more than one literal data packet")
+			}
+			if len(body) < 6 || len(body) < 6+int(body[1]) {
+				return nil, errors.New("openpgp: malformed literal data")
+			}
+			content = body[6+int(body[1]):]
+		case tagPadding:
+		case tagCompressed:
+			return nil, errors.New("openpgp: compressed data is not supported")
+		default:
+			return nil, errors.New("openpgp: unexpected packet in encrypted data")
+		}
+	}
+	if content == nil {
+		return nil, errors.New("openpgp: missing literal data")
+	}
+	return content, nil
+}
+
+//Encrypt returns a binary message of the plaintext for the recipients: a random session key encrypted to the
+//encryption subkey of each recipient, and the plaintext in a binary literal data packet encrypted with AES-256-GCM.
+//Use Armor with BlockMessage for an armored message.
+func Encrypt(plaintext []byte, recipients ...*Entity) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("openpgp: no recipient")
+	}
+	sessionKey := make([]byte, 32)
+	if _, err := io.ReadFull(cryptorand.Reader, sessionKey); err != nil {
+		return nil, err
+	}
+	var b []byte
+	for _, r := range recipients {
+		if r.Subkey == nil {
+			return nil, errors.New("openpgp: recipient without encryption subkey")
+		}
+		if r.expired(time.Now()) {
+			return nil, errors.New("openpgp: recipient key expired")
+		}
+		body, err := encryptSessionKey(cryptorand.Reader, r.Subkey, sessionKey)
+		if err != nil {
+			return nil, err
+		}
+		b = appendPacket(b, tagPKESK, body)
+	}
+	//binary format, no file name and no date
+	literal := append([]byte{'b', 0, 0, 0, 0, 0}, plaintext...)
+	body, err := encryptData(cryptorand.Reader, sessionKey, appendPacket(nil, tagLiteralData, literal))
+	if err != nil {
+		return nil, err
+	}
+	return appendPacket(b, tagSEIPD, body), nil
+}
+
+//Decrypt decrypts a message, binary or armored, with the secret encryption subkey of the entity and returns the
+//content of its literal data packet
+func Decrypt(msg []byte, key *Entity) ([]byte, error) {
+	if key.Subkey == nil || key.Subkey.PrivateKey == nil {
+		return nil, errors.New("openpgp: missing secret encryption subkey")
+	}
+	data, err := unarmor(msg, BlockMessage)
+	if err != nil {
+		return nil, err
+	}
+	var sessionKey []byte
+	for len(data) > 0 {
+		var tag byte
+		var body []byte
+		if tag, body, data, err = readPacket(data); err != nil {
+			return nil, err
+		}
+		switch tag {
+		case tagPKESK:
+			if sessionKey != nil {
+				continue
+			}
+			if sessionKey, err = decryptSessionKey(key.Subkey, body); err != nil && err != errNotRecipient {
+				return nil, err
+			}
+		case tagSEIPD:
+			if len(data) != 0 {
+				return nil, errors.New("openpgp: data after the encrypted data packet")
+			}
+			if sessionKey == nil {
+				return nil, errors.New("openpgp: message not encrypted to this key")
+			}
+			plaintext, err := decryptData(sessionKey, body)
+			if err != nil {
+				return nil, err
+			}
+			return readLiteral(plaintext)
+		case tagSKESK, tagMarker, tagPadding:
+		default:
+			return nil, errors.New("openpgp: unexpected packet in message")
+		}
+	}
+	return nil, errors.New("openpgp: missing encrypted data")
+}
@@ -0,0 +1,402 @@
+package openpgp
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+	"time"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/internal/randutil"
+	"golang.org/x/crypto/curve25519"
+)
+
+const keyVersion = 6
+
+var errUnsupportedAlgorithm = errors.New("openpgp: unsupported public key algorithm")
+
+//Key is a v6 primary key or subkey, with its secret key material if known. The public key material of a composite key
+//is the Ed25519 or X25519 public key followed by the ML-DSA-65 or ML-KEM-768 public key, the secret key material the
+//Ed25519 or X25519 secret key followed by the ML-DSA or ML-KEM key generation seed, as in the key packets. Ed25519 and
+//X25519 keys only have the first part.
+type Key struct {
+	Algorithm    byte
+	CreationTime time.Time
+	PublicKey    []byte
+	PrivateKey   []byte
+}
+
+//keySizes returns the sizes of the public and secret key material of an algorithm
+func keySizes(alg byte) (int, int, bool) {
+	switch alg {
+	case PubKeyAlgoMLDSA65Ed25519:
+		return ed25519.PublicKeySize + dilithium.NewMLDSA65().SIZEPK(), ed25519.SeedSize + dilithium.SEEDBYTES, true
+	case PubKeyAlgoMLKEM768X25519:
+		return curve25519.PointSize + kyber.NewMLKEM768().SIZEPK(), curve25519.ScalarSize + kyber.SEEDBYTES + kyber.SIZEZ, true
+	case PubKeyAlgoEd25519:
+		return ed25519.PublicKeySize, ed25519.SeedSize, true
+	case PubKeyAlgoX25519:
+		return curve25519.PointSize, curve25519.ScalarSize, true
+	}
+	return 0, 0, false
+}
+
+//publicKey returns the public key material of secret key material of the right size
+func publicKey(alg byte, priv []byte) ([]byte, error) {
+	switch alg {
+	case PubKeyAlgoMLDSA65Ed25519:
+		pub := ed25519.NewKeyFromSeed(priv[:ed25519.SeedSize]).Public().(ed25519.PublicKey)
+		pk, _ := dilithium.NewMLDSA65().KeyGen(priv[ed25519.SeedSize:])
+		return append(append([]byte{}, pub...), pk...), nil
+	case PubKeyAlgoMLKEM768X25519:
+		pub, err := curve25519.X25519(priv[:curve25519.ScalarSize], curve25519.Basepoint)
+		if err != nil {
+			return nil, err
+		}
+		pk, _ := kyber.NewMLKEM768().KeyGen(priv[curve25519.ScalarSize:])
+		return append(pub, pk...), nil
+	case PubKeyAlgoEd25519:
+		return append([]byte{}, ed25519.NewKeyFromSeed(priv).Public().(ed25519.PublicKey)...), nil
+	case PubKeyAlgoX25519:
+		return curve25519.X25519(priv, curve25519.Basepoint)
+	}
+	return nil, errUnsupportedAlgorithm
+}
+
+//newKey generates a key of an algorithm
+func newKey(alg byte, rand io.Reader, created time.Time) (*Key, error) {
+	_, privateSize, _ := keySizes(alg)
+	k := &Key{Algorithm: alg, CreationTime: created, PrivateKey: make([]byte, privateSize)}
+	if _, err := io.ReadFull(rand, k.PrivateKey); err != nil {
+		return nil, err
+	}
+	var err error
+	if k.PublicKey, err = publicKey(alg, k.PrivateKey); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+//body returns the body of the public key packet
+func (k *Key) body() []byte {
+	b := make([]byte, 10, 10+len(k.PublicKey))
+	b[0] = keyVersion
+	binary.BigEndian.PutUint32(b[1:5], uint32(k.CreationTime.Unix()))
+	b[5] = k.Algorithm
+	binary.BigEndian.PutUint32(b[6:10], uint32(len(k.PublicKey)))
+	return append(b, k.PublicKey...)
+}
+
+//secretBody returns the body of the secret key packet, with the secret key material unencrypted
+func (k *Key) secretBody() []byte {
+	return append(append(k.body(), 0), k.PrivateKey...)
+}
+
+//hashKey writes the key to a signature hash
+func hashKey(h hash.Hash, k *Key) {
+	body := k.body()
+	var prefix [5]byte
+	prefix[0] = 0x9b
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(body)))
+	h.Write(prefix[:])
+	h.Write(body)
+}
+
+//Fingerprint returns the v6 fingerprint of the key, the SHA-256 hash of its public key packet
+func (k *Key) Fingerprint() []byte {
+	h := sha256.New()
+	hashKey(h, k)
+	return h.Sum(nil)
+}
+
+//KeyID returns the key ID, the first 8 bytes of the fingerprint
+func (k *Key) KeyID() uint64 {
+	return binary.BigEndian.Uint64(k.Fingerprint())
+}
+
+//public returns a copy of the key without the secret key material
+func (k *Key) public() *Key {
+	p := *k
+	p.PrivateKey = nil
+	return &p
+}
+
+//parseKey decodes a public or secret key packet body and checks that the secret key material matches the public one
+func parseKey(body []byte, secret bool) (*Key, error) {
+	if len(body) < 10 || body[0] != keyVersion {
+		return nil, errors.New("openpgp: unsupported key version")
+	}
+	k := &Key{Algorithm: body[5], CreationTime: time.Unix(int64(binary.BigEndian.Uint32(body[1:5])), 0)}
+	publicSize, privateSize, ok := keySizes(k.Algorithm)
+	if !ok {
+		return nil, errUnsupportedAlgorithm
+	}
+	if int(binary.BigEndian.Uint32(body[6:10])) != publicSize || len(body) < 10+publicSize {
+		return nil, errors.New("openpgp: invalid public key material")
+	}
+	k.PublicKey = append([]byte{}, body[10:10+publicSize]...)
+	rest := body[10+publicSize:]
+	if !secret {
+		if len(rest) != 0 {
+			return nil, errors.New("openpgp: trailing data in public key packet")
+		}
+		return k, nil
+	}
+	if len(rest) == 0 || rest[0] != 0 {
+		return nil, errors.New("openpgp: encrypted secret keys are not supported")
+	}
+	if len(rest) != 1+privateSize {
+		return nil, errors.New("openpgp: invalid secret key material")
+	}
+	k.PrivateKey = append([]byte{}, rest[1:]...)
+	pub, err := publicKey(k.Algorithm, k.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(pub, k.PublicKey) {
+		return nil, errors.New("openpgp: secret key does not match the public key")
+	}
+	return k, nil
+}
+
+//Entity is a transferable v6 key: an ML-DSA-65+Ed25519 or Ed25519 primary key, an optional user ID and an
+//ML-KEM-768+X25519 or X25519 encryption subkey, with their self-signatures
+type Entity struct {
+	PrimaryKey *Key
+	UserID     string
+	Subkey     *Key
+	//self-signature packet bodies
+	directSignature []byte
+	userIDSignature []byte
+	subkeySignature []byte
+	//flags are the key flags of the direct-key signature
+	flags byte
+	//expires is the expiration time of the key, zero if the key does not expire
+	expires time.Time
+}
+
+//GenerateKey creates a transferable key, with a user ID if not empty. If rand is nil, crypto/rand is used.
+func GenerateKey(userID string, rand io.Reader) (*Entity, error) {
+	rand = randutil.Reader(rand)
+	created := time.Unix(time.Now().Unix(), 0)
+	primary, err := newKey(PubKeyAlgoMLDSA65Ed25519, rand, created)
+	if err != nil {
+		return nil, err
+	}
+	subkey, err := newKey(PubKeyAlgoMLKEM768X25519, rand, created)
+	if err != nil {
+		return nil, err
+	}
+	e := &Entity{PrimaryKey: primary, UserID: userID, Subkey: subkey, flags: flagCertify | flagSign}
+	e.directSignature, err = primary.sign(rand, sigDirectKey, created, [][]byte{
+		subpacket(spKeyFlags, e.flags),
+		subpacket(spFeatures, featureSEIPDv2),
+		subpacket(spPreferredSymmetric, cipherAES256),
+		subpacket(spPreferredHash, hashSHA3256, hashSHA512),
+		subpacket(spPreferredAEAD, cipherAES256, aeadGCM),
+	}, func(h hash.Hash) error {
+		hashKey(h, primary)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if userID != "" {
+		e.userIDSignature, err = primary.sign(rand, sigPositiveCertification, created, nil, func(h hash.Hash) error {
+			hashKey(h, primary)
+			hashUserID(h, userID)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	e.subkeySignature, err = primary.sign(rand, sigSubkeyBinding, created, [][]byte{
+		subpacket(spKeyFlags, flagEncryptCommunications|flagEncryptStorage),
+	}, func(h hash.Hash) error {
+		hashKey(h, primary)
+		hashKey(h, subkey)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+//Public returns a copy of the entity without the secret key material
+func (e *Entity) Public() *Entity {
+	p := *e
+	p.PrimaryKey = e.PrimaryKey.public()
+	if e.Subkey != nil {
+		p.Subkey = e.Subkey.public()
+	}
+	return &p
+}
+
+//prefers reports whether an encryption subkey is better than the current one: any subkey if there is none yet, an
+//ML-KEM-768+X25519 subkey rather than an X25519 one
+func (e *Entity) prefers(k *Key) bool {
+	return e.Subkey == nil || e.Subkey.Algorithm != PubKeyAlgoMLKEM768X25519 && k.Algorithm == PubKeyAlgoMLKEM768X25519
+}
+
+//expired reports whether the key is expired at a given time
+func (e *Entity) expired(t time.Time) bool {
+	return !e.expires.IsZero() && !t.Before(e.expires)
+}
+
+//Serialize returns the binary transferable key: a secret key if the secret key material of the primary key is
+//known, a public key otherwise. Use Armor with BlockPrivateKey or BlockPublicKey for an armored key.
+func (e *Entity) Serialize() []byte {
+	var b []byte
+	if e.PrimaryKey.PrivateKey != nil {
+		b = appendPacket(b, tagSecretKey, e.PrimaryKey.secretBody())
+	} else {
+		b = appendPacket(b, tagPublicKey, e.PrimaryKey.body())
+	}
+	b = appendPacket(b, tagSignature, e.directSignature)
+	if e.userIDSignature != nil {
+		b = appendPacket(b, tagUserID, []byte(e.UserID))
+		b = appendPacket(b, tagSignature, e.userIDSignature)
+	}
+	if e.Subkey != nil {
+		if e.Subkey.PrivateKey != nil && e.PrimaryKey.PrivateKey != nil {
+			b = appendPacket(b, tagSecretSubkey, e.Subkey.secretBody())
+		} else {
+			b = appendPacket(b, tagPublicSubkey, e.Subkey.body())
+		}
+		b = appendPacket(b, tagSignature, e.subkeySignature)
+	}
+	return b
+}
+
+//ReadKey reads a transferable public or secret key, binary or armored, and checks its self-signatures. Additional
+//user IDs, subkeys of other algorithms and components without a valid self-signature are skipped. An ML-KEM-768+X25519
+//encryption subkey is preferred to an X25519 one. Revoked keys are rejected.
+func ReadKey(data []byte) (*Entity, error) {
+	data, err := unarmor(data, BlockPublicKey, BlockPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	tag, body, data, err := readPacket(data)
+	if err != nil {
+		return nil, err
+	}
+	if tag != tagPublicKey && tag != tagSecretKey {
+		return nil, errors.New("openpgp: not a key")
+	}
+	primary, err := parseKey(body, tag == tagSecretKey)
+	if err != nil {
+		return nil, err
+	}
+	if primary.Algorithm != PubKeyAlgoMLDSA65Ed25519 && primary.Algorithm != PubKeyAlgoEd25519 {
+		return nil, errors.New("openpgp: primary key is not a signing key")
+	}
+	e := &Entity{PrimaryKey: primary}
+
+	//the component whose signatures follow
+	const (
+		inPrimary = iota
+		inUserID
+		inSubkey
+		inIgnored
+	)
+	state := inPrimary
+	var userID string
+	var subkey *Key
+	//fallback is the subkey replaced by a preferred one, restored if the latter is revoked
+	var fallback *Key
+	var fallbackSignature []byte
+	for len(data) > 0 {
+		if tag, body, data, err = readPacket(data); err != nil {
+			return nil, err
+		}
+		switch tag {
+		case tagPublicKey, tagSecretKey:
+			return nil, errors.New("openpgp: more than one key")
+		case tagUserID:
+			state = inIgnored
+			if e.userIDSignature == nil {
+				userID, state = string(body), inUserID
+			}
+		case tagPublicSubkey, tagSecretSubkey:
+			state = inIgnored
+			k, err := parseKey(body, tag == tagSecretSubkey)
+			if err == errUnsupportedAlgorithm || err == nil && k.Algorithm != PubKeyAlgoMLKEM768X25519 && k.Algorithm != PubKeyAlgoX25519 {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if e.prefers(k) {
+				subkey, state = k, inSubkey
+			}
+		case tagSignature:
+			if state == inIgnored {
+				continue
+			}
+			s, err := parseSignature(body)
+			if err != nil {
+				continue
+			}
+			switch {
+			case state == inPrimary && s.sigType == sigDirectKey && e.directSignature == nil:
+				if s.verify(primary, func(h hash.Hash) error {
+					hashKey(h, primary)
+					return nil
+				}) != nil {
+					continue
+				}
+				e.directSignature, e.flags = body, s.keyFlags
+				if s.keyExpiration != 0 {
+					e.expires = primary.CreationTime.Add(time.Duration(s.keyExpiration) * time.Second)
+				}
+			case state == inPrimary && s.sigType == sigKeyRevocation:
+				if s.verify(primary, func(h hash.Hash) error {
+					hashKey(h, primary)
+					return nil
+				}) == nil {
+					return nil, errors.New("openpgp: key is revoked")
+				}
+			case state == inUserID && s.sigType >= sigGenericCertification && s.sigType <= sigPositiveCertification:
+				if s.verify(primary, func(h hash.Hash) error {
+					hashKey(h, primary)
+					hashUserID(h, userID)
+					return nil
+				}) != nil {
+					continue
+				}
+				e.UserID, e.userIDSignature, state = userID, body, inIgnored
+			case state == inSubkey && (s.sigType == sigSubkeyBinding || s.sigType == sigSubkeyRevocation):
+				if s.verify(primary, func(h hash.Hash) error {
+					hashKey(h, primary)
+					hashKey(h, subkey)
+					return nil
+				}) != nil {
+					continue
+				}
+				if s.sigType == sigSubkeyRevocation {
+					if e.Subkey == subkey {
+						e.Subkey, e.subkeySignature = fallback, fallbackSignature
+					}
+					state = inIgnored
+				} else if e.prefers(subkey) && s.keyFlags&(flagEncryptCommunications|flagEncryptStorage) != 0 {
+					fallback, fallbackSignature = e.Subkey, e.subkeySignature
+					e.Subkey, e.subkeySignature = subkey, body
+				}
+			}
+		}
+	}
+	if e.directSignature == nil {
+		return nil, errors.New("openpgp: missing direct-key signature")
+	}
+	if e.Subkey != nil && (e.Subkey.PrivateKey == nil) != (primary.PrivateKey == nil) {
+		return nil, errors.New("openpgp: secret key with a public subkey")
+	}
+	return e, nil
+}
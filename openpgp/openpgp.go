@@ -0,0 +1,235 @@
+//Package openpgp implements v6 OpenPGP keys, signatures and messages (RFC 9580) with the composite algorithms of the
+//OpenPGP post-quantum draft: ML-DSA-65+Ed25519 signing keys and ML-KEM-768+X25519 encryption subkeys. The Ed25519 and
+//X25519 keys of RFC 9580 are also read, so that messages can be exchanged with existing v6 keys.
+//
+//GenerateKey creates a transferable key made of an ML-DSA-65+Ed25519 primary key certified by a direct-key signature,
+//an optional user ID and an ML-KEM-768+X25519 encryption subkey. Sign and Verify handle detached signatures of
+//documents, Encrypt and Decrypt messages made of v6 public-key encrypted session key packets followed by a version 2
+//symmetrically encrypted and integrity protected data packet. Armor and Dearmor convert to and from the ASCII armor.
+//
+//Both halves of a composite algorithm are always used: a signature is valid only if the Ed25519 and the ML-DSA
+//signatures of the digest are, and the key encryption key is derived from both the X25519 and the ML-KEM shared
+//secrets. Secret keys are stored unencrypted. Messages are encrypted with AES-GCM, which keys generated here advertise
+//in their preferences, and decrypted with AES-GCM or AES-OCB. The algorithm identifiers are those of the draft.
+package openpgp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+//Public key algorithms of RFC 9580 and of the OpenPGP post-quantum draft
+const (
+	PubKeyAlgoX25519         byte = 25
+	PubKeyAlgoEd25519        byte = 27
+	PubKeyAlgoMLDSA65Ed25519 byte = 30
+	PubKeyAlgoMLKEM768X25519 byte = 35
+)
+
+//Armor block types
+const (
+	BlockPublicKey  = "PGP PUBLIC KEY BLOCK"
+	BlockPrivateKey = "PGP PRIVATE KEY BLOCK"
+	BlockMessage    = "PGP MESSAGE"
+	BlockSignature  = "PGP SIGNATURE"
+)
+
+//Packet tags
+const (
+	tagPKESK        = 1
+	tagSignature    = 2
+	tagSKESK        = 3
+	tagSecretKey    = 5
+	tagPublicKey    = 6
+	tagSecretSubkey = 7
+	tagCompressed   = 8
+	tagMarker       = 10
+	tagLiteralData  = 11
+	tagUserID       = 13
+	tagPublicSubkey = 14
+	tagSEIPD        = 18
+	tagPadding      = 21
+)
+
+var errShortPacket = errors.New("openpgp: truncated packet")
+
+//appendLength appends a new format packet or subpacket length
+func appendLength(b []byte, n int) []byte {
+	switch {
+	case n < 192:
+		return append(b, byte(n))
+	case n < 8384:
+		n -= 192
+		return append(b, byte(n>>8)+192, byte(n))
+	}
+	return append(b, 0xff, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+//appendPacket appends a packet with a new format header
+func appendPacket(b []byte, tag byte, body []byte) []byte {
+	b = appendLength(append(b, 0xc0|tag), len(body))
+	return append(b, body...)
+}
+
+//readLength reads a new format length and reports whether it is a partial body length
+func readLength(data []byte) (int, bool, []byte, error) {
+	if len(data) == 0 {
+		return 0, false, nil, errShortPacket
+	}
+	switch l := data[0]; {
+	case l < 192:
+		return int(l), false, data[1:], nil
+	case l < 224:
+		if len(data) < 2 {
+			return 0, false, nil, errShortPacket
+		}
+		return (int(l)-192)<<8 + int(data[1]) + 192, false, data[2:], nil
+	case l < 255:
+		return 1 << (l & 0x1f), true, data[1:], nil
+	}
+	if len(data) < 5 {
+		return 0, false, nil, errShortPacket
+	}
+	n := binary.BigEndian.Uint32(data[1:5])
+	if uint64(n) > uint64(len(data)-5) {
+		return 0, false, nil, errShortPacket
+	}
+	return int(n), false, data[5:], nil
+}
+
+//readPacket reads a packet with a new or old format header and returns its tag, its body and the remaining data.
+//Partial body lengths are joined.
+func readPacket(data []byte) (byte, []byte, []byte, error) {
+	if len(data) == 0 || data[0]&0x80 == 0 {
+		return 0, nil, nil, errors.New("openpgp: invalid packet header")
+	}
+	h := data[0]
+	data = data[1:]
+	if h&0x40 == 0 {
+		tag := h >> 2 & 0x0f
+		if h&3 == 3 {
+			//indeterminate length, up to the end of the data
+			return tag, data, nil, nil
+		}
+		size := 1 << (h & 3)
+		if len(data) < size {
+			return 0, nil, nil, errShortPacket
+		}
+		n := 0
+		for _, c := range data[:size] {
+			n = n<<8 | int(c)
+		}
+		data = data[size:]
+		if n < 0 || n > len(data) {
+			return 0, nil, nil, errShortPacket
+		}
+		return tag, data[:n], data[n:], nil
+	}
+	var body []byte
+	for {
+		n, partial, rest, err := readLength(data)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		if n > len(rest) {
+			return 0, nil, nil, errShortPacket
+		}
+		body = append(body, rest[:n]...)
+		data = rest[n:]
+		if !partial {
+			return h & 0x3f, body, data, nil
+		}
+	}
+}
+
+//crc24 is the checksum of the armor
+func crc24(data []byte) uint32 {
+	crc := uint32(0xb704ce)
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= 0x1864cfb
+			}
+		}
+	}
+	return crc & 0xffffff
+}
+
+//Armor returns the ASCII armor of data, with lines of 64 characters and without checksum, as recommended by RFC 9580
+func Armor(blockType string, data []byte) []byte {
+	var out bytes.Buffer
+	out.WriteString("-----BEGIN " + blockType + "-----\n\n")
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 64 {
+		out.WriteString(encoded[:64] + "\n")
+		encoded = encoded[64:]
+	}
+	out.WriteString(encoded + "\n")
+	out.WriteString("-----END " + blockType + "-----\n")
+	return out.Bytes()
+}
+
+//Dearmor decodes the first ASCII armored block of data and returns its type. Armor headers are skipped and the
+//CRC24 checksum, if present, is checked.
+func Dearmor(data []byte) (string, []byte, error) {
+	lines := strings.Split(string(data), "\n")
+	i, blockType := 0, ""
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(line, "-----BEGIN ") && strings.HasSuffix(line, "-----") && len(line) > 16 {
+			blockType = line[11 : len(line)-5]
+			break
+		}
+	}
+	if blockType == "" {
+		return "", nil, errors.New("openpgp: no armored block")
+	}
+	for i++; i < len(lines) && strings.Contains(lines[i], ":"); i++ {
+	}
+	var encoded strings.Builder
+	checksum := ""
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case line == "-----END "+blockType+"-----":
+			b, err := base64.StdEncoding.DecodeString(encoded.String())
+			if err != nil {
+				return "", nil, err
+			}
+			if checksum != "" {
+				c, err := base64.StdEncoding.DecodeString(checksum)
+				if err != nil || len(c) != 3 || uint32(c[0])<<16|uint32(c[1])<<8|uint32(c[2]) != crc24(b) {
+					return "", nil, errors.New("openpgp: invalid armor checksum")
+				}
+			}
+			return blockType, b, nil
+		case strings.HasPrefix(line, "="):
+			checksum = line[1:]
+		default:
+			encoded.WriteString(line)
+		}
+	}
+	return "", nil, errors.New("openpgp: missing armor end line")
+}
+
+//unarmor returns data, decoded if armored with one of the block types
+func unarmor(data []byte, blockTypes ...string) ([]byte, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN ")) {
+		return data, nil
+	}
+	blockType, b, err := Dearmor(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range blockTypes {
+		if blockType == t {
+			return b, nil
+		}
+	}
+	return nil, errors.New("openpgp: unexpected armored block " + blockType)
+}
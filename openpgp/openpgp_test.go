@@ -0,0 +1,349 @@
+package openpgp
+
+import (
+	"bytes"
+	cryptorand "crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var document = []byte("release v1.2.0 checksums\n")
+
+func generate(t *testing.T, userID string) *Entity {
+	e, err := GenerateKey(userID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestPacketLength(t *testing.T) {
+	for _, n := range []int{0, 191, 192, 8383, 8384, 100000} {
+		body := make([]byte, n)
+		tag, parsed, rest, err := readPacket(append(appendPacket(nil, tagLiteralData, body), 0xc0|tagPadding, 0))
+		if err != nil || tag != tagLiteralData || len(parsed) != n || len(rest) != 2 {
+			t.Fatal(n, "unexpected packet", err)
+		}
+	}
+	//partial body lengths of 512 and 1 bytes followed by 3 bytes, and an old format header with a 2 byte length
+	partial := append(append([]byte{0xc0 | tagLiteralData, 0xe9}, make([]byte, 512)...), 0xe0, 1, 3, 1, 2, 3)
+	if tag, body, _, err := readPacket(partial); err != nil || tag != tagLiteralData || len(body) != 516 {
+		t.Fatal("unexpected partial packet", err)
+	}
+	if tag, body, _, err := readPacket([]byte{0x80 | tagSignature<<2 | 1, 0, 2, 1, 2}); err != nil || tag != tagSignature || len(body) != 2 {
+		t.Fatal("unexpected old format packet", err)
+	}
+	if _, _, _, err := readPacket([]byte{0xc0 | tagLiteralData, 0xff, 0, 1, 0, 0}); err == nil {
+		t.Fatal("truncated packet accepted")
+	}
+}
+
+func TestArmor(t *testing.T) {
+	data := bytes.Repeat([]byte{0x42}, 100)
+	armored := Armor(BlockMessage, data)
+	blockType, decoded, err := Dearmor(armored)
+	if err != nil || blockType != BlockMessage || !bytes.Equal(decoded, data) {
+		t.Fatal("armor round trip failed", err)
+	}
+	//headers and a checksum, as written by older implementations
+	c := crc24(data)
+	checksum := "=" + base64.StdEncoding.EncodeToString([]byte{byte(c >> 16), byte(c >> 8), byte(c)})
+	lines := strings.Split(string(armored), "\n")
+	withChecksum := strings.Join(append(append([]string{lines[0], "Comment: release key"}, lines[2:len(lines)-2]...),
+		checksum, lines[len(lines)-2], ""), "\n")
+	if _, decoded, err := Dearmor([]byte(withChecksum)); err != nil || !bytes.Equal(decoded, data) {
+		t.Fatal("armor with checksum rejected", err)
+	}
+	if _, _, err := Dearmor([]byte(strings.Replace(withChecksum, checksum, "=AAAA", 1))); err == nil {
+		t.Fatal("invalid checksum accepted")
+	}
+	if _, err := unarmor(armored, BlockSignature); err == nil {
+		t.Fatal("unexpected block type accepted")
+	}
+}
+
+func TestKey(t *testing.T) {
+	e := generate(t, "Release Signing <release@example.com>")
+	if len(e.PrimaryKey.Fingerprint()) != 32 || e.PrimaryKey.Algorithm != PubKeyAlgoMLDSA65Ed25519 ||
+		e.Subkey.Algorithm != PubKeyAlgoMLKEM768X25519 {
+		t.Fatal("unexpected key")
+	}
+	for _, k := range []*Entity{e, e.Public()} {
+		blockType := BlockPublicKey
+		if k.PrimaryKey.PrivateKey != nil {
+			blockType = BlockPrivateKey
+		}
+		serialized := k.Serialize()
+		for _, data := range [][]byte{serialized, Armor(blockType, serialized)} {
+			parsed, err := ReadKey(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(parsed.Serialize(), serialized) || parsed.UserID != e.UserID ||
+				!bytes.Equal(parsed.Subkey.Fingerprint(), e.Subkey.Fingerprint()) {
+				t.Fatal("key changed by encoding")
+			}
+			if (parsed.PrimaryKey.PrivateKey == nil) != (k.PrimaryKey.PrivateKey == nil) ||
+				(parsed.Subkey.PrivateKey == nil) != (k.Subkey.PrivateKey == nil) {
+				t.Fatal("unexpected secret key material")
+			}
+			if parsed.flags != flagCertify|flagSign {
+				t.Fatal("unexpected key flags")
+			}
+		}
+	}
+	anonymous := generate(t, "")
+	parsed, err := ReadKey(anonymous.Public().Serialize())
+	if err != nil || parsed.UserID != "" || parsed.Subkey == nil {
+		t.Fatal("key without user ID not read", err)
+	}
+}
+
+func TestReadKeyErrors(t *testing.T) {
+	e := generate(t, "release")
+	public := e.Public().Serialize()
+	//a modified subkey is dropped for lack of a valid binding signature
+	tampered := append([]byte{}, public...)
+	tampered[len(tampered)-len(appendPacket(nil, tagSignature, e.subkeySignature))-1] ^= 1
+	parsed, err := ReadKey(tampered)
+	if err != nil || parsed.Subkey != nil {
+		t.Fatal("modified subkey accepted", err)
+	}
+	//a modified primary key has no valid direct-key signature
+	tampered = append([]byte{}, public...)
+	tampered[20] ^= 1
+	if _, err := ReadKey(tampered); err == nil {
+		t.Fatal("modified primary key accepted")
+	}
+	//secret key material of another key
+	other := generate(t, "")
+	secret := e.Serialize()
+	copy(secret[3+10+len(e.PrimaryKey.PublicKey)+1:], other.PrimaryKey.PrivateKey)
+	if _, err := ReadKey(secret); err == nil {
+		t.Fatal("mismatched secret key accepted")
+	}
+	if _, err := ReadKey(append(public, public...)); err == nil {
+		t.Fatal("two keys accepted")
+	}
+	if _, err := ReadKey(Armor(BlockMessage, public)); err == nil {
+		t.Fatal("key read from a message block")
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	e := generate(t, "release")
+	other := generate(t, "other")
+	sig, err := Sign(bytes.NewReader(document), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range [][]byte{sig, Armor(BlockSignature, sig)} {
+		signer, err := Verify(s, bytes.NewReader(document), other.Public(), e.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(signer.PrimaryKey.Fingerprint(), e.PrimaryKey.Fingerprint()) {
+			t.Fatal("unexpected signer")
+		}
+	}
+	if _, err := Verify(sig, bytes.NewReader(document[1:]), e); err == nil {
+		t.Fatal("signature of another message accepted")
+	}
+	if _, err := Verify(sig, bytes.NewReader(document), other); err == nil {
+		t.Fatal("signature accepted for another key")
+	}
+	//either half of the composite signature must be valid
+	for _, i := range []int{len(sig) - 3309 - 1, len(sig) - 1} {
+		tampered := append([]byte{}, sig...)
+		tampered[i] ^= 1
+		if _, err := Verify(tampered, bytes.NewReader(document), e); err == nil {
+			t.Fatal("modified signature accepted", i)
+		}
+	}
+	if _, err := Sign(bytes.NewReader(document), e.Public()); err == nil {
+		t.Fatal("signed with a public key")
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	alice, bob := generate(t, "alice"), generate(t, "bob")
+	eve := generate(t, "eve")
+	chunkSize := 1 << (chunkSizeOctet + 6)
+	for _, n := range []int{0, 1, chunkSize - 6, chunkSize, 2*chunkSize + 100} {
+		plaintext := bytes.Repeat([]byte{'p'}, n)
+		msg, err := Encrypt(plaintext, alice.Public(), bob.Public())
+		if err != nil {
+			t.Fatal(n, err)
+		}
+		for _, e := range []*Entity{alice, bob} {
+			for _, m := range [][]byte{msg, Armor(BlockMessage, msg)} {
+				got, err := Decrypt(m, e)
+				if err != nil {
+					t.Fatal(n, err)
+				}
+				if !bytes.Equal(got, plaintext) {
+					t.Fatal(n, "unexpected plaintext")
+				}
+			}
+		}
+		if _, err := Decrypt(msg, eve); err == nil {
+			t.Fatal(n, "decrypted with another key")
+		}
+		tampered := append([]byte{}, msg...)
+		tampered[len(tampered)-20] ^= 1
+		if _, err := Decrypt(tampered, alice); err == nil {
+			t.Fatal(n, "modified message accepted")
+		}
+	}
+	if _, err := Decrypt(mustEncrypt(t, document, alice), alice.Public()); err == nil {
+		t.Fatal("decrypted with a public key")
+	}
+	public := alice.Public()
+	public.Subkey = nil
+	if _, err := Encrypt(document, public); err == nil {
+		t.Fatal("encrypted without encryption subkey")
+	}
+}
+
+func mustEncrypt(t *testing.T, plaintext []byte, recipient *Entity) []byte {
+	msg, err := Encrypt(plaintext, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestTruncatedMessage(t *testing.T) {
+	e := generate(t, "release")
+	plaintext := make([]byte, 3<<(chunkSizeOctet+6))
+	msg := mustEncrypt(t, plaintext, e)
+	//drop the last chunk and keep the final tag, then move the packet length accordingly
+	tag, body, _, err := readPacket(msg)
+	if err != nil || tag != tagPKESK {
+		t.Fatal("unexpected first packet", err)
+	}
+	pkesk := appendPacket(nil, tagPKESK, body)
+	_, body, _, err = readPacket(msg[len(pkesk):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := 1<<(chunkSizeOctet+6) + 16
+	truncated := append(append([]byte{}, body[:len(body)-16-chunk]...), body[len(body)-16:]...)
+	if _, err := Decrypt(append(pkesk, appendPacket(nil, tagSEIPD, truncated)...), e); err == nil {
+		t.Fatal("truncated message accepted")
+	}
+	if got, err := Decrypt(append(pkesk, appendPacket(nil, tagSEIPD, body)...), e); err != nil || len(got) != len(plaintext) {
+		t.Fatal("rebuilt message rejected", err)
+	}
+}
+
+func readTestdata(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+//The sample v6 Ed25519 and X25519 keys of RFC 9580, Appendices A.3 and A.4, a message encrypted to the X25519 subkey
+//with AES-128-OCB and the text signature of the cleartext signed message of Appendix A.7
+func TestRFC9580(t *testing.T) {
+	secret, err := ReadKey(readTestdata(t, "rfc9580-secret-key.asc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := ReadKey(readTestdata(t, "rfc9580-public-key.asc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(public.Serialize(), secret.Public().Serialize()) {
+		t.Fatal("secret and public keys differ")
+	}
+	for _, v := range []struct {
+		k           *Key
+		alg         byte
+		fingerprint string
+	}{
+		{public.PrimaryKey, PubKeyAlgoEd25519, "cb186c4f0609a697e4d52dfa6c722b0c1f1e27c18a56708f6525ec27bad9acc9"},
+		{public.Subkey, PubKeyAlgoX25519, "12c83f1e706f6308fe151a417743a1f033790e93e9978488d1db378da9930885"},
+	} {
+		if v.k.Algorithm != v.alg || hex.EncodeToString(v.k.Fingerprint()) != v.fingerprint {
+			t.Fatal("unexpected key", v.fingerprint)
+		}
+	}
+
+	plaintext, err := Decrypt(readTestdata(t, "rfc9580-message.asc"), secret)
+	if err != nil || string(plaintext) != "Hello, world!" {
+		t.Fatal("sample message not decrypted", err)
+	}
+
+	text := "What we need from the grocery store:\n\n- tofu\n- vegetables\n- noodles\n"
+	sig := readTestdata(t, "rfc9580-grocery.sig")
+	if _, err := Verify(sig, strings.NewReader(text), public); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(sig, strings.NewReader(strings.Replace(text, "\n", "\r\n", -1)), public); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(sig, strings.NewReader(strings.Replace(text, "tofu", "tempeh", 1)), public); err == nil {
+		t.Fatal("signature of another text accepted")
+	}
+
+	//and in the other direction, with the sample keys
+	msg := mustEncrypt(t, document, public)
+	if plaintext, err := Decrypt(msg, secret); err != nil || !bytes.Equal(plaintext, document) {
+		t.Fatal("message to the sample key not decrypted", err)
+	}
+	sig, err = Sign(bytes.NewReader(document), secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(sig, bytes.NewReader(document), public); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPreferredSubkey(t *testing.T) {
+	//the X25519 subkey of the sample key followed by an ML-KEM-768+X25519 subkey bound to the same primary key
+	sample, err := ReadKey(readTestdata(t, "rfc9580-secret-key.asc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subkey, err := newKey(PubKeyAlgoMLKEM768X25519, cryptorand.Reader, sample.PrimaryKey.CreationTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binding, err := sample.PrimaryKey.sign(cryptorand.Reader, sigSubkeyBinding, sample.PrimaryKey.CreationTime, [][]byte{
+		subpacket(spKeyFlags, flagEncryptCommunications|flagEncryptStorage),
+	}, func(h hash.Hash) error {
+		hashKey(h, sample.PrimaryKey)
+		hashKey(h, subkey)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := appendPacket(sample.Serialize(), tagSecretSubkey, subkey.secretBody())
+	parsed, err := ReadKey(appendPacket(data, tagSignature, binding))
+	if err != nil || parsed.Subkey.Algorithm != PubKeyAlgoMLKEM768X25519 {
+		t.Fatal("ML-KEM subkey not preferred", err)
+	}
+	//a revoked ML-KEM subkey leaves the X25519 one
+	revocation, err := sample.PrimaryKey.sign(cryptorand.Reader, sigSubkeyRevocation, sample.PrimaryKey.CreationTime, nil, func(h hash.Hash) error {
+		hashKey(h, sample.PrimaryKey)
+		hashKey(h, subkey)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err = ReadKey(appendPacket(appendPacket(data, tagSignature, binding), tagSignature, revocation))
+	if err != nil || parsed.Subkey.Algorithm != PubKeyAlgoX25519 {
+		t.Fatal("X25519 subkey not kept", err)
+	}
+}
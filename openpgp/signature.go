@@ -0,0 +1,397 @@
+package openpgp
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+	"time"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	"golang.org/x/crypto/sha3"
+)
+
+const signatureVersion = 6
+
+//Signature types
+const (
+	sigBinary                = 0x00
+	sigText                  = 0x01
+	sigGenericCertification  = 0x10
+	sigPositiveCertification = 0x13
+	sigSubkeyBinding         = 0x18
+	sigDirectKey             = 0x1f
+	sigKeyRevocation         = 0x20
+	sigSubkeyRevocation      = 0x28
+)
+
+//Signature subpacket types
+const (
+	spCreationTime        = 2
+	spSignatureExpiration = 3
+	spKeyExpiration       = 9
+	spPreferredSymmetric  = 11
+	spIssuerKeyID         = 16
+	spPreferredHash       = 21
+	spKeyFlags            = 27
+	spFeatures            = 30
+	spIssuerFingerprint   = 33
+	spPreferredAEAD       = 39
+
+	spCritical = 0x80
+)
+
+//Key flags
+const (
+	flagCertify               = 0x01
+	flagSign                  = 0x02
+	flagEncryptCommunications = 0x04
+	flagEncryptStorage        = 0x08
+)
+
+const featureSEIPDv2 = 0x08
+
+//Hash algorithms
+const (
+	hashSHA256  = 8
+	hashSHA512  = 10
+	hashSHA3256 = 12
+	hashSHA3512 = 14
+)
+
+//hashFunction returns the hash function of an algorithm and the salt size of v6 signatures using it
+func hashFunction(alg byte) (func() hash.Hash, int, bool) {
+	switch alg {
+	case hashSHA256:
+		return sha256.New, 16, true
+	case hashSHA512:
+		return sha512.New, 32, true
+	case hashSHA3256:
+		return sha3.New256, 16, true
+	case hashSHA3512:
+		return sha3.New512, 32, true
+	}
+	return nil, 0, false
+}
+
+//subpacket encodes a signature subpacket
+func subpacket(typ byte, content ...byte) []byte {
+	return append(appendLength(nil, 1+len(content)), append([]byte{typ}, content...)...)
+}
+
+//hashUserID writes a user ID to a signature hash
+func hashUserID(h hash.Hash, userID string) {
+	var prefix [5]byte
+	prefix[0] = 0xb4
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(userID)))
+	h.Write(prefix[:])
+	h.Write([]byte(userID))
+}
+
+//digest returns the hash of a v6 signature: the salt, the signed data and the hashed part of the signature packet
+//followed by its trailer
+func digest(newHash func() hash.Hash, salt, hashed []byte, hashData func(hash.Hash) error) ([]byte, error) {
+	h := newHash()
+	h.Write(salt)
+	if err := hashData(h); err != nil {
+		return nil, err
+	}
+	h.Write(hashed)
+	var trailer [6]byte
+	trailer[0], trailer[1] = signatureVersion, 0xff
+	binary.BigEndian.PutUint32(trailer[2:], uint32(len(hashed)))
+	h.Write(trailer[:])
+	return h.Sum(nil), nil
+}
+
+//sign returns the body of a v6 signature packet made with the key over the data written by hashData. The hashed
+//subpackets are the creation time and the issuer fingerprint followed by extra, the hash algorithm is SHA3-256.
+func (k *Key) sign(rand io.Reader, sigType byte, created time.Time, extra [][]byte, hashData func(hash.Hash) error) ([]byte, error) {
+	if k.Algorithm != PubKeyAlgoMLDSA65Ed25519 && k.Algorithm != PubKeyAlgoEd25519 || k.PrivateKey == nil {
+		return nil, errors.New("openpgp: not a secret signing key")
+	}
+	var subpackets []byte
+	t := make([]byte, 4)
+	binary.BigEndian.PutUint32(t, uint32(created.Unix()))
+	subpackets = append(subpackets, subpacket(spCreationTime|spCritical, t...)...)
+	subpackets = append(subpackets, subpacket(spIssuerFingerprint, append([]byte{keyVersion}, k.Fingerprint()...)...)...)
+	for _, s := range extra {
+		subpackets = append(subpackets, s...)
+	}
+	hashed := []byte{signatureVersion, sigType, k.Algorithm, hashSHA3256, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(hashed[4:], uint32(len(subpackets)))
+	hashed = append(hashed, subpackets...)
+
+	newHash, saltSize, _ := hashFunction(hashSHA3256)
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand, salt); err != nil {
+		return nil, err
+	}
+	d, err := digest(newHash, salt, hashed, hashData)
+	if err != nil {
+		return nil, err
+	}
+	var material []byte
+	if k.Algorithm == PubKeyAlgoEd25519 {
+		material = ed25519.Sign(ed25519.NewKeyFromSeed(k.PrivateKey), d)
+	} else if material, err = compositeSign(k.PrivateKey, d); err != nil {
+		return nil, err
+	}
+	//no unhashed subpackets
+	body := append(append([]byte{}, hashed...), 0, 0, 0, 0, d[0], d[1], byte(saltSize))
+	body = append(body, salt...)
+	return append(body, material...), nil
+}
+
+//compositeSign signs the digest with Ed25519 and ML-DSA-65
+func compositeSign(priv, d []byte) ([]byte, error) {
+	sig := ed25519.Sign(ed25519.NewKeyFromSeed(priv[:ed25519.SeedSize]), d)
+	mldsa := dilithium.NewMLDSA65()
+	_, sk := mldsa.KeyGen(priv[ed25519.SeedSize:])
+	pqSig := mldsa.Sign(sk, d)
+	if pqSig == nil {
+		return nil, errors.New("openpgp: signature failed")
+	}
+	return append(sig, pqSig...), nil
+}
+
+//compositeVerify checks that both the Ed25519 and the ML-DSA-65 signatures of the digest are valid
+func compositeVerify(pub, d, sig []byte) bool {
+	mldsa := dilithium.NewMLDSA65()
+	if len(sig) != ed25519.SignatureSize+mldsa.SIZESIG() {
+		return false
+	}
+	edValid := ed25519.Verify(pub[:ed25519.PublicKeySize], d, sig[:ed25519.SignatureSize])
+	pqValid := mldsa.Verify(pub[ed25519.PublicKeySize:], d, sig[ed25519.SignatureSize:])
+	return edValid && pqValid
+}
+
+//signature is a decoded v6 signature packet
+type signature struct {
+	sigType  byte
+	pubAlgo  byte
+	hashAlgo byte
+	//hashed is the hashed part of the packet, from the version to the hashed subpackets
+	hashed   []byte
+	left16   []byte
+	salt     []byte
+	material []byte
+
+	created       time.Time
+	expiration    uint32
+	keyExpiration uint32
+	issuer        []byte
+	keyFlags      byte
+}
+
+//parseSignature decodes the body of a v6 signature packet made with ML-DSA-65+Ed25519 or Ed25519
+func parseSignature(body []byte) (*signature, error) {
+	if len(body) < 8 || body[0] != signatureVersion {
+		return nil, errors.New("openpgp: unsupported signature version")
+	}
+	if body[2] != PubKeyAlgoMLDSA65Ed25519 && body[2] != PubKeyAlgoEd25519 {
+		return nil, errUnsupportedAlgorithm
+	}
+	_, saltSize, ok := hashFunction(body[3])
+	if !ok {
+		return nil, errors.New("openpgp: unsupported hash algorithm")
+	}
+	s := &signature{sigType: body[1], pubAlgo: body[2], hashAlgo: body[3]}
+	n := binary.BigEndian.Uint32(body[4:8])
+	if uint64(n)+12 > uint64(len(body)) {
+		return nil, errShortPacket
+	}
+	s.hashed, body = body[:8+n], body[8+n:]
+	if err := s.parseSubpackets(s.hashed[8:]); err != nil {
+		return nil, err
+	}
+	if s.created.IsZero() {
+		return nil, errors.New("openpgp: missing signature creation time")
+	}
+	//unhashed subpackets are not authenticated, only checked for unknown critical ones
+	n = binary.BigEndian.Uint32(body[:4])
+	if uint64(n)+3 > uint64(len(body)-4) {
+		return nil, errShortPacket
+	}
+	if err := new(signature).parseSubpackets(body[4 : 4+n]); err != nil {
+		return nil, err
+	}
+	body = body[4+n:]
+	if int(body[2]) != saltSize || len(body) < 3+saltSize {
+		return nil, errors.New("openpgp: invalid signature salt")
+	}
+	s.left16, s.salt, s.material = body[:2], body[3:3+saltSize], body[3+saltSize:]
+	return s, nil
+}
+
+//parseSubpackets decodes the subpackets understood by this package and rejects unknown critical ones
+func (s *signature) parseSubpackets(data []byte) error {
+	for len(data) > 0 {
+		n, partial, rest, err := readLength(data)
+		if err != nil {
+			return err
+		}
+		if partial || n == 0 || n > len(rest) {
+			return errors.New("openpgp: invalid signature subpacket")
+		}
+		typ, content := rest[0], rest[1:n]
+		data = rest[n:]
+		switch typ &^ spCritical {
+		case spCreationTime, spSignatureExpiration, spKeyExpiration:
+			if len(content) != 4 {
+				return errors.New("openpgp: invalid signature subpacket")
+			}
+			v := binary.BigEndian.Uint32(content)
+			switch typ &^ spCritical {
+			case spCreationTime:
+				s.created = time.Unix(int64(v), 0)
+			case spSignatureExpiration:
+				s.expiration = v
+			default:
+				s.keyExpiration = v
+			}
+		case spIssuerFingerprint:
+			s.issuer = content
+		case spKeyFlags:
+			if len(content) > 0 {
+				s.keyFlags = content[0]
+			}
+		case spPreferredSymmetric, spIssuerKeyID, spPreferredHash, spFeatures, spPreferredAEAD:
+		default:
+			if typ&spCritical != 0 {
+				return errors.New("openpgp: unknown critical signature subpacket")
+			}
+		}
+	}
+	return nil
+}
+
+//verify checks the signature made by the key over the data written by hashData
+func (s *signature) verify(k *Key, hashData func(hash.Hash) error) error {
+	if s.pubAlgo != k.Algorithm {
+		return errors.New("openpgp: signature made with another algorithm")
+	}
+	if s.issuer != nil && !bytes.Equal(s.issuer, append([]byte{keyVersion}, k.Fingerprint()...)) {
+		return errors.New("openpgp: signature issued by another key")
+	}
+	if s.created.Before(k.CreationTime) {
+		return errors.New("openpgp: signature older than the key")
+	}
+	if s.expiration != 0 && !time.Now().Before(s.created.Add(time.Duration(s.expiration)*time.Second)) {
+		return errors.New("openpgp: signature expired")
+	}
+	newHash, _, _ := hashFunction(s.hashAlgo)
+	d, err := digest(newHash, s.salt, s.hashed, hashData)
+	if err != nil {
+		return err
+	}
+	var valid bool
+	if k.Algorithm == PubKeyAlgoEd25519 {
+		valid = len(s.material) == ed25519.SignatureSize && ed25519.Verify(k.PublicKey, d, s.material)
+	} else {
+		valid = compositeVerify(k.PublicKey, d, s.material)
+	}
+	if !bytes.Equal(d[:2], s.left16) || !valid {
+		return errors.New("openpgp: invalid signature")
+	}
+	return nil
+}
+
+//canonicalText converts the line endings of the text written to CR LF, as text signatures require
+type canonicalText struct {
+	w      io.Writer
+	lastCR bool
+}
+
+func (t *canonicalText) Write(p []byte) (int, error) {
+	start := 0
+	for i, c := range p {
+		if c != '\n' || i > 0 && p[i-1] == '\r' || i == 0 && t.lastCR {
+			continue
+		}
+		if _, err := t.w.Write(p[start:i]); err != nil {
+			return 0, err
+		}
+		if _, err := t.w.Write([]byte("\r\n")); err != nil {
+			return 0, err
+		}
+		start = i + 1
+	}
+	if _, err := t.w.Write(p[start:]); err != nil {
+		return 0, err
+	}
+	if len(p) > 0 {
+		t.lastCR = p[len(p)-1] == '\r'
+	}
+	return len(p), nil
+}
+
+//Sign returns a detached binary signature of the message made with the primary key of the signer. Use Armor with
+//BlockSignature for an armored signature.
+func Sign(message io.Reader, signer *Entity) ([]byte, error) {
+	body, err := signer.PrimaryKey.sign(cryptorand.Reader, sigBinary, time.Now(), nil, func(h hash.Hash) error {
+		_, err := io.Copy(h, message)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return appendPacket(nil, tagSignature, body), nil
+}
+
+//Verify checks a detached signature of the message, binary or armored, and returns the key that made it among the
+//given keys. The signature must name its issuer with an issuer fingerprint subpacket, as v6 signatures do, and be
+//made while the key was valid for signing. The line endings of the message are converted to CR LF for a text
+//signature.
+func Verify(sig []byte, message io.Reader, keys ...*Entity) (*Entity, error) {
+	data, err := unarmor(sig, BlockSignature)
+	if err != nil {
+		return nil, err
+	}
+	tag, body, rest, err := readPacket(data)
+	if err != nil {
+		return nil, err
+	}
+	if tag != tagSignature || len(rest) != 0 {
+		return nil, errors.New("openpgp: not a single signature packet")
+	}
+	s, err := parseSignature(body)
+	if err != nil {
+		return nil, err
+	}
+	if s.sigType != sigBinary && s.sigType != sigText {
+		return nil, errors.New("openpgp: not a document signature")
+	}
+	if s.issuer == nil {
+		return nil, errors.New("openpgp: missing issuer fingerprint")
+	}
+	//the message can only be read once, the key is selected by its fingerprint
+	for _, e := range keys {
+		if !bytes.Equal(s.issuer, append([]byte{keyVersion}, e.PrimaryKey.Fingerprint()...)) {
+			continue
+		}
+		if e.flags&flagSign == 0 {
+			return nil, errors.New("openpgp: key not allowed to sign")
+		}
+		if e.expired(s.created) {
+			return nil, errors.New("openpgp: signature made after the key expired")
+		}
+		if err := s.verify(e.PrimaryKey, func(h hash.Hash) error {
+			var w io.Writer = h
+			if s.sigType == sigText {
+				w = &canonicalText{w: h}
+			}
+			_, err := io.Copy(w, message)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	return nil, errors.New("openpgp: signature made by an unknown key")
+}
@@ -0,0 +1,247 @@
+//Package pqconn implements a post-quantum secure channel over a net.Conn, in the spirit of crypto/tls.
+//
+//The handshake follows the structure of TLS 1.3. The client sends an ephemeral Kyber public key, the server answers
+//with an encapsulation to it, and the shared secret feeds a TLS 1.3 style key schedule. The server then proves the
+//possession of its Dilithium key by signing the transcript, optionally asks the client to do the same, and both sides
+//confirm the handshake with Finished messages. Application data is protected by the record layer of TLS 1.3 with
+//ChaCha20-Poly1305: sequence number nonces, key updates every 2^24 records or on demand, and close_notify alerts.
+//
+//Unlike TLS, there are no certificates: each party is identified by its Dilithium public key, which the peer checks
+//against a pinned key or with a callback.
+package pqconn
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/internal/randutil"
+	"github.com/kudelskisecurity/crystals-go/internal/record"
+)
+
+//ClientAuthType declares whether the server asks the client to authenticate
+type ClientAuthType int
+
+const (
+	//NoClientAuth does not ask for a client key
+	NoClientAuth ClientAuthType = iota
+	//RequestClientAuth asks for a client key, clients without one may still connect
+	RequestClientAuth
+	//RequireClientAuth rejects clients without a key
+	RequireClientAuth
+)
+
+//Config configures a client or a server. It must not be modified once passed to Client or Server.
+type Config struct {
+	//KEM is used for the ephemeral key exchange, NewKyber768() if nil. Both sides must use the same one.
+	KEM *kyber.Kyber
+	//Dilithium is the signature scheme of the keys, NewDilithium3() if nil. Both sides must use the same one.
+	Dilithium *dilithium.Dilithium
+	//PublicKey and PrivateKey are the Dilithium key pair of the local party, required for servers and for clients
+	//that authenticate
+	PublicKey  []byte
+	PrivateKey []byte
+	//PeerPublicKey pins the Dilithium public key of the peer
+	PeerPublicKey []byte
+	//VerifyPeer is called with the Dilithium public key of the peer once its signature has been checked, and aborts
+	//the handshake if it returns an error. Clients must set PeerPublicKey or VerifyPeer.
+	VerifyPeer func(publicKey []byte) error
+	//ClientAuth is the client authentication policy of servers
+	ClientAuth ClientAuthType
+	//RecordsPerKey is the number of records sent before the key is updated, 2^24 if zero
+	RecordsPerKey uint64
+	//Rand is read for the hello randoms, the ephemeral keys and the encapsulations, crypto/rand if nil
+	Rand io.Reader
+}
+
+func (c *Config) kem() *kyber.Kyber {
+	if c.KEM == nil {
+		return kyber.NewKyber768()
+	}
+	return c.KEM
+}
+
+func (c *Config) dilithium() *dilithium.Dilithium {
+	if c.Dilithium == nil {
+		return dilithium.NewDilithium3()
+	}
+	return c.Dilithium
+}
+
+func (c *Config) rand() io.Reader {
+	return randutil.Reader(c.Rand)
+}
+
+//Conn is a secure connection. It implements net.Conn; the handshake runs on the first Read or Write, or on an
+//explicit call to Handshake.
+type Conn struct {
+	conn     net.Conn
+	config   *Config
+	isClient bool
+	rec      *record.Conn
+
+	handshakeMutex sync.Mutex
+	handshakeErr   error
+	handshakeDone  bool
+	peerKey        []byte
+}
+
+//Client returns a new client side connection over conn
+func Client(conn net.Conn, config *Config) *Conn {
+	return &Conn{conn: conn, config: config, isClient: true, rec: record.New(conn, labelPrefix)}
+}
+
+//Server returns a new server side connection over conn
+func Server(conn net.Conn, config *Config) *Conn {
+	return &Conn{conn: conn, config: config, rec: record.New(conn, labelPrefix)}
+}
+
+//Dial connects to addr and runs the handshake as a client
+func Dial(network, addr string, config *Config) (*Conn, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	c := Client(conn, config)
+	if err := c.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+type listener struct {
+	net.Listener
+	config *Config
+}
+
+//Accept waits for the next connection and returns it as a server side Conn, the handshake is not run yet
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return Server(conn, l.config), nil
+}
+
+//NewListener returns a listener whose accepted connections are server side Conns
+func NewListener(inner net.Listener, config *Config) net.Listener {
+	return &listener{Listener: inner, config: config}
+}
+
+//Listen listens on addr and returns a listener of server side Conns
+func Listen(network, addr string, config *Config) (net.Listener, error) {
+	if len(config.PrivateKey) == 0 {
+		return nil, errors.New("pqconn: servers need a key pair")
+	}
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewListener(l, config), nil
+}
+
+//Handshake runs the handshake if it has not been run yet
+func (c *Conn) Handshake() error {
+	c.handshakeMutex.Lock()
+	defer c.handshakeMutex.Unlock()
+	if c.handshakeDone || c.handshakeErr != nil {
+		return c.handshakeErr
+	}
+	if c.isClient {
+		c.handshakeErr = c.clientHandshake()
+	} else {
+		c.handshakeErr = c.serverHandshake()
+	}
+	if c.handshakeErr == nil {
+		c.handshakeDone = true
+		if c.config.RecordsPerKey != 0 {
+			c.rec.SetRecordsPerKey(c.config.RecordsPerKey)
+		}
+	}
+	return c.handshakeErr
+}
+
+//PeerPublicKey returns the Dilithium public key of the peer, nil if the peer did not authenticate or before the
+//handshake
+func (c *Conn) PeerPublicKey() []byte {
+	c.handshakeMutex.Lock()
+	defer c.handshakeMutex.Unlock()
+	return append([]byte(nil), c.peerKey...)
+}
+
+//Read reads application data, running the handshake first if needed
+func (c *Conn) Read(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	return c.rec.Read(b)
+}
+
+//Write writes application data, running the handshake first if needed
+func (c *Conn) Write(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	return c.rec.Write(b)
+}
+
+//UpdateKeys updates the sending key and asks the peer to update its own
+func (c *Conn) UpdateKeys() error {
+	if err := c.Handshake(); err != nil {
+		return err
+	}
+	return c.rec.UpdateKeys()
+}
+
+//CloseWrite sends a close_notify alert; the peer reads io.EOF but can still send data
+func (c *Conn) CloseWrite() error {
+	c.handshakeMutex.Lock()
+	done := c.handshakeDone
+	c.handshakeMutex.Unlock()
+	if !done {
+		return errors.New("pqconn: CloseWrite before the end of the handshake")
+	}
+	return c.rec.CloseWrite()
+}
+
+//Close sends a close_notify alert if the handshake is complete and closes the connection
+func (c *Conn) Close() error {
+	c.handshakeMutex.Lock()
+	done := c.handshakeDone
+	c.handshakeMutex.Unlock()
+	if !done {
+		return c.conn.Close()
+	}
+	return c.rec.Close()
+}
+
+//LocalAddr returns the local network address
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+//RemoteAddr returns the remote network address
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+//SetDeadline sets the read and write deadlines of the underlying connection
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+//SetReadDeadline sets the read deadline of the underlying connection
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+//SetWriteDeadline sets the write deadline of the underlying connection. A write that times out leaves the connection
+//unusable for further writes.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
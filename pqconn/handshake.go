@@ -0,0 +1,409 @@
+package pqconn
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/internal/record"
+)
+
+//labelPrefix replaces "tls13 " in the key derivations
+const labelPrefix = "pqconn "
+
+const protocolVersion = 1
+
+//Handshake message types
+const (
+	typeClientHello        uint8 = 1
+	typeServerHello        uint8 = 2
+	typeCertificate        uint8 = 11
+	typeCertificateRequest uint8 = 13
+	typeCertificateVerify  uint8 = 15
+	typeFinished           uint8 = 20
+)
+
+//Identifiers of the KEM and signature schemes sent in the ClientHello
+var (
+	kemIDs = map[string]uint8{
+		"Kyber512": 1, "Kyber768": 2, "Kyber1024": 3,
+		"ML-KEM-512": 4, "ML-KEM-768": 5, "ML-KEM-1024": 6,
+	}
+	signatureIDs = map[string]uint8{
+		"Dilithium2": 1, "Dilithium3": 2, "Dilithium5": 3,
+	}
+)
+
+const (
+	serverSignatureContext = "pqconn, server CertificateVerify"
+	clientSignatureContext = "pqconn, client CertificateVerify"
+)
+
+//handshakeError is sent to the peer as an alert before being returned
+type handshakeError struct {
+	alert uint8
+	msg   string
+}
+
+func (e *handshakeError) Error() string {
+	return "pqconn: " + e.msg
+}
+
+func (c *Conn) fail(alert uint8, msg string) error {
+	c.rec.SendAlert(alert)
+	return &handshakeError{alert: alert, msg: msg}
+}
+
+//transcript is the running hash of the handshake messages
+type transcript struct {
+	h hash.Hash
+}
+
+func newTranscript() *transcript {
+	return &transcript{h: sha256.New()}
+}
+
+func (t *transcript) add(msg []byte) {
+	t.h.Write(msg)
+}
+
+func (t *transcript) sum() []byte {
+	return t.h.Sum(nil)
+}
+
+//signedContent is the content covered by a CertificateVerify signature, as in TLS 1.3
+func signedContent(context string, transcriptHash []byte) []byte {
+	out := bytes.Repeat([]byte{0x20}, 64)
+	out = append(out, context...)
+	out = append(out, 0)
+	return append(out, transcriptHash...)
+}
+
+func marshalHandshake(typ uint8, body []byte) []byte {
+	n := len(body)
+	return append([]byte{typ, byte(n >> 16), byte(n >> 8), byte(n)}, body...)
+}
+
+//writeHandshake sends a handshake message in its own record and adds it to the transcript
+func (c *Conn) writeHandshake(t *transcript, typ uint8, body []byte) error {
+	msg := marshalHandshake(typ, body)
+	t.add(msg)
+	return c.rec.WriteRecord(record.TypeHandshake, msg)
+}
+
+//readHandshake reads the next handshake message, which must fit in one record, and returns its type and body
+//without adding it to the transcript
+func (c *Conn) readHandshake() (uint8, []byte, []byte, error) {
+	typ, data, err := c.rec.ReadRecord()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	switch typ {
+	case record.TypeHandshake:
+	case record.TypeAlert:
+		if len(data) == 2 {
+			return 0, nil, nil, record.AlertError(data[1])
+		}
+		return 0, nil, nil, c.fail(record.AlertDecodeError, "malformed alert")
+	default:
+		return 0, nil, nil, c.fail(record.AlertUnexpected, "unexpected record")
+	}
+	if len(data) < 4 || int(data[1])<<16|int(data[2])<<8|int(data[3]) != len(data)-4 {
+		return 0, nil, nil, c.fail(record.AlertDecodeError, "malformed handshake message")
+	}
+	return data[0], data[4:], data, nil
+}
+
+//readExpected reads a handshake message whose type is one of types
+func (c *Conn) readExpected(types ...uint8) (uint8, []byte, []byte, error) {
+	got, body, msg, err := c.readHandshake()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	for _, typ := range types {
+		if got == typ {
+			return got, body, msg, nil
+		}
+	}
+	return 0, nil, nil, c.fail(record.AlertUnexpected, "unexpected handshake message")
+}
+
+//expectHandshake reads a handshake message of the given type and adds it to the transcript
+func (c *Conn) expectHandshake(t *transcript, typ uint8) ([]byte, error) {
+	_, body, msg, err := c.readExpected(typ)
+	if err != nil {
+		return nil, err
+	}
+	t.add(msg)
+	return body, nil
+}
+
+//keySchedule holds the secrets of the TLS 1.3 key schedule, without pre-shared keys
+type keySchedule struct {
+	handshakeSecret       []byte
+	clientHandshakeSecret []byte
+	serverHandshakeSecret []byte
+}
+
+func newKeySchedule(ss, transcriptHash []byte) *keySchedule {
+	early := record.Extract(nil, nil)
+	derived := record.ExpandLabel(labelPrefix, early, "derived", emptyHash(), sha256.Size)
+	hs := record.Extract(derived, ss)
+	return &keySchedule{
+		handshakeSecret:       hs,
+		clientHandshakeSecret: record.ExpandLabel(labelPrefix, hs, "c hs traffic", transcriptHash, sha256.Size),
+		serverHandshakeSecret: record.ExpandLabel(labelPrefix, hs, "s hs traffic", transcriptHash, sha256.Size),
+	}
+}
+
+//applicationSecrets returns the client and server application traffic secrets
+func (ks *keySchedule) applicationSecrets(transcriptHash []byte) ([]byte, []byte) {
+	derived := record.ExpandLabel(labelPrefix, ks.handshakeSecret, "derived", emptyHash(), sha256.Size)
+	ms := record.Extract(derived, nil)
+	return record.ExpandLabel(labelPrefix, ms, "c ap traffic", transcriptHash, sha256.Size),
+		record.ExpandLabel(labelPrefix, ms, "s ap traffic", transcriptHash, sha256.Size)
+}
+
+func emptyHash() []byte {
+	h := sha256.Sum256(nil)
+	return h[:]
+}
+
+//checkPeer applies the pinned key and the callback of the configuration to an authenticated peer key
+func (c *Conn) checkPeer(pk []byte) error {
+	if c.config.PeerPublicKey != nil && !bytes.Equal(pk, c.config.PeerPublicKey) {
+		return c.fail(record.AlertBadCertificate, "unexpected peer public key")
+	}
+	if c.config.VerifyPeer != nil {
+		if err := c.config.VerifyPeer(pk); err != nil {
+			c.rec.SendAlert(record.AlertBadCertificate)
+			return err
+		}
+	}
+	c.peerKey = pk
+	return nil
+}
+
+//sendAuthentication sends the Certificate, CertificateVerify and Finished messages of the local party
+func (c *Conn) sendAuthentication(t *transcript, sendKey bool, context string, secret []byte) error {
+	d := c.config.dilithium()
+	var pk []byte
+	if sendKey {
+		pk = c.config.PublicKey
+	}
+	if err := c.writeHandshake(t, typeCertificate, pk); err != nil {
+		return err
+	}
+	if sendKey {
+		sig := d.Sign(c.config.PrivateKey, signedContent(context, t.sum()))
+		if sig == nil {
+			return c.fail(record.AlertInternalError, "failed to sign the handshake")
+		}
+		if err := c.writeHandshake(t, typeCertificateVerify, sig); err != nil {
+			return err
+		}
+	}
+	return c.writeHandshake(t, typeFinished, record.FinishedMAC(labelPrefix, secret, t.sum()))
+}
+
+//readAuthentication reads the Certificate, CertificateVerify and Finished messages of the peer. An empty Certificate
+//is accepted if the authentication is not required.
+func (c *Conn) readAuthentication(t *transcript, context string, secret []byte, required bool) error {
+	_, pk, msg, err := c.readExpected(typeCertificate)
+	if err != nil {
+		return err
+	}
+	return c.verifyAuthentication(t, pk, msg, context, secret, required)
+}
+
+//verifyAuthentication processes a Certificate message of the peer and reads the CertificateVerify and Finished
+//messages that follow
+func (c *Conn) verifyAuthentication(t *transcript, pk, msg []byte, context string, secret []byte, required bool) error {
+	t.add(msg)
+	d := c.config.dilithium()
+	if len(pk) == 0 {
+		if required {
+			return c.fail(record.AlertCertRequired, "peer did not authenticate")
+		}
+	} else {
+		if len(pk) != d.SIZEPK() {
+			return c.fail(record.AlertDecodeError, "invalid peer public key")
+		}
+		content := signedContent(context, t.sum())
+		sig, err := c.expectHandshake(t, typeCertificateVerify)
+		if err != nil {
+			return err
+		}
+		if !d.Verify(pk, content, sig) {
+			return c.fail(record.AlertDecryptError, "invalid handshake signature")
+		}
+		if err := c.checkPeer(append([]byte{}, pk...)); err != nil {
+			return err
+		}
+	}
+	return c.readFinished(t, secret)
+}
+
+//readFinished reads the Finished message of the peer and checks it against the transcript
+func (c *Conn) readFinished(t *transcript, secret []byte) error {
+	expected := record.FinishedMAC(labelPrefix, secret, t.sum())
+	finished, err := c.expectHandshake(t, typeFinished)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(finished, expected) {
+		return c.fail(record.AlertDecryptError, "invalid Finished message")
+	}
+	return nil
+}
+
+func (c *Conn) suite() (uint8, uint8, error) {
+	kemID, ok := kemIDs[c.config.kem().Name]
+	if !ok {
+		return 0, 0, errors.New("pqconn: unsupported KEM " + c.config.kem().Name)
+	}
+	sigID, ok := signatureIDs[c.config.dilithium().Name]
+	if !ok {
+		return 0, 0, errors.New("pqconn: unsupported signature scheme " + c.config.dilithium().Name)
+	}
+	return kemID, sigID, nil
+}
+
+func (c *Conn) clientHandshake() error {
+	if c.config.PeerPublicKey == nil && c.config.VerifyPeer == nil {
+		return errors.New("pqconn: the server key is neither pinned nor verified")
+	}
+	kemID, sigID, err := c.suite()
+	if err != nil {
+		return err
+	}
+	k := c.config.kem()
+	t := newTranscript()
+
+	hello := make([]byte, 35, 35+k.SIZEPK())
+	hello[0] = protocolVersion
+	if _, err := io.ReadFull(c.config.rand(), hello[1:33]); err != nil {
+		return err
+	}
+	hello[33], hello[34] = kemID, sigID
+	seed := make([]byte, 2*kyber.SEEDBYTES)
+	if _, err := io.ReadFull(c.config.rand(), seed); err != nil {
+		return err
+	}
+	pk, sk := k.KeyGen(seed)
+	if err := c.writeHandshake(t, typeClientHello, append(hello, pk...)); err != nil {
+		return err
+	}
+
+	sh, err := c.expectHandshake(t, typeServerHello)
+	if err != nil {
+		return err
+	}
+	if len(sh) != 32+k.SIZEC() {
+		return c.fail(record.AlertDecodeError, "malformed ServerHello")
+	}
+	ks := newKeySchedule(k.Decaps(sk, sh[32:]), t.sum())
+	c.rec.SetReadSecret(ks.serverHandshakeSecret)
+	c.rec.SetWriteSecret(ks.clientHandshakeSecret)
+
+	typ, body, msg, err := c.readExpected(typeCertificateRequest, typeCertificate)
+	if err != nil {
+		return err
+	}
+	certRequested := typ == typeCertificateRequest
+	if certRequested {
+		if len(body) != 0 {
+			return c.fail(record.AlertDecodeError, "malformed CertificateRequest")
+		}
+		t.add(msg)
+		if _, body, msg, err = c.readExpected(typeCertificate); err != nil {
+			return err
+		}
+	}
+	if err := c.verifyAuthentication(t, body, msg, serverSignatureContext, ks.serverHandshakeSecret, true); err != nil {
+		return err
+	}
+	clientSecret, serverSecret := ks.applicationSecrets(t.sum())
+	c.rec.SetReadSecret(serverSecret)
+
+	if certRequested {
+		if err := c.sendAuthentication(t, len(c.config.PrivateKey) != 0, clientSignatureContext, ks.clientHandshakeSecret); err != nil {
+			return err
+		}
+	} else if err := c.writeHandshake(t, typeFinished, record.FinishedMAC(labelPrefix, ks.clientHandshakeSecret, t.sum())); err != nil {
+		return err
+	}
+	c.rec.SetWriteSecret(clientSecret)
+	return nil
+}
+
+func (c *Conn) serverHandshake() error {
+	if len(c.config.PrivateKey) == 0 {
+		return errors.New("pqconn: servers need a key pair")
+	}
+	kemID, sigID, err := c.suite()
+	if err != nil {
+		return err
+	}
+	k := c.config.kem()
+	t := newTranscript()
+
+	ch, err := c.expectHandshake(t, typeClientHello)
+	if err != nil {
+		return err
+	}
+	if len(ch) < 35 || ch[0] != protocolVersion {
+		return c.fail(record.AlertDecodeError, "malformed ClientHello")
+	}
+	if ch[33] != kemID || ch[34] != sigID {
+		return c.fail(record.AlertHandshake, "client uses other algorithms")
+	}
+	if len(ch) != 35+k.SIZEPK() {
+		return c.fail(record.AlertDecodeError, "malformed ClientHello")
+	}
+	coins := make([]byte, kyber.SEEDBYTES)
+	hello := make([]byte, 32, 32+k.SIZEC())
+	if _, err := io.ReadFull(c.config.rand(), hello); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(c.config.rand(), coins); err != nil {
+		return err
+	}
+	ct, ss := k.Encaps(ch[35:], coins)
+	if ct == nil {
+		return c.fail(record.AlertHandshake, "invalid client key share")
+	}
+	if err := c.writeHandshake(t, typeServerHello, append(hello, ct...)); err != nil {
+		return err
+	}
+	ks := newKeySchedule(ss, t.sum())
+	c.rec.SetReadSecret(ks.clientHandshakeSecret)
+	c.rec.SetWriteSecret(ks.serverHandshakeSecret)
+
+	requestCert := c.config.ClientAuth != NoClientAuth
+	if requestCert {
+		if err := c.writeHandshake(t, typeCertificateRequest, nil); err != nil {
+			return err
+		}
+	}
+	if err := c.sendAuthentication(t, true, serverSignatureContext, ks.serverHandshakeSecret); err != nil {
+		return err
+	}
+	clientSecret, serverSecret := ks.applicationSecrets(t.sum())
+	c.rec.SetWriteSecret(serverSecret)
+
+	if requestCert {
+		required := c.config.ClientAuth == RequireClientAuth || c.config.PeerPublicKey != nil
+		if err := c.readAuthentication(t, clientSignatureContext, ks.clientHandshakeSecret, required); err != nil {
+			return err
+		}
+	} else if err := c.readFinished(t, ks.clientHandshakeSecret); err != nil {
+		return err
+	}
+	c.rec.SetReadSecret(clientSecret)
+	return nil
+}
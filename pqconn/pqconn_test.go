@@ -0,0 +1,221 @@
+package pqconn
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+)
+
+type keyPair struct {
+	pk, sk []byte
+}
+
+func newKeyPair(d *dilithium.Dilithium) keyPair {
+	pk, sk := d.KeyGen(nil)
+	return keyPair{pk, sk}
+}
+
+//pipe runs the handshake of a client and a server over net.Pipe
+func pipe(t *testing.T, cc, sc *Config) (*Conn, *Conn, error, error) {
+	a, b := net.Pipe()
+	client, server := Client(a, cc), Server(b, sc)
+	errs := make(chan error, 1)
+	go func() {
+		err := server.Handshake()
+		if err != nil {
+			b.Close()
+		}
+		errs <- err
+	}()
+	cerr := client.Handshake()
+	if cerr != nil {
+		a.Close()
+	}
+	return client, server, cerr, <-errs
+}
+
+func TestHandshake(t *testing.T) {
+	for _, suite := range []struct {
+		k *kyber.Kyber
+		d *dilithium.Dilithium
+	}{
+		{kyber.NewKyber512(), dilithium.NewDilithium2()},
+		{nil, nil},
+		{kyber.NewMLKEM1024(), dilithium.NewDilithium5()},
+	} {
+		d := suite.d
+		if d == nil {
+			d = dilithium.NewDilithium3()
+		}
+		server := newKeyPair(d)
+		sc := &Config{KEM: suite.k, Dilithium: suite.d, PublicKey: server.pk, PrivateKey: server.sk}
+		cc := &Config{KEM: suite.k, Dilithium: suite.d, PeerPublicKey: server.pk}
+		client, srv, cerr, serr := pipe(t, cc, sc)
+		if cerr != nil || serr != nil {
+			t.Fatal(cerr, serr)
+		}
+		if !bytes.Equal(client.PeerPublicKey(), server.pk) || srv.PeerPublicKey() != nil {
+			t.Fatal("unexpected peer keys")
+		}
+
+		msg := make([]byte, 100000)
+		for i := range msg {
+			msg[i] = byte(i)
+		}
+		go func() {
+			client.Write(msg)
+			client.Close()
+		}()
+		got, err := ioutil.ReadAll(srv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Fatal("data mismatch")
+		}
+		srv.Close()
+	}
+}
+
+func TestServerAuthentication(t *testing.T) {
+	d := dilithium.NewDilithium3()
+	server, other := newKeyPair(d), newKeyPair(d)
+	sc := &Config{PublicKey: server.pk, PrivateKey: server.sk}
+
+	if _, _, cerr, _ := pipe(t, &Config{PeerPublicKey: other.pk}, sc); cerr == nil {
+		t.Fatal("client accepted an unexpected server key")
+	}
+	verifyErr := errors.New("rejected")
+	if _, _, cerr, _ := pipe(t, &Config{VerifyPeer: func([]byte) error { return verifyErr }}, sc); cerr != verifyErr {
+		t.Fatalf("expected the VerifyPeer error, got %v", cerr)
+	}
+	if _, _, cerr, _ := pipe(t, &Config{}, sc); cerr == nil {
+		t.Fatal("client without a way to check the server key accepted")
+	}
+	//a server that does not know the private key of the pinned key
+	forged := &Config{PublicKey: other.pk, PrivateKey: server.sk}
+	if _, _, cerr, _ := pipe(t, &Config{PeerPublicKey: other.pk}, forged); cerr == nil {
+		t.Fatal("client accepted a server without the private key")
+	}
+}
+
+func TestClientAuthentication(t *testing.T) {
+	d := dilithium.NewDilithium3()
+	server, client := newKeyPair(d), newKeyPair(d)
+	sc := &Config{PublicKey: server.pk, PrivateKey: server.sk, ClientAuth: RequireClientAuth}
+	cc := &Config{PeerPublicKey: server.pk, PublicKey: client.pk, PrivateKey: client.sk}
+
+	_, srv, cerr, serr := pipe(t, cc, sc)
+	if cerr != nil || serr != nil {
+		t.Fatal(cerr, serr)
+	}
+	if !bytes.Equal(srv.PeerPublicKey(), client.pk) {
+		t.Fatal("server did not authenticate the client")
+	}
+
+	anonymous := &Config{PeerPublicKey: server.pk}
+	if _, _, _, serr := pipe(t, anonymous, sc); serr == nil {
+		t.Fatal("server accepted a client without key")
+	}
+	sc.ClientAuth = RequestClientAuth
+	if _, srv, cerr, serr := pipe(t, anonymous, sc); cerr != nil || serr != nil || srv.PeerPublicKey() != nil {
+		t.Fatal("optional client authentication failed", cerr, serr)
+	}
+}
+
+func TestKeyUpdate(t *testing.T) {
+	d := dilithium.NewDilithium2()
+	server := newKeyPair(d)
+	sc := &Config{Dilithium: d, PublicKey: server.pk, PrivateKey: server.sk, RecordsPerKey: 3}
+	cc := &Config{Dilithium: d, PeerPublicKey: server.pk, RecordsPerKey: 2}
+	client, srv, cerr, serr := pipe(t, cc, sc)
+	if cerr != nil || serr != nil {
+		t.Fatal(cerr, serr)
+	}
+	done := make(chan error)
+	go func() {
+		buf := make([]byte, 10)
+		for i := 0; i < 10; i++ {
+			if _, err := io.ReadFull(srv, buf); err != nil {
+				done <- err
+				return
+			}
+			if _, err := srv.Write(buf); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	buf := make([]byte, 10)
+	for i := 0; i < 10; i++ {
+		if i == 5 {
+			if err := client.UpdateKeys(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		msg := bytes.Repeat([]byte{byte(i)}, 10)
+		if _, err := client.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(client, buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, msg) {
+			t.Fatal("echo mismatch")
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTruncation(t *testing.T) {
+	d := dilithium.NewDilithium2()
+	server := newKeyPair(d)
+	sc := &Config{Dilithium: d, PublicKey: server.pk, PrivateKey: server.sk}
+	cc := &Config{Dilithium: d, PeerPublicKey: server.pk}
+	client, srv, cerr, serr := pipe(t, cc, sc)
+	if cerr != nil || serr != nil {
+		t.Fatal(cerr, serr)
+	}
+	//closing the transport without close_notify is not a clean end of stream
+	go client.conn.Close()
+	if _, err := ioutil.ReadAll(srv); err == nil {
+		t.Fatal("truncated stream read as complete")
+	}
+}
+
+func TestListen(t *testing.T) {
+	d := dilithium.NewDilithium2()
+	server := newKeyPair(d)
+	l, err := Listen("tcp", "127.0.0.1:0", &Config{Dilithium: d, PublicKey: server.pk, PrivateKey: server.sk})
+	if err != nil {
+		t.Skip("cannot listen on loopback:", err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		io.Copy(conn, conn)
+		conn.Close()
+	}()
+	conn, err := Dial("tcp", l.Addr().String(), &Config{Dilithium: d, PeerPublicKey: server.pk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatal("echo failed", err)
+	}
+}
@@ -0,0 +1,103 @@
+package pqxdh
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+//Bundles and initial messages are serialized as a sequence of fields: key IDs as big-endian uint32, keys, signatures and
+//ciphertexts with a uint16 length prefix. Absent optional keys are encoded as empty fields. The initial ciphertext takes
+//the rest of an initial message.
+
+var errMalformed = errors.New("pqxdh: malformed message")
+
+func addBytes(b *cryptobyte.Builder, v []byte) {
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(v)
+	})
+}
+
+func readBytes(s *cryptobyte.String, out *[]byte) bool {
+	var v cryptobyte.String
+	if !s.ReadUint16LengthPrefixed(&v) {
+		return false
+	}
+	if len(v) == 0 {
+		*out = nil
+	} else {
+		*out = append([]byte{}, v...)
+	}
+	return true
+}
+
+//MarshalBinary encodes the bundle
+func (b *PrekeyBundle) MarshalBinary() ([]byte, error) {
+	var cb cryptobyte.Builder
+	addBytes(&cb, b.IdentityKey)
+	addBytes(&cb, b.SigningKey)
+	cb.AddUint32(b.SignedPrekeyID)
+	addBytes(&cb, b.SignedPrekey)
+	addBytes(&cb, b.SignedPrekeySig)
+	cb.AddUint32(b.PQPrekeyID)
+	addBytes(&cb, b.PQPrekey)
+	addBytes(&cb, b.PQPrekeySig)
+	cb.AddUint32(b.OneTimePrekeyID)
+	addBytes(&cb, b.OneTimePrekey)
+	return cb.Bytes()
+}
+
+//UnmarshalBinary decodes a bundle encoded by MarshalBinary. The signatures are not checked, see Verify.
+func (b *PrekeyBundle) UnmarshalBinary(data []byte) error {
+	s := cryptobyte.String(data)
+	if !readBytes(&s, &b.IdentityKey) ||
+		!readBytes(&s, &b.SigningKey) ||
+		!s.ReadUint32(&b.SignedPrekeyID) ||
+		!readBytes(&s, &b.SignedPrekey) ||
+		!readBytes(&s, &b.SignedPrekeySig) ||
+		!s.ReadUint32(&b.PQPrekeyID) ||
+		!readBytes(&s, &b.PQPrekey) ||
+		!readBytes(&s, &b.PQPrekeySig) ||
+		!s.ReadUint32(&b.OneTimePrekeyID) ||
+		!readBytes(&s, &b.OneTimePrekey) ||
+		!s.Empty() {
+		return errMalformed
+	}
+	return nil
+}
+
+//MarshalBinary encodes the initial message
+func (m *InitialMessage) MarshalBinary() ([]byte, error) {
+	var cb cryptobyte.Builder
+	addBytes(&cb, m.IdentityKey)
+	addBytes(&cb, m.EphemeralKey)
+	addBytes(&cb, m.PQCiphertext)
+	cb.AddUint32(m.SignedPrekeyID)
+	cb.AddUint32(m.PQPrekeyID)
+	if m.HasOneTimePrekey {
+		cb.AddUint8(1)
+	} else {
+		cb.AddUint8(0)
+	}
+	cb.AddUint32(m.OneTimePrekeyID)
+	cb.AddBytes(m.Ciphertext)
+	return cb.Bytes()
+}
+
+//UnmarshalBinary decodes an initial message encoded by MarshalBinary
+func (m *InitialMessage) UnmarshalBinary(data []byte) error {
+	s := cryptobyte.String(data)
+	var hasOPK uint8
+	if !readBytes(&s, &m.IdentityKey) ||
+		!readBytes(&s, &m.EphemeralKey) ||
+		!readBytes(&s, &m.PQCiphertext) ||
+		!s.ReadUint32(&m.SignedPrekeyID) ||
+		!s.ReadUint32(&m.PQPrekeyID) ||
+		!s.ReadUint8(&hasOPK) || hasOPK > 1 ||
+		!s.ReadUint32(&m.OneTimePrekeyID) {
+		return errMalformed
+	}
+	m.HasOneTimePrekey = hasOPK == 1
+	m.Ciphertext = append([]byte{}, s...)
+	return nil
+}
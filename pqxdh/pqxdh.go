@@ -0,0 +1,254 @@
+//Package pqxdh implements the PQXDH key agreement protocol of Signal (https://signal.org/docs/specifications/pqxdh/).
+//It combines X25519 Diffie-Hellman exchanges between identity keys, signed prekeys and one-time prekeys with a Kyber1024
+//encapsulation to a signed post-quantum prekey. Prekeys are signed either with XEdDSA using the X25519 identity key,
+//or with a Dilithium key belonging to the identity.
+package pqxdh
+
+import (
+	"crypto/sha512"
+	"errors"
+	"io"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/internal/randutil"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+//DefaultInfo is the KDF info string used when Config.Info is empty
+const DefaultInfo = "PQXDH_CURVE25519_SHA-512_CRYSTALS-KYBER-1024"
+
+//Encoding type bytes of EncodeEC and EncodeKEM
+const (
+	curve25519Type = 0x05
+	kyber1024Type  = 0x08
+	mlkem1024Type  = 0x0a
+)
+
+//SharedKeySize is the size in bytes of the secret key SK agreed by both parties
+const SharedKeySize = 32
+
+//Config holds the protocol parameters both parties must agree on
+type Config struct {
+	//Info identifies the application, DefaultInfo if empty
+	Info string
+	//KEM is the post-quantum KEM, NewKyber1024() if nil. Only Kyber1024 and ML-KEM-1024 are allowed.
+	KEM *kyber.Kyber
+	//Dilithium signs the prekeys if not nil, otherwise XEdDSA with the identity key is used
+	Dilithium *dilithium.Dilithium
+	//Rand is the source of the X25519 and Kyber keys, the encapsulation coins and the XEdDSA nonces, crypto/rand if
+	//nil
+	Rand io.Reader
+}
+
+func (c *Config) info() []byte {
+	if c == nil || c.Info == "" {
+		return []byte(DefaultInfo)
+	}
+	return []byte(c.Info)
+}
+
+func (c *Config) kem() *kyber.Kyber {
+	if c == nil || c.KEM == nil {
+		return kyber.NewKyber1024()
+	}
+	return c.KEM
+}
+
+func (c *Config) dilithium() *dilithium.Dilithium {
+	if c == nil {
+		return nil
+	}
+	return c.Dilithium
+}
+
+func (c *Config) rand() io.Reader {
+	if c == nil {
+		return randutil.Reader(nil)
+	}
+	return randutil.Reader(c.Rand)
+}
+
+//kemType returns the EncodeKEM type byte of the configured KEM
+func (c *Config) kemType() (byte, error) {
+	switch c.kem().Name {
+	case "Kyber1024":
+		return kyber1024Type, nil
+	case "ML-KEM-1024":
+		return mlkem1024Type, nil
+	}
+	return 0, errors.New("pqxdh: unsupported KEM " + c.kem().Name)
+}
+
+//EncodeEC encodes an X25519 public key as a type byte followed by the little-endian u-coordinate
+func EncodeEC(pk []byte) []byte {
+	return append([]byte{curve25519Type}, pk...)
+}
+
+//encodeKEM encodes a KEM public key as a type byte followed by the packed key
+func (c *Config) encodeKEM(pk []byte) ([]byte, error) {
+	t, err := c.kemType()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{t}, pk...), nil
+}
+
+//AssociatedData returns AD = EncodeEC(IK_A) || EncodeEC(IK_B). When prekeys are signed with Dilithium, the responder's
+//Dilithium public key is part of its identity and is appended as well.
+func AssociatedData(initiatorIK, responderIK, responderSigningKey []byte) []byte {
+	ad := append(EncodeEC(initiatorIK), EncodeEC(responderIK)...)
+	return append(ad, responderSigningKey...)
+}
+
+//kdf derives SK from the key material: HKDF with a zero salt, IKM = F || KM where F is 32 0xFF bytes, and the info string
+func (c *Config) kdf(km []byte) []byte {
+	f := make([]byte, 32)
+	for i := range f {
+		f[i] = 0xff
+	}
+	salt := make([]byte, sha512.Size)
+	sk := make([]byte, SharedKeySize)
+	io.ReadFull(hkdf.New(sha512.New, append(f, km...), salt, c.info()), sk)
+	return sk
+}
+
+//dh computes X25519 and rejects low order points
+func dh(priv, pub []byte) ([]byte, error) {
+	out, err := curve25519.X25519(priv, pub)
+	if err != nil {
+		return nil, errors.New("pqxdh: invalid Diffie-Hellman public key")
+	}
+	return out, nil
+}
+
+//initialMessageKey derives the AEAD key of the initial ciphertext so that SK itself is only handed to the application
+func initialMessageKey(sk []byte) []byte {
+	key := make([]byte, chacha20poly1305.KeySize)
+	io.ReadFull(hkdf.Expand(sha512.New, sk, []byte("PQXDH initial message")), key)
+	return key
+}
+
+//Initiate runs the initiator (Alice) side of PQXDH against a prekey bundle of the responder (Bob).
+//It verifies the prekey signatures, computes SK, and encrypts plaintext into the initial message.
+//The caller must check that bundle.IdentityKey (and bundle.SigningKey) belong to the intended responder.
+func Initiate(c *Config, alice *Identity, bundle *PrekeyBundle, plaintext []byte) (*InitialMessage, []byte, error) {
+	if err := bundle.Verify(c); err != nil {
+		return nil, nil, err
+	}
+
+	ek, err := newDHKeyPair(c.rand())
+	if err != nil {
+		return nil, nil, err
+	}
+	coins := make([]byte, kyber.SEEDBYTES)
+	if _, err := io.ReadFull(c.rand(), coins); err != nil {
+		return nil, nil, err
+	}
+	ct, ss := c.kem().Encaps(bundle.PQPrekey, coins)
+	if ct == nil {
+		return nil, nil, errors.New("pqxdh: invalid post-quantum prekey")
+	}
+
+	dh1, err := dh(alice.dh.private, bundle.SignedPrekey)
+	if err != nil {
+		return nil, nil, err
+	}
+	dh2, err := dh(ek.private, bundle.IdentityKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	dh3, err := dh(ek.private, bundle.SignedPrekey)
+	if err != nil {
+		return nil, nil, err
+	}
+	km := append(append(dh1, dh2...), dh3...)
+	if bundle.OneTimePrekey != nil {
+		dh4, err := dh(ek.private, bundle.OneTimePrekey)
+		if err != nil {
+			return nil, nil, err
+		}
+		km = append(km, dh4...)
+	}
+	km = append(km, ss...)
+	sk := c.kdf(km)
+
+	msg := &InitialMessage{
+		IdentityKey:      alice.PublicKey(),
+		EphemeralKey:     ek.public,
+		PQCiphertext:     ct,
+		SignedPrekeyID:   bundle.SignedPrekeyID,
+		PQPrekeyID:       bundle.PQPrekeyID,
+		OneTimePrekeyID:  bundle.OneTimePrekeyID,
+		HasOneTimePrekey: bundle.OneTimePrekey != nil,
+	}
+	aead, _ := chacha20poly1305.New(initialMessageKey(sk))
+	ad := AssociatedData(msg.IdentityKey, bundle.IdentityKey, bundle.SigningKey)
+	msg.Ciphertext = aead.Seal(nil, make([]byte, chacha20poly1305.NonceSize), plaintext, ad)
+	return msg, sk, nil
+}
+
+//Respond runs the responder (Bob) side of PQXDH on an initial message.
+//It returns the decrypted initial plaintext and SK. One-time prekeys used by the message are deleted from the store
+//only once the initial ciphertext has been authenticated.
+func (s *PrekeyStore) Respond(msg *InitialMessage) ([]byte, []byte, error) {
+	c := s.config
+	spk, ok := s.signedPrekeys[msg.SignedPrekeyID]
+	if !ok {
+		return nil, nil, errors.New("pqxdh: unknown signed prekey")
+	}
+	pqpk, ok := s.pqPrekeys[msg.PQPrekeyID]
+	if !ok {
+		return nil, nil, errors.New("pqxdh: unknown post-quantum prekey")
+	}
+	var opk *dhKeyPair
+	if msg.HasOneTimePrekey {
+		opk, ok = s.oneTimePrekeys[msg.OneTimePrekeyID]
+		if !ok {
+			return nil, nil, errors.New("pqxdh: unknown one-time prekey")
+		}
+	}
+	if len(msg.PQCiphertext) != c.kem().SIZEC() {
+		return nil, nil, errors.New("pqxdh: invalid post-quantum ciphertext")
+	}
+
+	dh1, err := dh(spk.private, msg.IdentityKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	dh2, err := dh(s.identity.dh.private, msg.EphemeralKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	dh3, err := dh(spk.private, msg.EphemeralKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	km := append(append(dh1, dh2...), dh3...)
+	if opk != nil {
+		dh4, err := dh(opk.private, msg.EphemeralKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		km = append(km, dh4...)
+	}
+	km = append(km, c.kem().Decaps(pqpk.private, msg.PQCiphertext)...)
+	sk := c.kdf(km)
+
+	aead, _ := chacha20poly1305.New(initialMessageKey(sk))
+	ad := AssociatedData(msg.IdentityKey, s.identity.PublicKey(), s.identity.SigningKey())
+	plaintext, err := aead.Open(nil, make([]byte, chacha20poly1305.NonceSize), msg.Ciphertext, ad)
+	if err != nil {
+		return nil, nil, errors.New("pqxdh: failed to decrypt initial message")
+	}
+
+	if opk != nil {
+		delete(s.oneTimePrekeys, msg.OneTimePrekeyID)
+	}
+	if !pqpk.lastResort {
+		delete(s.pqPrekeys, msg.PQPrekeyID)
+	}
+	return plaintext, sk, nil
+}
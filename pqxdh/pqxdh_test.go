@@ -0,0 +1,203 @@
+package pqxdh
+
+import (
+	"bytes"
+	"testing"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+)
+
+func newResponder(t *testing.T, c *Config, oneTime int) (*Identity, *PrekeyStore) {
+	bob, err := NewIdentity(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewPrekeyStore(c, bob)
+	if _, err := store.RotateSignedPrekey(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GeneratePQPrekey(true); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < oneTime; i++ {
+		if _, err := store.GeneratePQPrekey(false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.GenerateOneTimePrekeys(oneTime); err != nil {
+		t.Fatal(err)
+	}
+	return bob, store
+}
+
+func exchange(t *testing.T, c *Config, alice *Identity, store *PrekeyStore) *InitialMessage {
+	bundle, err := store.Bundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, skA, err := Initiate(c, alice, bundle, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt, skB, err := store.Respond(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(skA, skB) || len(skA) != SharedKeySize {
+		t.Fatal("shared keys differ")
+	}
+	if string(pt) != "hello" {
+		t.Fatal("initial plaintext mismatch")
+	}
+	return msg
+}
+
+func TestPQXDH(t *testing.T) {
+	configs := map[string]*Config{
+		"XEdDSA":                {},
+		"Dilithium3":            {Dilithium: dilithium.NewDilithium3()},
+		"ML-KEM-1024":           {KEM: kyber.NewMLKEM1024(), Info: "PQXDH_CURVE25519_SHA-512_ML-KEM-1024"},
+		"ML-KEM-1024+Dilithium": {KEM: kyber.NewMLKEM1024(), Dilithium: dilithium.NewDilithium5()},
+	}
+	for name, c := range configs {
+		t.Run(name, func(t *testing.T) {
+			alice, err := NewIdentity(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, store := newResponder(t, c, 1)
+
+			msg := exchange(t, c, alice, store)
+			if !msg.HasOneTimePrekey {
+				t.Fatal("first bundle should carry a one-time prekey")
+			}
+			//the one-time prekeys are consumed: replaying the message fails
+			if _, _, err := store.Respond(msg); err == nil {
+				t.Fatal("replayed initial message was accepted")
+			}
+
+			//without one-time prekeys, the last-resort prekey is used and kept
+			for i := 0; i < 2; i++ {
+				msg = exchange(t, c, alice, store)
+				if msg.HasOneTimePrekey || msg.PQPrekeyID != store.lastResortPQ {
+					t.Fatal("expected the last-resort prekey")
+				}
+			}
+		})
+	}
+}
+
+func TestUnsupportedKEM(t *testing.T) {
+	c := &Config{KEM: kyber.NewKyber768()}
+	bob, _ := NewIdentity(c)
+	if _, err := NewPrekeyStore(c, bob).GeneratePQPrekey(true); err == nil {
+		t.Fatal("Kyber768 should be rejected")
+	}
+}
+
+func TestBundleSignatures(t *testing.T) {
+	for _, c := range []*Config{{}, {Dilithium: dilithium.NewDilithium2()}} {
+		alice, _ := NewIdentity(c)
+		_, store := newResponder(t, c, 0)
+		bundle, err := store.Bundle()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bundle.Verify(c); err != nil {
+			t.Fatal(err)
+		}
+
+		bad := *bundle
+		bad.SignedPrekeySig = append([]byte{}, bundle.SignedPrekeySig...)
+		bad.SignedPrekeySig[3] ^= 1
+		if _, _, err := Initiate(c, alice, &bad, nil); err == nil {
+			t.Fatal("tampered signed prekey signature accepted")
+		}
+
+		bad = *bundle
+		bad.PQPrekey = append([]byte{}, bundle.PQPrekey...)
+		bad.PQPrekey[0] ^= 1
+		if _, _, err := Initiate(c, alice, &bad, nil); err == nil {
+			t.Fatal("tampered post-quantum prekey accepted")
+		}
+
+		//a prekey signature must not verify as a signature of the other prekey
+		bad = *bundle
+		bad.PQPrekeySig = bundle.SignedPrekeySig
+		if _, _, err := Initiate(c, alice, &bad, nil); err == nil {
+			t.Fatal("swapped signature accepted")
+		}
+	}
+}
+
+func TestTamperedMessage(t *testing.T) {
+	c := &Config{}
+	alice, _ := NewIdentity(c)
+	mallory, _ := NewIdentity(c)
+	_, store := newResponder(t, c, 1)
+	bundle, _ := store.Bundle()
+	msg, _, err := Initiate(c, alice, bundle, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forged := *msg
+	forged.IdentityKey = mallory.PublicKey()
+	if _, _, err := store.Respond(&forged); err == nil {
+		t.Fatal("message with a substituted identity key accepted")
+	}
+	forged = *msg
+	forged.PQCiphertext = append([]byte{}, msg.PQCiphertext...)
+	forged.PQCiphertext[0] ^= 1
+	if _, _, err := store.Respond(&forged); err == nil {
+		t.Fatal("message with a tampered ciphertext accepted")
+	}
+
+	//failed attempts must not consume the one-time prekeys
+	if _, _, err := store.Respond(msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	c := &Config{Dilithium: dilithium.NewDilithium3()}
+	alice, _ := NewIdentity(c)
+	_, store := newResponder(t, c, 1)
+	bundle, _ := store.Bundle()
+
+	enc, err := bundle.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b2 PrekeyBundle
+	if err := b2.UnmarshalBinary(enc); err != nil {
+		t.Fatal(err)
+	}
+	if err := b2.UnmarshalBinary(enc[:len(enc)-1]); err == nil {
+		t.Fatal("truncated bundle accepted")
+	}
+	if err := b2.UnmarshalBinary(enc); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, skA, err := Initiate(c, alice, &b2, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err = msg.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m2 InitialMessage
+	if err := m2.UnmarshalBinary(enc); err != nil {
+		t.Fatal(err)
+	}
+	pt, skB, err := store.Respond(&m2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(skA, skB) || string(pt) != "hello" {
+		t.Fatal("round trip through the encoding failed")
+	}
+}
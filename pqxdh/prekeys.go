@@ -0,0 +1,284 @@
+package pqxdh
+
+import (
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+//dhKeyPair is an X25519 key pair
+type dhKeyPair struct {
+	private []byte
+	public  []byte
+}
+
+func newDHKeyPair(rand io.Reader) (*dhKeyPair, error) {
+	priv := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand, priv); err != nil {
+		return nil, err
+	}
+	priv = clamp(priv)
+	pub, err := curve25519.X25519(priv, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return &dhKeyPair{private: priv, public: pub}, nil
+}
+
+//Identity is a long-term PQXDH identity: an X25519 key pair, plus a Dilithium key pair when the configuration signs
+//prekeys with Dilithium
+type Identity struct {
+	dh    *dhKeyPair
+	sigPK []byte
+	sigSK []byte
+}
+
+//NewIdentity generates an identity for the given configuration
+func NewIdentity(c *Config) (*Identity, error) {
+	kp, err := newDHKeyPair(c.rand())
+	if err != nil {
+		return nil, err
+	}
+	id := &Identity{dh: kp}
+	if d := c.dilithium(); d != nil {
+		seed := make([]byte, 32)
+		if _, err := io.ReadFull(c.rand(), seed); err != nil {
+			return nil, err
+		}
+		id.sigPK, id.sigSK = d.KeyGen(seed)
+	}
+	return id, nil
+}
+
+//PublicKey returns the X25519 identity public key IK
+func (id *Identity) PublicKey() []byte {
+	return append([]byte{}, id.dh.public...)
+}
+
+//SigningKey returns the Dilithium public key of the identity, or nil when prekeys are signed with XEdDSA
+func (id *Identity) SigningKey() []byte {
+	if id.sigPK == nil {
+		return nil
+	}
+	return append([]byte{}, id.sigPK...)
+}
+
+//sign signs an encoded prekey with Dilithium or XEdDSA
+func (id *Identity) sign(c *Config, msg []byte) ([]byte, error) {
+	if d := c.dilithium(); d != nil {
+		if id.sigSK == nil {
+			return nil, errors.New("pqxdh: identity has no Dilithium key")
+		}
+		sig := d.Sign(id.sigSK, msg)
+		if sig == nil {
+			return nil, errors.New("pqxdh: failed to sign prekey")
+		}
+		return sig, nil
+	}
+	return xeddsaSign(id.dh.private, msg, c.rand())
+}
+
+//verifyPrekey checks the signature of an encoded prekey
+func verifyPrekey(c *Config, identityKey, signingKey, msg, sig []byte) bool {
+	if d := c.dilithium(); d != nil {
+		return len(signingKey) == d.SIZEPK() && d.Verify(signingKey, msg, sig)
+	}
+	return signingKey == nil && xeddsaVerify(identityKey, msg, sig)
+}
+
+//pqPrekey is a signed KEM key pair, either one-time or last-resort
+type pqPrekey struct {
+	private    []byte
+	public     []byte
+	signature  []byte
+	lastResort bool
+}
+
+//signedPrekey is the medium-term X25519 prekey of the responder
+type signedPrekey struct {
+	*dhKeyPair
+	signature []byte
+}
+
+//PrekeyStore holds the private prekeys of a responder and publishes bundles of their public parts
+type PrekeyStore struct {
+	config         *Config
+	identity       *Identity
+	signedPrekeys  map[uint32]*signedPrekey
+	oneTimePrekeys map[uint32]*dhKeyPair
+	pqPrekeys      map[uint32]*pqPrekey
+	published      map[uint32]bool
+	currentSPK     uint32
+	lastResortPQ   uint32
+	nextID         uint32
+}
+
+//NewPrekeyStore creates an empty store for the identity. A signed prekey and a last-resort post-quantum prekey must be
+//generated before a bundle can be published.
+func NewPrekeyStore(c *Config, id *Identity) *PrekeyStore {
+	return &PrekeyStore{
+		config:         c,
+		identity:       id,
+		signedPrekeys:  map[uint32]*signedPrekey{},
+		oneTimePrekeys: map[uint32]*dhKeyPair{},
+		pqPrekeys:      map[uint32]*pqPrekey{},
+		published:      map[uint32]bool{},
+		nextID:         1,
+	}
+}
+
+func (s *PrekeyStore) newID() uint32 {
+	id := s.nextID
+	s.nextID++
+	return id
+}
+
+//RotateSignedPrekey generates and signs a new signed prekey, which is used by the bundles published from now on.
+//Previous signed prekeys stay available to answer messages in flight until removed with DeleteSignedPrekey.
+func (s *PrekeyStore) RotateSignedPrekey() (uint32, error) {
+	kp, err := newDHKeyPair(s.config.rand())
+	if err != nil {
+		return 0, err
+	}
+	sig, err := s.identity.sign(s.config, EncodeEC(kp.public))
+	if err != nil {
+		return 0, err
+	}
+	id := s.newID()
+	s.signedPrekeys[id] = &signedPrekey{dhKeyPair: kp, signature: sig}
+	s.currentSPK = id
+	return id, nil
+}
+
+//DeleteSignedPrekey removes an old signed prekey
+func (s *PrekeyStore) DeleteSignedPrekey(id uint32) {
+	if id != s.currentSPK {
+		delete(s.signedPrekeys, id)
+	}
+}
+
+//GenerateOneTimePrekeys adds n one-time X25519 prekeys to the store
+func (s *PrekeyStore) GenerateOneTimePrekeys(n int) error {
+	for i := 0; i < n; i++ {
+		kp, err := newDHKeyPair(s.config.rand())
+		if err != nil {
+			return err
+		}
+		s.oneTimePrekeys[s.newID()] = kp
+	}
+	return nil
+}
+
+//GeneratePQPrekey adds a signed post-quantum prekey to the store. A last-resort prekey replaces the previous one and
+//is used whenever no one-time post-quantum prekey is left.
+func (s *PrekeyStore) GeneratePQPrekey(lastResort bool) (uint32, error) {
+	seed := make([]byte, 64)
+	if _, err := io.ReadFull(s.config.rand(), seed); err != nil {
+		return 0, err
+	}
+	pk, sk := s.config.kem().KeyGen(seed)
+	enc, err := s.config.encodeKEM(pk)
+	if err != nil {
+		return 0, err
+	}
+	sig, err := s.identity.sign(s.config, enc)
+	if err != nil {
+		return 0, err
+	}
+	id := s.newID()
+	s.pqPrekeys[id] = &pqPrekey{private: sk, public: pk, signature: sig, lastResort: lastResort}
+	if lastResort {
+		delete(s.pqPrekeys, s.lastResortPQ)
+		s.lastResortPQ = id
+	}
+	return id, nil
+}
+
+//Bundle returns a prekey bundle for one initiator. Each one-time prekey (X25519 or post-quantum) is handed out in at
+//most one bundle; when none is left the bundle has no one-time X25519 prekey and uses the last-resort post-quantum prekey.
+func (s *PrekeyStore) Bundle() (*PrekeyBundle, error) {
+	spk, ok := s.signedPrekeys[s.currentSPK]
+	if !ok {
+		return nil, errors.New("pqxdh: no signed prekey")
+	}
+	b := &PrekeyBundle{
+		IdentityKey:     s.identity.PublicKey(),
+		SigningKey:      s.identity.SigningKey(),
+		SignedPrekeyID:  s.currentSPK,
+		SignedPrekey:    spk.public,
+		SignedPrekeySig: spk.signature,
+	}
+
+	pqID := s.lastResortPQ
+	for id, pq := range s.pqPrekeys {
+		if !pq.lastResort && !s.published[id] && (pqID == s.lastResortPQ || id < pqID) {
+			pqID = id
+		}
+	}
+	pq, ok := s.pqPrekeys[pqID]
+	if !ok {
+		return nil, errors.New("pqxdh: no post-quantum prekey")
+	}
+	s.published[pqID] = !pq.lastResort
+	b.PQPrekeyID, b.PQPrekey, b.PQPrekeySig = pqID, pq.public, pq.signature
+
+	var opkID uint32
+	for id := range s.oneTimePrekeys {
+		if !s.published[id] && (opkID == 0 || id < opkID) {
+			opkID = id
+		}
+	}
+	if opkID != 0 {
+		s.published[opkID] = true
+		b.OneTimePrekeyID, b.OneTimePrekey = opkID, s.oneTimePrekeys[opkID].public
+	}
+	return b, nil
+}
+
+//PrekeyBundle is the set of public prekeys an initiator fetches to start a session with a responder
+type PrekeyBundle struct {
+	IdentityKey     []byte //IK_B
+	SigningKey      []byte //Dilithium public key of the responder, nil with XEdDSA
+	SignedPrekeyID  uint32
+	SignedPrekey    []byte //SPK_B
+	SignedPrekeySig []byte //Sig(IK_B, EncodeEC(SPK_B))
+	PQPrekeyID      uint32
+	PQPrekey        []byte //PQPK_B, one-time or last-resort
+	PQPrekeySig     []byte //Sig(IK_B, EncodeKEM(PQPK_B))
+	OneTimePrekeyID uint32
+	OneTimePrekey   []byte //OPK_B, nil if none was available
+}
+
+//Verify checks the sizes of the keys of the bundle and the signatures of its prekeys
+func (b *PrekeyBundle) Verify(c *Config) error {
+	if len(b.IdentityKey) != 32 || len(b.SignedPrekey) != 32 || (b.OneTimePrekey != nil && len(b.OneTimePrekey) != 32) {
+		return errors.New("pqxdh: invalid X25519 key in bundle")
+	}
+	if len(b.PQPrekey) != c.kem().SIZEPK() {
+		return errors.New("pqxdh: invalid post-quantum prekey in bundle")
+	}
+	if !verifyPrekey(c, b.IdentityKey, b.SigningKey, EncodeEC(b.SignedPrekey), b.SignedPrekeySig) {
+		return errors.New("pqxdh: invalid signed prekey signature")
+	}
+	enc, err := c.encodeKEM(b.PQPrekey)
+	if err != nil {
+		return err
+	}
+	if !verifyPrekey(c, b.IdentityKey, b.SigningKey, enc, b.PQPrekeySig) {
+		return errors.New("pqxdh: invalid post-quantum prekey signature")
+	}
+	return nil
+}
+
+//InitialMessage is sent by the initiator to the responder to establish SK
+type InitialMessage struct {
+	IdentityKey      []byte //IK_A
+	EphemeralKey     []byte //EK_A
+	PQCiphertext     []byte //CT
+	SignedPrekeyID   uint32
+	PQPrekeyID       uint32
+	HasOneTimePrekey bool
+	OneTimePrekeyID  uint32
+	Ciphertext       []byte //initial ciphertext, authenticated with AD
+}
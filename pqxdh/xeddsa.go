@@ -0,0 +1,105 @@
+package pqxdh
+
+import (
+	"crypto/ed25519"
+	"crypto/sha512"
+	"crypto/subtle"
+	"io"
+
+	"filippo.io/edwards25519"
+	"filippo.io/edwards25519/field"
+)
+
+//XEdDSA (https://signal.org/docs/specifications/xeddsa/) lets an X25519 key pair produce signatures that verify
+//as Ed25519 signatures under the Edwards form of the Montgomery public key.
+
+//xeddsaSignatureSize is the size in bytes of an XEdDSA signature
+const xeddsaSignatureSize = 64
+
+//clamp turns 32 random bytes into an X25519 private scalar
+func clamp(k []byte) []byte {
+	c := append([]byte{}, k...)
+	c[0] &= 248
+	c[31] &= 127
+	c[31] |= 64
+	return c
+}
+
+//calculateKeyPair returns the Edwards public key A with a zero sign bit and the matching private scalar a for the
+//X25519 private key k, which is clamped
+func calculateKeyPair(k []byte) ([]byte, *edwards25519.Scalar) {
+	kr, _ := edwards25519.NewScalar().SetBytesWithClamping(k)
+	E := new(edwards25519.Point).ScalarBaseMult(kr).Bytes()
+	sign := int(E[31] >> 7)
+	A := E
+	A[31] &= 0x7f
+	a := kr.Bytes()
+	subtle.ConstantTimeCopy(sign, a, edwards25519.NewScalar().Negate(kr).Bytes())
+	s, _ := edwards25519.NewScalar().SetCanonicalBytes(a)
+	return A, s
+}
+
+//xeddsaSign signs msg with the X25519 private key k, using 64 bytes read from rand as nonce randomness
+func xeddsaSign(k, msg []byte, rand io.Reader) ([]byte, error) {
+	var Z [64]byte
+	if _, err := io.ReadFull(rand, Z[:]); err != nil {
+		return nil, err
+	}
+	A, a := calculateKeyPair(k)
+
+	//hash_1(X) = SHA512(2^256 - 2 || X)
+	h := sha512.New()
+	prefix := make([]byte, 32)
+	for i := range prefix {
+		prefix[i] = 0xff
+	}
+	prefix[0] = 0xfe
+	h.Write(prefix)
+	h.Write(a.Bytes())
+	h.Write(msg)
+	h.Write(Z[:])
+	r, _ := edwards25519.NewScalar().SetUniformBytes(h.Sum(nil))
+	R := new(edwards25519.Point).ScalarBaseMult(r).Bytes()
+
+	h.Reset()
+	h.Write(R)
+	h.Write(A)
+	h.Write(msg)
+	hs, _ := edwards25519.NewScalar().SetUniformBytes(h.Sum(nil))
+	s := edwards25519.NewScalar().MultiplyAdd(hs, a, r)
+
+	return append(R, s.Bytes()...), nil
+}
+
+//montgomeryToEdwards converts an X25519 public key u to the Edwards encoding of y = (u-1)/(u+1) with a zero sign bit
+func montgomeryToEdwards(u []byte) ([]byte, bool) {
+	if len(u) != 32 {
+		return nil, false
+	}
+	//the top bit of X25519 public keys is ignored, but u must be reduced
+	x, _ := new(field.Element).SetBytes(u)
+	masked := append([]byte{}, u...)
+	masked[31] &= 0x7f
+	if subtle.ConstantTimeCompare(x.Bytes(), masked) != 1 {
+		return nil, false
+	}
+	one := new(field.Element).One()
+	den := new(field.Element).Add(x, one)
+	if den.Equal(new(field.Element).Zero()) == 1 {
+		return nil, false
+	}
+	y := new(field.Element).Subtract(x, one)
+	return y.Multiply(y, den.Invert(den)).Bytes(), true
+}
+
+//xeddsaVerify checks an XEdDSA signature made by the owner of the X25519 public key u
+func xeddsaVerify(u, msg, sig []byte) bool {
+	if len(sig) != xeddsaSignatureSize {
+		return false
+	}
+	A, ok := montgomeryToEdwards(u)
+	if !ok {
+		return false
+	}
+	return ed25519.Verify(ed25519.PublicKey(A), msg, sig)
+}
@@ -0,0 +1,101 @@
+package pqxdh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/hex"
+	"testing"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+//TestCalculateKeyPair checks the Edwards public key derived from an X25519 private key against crypto/ed25519
+func TestCalculateKeyPair(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		seed := make([]byte, ed25519.SeedSize)
+		rand.Read(seed)
+		pub := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+		h := sha512.Sum512(seed)
+		A, _ := calculateKeyPair(h[:32])
+		pub[31] &= 0x7f
+		if !bytes.Equal(A, pub) {
+			t.Fatal("calculateKeyPair does not match crypto/ed25519")
+		}
+	}
+}
+
+//The signatures of "XEdDSA test" with the private keys of bytes 1 to 4 and nonce randomness of bytes 0x11 to 0x14.
+//The Edwards public key of the third key has its sign bit set.
+var xeddsaVectors = []string{
+	"c0d98b6bccbb1f99e4b2d5b20cabaacefbff1dd3ac610ea98a98f820b96b068f57d61db1479ccb97d785299d7b605b4ee4553cdd0de6401132ca5f7ca840e405",
+	"7193d4b5c874e4c9d0a47c6ed67fc59fde167bf4ca2a9fcffb47c5b95a2007fbbdf2db0d0bcce1c46202c4ab425a247e3757b2926a660fea30c7f62eb89b5a09",
+	"3b4fa96374ee9094700dc32e3b7e64a0e736c89654a75f090de10592d2aea92b4ac2deb9bb7b5b99df7a9857b0db125068437e80aa9409ecce72817f846c3b0b",
+	"b99d3e35eb888754c684ae919a1dcce69b3e338fb9f4ff0e6064b4e72c9555588dd7810c34b23bf3293147ba641c7f43c40b29015229d487689be6359dde1003",
+}
+
+func TestXEdDSAVectors(t *testing.T) {
+	msg := []byte("XEdDSA test")
+	for i, want := range xeddsaVectors {
+		k := bytes.Repeat([]byte{byte(i + 1)}, 32)
+		sig, err := xeddsaSign(k, msg, bytes.NewReader(bytes.Repeat([]byte{byte(i + 0x11)}, 64)))
+		if err != nil || hex.EncodeToString(sig) != want {
+			t.Fatalf("unexpected signature %d %x", i+1, sig)
+		}
+		u, _ := curve25519.X25519(k, curve25519.Basepoint)
+		if !xeddsaVerify(u, msg, sig) {
+			t.Fatal("known answer signature rejected", i+1)
+		}
+	}
+}
+
+func TestMontgomeryToEdwards(t *testing.T) {
+	//u = p - 1 has no Edwards form and u = p is not reduced
+	p := bytes.Repeat([]byte{0xff}, 32)
+	p[0], p[31] = 0xed, 0x7f
+	minusOne := append([]byte{}, p...)
+	minusOne[0]--
+	for _, u := range [][]byte{p, minusOne, p[1:]} {
+		if _, ok := montgomeryToEdwards(u); ok {
+			t.Fatalf("invalid public key converted %x", u)
+		}
+	}
+	//the base point u = 9 maps to y = 4/5
+	u := make([]byte, 32)
+	u[0] = 9
+	if y, ok := montgomeryToEdwards(u); !ok || hex.EncodeToString(y) != "5866666666666666666666666666666666666666666666666666666666666666" {
+		t.Fatalf("unexpected Edwards base point %x", y)
+	}
+}
+
+func TestXEdDSA(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		k := make([]byte, 32)
+		rand.Read(k)
+		u, _ := curve25519.X25519(k, curve25519.Basepoint)
+
+		//the Edwards key derived when signing must be the conversion of the Montgomery public key
+		A, _ := calculateKeyPair(clamp(k))
+		conv, ok := montgomeryToEdwards(u)
+		if !ok || !bytes.Equal(A[:], conv) {
+			t.Fatal("calculateKeyPair does not match the X25519 public key")
+		}
+
+		msg := []byte("prekey")
+		sig, err := xeddsaSign(k, msg, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !xeddsaVerify(u, msg, sig) {
+			t.Fatal("valid signature rejected")
+		}
+		if xeddsaVerify(u, []byte("prekez"), sig) {
+			t.Fatal("signature on another message accepted")
+		}
+		sig[40] ^= 1
+		if xeddsaVerify(u, msg, sig) {
+			t.Fatal("modified signature accepted")
+		}
+	}
+}
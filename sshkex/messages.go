@@ -0,0 +1,141 @@
+package sshkex
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"github.com/kudelskisecurity/crystals-go/internal/randutil"
+	"golang.org/x/crypto/ssh"
+)
+
+//InitMsg is SSH_MSG_KEX_HYBRID_INIT, message number 30
+type InitMsg struct {
+	ClientInit []byte `sshtype:"30"`
+}
+
+//ReplyMsg is SSH_MSG_KEX_HYBRID_REPLY, message number 31
+type ReplyMsg struct {
+	HostKey     []byte `sshtype:"31"`
+	ServerReply []byte
+	Signature   []byte
+}
+
+//MarshalInit encodes the payload of SSH_MSG_KEX_HYBRID_INIT
+func MarshalInit(clientInit []byte) []byte {
+	return ssh.Marshal(&InitMsg{ClientInit: clientInit})
+}
+
+//ParseInit decodes the payload of SSH_MSG_KEX_HYBRID_INIT and returns Q_C
+func ParseInit(payload []byte) ([]byte, error) {
+	var m InitMsg
+	if err := ssh.Unmarshal(payload, &m); err != nil {
+		return nil, err
+	}
+	if len(m.ClientInit) != ClientInitSize {
+		return nil, errors.New("sshkex: invalid client init length")
+	}
+	return m.ClientInit, nil
+}
+
+//MarshalReply encodes the payload of SSH_MSG_KEX_HYBRID_REPLY
+func MarshalReply(m *ReplyMsg) []byte {
+	return ssh.Marshal(m)
+}
+
+//ParseReply decodes the payload of SSH_MSG_KEX_HYBRID_REPLY
+func ParseReply(payload []byte) (*ReplyMsg, error) {
+	var m ReplyMsg
+	if err := ssh.Unmarshal(payload, &m); err != nil {
+		return nil, err
+	}
+	if len(m.ServerReply) != ServerReplySize {
+		return nil, errors.New("sshkex: invalid server reply length")
+	}
+	return &m, nil
+}
+
+//HandshakeInfo holds the values of the exchange hash other than the shared secret. The versions are the
+//identification strings without CR LF and the key exchange inits are the full SSH_MSG_KEXINIT payloads.
+type HandshakeInfo struct {
+	ClientVersion []byte
+	ServerVersion []byte
+	ClientKexInit []byte
+	ServerKexInit []byte
+	HostKey       []byte
+	ClientInit    []byte
+	ServerReply   []byte
+}
+
+func writeString(w io.Writer, s []byte) {
+	n := len(s)
+	w.Write([]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+	w.Write(s)
+}
+
+//ExchangeHash computes H = SHA-256(V_C || V_S || I_C || I_S || K_S || Q_C || Q_S || K), all encoded as strings
+func ExchangeHash(info *HandshakeInfo, k []byte) []byte {
+	h := sha256.New()
+	writeString(h, info.ClientVersion)
+	writeString(h, info.ServerVersion)
+	writeString(h, info.ClientKexInit)
+	writeString(h, info.ServerKexInit)
+	writeString(h, info.HostKey)
+	writeString(h, info.ClientInit)
+	writeString(h, info.ServerReply)
+	writeString(h, k)
+	return h.Sum(nil)
+}
+
+//DeriveKey derives n bytes of key material as in RFC 4253, Section 7.2, with K encoded as a string. letter is 'A' to
+//'F' and sessionID is the exchange hash of the first key exchange of the connection.
+func DeriveKey(k, h, sessionID []byte, letter byte, n int) []byte {
+	out := make([]byte, 0, n+sha256.Size)
+	d := sha256.New()
+	writeString(d, k)
+	d.Write(h)
+	d.Write([]byte{letter})
+	d.Write(sessionID)
+	out = d.Sum(out)
+	for len(out) < n {
+		d.Reset()
+		writeString(d, k)
+		d.Write(h)
+		d.Write(out)
+		out = d.Sum(out)
+	}
+	return out[:n]
+}
+
+//SignExchangeHash signs H with the host key of the server and returns the encoded signature. algorithm selects the
+//signature algorithm of RSA keys, for example ssh.SigAlgoRSASHA2256, and is ignored if empty.
+func SignExchangeHash(signer ssh.Signer, algorithm string, rand io.Reader, h []byte) ([]byte, error) {
+	var sig *ssh.Signature
+	var err error
+	if as, ok := signer.(ssh.AlgorithmSigner); ok && algorithm != "" {
+		sig, err = as.SignWithAlgorithm(randutil.Reader(rand), h, algorithm)
+	} else {
+		sig, err = signer.Sign(randutil.Reader(rand), h)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ssh.Marshal(sig), nil
+}
+
+//VerifyExchangeHash checks the signature of H by the host key of a reply and returns the host key, to be checked by
+//the caller against its known hosts
+func VerifyExchangeHash(m *ReplyMsg, h []byte) (ssh.PublicKey, error) {
+	key, err := ssh.ParsePublicKey(m.HostKey)
+	if err != nil {
+		return nil, err
+	}
+	var sig ssh.Signature
+	if err := ssh.Unmarshal(m.Signature, &sig); err != nil {
+		return nil, err
+	}
+	if err := key.Verify(h, &sig); err != nil {
+		return nil, errors.New("sshkex: invalid exchange hash signature")
+	}
+	return key, nil
+}
@@ -0,0 +1,120 @@
+//Package sshkex implements the computations of the mlkem768x25519-sha256 SSH key exchange of OpenSSH
+//(draft-ietf-sshm-mlkem-hybrid-kex), the hybrid of ML-KEM-768 and X25519 that OpenSSH negotiates by default.
+//
+//The client sends Q_C = ek || X25519 public key in SSH_MSG_KEX_HYBRID_INIT, the server answers with
+//Q_S = ct || X25519 public key in SSH_MSG_KEX_HYBRID_REPLY, and the shared secret is K = SHA-256(K_PQ || K_CL). Unlike
+//the Diffie-Hellman key exchanges, K is encoded as a string, not as an mpint, in the exchange hash and in the key
+//derivation.
+//
+//The key exchange algorithms of golang.org/x/crypto/ssh cannot be extended from outside of the package, so this package
+//provides the messages, the exchange hash and the host key signature for SSH implementations built on it.
+package sshkex
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	kyber "github.com/kudelskisecurity/crystals-go/crystals-kyber"
+	"github.com/kudelskisecurity/crystals-go/internal/randutil"
+	"golang.org/x/crypto/curve25519"
+)
+
+//Name is the name of the key exchange method in SSH_MSG_KEXINIT
+const Name = "mlkem768x25519-sha256"
+
+//Sizes of Q_C and Q_S
+const (
+	ClientInitSize  = 1184 + curve25519.PointSize
+	ServerReplySize = 1088 + curve25519.PointSize
+)
+
+//Client is the ephemeral state of a client during the key exchange
+type Client struct {
+	x25519 []byte
+	kemSK  []byte
+	init   []byte
+}
+
+//NewClient generates the ephemeral keys of a client, reading randomness from rand (crypto/rand if nil)
+func NewClient(rand io.Reader) (*Client, error) {
+	rand = randutil.Reader(rand)
+	seed := make([]byte, 2*kyber.SEEDBYTES)
+	if _, err := io.ReadFull(rand, seed); err != nil {
+		return nil, err
+	}
+	priv := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand, priv); err != nil {
+		return nil, err
+	}
+	return newClient(seed, priv)
+}
+
+func newClient(seed, x25519 []byte) (*Client, error) {
+	pub, err := curve25519.X25519(x25519, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	ek, sk := kyber.NewMLKEM768().KeyGen(seed)
+	return &Client{x25519: x25519, kemSK: sk, init: append(ek, pub...)}, nil
+}
+
+//Init returns Q_C, the client public values
+func (c *Client) Init() []byte {
+	return append([]byte{}, c.init...)
+}
+
+//SharedSecret checks Q_S and returns the shared secret K
+func (c *Client) SharedSecret(serverReply []byte) ([]byte, error) {
+	if len(serverReply) != ServerReplySize {
+		return nil, errors.New("sshkex: invalid server reply length")
+	}
+	ct, pub := serverReply[:ServerReplySize-curve25519.PointSize], serverReply[ServerReplySize-curve25519.PointSize:]
+	kcl, err := curve25519.X25519(c.x25519, pub)
+	if err != nil {
+		return nil, errors.New("sshkex: invalid server X25519 key")
+	}
+	return combine(kyber.NewMLKEM768().Decaps(c.kemSK, ct), kcl), nil
+}
+
+//Server checks Q_C and returns Q_S and the shared secret K, reading randomness from rand (crypto/rand if nil)
+func Server(clientInit []byte, rand io.Reader) ([]byte, []byte, error) {
+	rand = randutil.Reader(rand)
+	coins := make([]byte, kyber.SEEDBYTES)
+	if _, err := io.ReadFull(rand, coins); err != nil {
+		return nil, nil, err
+	}
+	priv := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand, priv); err != nil {
+		return nil, nil, err
+	}
+	return server(clientInit, coins, priv)
+}
+
+func server(clientInit, coins, x25519 []byte) ([]byte, []byte, error) {
+	if len(clientInit) != ClientInitSize {
+		return nil, nil, errors.New("sshkex: invalid client init length")
+	}
+	ek, peer := clientInit[:ClientInitSize-curve25519.PointSize], clientInit[ClientInitSize-curve25519.PointSize:]
+	kcl, err := curve25519.X25519(x25519, peer)
+	if err != nil {
+		return nil, nil, errors.New("sshkex: invalid client X25519 key")
+	}
+	pub, err := curve25519.X25519(x25519, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	ct, kpq := kyber.NewMLKEM768().Encaps(ek, coins)
+	if ct == nil {
+		return nil, nil, errors.New("sshkex: invalid client ML-KEM key")
+	}
+	return append(ct, pub...), combine(kpq, kcl), nil
+}
+
+//combine computes K = SHA-256(K_PQ || K_CL)
+func combine(kpq, kcl []byte) []byte {
+	h := sha256.New()
+	h.Write(kpq)
+	h.Write(kcl)
+	return h.Sum(nil)
+}
@@ -0,0 +1,123 @@
+package sshkex
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+//The vector was produced with the crypto/ecdh and crypto/mlkem packages of the Go standard library
+func TestVector(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/mlkem768x25519-sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := map[string][]byte{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		kv := strings.SplitN(line, ": ", 2)
+		v[kv[0]], _ = hex.DecodeString(kv[1])
+	}
+	c, err := newClient(v["mlkem seed"], v["client x25519"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c.Init(), v["Q_C"]) {
+		t.Fatal("Q_C mismatch")
+	}
+	qs, k, err := server(c.Init(), v["mlkem coins"], v["server x25519"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(qs, v["Q_S"]) || !bytes.Equal(k, v["K"]) {
+		t.Fatal("server mismatch")
+	}
+	k, err = c.SharedSecret(qs)
+	if err != nil || !bytes.Equal(k, v["K"]) {
+		t.Fatal("client shared secret mismatch", err)
+	}
+}
+
+func TestKeyExchange(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(nil)
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &HandshakeInfo{
+		ClientVersion: []byte("SSH-2.0-client"),
+		ServerVersion: []byte("SSH-2.0-server"),
+		ClientKexInit: []byte{20, 1},
+		ServerKexInit: []byte{20, 2},
+		HostKey:       hostKey.PublicKey().Marshal(),
+	}
+
+	c, err := NewClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	init := MarshalInit(c.Init())
+	if init[0] != 30 {
+		t.Fatal("unexpected init message number")
+	}
+
+	//server
+	qc, err := ParseInit(init)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qs, ks, err := Server(qc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info.ClientInit, info.ServerReply = qc, qs
+	sig, err := SignExchangeHash(hostKey, "", nil, ExchangeHash(info, ks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := MarshalReply(&ReplyMsg{HostKey: info.HostKey, ServerReply: qs, Signature: sig})
+
+	//client
+	m, err := ParseReply(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kc, err := c.SharedSecret(m.ServerReply)
+	if err != nil || !bytes.Equal(kc, ks) {
+		t.Fatal("shared secrets differ", err)
+	}
+	h := ExchangeHash(info, kc)
+	key, err := VerifyExchangeHash(m, h)
+	if err != nil || !bytes.Equal(key.Marshal(), info.HostKey) {
+		t.Fatal("host signature rejected", err)
+	}
+	h[0] ^= 1
+	if _, err := VerifyExchangeHash(m, h); err == nil {
+		t.Fatal("signature of another exchange hash accepted")
+	}
+
+	if _, err := c.SharedSecret(qs[1:]); err == nil {
+		t.Fatal("short reply accepted")
+	}
+	if _, _, err := Server(make([]byte, ClientInitSize), nil); err == nil {
+		t.Fatal("low-order X25519 key accepted")
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	k, h := []byte("shared secret"), []byte("exchange hash")
+	long := DeriveKey(k, h, h, 'C', 64)
+	if !bytes.Equal(DeriveKey(k, h, h, 'C', 16), long[:16]) {
+		t.Fatal("short keys are not prefixes of long keys")
+	}
+	first := sha256.Sum256(append(append(append([]byte{0, 0, 0, 13}, k...), h...), append([]byte{'C'}, h...)...))
+	second := sha256.Sum256(append(append(append([]byte{0, 0, 0, 13}, k...), h...), first[:]...))
+	if !bytes.Equal(long, append(first[:], second[:]...)) {
+		t.Fatal("unexpected key material")
+	}
+}
@@ -0,0 +1,186 @@
+package sshsig
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	"golang.org/x/crypto/ssh"
+)
+
+//Experimental SSH key types: the names of the SSH ML-DSA draft, and those of the Open Quantum Safe OpenSSH fork for
+//round 3 Dilithium. OpenSSH does not know them.
+const (
+	KeyTypeMLDSA44    = "ssh-mldsa-44"
+	KeyTypeMLDSA65    = "ssh-mldsa-65"
+	KeyTypeMLDSA87    = "ssh-mldsa-87"
+	KeyTypeDilithium2 = "ssh-dilithium2"
+	KeyTypeDilithium3 = "ssh-dilithium3"
+	KeyTypeDilithium5 = "ssh-dilithium5"
+)
+
+var keyTypes = map[string]string{
+	"ML-DSA-44":  KeyTypeMLDSA44,
+	"ML-DSA-65":  KeyTypeMLDSA65,
+	"ML-DSA-87":  KeyTypeMLDSA87,
+	"Dilithium2": KeyTypeDilithium2,
+	"Dilithium3": KeyTypeDilithium3,
+	"Dilithium5": KeyTypeDilithium5,
+}
+
+var constructors = map[string]func(...bool) *dilithium.Dilithium{
+	KeyTypeMLDSA44:    dilithium.NewMLDSA44,
+	KeyTypeMLDSA65:    dilithium.NewMLDSA65,
+	KeyTypeMLDSA87:    dilithium.NewMLDSA87,
+	KeyTypeDilithium2: dilithium.NewDilithium2,
+	KeyTypeDilithium3: dilithium.NewDilithium3,
+	KeyTypeDilithium5: dilithium.NewDilithium5,
+}
+
+//publicKey is an ssh.PublicKey holding an ML-DSA or Dilithium public key
+type publicKey struct {
+	keyType string
+	d       *dilithium.Dilithium
+	key     []byte
+}
+
+//NewPublicKey returns the ssh.PublicKey of an ML-DSA or Dilithium public key
+func NewPublicKey(d *dilithium.Dilithium, pk []byte) (ssh.PublicKey, error) {
+	keyType, ok := keyTypes[d.Name]
+	if !ok {
+		return nil, errors.New("sshsig: no SSH key type for " + d.Name)
+	}
+	if len(pk) != d.SIZEPK() {
+		return nil, errors.New("sshsig: invalid public key length")
+	}
+	return &publicKey{keyType: keyType, d: d, key: append([]byte{}, pk...)}, nil
+}
+
+func (k *publicKey) Type() string {
+	return k.keyType
+}
+
+//Marshal returns the wire encoding of the key: the key type and the public key, both as strings
+func (k *publicKey) Marshal() []byte {
+	return ssh.Marshal(struct {
+		Type string
+		Key  []byte
+	}{k.keyType, k.key})
+}
+
+func (k *publicKey) Verify(data []byte, sig *ssh.Signature) error {
+	if sig.Format != k.keyType {
+		return errors.New("sshsig: signature type " + sig.Format + " for key type " + k.keyType)
+	}
+	if !k.d.Verify(k.key, data, sig.Blob) {
+		return errors.New("sshsig: invalid signature")
+	}
+	return nil
+}
+
+//signer is an ssh.Signer holding an ML-DSA or Dilithium private key
+type signer struct {
+	pub *publicKey
+	sk  []byte
+}
+
+//NewSigner returns an ssh.Signer for an ML-DSA or Dilithium key pair. The signatures are randomized or deterministic
+//depending on the Dilithium instance, the reader given to Sign is not used.
+func NewSigner(d *dilithium.Dilithium, pk, sk []byte) (ssh.Signer, error) {
+	pub, err := NewPublicKey(d, pk)
+	if err != nil {
+		return nil, err
+	}
+	if len(sk) != d.SIZESK() {
+		return nil, errors.New("sshsig: invalid private key length")
+	}
+	return &signer{pub: pub.(*publicKey), sk: sk}, nil
+}
+
+func (s *signer) PublicKey() ssh.PublicKey {
+	return s.pub
+}
+
+func (s *signer) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	sig := s.pub.d.Sign(s.sk, data)
+	if sig == nil {
+		return nil, errors.New("sshsig: signature failed")
+	}
+	return &ssh.Signature{Format: s.pub.keyType, Blob: sig}, nil
+}
+
+//ParsePublicKey decodes a public key in wire format. The ML-DSA and Dilithium key types are handled here, the
+//others by ssh.ParsePublicKey.
+func ParsePublicKey(in []byte) (ssh.PublicKey, error) {
+	var w struct {
+		Type string
+		Rest []byte `ssh:"rest"`
+	}
+	if err := ssh.Unmarshal(in, &w); err != nil {
+		return nil, err
+	}
+	newDilithium, ok := constructors[w.Type]
+	if !ok {
+		return ssh.ParsePublicKey(in)
+	}
+	var k struct {
+		Type string
+		Key  []byte
+	}
+	if err := ssh.Unmarshal(in, &k); err != nil {
+		return nil, err
+	}
+	return NewPublicKey(newDilithium(), k.Key)
+}
+
+//ParseAuthorizedKey parses a public key from an authorized_keys or allowed signers line, in the format written by
+//ssh.MarshalAuthorizedKey. Blank lines and comments are skipped. Options before the key are only supported for the
+//key types of ssh.ParseAuthorizedKey.
+func ParseAuthorizedKey(in []byte) (out ssh.PublicKey, comment string, options []string, rest []byte, err error) {
+	for len(in) > 0 {
+		var line []byte
+		line, rest = in, nil
+		if i := bytes.IndexByte(in, '\n'); i >= 0 {
+			line, rest = in[:i], in[i+1:]
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			in = rest
+			continue
+		}
+		fields := bytes.Fields(line)
+		if _, ok := constructors[string(fields[0])]; !ok {
+			return ssh.ParseAuthorizedKey(in)
+		}
+		if len(fields) < 2 {
+			return nil, "", nil, nil, errors.New("sshsig: missing key data")
+		}
+		wire, err := base64.StdEncoding.DecodeString(string(fields[1]))
+		if err != nil {
+			return nil, "", nil, nil, err
+		}
+		if out, err = ParsePublicKey(wire); err != nil {
+			return nil, "", nil, nil, err
+		}
+		if out.Type() != string(fields[0]) {
+			return nil, "", nil, nil, errors.New("sshsig: key type mismatch")
+		}
+		if len(fields) > 2 {
+			comment = string(bytes.Join(fields[2:], []byte(" ")))
+		}
+		return out, comment, nil, rest, nil
+	}
+	return nil, "", nil, nil, errors.New("sshsig: no key found")
+}
+
+//MarshalAuthorizedKey returns the authorized_keys line of a key followed by a comment, if not empty. Without comment
+//it is the same as ssh.MarshalAuthorizedKey.
+func MarshalAuthorizedKey(key ssh.PublicKey, comment string) []byte {
+	line := ssh.MarshalAuthorizedKey(key)
+	if comment == "" {
+		return line
+	}
+	return append(append(line[:len(line)-1], ' '), comment+"\n"...)
+}
@@ -0,0 +1,183 @@
+//Package sshsig implements the SSH signature format of OpenSSH (PROTOCOL.sshsig), as produced by ssh-keygen -Y sign
+//and used to sign git commits and files, and adapts ML-DSA and Dilithium keys to the ssh.Signer and ssh.PublicKey
+//interfaces of golang.org/x/crypto/ssh under experimental key type names.
+//
+//Sign and Verify work with any ssh.Signer and public key, so post-quantum and classical signatures share the same
+//code path. Signatures made with ML-DSA or Dilithium keys can only be verified by this package, not by OpenSSH.
+package sshsig
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"hash"
+	"io"
+
+	"golang.org/x/crypto/ssh"
+)
+
+//Hash algorithms of the message
+const (
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+)
+
+const (
+	magic      = "SSHSIG"
+	version    = 1
+	armorLabel = "SSH SIGNATURE"
+)
+
+func hashFunction(name string) (func() hash.Hash, error) {
+	switch name {
+	case HashSHA256:
+		return sha256.New, nil
+	case HashSHA512:
+		return sha512.New, nil
+	}
+	return nil, errors.New("sshsig: unsupported hash algorithm " + name)
+}
+
+//blob is the signature blob, after the magic preamble
+type blob struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+//signedData is the data given to the signature algorithm, after the magic preamble
+type signedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+//Signature is a decoded SSH signature
+type Signature struct {
+	PublicKey     ssh.PublicKey
+	Namespace     string
+	HashAlgorithm string
+	Signature     *ssh.Signature
+}
+
+//toBeSigned hashes the message and returns the data signed by the key
+func toBeSigned(message io.Reader, namespace, hashAlgorithm string) ([]byte, error) {
+	h, err := hashFunction(hashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	d := h()
+	if _, err := io.Copy(d, message); err != nil {
+		return nil, err
+	}
+	return append([]byte(magic), ssh.Marshal(signedData{Namespace: namespace, HashAlgorithm: hashAlgorithm, Hash: d.Sum(nil)})...), nil
+}
+
+//Sign signs the message in a namespace, such as "git" or "file", and returns the armored signature. The
+//hash algorithm is HashSHA512 if empty, as for ssh-keygen. RSA keys sign with rsa-sha2-512.
+func Sign(signer ssh.Signer, rand io.Reader, message io.Reader, namespace, hashAlgorithm string) ([]byte, error) {
+	if namespace == "" {
+		return nil, errors.New("sshsig: empty namespace")
+	}
+	if hashAlgorithm == "" {
+		hashAlgorithm = HashSHA512
+	}
+	tbs, err := toBeSigned(message, namespace, hashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	var sig *ssh.Signature
+	//ssh-keygen and Verify reject SHA-1 RSA signatures
+	if signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		as, ok := signer.(ssh.AlgorithmSigner)
+		if !ok {
+			return nil, errors.New("sshsig: the RSA signer does not support rsa-sha2-512")
+		}
+		sig, err = as.SignWithAlgorithm(rand, tbs, ssh.SigAlgoRSASHA2512)
+	} else {
+		sig, err = signer.Sign(rand, tbs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b := append([]byte(magic), ssh.Marshal(blob{
+		Version:       version,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     namespace,
+		HashAlgorithm: hashAlgorithm,
+		Signature:     ssh.Marshal(sig),
+	})...)
+	return Armor(b), nil
+}
+
+//Armor returns the PEM-like armor of a signature blob, with lines of 70 characters like ssh-keygen
+func Armor(b []byte) []byte {
+	var out bytes.Buffer
+	out.WriteString("-----BEGIN " + armorLabel + "-----\n")
+	encoded := base64.StdEncoding.EncodeToString(b)
+	for len(encoded) > 70 {
+		out.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+	out.WriteString(encoded + "\n")
+	out.WriteString("-----END " + armorLabel + "-----\n")
+	return out.Bytes()
+}
+
+//Parse decodes an armored signature
+func Parse(armored []byte) (*Signature, error) {
+	p, _ := pem.Decode(armored)
+	if p == nil || p.Type != armorLabel {
+		return nil, errors.New("sshsig: not an armored SSH signature")
+	}
+	if !bytes.HasPrefix(p.Bytes, []byte(magic)) {
+		return nil, errors.New("sshsig: invalid signature preamble")
+	}
+	var b blob
+	if err := ssh.Unmarshal(p.Bytes[len(magic):], &b); err != nil {
+		return nil, err
+	}
+	if b.Version != version {
+		return nil, errors.New("sshsig: unsupported signature version")
+	}
+	pub, err := ParsePublicKey(b.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	sig := new(ssh.Signature)
+	if err := ssh.Unmarshal(b.Signature, sig); err != nil {
+		return nil, err
+	}
+	return &Signature{PublicKey: pub, Namespace: b.Namespace, HashAlgorithm: b.HashAlgorithm, Signature: sig}, nil
+}
+
+//Verify checks an armored signature of the message in a namespace and returns the public key that made
+//it. Whether the key is allowed to sign, as checked by ssh-keygen with an allowed signers file, is left to the caller.
+//As with ssh-keygen, RSA signatures must use rsa-sha2-256 or rsa-sha2-512, not SHA-1.
+func Verify(armored []byte, message io.Reader, namespace string) (ssh.PublicKey, error) {
+	s, err := Parse(armored)
+	if err != nil {
+		return nil, err
+	}
+	if s.Namespace != namespace {
+		return nil, errors.New("sshsig: signature for namespace " + s.Namespace)
+	}
+	if s.Signature.Format == ssh.SigAlgoRSA {
+		return nil, errors.New("sshsig: SHA-1 RSA signatures are not accepted")
+	}
+	tbs, err := toBeSigned(message, s.Namespace, s.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.PublicKey.Verify(tbs, s.Signature); err != nil {
+		return nil, err
+	}
+	return s.PublicKey, nil
+}
@@ -0,0 +1,172 @@
+package sshsig
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"strings"
+	"testing"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	"golang.org/x/crypto/ssh"
+)
+
+var message = []byte("artifact v1.0.0\n")
+
+//The signatures in testdata were made with ssh-keygen -Y sign -n file -f key artifact.txt
+func TestOpenSSH(t *testing.T) {
+	for _, name := range []string{"ed25519", "rsa"} {
+		sig, err := os.ReadFile("testdata/" + name + ".sig")
+		if err != nil {
+			t.Fatal(err)
+		}
+		line, err := os.ReadFile("testdata/" + name + ".pub")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, _, _, _, err := ParseAuthorizedKey(line)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		pub, err := Verify(sig, bytes.NewReader(message), "file")
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if !bytes.Equal(pub.Marshal(), expected.Marshal()) {
+			t.Fatal(name, "unexpected signer")
+		}
+		if _, err := Verify(sig, bytes.NewReader(message), "git"); err == nil {
+			t.Fatal(name, "signature accepted in another namespace")
+		}
+		if _, err := Verify(sig, strings.NewReader("artifact v1.0.1\n"), "file"); err == nil {
+			t.Fatal(name, "signature of another message accepted")
+		}
+	}
+}
+
+func TestRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, _ := ssh.NewSignerFromKey(key)
+	sig, err := Sign(signer, nil, bytes.NewReader(message), "file", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := Parse(sig); err != nil || s.Signature.Format != ssh.SigAlgoRSASHA2512 {
+		t.Fatal("unexpected RSA signature algorithm", err)
+	}
+	if _, err := Verify(sig, bytes.NewReader(message), "file"); err != nil {
+		t.Fatal(err)
+	}
+
+	//ssh-keygen rejects SHA-1 signatures
+	tbs, _ := toBeSigned(bytes.NewReader(message), "file", HashSHA512)
+	legacy, err := signer.(ssh.AlgorithmSigner).SignWithAlgorithm(rand.Reader, tbs, ssh.SigAlgoRSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := append([]byte(magic), ssh.Marshal(blob{
+		Version:       version,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     "file",
+		HashAlgorithm: HashSHA512,
+		Signature:     ssh.Marshal(legacy),
+	})...)
+	if _, err := Verify(Armor(b), bytes.NewReader(message), "file"); err == nil {
+		t.Fatal("SHA-1 RSA signature accepted")
+	}
+}
+
+func TestDilithium(t *testing.T) {
+	for _, d := range []*dilithium.Dilithium{dilithium.NewMLDSA44(), dilithium.NewMLDSA65(), dilithium.NewMLDSA87(),
+		dilithium.NewDilithium2(), dilithium.NewDilithium3(), dilithium.NewDilithium5()} {
+		pk, sk := d.KeyGen(nil)
+		signer, err := NewSigner(d, pk, sk)
+		if err != nil {
+			t.Fatal(d.Name, err)
+		}
+		for _, h := range []string{HashSHA256, HashSHA512} {
+			sig, err := Sign(signer, nil, bytes.NewReader(message), "git", h)
+			if err != nil {
+				t.Fatal(d.Name, err)
+			}
+			pub, err := Verify(sig, bytes.NewReader(message), "git")
+			if err != nil {
+				t.Fatal(d.Name, err)
+			}
+			if !bytes.Equal(pub.Marshal(), signer.PublicKey().Marshal()) {
+				t.Fatal(d.Name, "unexpected signer")
+			}
+			s, err := Parse(sig)
+			if err != nil || s.HashAlgorithm != h || s.Signature.Format != keyTypes[d.Name] {
+				t.Fatal(d.Name, "unexpected signature", err)
+			}
+			if _, err := Verify(sig, bytes.NewReader(message[1:]), "git"); err == nil {
+				t.Fatal(d.Name, "signature of another message accepted")
+			}
+		}
+	}
+}
+
+func TestSigner(t *testing.T) {
+	d := dilithium.NewMLDSA65()
+	pk, sk := d.KeyGen(nil)
+	signer, err := NewSigner(d, pk, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := signer.Sign(nil, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signer.PublicKey().Verify(message, sig); err != nil {
+		t.Fatal(err)
+	}
+	sig.Format = KeyTypeMLDSA44
+	if err := signer.PublicKey().Verify(message, sig); err == nil {
+		t.Fatal("signature of another type accepted")
+	}
+	if _, err := NewSigner(d, pk, sk[1:]); err == nil {
+		t.Fatal("short private key accepted")
+	}
+	if _, err := NewSigner(dilithium.NewMLDSA44(), pk, sk); err == nil {
+		t.Fatal("key of another instance accepted")
+	}
+}
+
+func TestAuthorizedKey(t *testing.T) {
+	d := dilithium.NewMLDSA87()
+	pk, _ := d.KeyGen(nil)
+	pub, _ := NewPublicKey(d, pk)
+	line := MarshalAuthorizedKey(pub, "release signing key")
+	if !bytes.HasPrefix(line, []byte(KeyTypeMLDSA87+" ")) || !bytes.HasSuffix(line, []byte(" release signing key\n")) {
+		t.Fatal("unexpected authorized key line")
+	}
+	ed, err := os.ReadFile("testdata/ed25519.pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := append(append([]byte("# keys\n\n"), line...), ed...)
+	parsed, comment, _, rest, err := ParseAuthorizedKey(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsed.Marshal(), pub.Marshal()) || comment != "release signing key" {
+		t.Fatal("unexpected key")
+	}
+	parsed, comment, _, _, err = ParseAuthorizedKey(rest)
+	if err != nil || parsed.Type() != ssh.KeyAlgoED25519 || comment != "release@example.com" {
+		t.Fatal("unexpected Ed25519 key", err)
+	}
+	//wire format round trip
+	parsed, err = ParsePublicKey(pub.Marshal())
+	if err != nil || !bytes.Equal(parsed.Marshal(), pub.Marshal()) {
+		t.Fatal("wire format round trip failed", err)
+	}
+	if _, err := ParsePublicKey(append(pub.Marshal(), 0)); err == nil {
+		t.Fatal("trailing data accepted")
+	}
+}
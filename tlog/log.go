@@ -0,0 +1,246 @@
+package tlog
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kudelskisecurity/crystals-go/note"
+)
+
+//Checkpoint is the tree head of a log in the C2SP tlog-checkpoint format: the origin of the log, the tree size and
+//the root hash on three lines, followed by optional extension lines
+type Checkpoint struct {
+	Origin     string
+	Size       uint64
+	Hash       Hash
+	Extensions []string
+}
+
+//Text returns the text of the checkpoint, as signed in a note
+func (c *Checkpoint) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n%d\n%s\n", c.Origin, c.Size, base64.StdEncoding.EncodeToString(c.Hash[:]))
+	for _, e := range c.Extensions {
+		b.WriteString(e + "\n")
+	}
+	return b.String()
+}
+
+var errCheckpoint = errors.New("tlog: malformed checkpoint")
+
+//ParseCheckpoint decodes the text of a checkpoint
+func ParseCheckpoint(text string) (*Checkpoint, error) {
+	if !strings.HasSuffix(text, "\n") {
+		return nil, errCheckpoint
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if len(lines) < 3 || lines[0] == "" {
+		return nil, errCheckpoint
+	}
+	c := &Checkpoint{Origin: lines[0]}
+	size, err := strconv.ParseUint(lines[1], 10, 64)
+	if err != nil || strconv.FormatUint(size, 10) != lines[1] {
+		return nil, errCheckpoint
+	}
+	c.Size = size
+	hash, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil || len(hash) != len(c.Hash) {
+		return nil, errCheckpoint
+	}
+	copy(c.Hash[:], hash)
+	for _, e := range lines[3:] {
+		if e == "" {
+			return nil, errCheckpoint
+		}
+		c.Extensions = append(c.Extensions, e)
+	}
+	return c, nil
+}
+
+//OpenCheckpoint opens a signed checkpoint of the log of the given origin. It must be signed by a known key named
+//after the origin, the key of the log. Cosignatures of other known keys are verified too and listed in the note.
+func OpenCheckpoint(msg []byte, origin string, known note.Verifiers) (*Checkpoint, *note.Note, error) {
+	n, err := note.Open(msg, known)
+	if err != nil {
+		return nil, nil, err
+	}
+	signed := false
+	for _, sig := range n.Sigs {
+		signed = signed || sig.Name == origin
+	}
+	if !signed {
+		return nil, nil, errors.New("tlog: checkpoint not signed by the key of " + origin)
+	}
+	c, err := ParseCheckpoint(n.Text)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.Origin != origin {
+		return nil, nil, errors.New("tlog: checkpoint of " + c.Origin + " instead of " + origin)
+	}
+	return c, n, nil
+}
+
+//Log is an append-only log whose checkpoints are signed by a signer named after the origin of the log. It is safe for
+//concurrent use, provided that its storage is not written by anything else.
+type Log struct {
+	mu      sync.Mutex
+	storage Storage
+	signer  note.Signer
+}
+
+//New returns the log kept in storage, signed by signer. Its origin is the name of the signer key, as created by
+//note.GenerateKey.
+func New(storage Storage, signer note.Signer) *Log {
+	return &Log{storage: storage, signer: signer}
+}
+
+//Origin returns the origin of the log
+func (l *Log) Origin() string {
+	return l.signer.Name()
+}
+
+//Size returns the number of entries of the log
+func (l *Log) Size() (uint64, error) {
+	return l.storage.Size()
+}
+
+//Append appends an entry and returns its index
+func (l *Log) Append(entry []byte) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	index, err := l.storage.Size()
+	if err != nil {
+		return 0, err
+	}
+	//the entry completes the subtrees of levels 1 to the number of trailing ones of its index
+	hashes := []Hash{LeafHash(entry)}
+	for level := 0; index>>level&1 == 1; level++ {
+		left, err := l.storage.Hash(level, index>>level-1)
+		if err != nil {
+			return 0, err
+		}
+		hashes = append(hashes, NodeHash(left, hashes[level]))
+	}
+	return index, l.storage.Append(entry, hashes)
+}
+
+//Entry returns the entry of the given index
+func (l *Log) Entry(index uint64) ([]byte, error) {
+	return l.storage.Entry(index)
+}
+
+//checkSize returns an error if size is larger than the log
+func (l *Log) checkSize(size uint64) error {
+	current, err := l.storage.Size()
+	if err != nil {
+		return err
+	}
+	if size > current {
+		return errRange
+	}
+	return nil
+}
+
+//TreeHash returns the root hash of the tree of the first size entries
+func (l *Log) TreeHash(size uint64) (Hash, error) {
+	if err := l.checkSize(size); err != nil {
+		return Hash{}, err
+	}
+	return subtreeHash(l.storage.Hash, 0, size)
+}
+
+//InclusionProof returns the proof that the entry of the given index is in the tree of the first size entries, to be
+//checked with VerifyInclusion
+func (l *Log) InclusionProof(index, size uint64) ([]Hash, error) {
+	if err := l.checkSize(size); err != nil {
+		return nil, err
+	}
+	if index >= size {
+		return nil, errRange
+	}
+	return inclusionProof(l.storage.Hash, index, 0, size)
+}
+
+//ConsistencyProof returns the proof that the tree of the first oldSize entries is a prefix of the tree of the first
+//newSize entries, to be checked with VerifyConsistency
+func (l *Log) ConsistencyProof(oldSize, newSize uint64) ([]Hash, error) {
+	if err := l.checkSize(newSize); err != nil {
+		return nil, err
+	}
+	if oldSize > newSize {
+		return nil, errRange
+	}
+	if oldSize == 0 {
+		return nil, nil
+	}
+	return consistencyProof(l.storage.Hash, oldSize, 0, newSize, true)
+}
+
+//Sign signs a checkpoint of the current tree, stores it as the latest checkpoint and returns it. Entries appended
+//concurrently are included in the next checkpoint.
+func (l *Log) Sign(extensions ...string) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	size, err := l.storage.Size()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := subtreeHash(l.storage.Hash, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range extensions {
+		if e == "" || strings.Contains(e, "\n") {
+			return nil, errors.New("tlog: invalid checkpoint extension line")
+		}
+	}
+	c := &Checkpoint{Origin: l.Origin(), Size: size, Hash: hash, Extensions: extensions}
+	msg, err := note.Sign(&note.Note{Text: c.Text()}, l.signer)
+	if err != nil {
+		return nil, err
+	}
+	return msg, l.storage.SetCheckpoint(msg)
+}
+
+//Checkpoint returns the latest signed checkpoint, nil if the log was never signed
+func (l *Log) Checkpoint() ([]byte, error) {
+	return l.storage.Checkpoint()
+}
+
+//Verify checks that every stored hash matches the entries, which reads the whole log
+func (l *Log) Verify() error {
+	size, err := l.storage.Size()
+	if err != nil {
+		return err
+	}
+	var stack []Hash
+	for i := uint64(0); i < size; i++ {
+		entry, err := l.storage.Entry(i)
+		if err != nil {
+			return err
+		}
+		h := LeafHash(entry)
+		for level := 0; ; level++ {
+			stored, err := l.storage.Hash(level, i>>level)
+			if err != nil {
+				return err
+			}
+			if stored != h {
+				return fmt.Errorf("tlog: hash of level %d and index %d does not match the entries", level, i>>level)
+			}
+			if level >= bits.TrailingZeros64(^i) {
+				break
+			}
+			h = NodeHash(stack[len(stack)-1], h)
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, h)
+	}
+	return nil
+}
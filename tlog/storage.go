@@ -0,0 +1,321 @@
+package tlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+//Storage stores the entries of a log, the hashes of the complete subtrees of its tree and its latest checkpoint. A
+//Log serializes its calls to Append and SetCheckpoint.
+type Storage interface {
+	//Size returns the number of entries
+	Size() (uint64, error)
+	//Append stores the entry of index Size() and the hashes of the subtrees it completes, hashes[level] being the hash
+	//of the subtree of that level ending with the entry, hashes[0] its leaf hash
+	Append(entry []byte, hashes []Hash) error
+	//Entry returns the entry of the given index
+	Entry(index uint64) ([]byte, error)
+	//Hash returns the hash of the complete subtree of the given level and index, covering the entries
+	//[index << level, (index+1) << level)
+	Hash(level int, index uint64) (Hash, error)
+	//Checkpoint returns the latest signed checkpoint, nil if there is none
+	Checkpoint() ([]byte, error)
+	//SetCheckpoint replaces the latest signed checkpoint
+	SetCheckpoint(checkpoint []byte) error
+}
+
+//storedHashIndex returns the position of the hash of the given level and index in the sequence of the hashes given
+//to Append: the hash of level l and index n follows the hash of level l-1 and index 2n+1, and the leaf hash of index
+//n follows the n + n/2 + n/4 + ... hashes of the previous complete subtrees.
+func storedHashIndex(level int, index uint64) uint64 {
+	for l := level; l > 0; l-- {
+		index = 2*index + 1
+	}
+	i := uint64(0)
+	for ; index > 0; index >>= 1 {
+		i += index
+	}
+	return i + uint64(level)
+}
+
+//storedHashCount returns the number of hashes stored for size entries
+func storedHashCount(size uint64) uint64 {
+	if size == 0 {
+		return 0
+	}
+	//the last hash stored for the entry size-1 is the one of the highest complete subtree ending with it
+	level := bits.TrailingZeros64(size)
+	return storedHashIndex(level, size>>level-1) + 1
+}
+
+var errNotFound = errors.New("tlog: entry or hash not found")
+
+//MemoryStorage is a Storage in memory, safe for concurrent use
+type MemoryStorage struct {
+	mu         sync.RWMutex
+	entries    [][]byte
+	hashes     []Hash
+	checkpoint []byte
+}
+
+//NewMemoryStorage returns an empty MemoryStorage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+//Size implements Storage
+func (s *MemoryStorage) Size() (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return uint64(len(s.entries)), nil
+}
+
+//Append implements Storage
+func (s *MemoryStorage) Append(entry []byte, hashes []Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, append([]byte{}, entry...))
+	s.hashes = append(s.hashes, hashes...)
+	return nil
+}
+
+//Entry implements Storage
+func (s *MemoryStorage) Entry(index uint64) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if index >= uint64(len(s.entries)) {
+		return nil, errNotFound
+	}
+	return append([]byte{}, s.entries[index]...), nil
+}
+
+//Hash implements Storage
+func (s *MemoryStorage) Hash(level int, index uint64) (Hash, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := storedHashIndex(level, index)
+	if i >= uint64(len(s.hashes)) {
+		return Hash{}, errNotFound
+	}
+	return s.hashes[i], nil
+}
+
+//Checkpoint implements Storage
+func (s *MemoryStorage) Checkpoint() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.checkpoint, nil
+}
+
+//SetCheckpoint implements Storage
+func (s *MemoryStorage) SetCheckpoint(checkpoint []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoint = append([]byte{}, checkpoint...)
+	return nil
+}
+
+//FileStorage is a Storage in a directory, safe for concurrent use. The directory holds four files: "entries", the
+//concatenated entries, "offsets", the big-endian 8-byte end offset of each entry in "entries", "hashes", the 32-byte
+//hashes in the order given to Append, and "checkpoint". An entry is committed once its offset is written: entries
+//and hashes left by an interrupted Append are discarded when the directory is opened again.
+type FileStorage struct {
+	mu                       sync.RWMutex
+	dir                      string
+	entries, offsets, hashes *os.File
+	size, end                uint64
+}
+
+const offsetSize = 8
+
+//OpenFileStorage opens the FileStorage of a directory, creating the directory and the files if needed
+func OpenFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &FileStorage{dir: dir}
+	var err error
+	for _, f := range []struct {
+		name string
+		file **os.File
+	}{{"entries", &s.entries}, {"offsets", &s.offsets}, {"hashes", &s.hashes}} {
+		if *f.file, err = os.OpenFile(filepath.Join(dir, f.name), os.O_RDWR|os.O_CREATE, 0600); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	if err := s.recover(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+//recover reads the number of committed entries and truncates the files to them
+func (s *FileStorage) recover() error {
+	info, err := s.offsets.Stat()
+	if err != nil {
+		return err
+	}
+	s.size = uint64(info.Size()) / offsetSize
+	if s.size > 0 {
+		var b [offsetSize]byte
+		if _, err := s.offsets.ReadAt(b[:], int64(s.size-1)*offsetSize); err != nil {
+			return err
+		}
+		s.end = binary.BigEndian.Uint64(b[:])
+	}
+	for _, t := range []struct {
+		f    *os.File
+		size uint64
+	}{{s.offsets, s.size * offsetSize}, {s.entries, s.end}, {s.hashes, storedHashCount(s.size) * uint64(len(Hash{}))}} {
+		info, err := t.f.Stat()
+		if err != nil {
+			return err
+		}
+		if uint64(info.Size()) < t.size {
+			return errors.New("tlog: truncated log file " + t.f.Name())
+		}
+		if err := t.f.Truncate(int64(t.size)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Close closes the files of the storage
+func (s *FileStorage) Close() error {
+	var err error
+	for _, f := range []*os.File{s.entries, s.offsets, s.hashes} {
+		if f == nil {
+			continue
+		}
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+//Size implements Storage
+func (s *FileStorage) Size() (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.size, nil
+}
+
+//Append implements Storage. The entry and the hashes are synced to disk before the offset commits them.
+func (s *FileStorage) Append(entry []byte, hashes []Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.entries.WriteAt(entry, int64(s.end)); err != nil {
+		return err
+	}
+	b := make([]byte, 0, len(hashes)*len(Hash{}))
+	for _, h := range hashes {
+		b = append(b, h[:]...)
+	}
+	if _, err := s.hashes.WriteAt(b, int64(storedHashCount(s.size))*int64(len(Hash{}))); err != nil {
+		return err
+	}
+	if err := s.entries.Sync(); err != nil {
+		return err
+	}
+	if err := s.hashes.Sync(); err != nil {
+		return err
+	}
+	var offset [offsetSize]byte
+	binary.BigEndian.PutUint64(offset[:], s.end+uint64(len(entry)))
+	if _, err := s.offsets.WriteAt(offset[:], int64(s.size)*offsetSize); err != nil {
+		return err
+	}
+	if err := s.offsets.Sync(); err != nil {
+		return err
+	}
+	s.size++
+	s.end += uint64(len(entry))
+	return nil
+}
+
+//Entry implements Storage
+func (s *FileStorage) Entry(index uint64) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if index >= s.size {
+		return nil, errNotFound
+	}
+	var b [2 * offsetSize]byte
+	start, end := uint64(0), uint64(0)
+	if index == 0 {
+		if _, err := s.offsets.ReadAt(b[offsetSize:], 0); err != nil {
+			return nil, err
+		}
+		end = binary.BigEndian.Uint64(b[offsetSize:])
+	} else {
+		if _, err := s.offsets.ReadAt(b[:], int64(index-1)*offsetSize); err != nil {
+			return nil, err
+		}
+		start, end = binary.BigEndian.Uint64(b[:]), binary.BigEndian.Uint64(b[offsetSize:])
+	}
+	if start > end || end > s.end {
+		return nil, errors.New("tlog: corrupted offsets file")
+	}
+	entry := make([]byte, end-start)
+	if _, err := s.entries.ReadAt(entry, int64(start)); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+//Hash implements Storage
+func (s *FileStorage) Hash(level int, index uint64) (Hash, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var h Hash
+	i := storedHashIndex(level, index)
+	if i >= storedHashCount(s.size) {
+		return h, errNotFound
+	}
+	_, err := s.hashes.ReadAt(h[:], int64(i)*int64(len(h)))
+	return h, err
+}
+
+//Checkpoint implements Storage
+func (s *FileStorage) Checkpoint() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, "checkpoint"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return b, err
+}
+
+//SetCheckpoint implements Storage. The checkpoint file is replaced atomically.
+func (s *FileStorage) SetCheckpoint(checkpoint []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := ioutil.TempFile(s.dir, "checkpoint")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(checkpoint)
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(s.dir, "checkpoint"))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
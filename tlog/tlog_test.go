@@ -0,0 +1,270 @@
+package tlog
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dilithium "github.com/kudelskisecurity/crystals-go/crystals-dilithium"
+	"github.com/kudelskisecurity/crystals-go/note"
+)
+
+//mth, path and proof compute MTH, PATH and PROOF of RFC 9162 from the entries
+func mth(entries [][]byte) Hash {
+	switch n := uint64(len(entries)); n {
+	case 0:
+		return EmptyHash
+	case 1:
+		return LeafHash(entries[0])
+	default:
+		k := split(n)
+		return NodeHash(mth(entries[:k]), mth(entries[k:]))
+	}
+}
+
+func path(m uint64, entries [][]byte) []Hash {
+	n := uint64(len(entries))
+	if n <= 1 {
+		return nil
+	}
+	k := split(n)
+	if m < k {
+		return append(path(m, entries[:k]), mth(entries[k:]))
+	}
+	return append(path(m-k, entries[k:]), mth(entries[:k]))
+}
+
+func subproof(m uint64, entries [][]byte, complete bool) []Hash {
+	n := uint64(len(entries))
+	if m == n {
+		if complete {
+			return nil
+		}
+		return []Hash{mth(entries)}
+	}
+	k := split(n)
+	if m <= k {
+		return append(subproof(m, entries[:k], complete), mth(entries[k:]))
+	}
+	return append(subproof(m-k, entries[k:], false), mth(entries[:k]))
+}
+
+func equal(a, b []Hash) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testSigner(t *testing.T) (note.Signer, note.Verifiers) {
+	skey, vkey, err := note.GenerateKey(dilithium.NewMLDSA44(), nil, "example.com/log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, _ := note.NewSigner(skey)
+	v, _ := note.NewVerifier(vkey)
+	return signer, note.VerifierList(v)
+}
+
+func TestStoredHashIndex(t *testing.T) {
+	//replay the order in which Log.Append stores the hashes
+	next := uint64(0)
+	for index := uint64(0); index < 100; index++ {
+		for level := 0; level == 0 || index>>(level-1)&1 == 1; level++ {
+			if i := storedHashIndex(level, (index+1)>>level-1); i != next {
+				t.Fatal("unexpected position of the hash", level, index, i, next)
+			}
+			next++
+		}
+		if storedHashCount(index+1) != next {
+			t.Fatal("unexpected hash count", index+1)
+		}
+	}
+}
+
+func TestKnownAnswer(t *testing.T) {
+	//the 8 leaves of the tests of the Certificate Transparency implementations
+	var entries [][]byte
+	for _, e := range []string{"", "00", "10", "2021", "3031", "40414243", "5051525354555657", "606162636465666768696a6b6c6d6e6f"} {
+		b, _ := hex.DecodeString(e)
+		entries = append(entries, b)
+	}
+	l := New(NewMemoryStorage(), nil)
+	for _, e := range entries {
+		l.Append(e)
+	}
+	for size, want := range map[uint64]string{
+		1: "6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+		8: "5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+	} {
+		if h, err := l.TreeHash(size); err != nil || hex.EncodeToString(h[:]) != want {
+			t.Fatal("unexpected root hash for size", size, err)
+		}
+	}
+}
+
+func TestProofs(t *testing.T) {
+	storage, err := OpenFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	for _, s := range []Storage{NewMemoryStorage(), storage} {
+		l := New(s, nil)
+		var entries [][]byte
+		for n := uint64(0); n <= 40; n++ {
+			root, err := l.TreeHash(n)
+			if err != nil || root != mth(entries) {
+				t.Fatal("unexpected root hash for size", n, err)
+			}
+			for m := uint64(0); m < n; m++ {
+				proof, err := l.InclusionProof(m, n)
+				if err != nil || !equal(proof, path(m, entries)) {
+					t.Fatal("unexpected inclusion proof", m, n, err)
+				}
+				if err := VerifyInclusion(m, n, LeafHash(entries[m]), proof, root); err != nil {
+					t.Fatal("inclusion proof rejected", m, n)
+				}
+				if err := VerifyInclusion(m, n, LeafHash([]byte("other")), proof, root); err == nil {
+					t.Fatal("inclusion proof of another entry accepted", m, n)
+				}
+				if len(proof) > 0 && VerifyInclusion(m, n, LeafHash(entries[m]), proof[1:], root) == nil {
+					t.Fatal("truncated inclusion proof accepted", m, n)
+				}
+			}
+			for m := uint64(0); m <= n; m++ {
+				proof, err := l.ConsistencyProof(m, n)
+				if err != nil || m > 0 && !equal(proof, subproof(m, entries, true)) {
+					t.Fatal("unexpected consistency proof", m, n, err)
+				}
+				oldRoot := mth(entries[:m])
+				if err := VerifyConsistency(m, n, oldRoot, root, proof); err != nil {
+					t.Fatal("consistency proof rejected", m, n)
+				}
+				if m > 0 && m < n {
+					if VerifyConsistency(m, n, LeafHash(nil), root, proof) == nil || VerifyConsistency(m, n, oldRoot, root, proof[1:]) == nil {
+						t.Fatal("invalid consistency proof accepted", m, n)
+					}
+				}
+			}
+			entry := []byte(fmt.Sprintf("entry %d", n))
+			if index, err := l.Append(entry); err != nil || index != n {
+				t.Fatal("unexpected index", index, err)
+			}
+			entries = append(entries, entry)
+		}
+		if err := l.Verify(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := l.InclusionProof(0, 42); err == nil {
+			t.Fatal("proof for a tree larger than the log")
+		}
+		if _, err := l.ConsistencyProof(2, 1); err == nil {
+			t.Fatal("consistency proof for a smaller tree")
+		}
+	}
+}
+
+func TestFileStorage(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, known := testSigner(t)
+	l := New(s, signer)
+	for i := 0; i < 5; i++ {
+		l.Append([]byte(strings.Repeat("x", i)))
+	}
+	checkpoint, err := l.Sign()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := l.TreeHash(5)
+	s.Close()
+
+	//an append interrupted before its offset was written
+	for _, name := range []string{"entries", "hashes"} {
+		f, _ := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_APPEND, 0)
+		f.Write([]byte("interrupted"))
+		f.Close()
+	}
+	if s, err = OpenFileStorage(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	l = New(s, signer)
+	if size, _ := l.Size(); size != 5 {
+		t.Fatal("unexpected size", size)
+	}
+	if stored, _ := l.Checkpoint(); string(stored) != string(checkpoint) {
+		t.Fatal("checkpoint not stored")
+	}
+	if entry, err := l.Entry(4); err != nil || string(entry) != "xxxx" {
+		t.Fatal("unexpected entry", string(entry), err)
+	}
+	l.Append([]byte("after"))
+	if err := l.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	proof, _ := l.ConsistencyProof(5, 6)
+	c, _, err := OpenCheckpoint(checkpoint, "example.com/log", known)
+	if err != nil || c.Size != 5 || c.Hash != root {
+		t.Fatal("unexpected checkpoint", err)
+	}
+	newRoot, _ := l.TreeHash(6)
+	if err := VerifyConsistency(c.Size, 6, c.Hash, newRoot, proof); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Truncate(filepath.Join(dir, "hashes"), 32)
+	if _, err := OpenFileStorage(dir); err == nil {
+		t.Fatal("truncated log opened")
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	signer, known := testSigner(t)
+	l := New(NewMemoryStorage(), signer)
+	l.Append([]byte("signature of release 1.0"))
+	msg, err := l.Sign("timestamp 1700000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, n, err := OpenCheckpoint(msg, l.Origin(), known)
+	if err != nil || c.Size != 1 || c.Hash != LeafHash([]byte("signature of release 1.0")) || len(c.Extensions) != 1 || len(n.Sigs) != 1 {
+		t.Fatal("unexpected checkpoint", err)
+	}
+	if c2, err := ParseCheckpoint(c.Text()); err != nil || c2.Text() != c.Text() {
+		t.Fatal("checkpoint text not parsed back", err)
+	}
+	if _, _, err := OpenCheckpoint(msg, "example.com/other", known); err == nil {
+		t.Fatal("checkpoint of another origin accepted")
+	}
+	other, _ := testSigner(t)
+	if _, _, err := OpenCheckpoint(msg, l.Origin(), note.VerifierList()); err == nil {
+		t.Fatal("checkpoint without a known key accepted")
+	}
+	if _, err := New(NewMemoryStorage(), other).Sign("two\nlines"); err == nil {
+		t.Fatal("invalid extension signed")
+	}
+	for _, text := range []string{
+		"example.com/log\n1\n",
+		"example.com/log\n01\n" + strings.Repeat("A", 43) + "=\n",
+		"example.com/log\n1\nAAAA\n",
+		"\n1\n" + strings.Repeat("A", 43) + "=\n",
+		"example.com/log\n1\n" + strings.Repeat("A", 43) + "=",
+	} {
+		if _, err := ParseCheckpoint(text); err == nil {
+			t.Fatal("malformed checkpoint parsed", text)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+//Package tlog implements an append-only transparency log: the Merkle tree hashing, inclusion proofs and consistency
+//proofs of RFC 6962 and RFC 9162, and checkpoints (signed tree heads) in the C2SP tlog-checkpoint format, signed notes
+//of the note package with ML-DSA or Dilithium keys.
+//
+//A Log appends entries to a Storage, which keeps the entries and the hashes of the complete subtrees of the tree, so
+//that tree hashes and proofs need a logarithmic number of hashes. MemoryStorage and FileStorage are provided.
+package tlog
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/bits"
+)
+
+//Hash is a SHA-256 hash of the tree
+type Hash [sha256.Size]byte
+
+//EmptyHash is the hash of the empty tree
+var EmptyHash = Hash(sha256.Sum256(nil))
+
+//LeafHash returns the hash of a leaf, SHA-256(0x00 || entry)
+func LeafHash(entry []byte) Hash {
+	return sha256.Sum256(append([]byte{0}, entry...))
+}
+
+//NodeHash returns the hash of an interior node, SHA-256(0x01 || left || right)
+func NodeHash(left, right Hash) Hash {
+	var b [1 + 2*sha256.Size]byte
+	b[0] = 1
+	copy(b[1:], left[:])
+	copy(b[1+sha256.Size:], right[:])
+	return sha256.Sum256(b[:])
+}
+
+//split returns the largest power of 2 smaller than n, for n > 1
+func split(n uint64) uint64 {
+	return 1 << (bits.Len64(n-1) - 1)
+}
+
+//hashReader returns the hash of the complete subtree of the given level and index, covering the leaves
+//[index << level, (index+1) << level)
+type hashReader func(level int, index uint64) (Hash, error)
+
+//subtreeHash returns the hash MTH of the n leaves from start
+func subtreeHash(read hashReader, start, n uint64) (Hash, error) {
+	if n == 0 {
+		return EmptyHash, nil
+	}
+	if n&(n-1) == 0 && start&(n-1) == 0 {
+		level := bits.TrailingZeros64(n)
+		return read(level, start>>level)
+	}
+	k := split(n)
+	left, err := subtreeHash(read, start, k)
+	if err != nil {
+		return Hash{}, err
+	}
+	right, err := subtreeHash(read, start+k, n-k)
+	if err != nil {
+		return Hash{}, err
+	}
+	return NodeHash(left, right), nil
+}
+
+//inclusionProof returns the audit path PATH(m, D[start:start+n]) of RFC 9162
+func inclusionProof(read hashReader, m, start, n uint64) ([]Hash, error) {
+	if n <= 1 {
+		return nil, nil
+	}
+	k := split(n)
+	var proof []Hash
+	var sibling Hash
+	var err error
+	if m < k {
+		if proof, err = inclusionProof(read, m, start, k); err == nil {
+			sibling, err = subtreeHash(read, start+k, n-k)
+		}
+	} else {
+		if proof, err = inclusionProof(read, m-k, start+k, n-k); err == nil {
+			sibling, err = subtreeHash(read, start, k)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(proof, sibling), nil
+}
+
+//consistencyProof returns SUBPROOF(m, D[start:start+n], complete) of RFC 9162
+func consistencyProof(read hashReader, m, start, n uint64, complete bool) ([]Hash, error) {
+	if m == n {
+		if complete {
+			return nil, nil
+		}
+		h, err := subtreeHash(read, start, n)
+		if err != nil {
+			return nil, err
+		}
+		return []Hash{h}, nil
+	}
+	k := split(n)
+	var proof []Hash
+	var sibling Hash
+	var err error
+	if m <= k {
+		if proof, err = consistencyProof(read, m, start, k, complete); err == nil {
+			sibling, err = subtreeHash(read, start+k, n-k)
+		}
+	} else {
+		if proof, err = consistencyProof(read, m-k, start+k, n-k, false); err == nil {
+			sibling, err = subtreeHash(read, start, k)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(proof, sibling), nil
+}
+
+var (
+	errInvalidProof = errors.New("tlog: invalid proof")
+	errRange        = errors.New("tlog: index out of range")
+)
+
+//VerifyInclusion checks the proof that the leaf of the given index and hash is in the tree of the given size and root
+//hash, as specified in RFC 9162
+func VerifyInclusion(index, size uint64, leaf Hash, proof []Hash, root Hash) error {
+	if index >= size {
+		return errRange
+	}
+	fn, sn, r := index, size-1, leaf
+	for _, p := range proof {
+		if sn == 0 {
+			return errInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			r = NodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = NodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || r != root {
+		return errInvalidProof
+	}
+	return nil
+}
+
+//VerifyConsistency checks the proof that the tree of size oldSize and root hash oldRoot is a prefix of the tree of
+//size newSize and root hash newRoot, as specified in RFC 9162
+func VerifyConsistency(oldSize, newSize uint64, oldRoot, newRoot Hash, proof []Hash) error {
+	switch {
+	case oldSize > newSize:
+		return errRange
+	case oldSize == newSize:
+		if len(proof) != 0 || oldRoot != newRoot {
+			return errInvalidProof
+		}
+		return nil
+	case oldSize == 0:
+		if len(proof) != 0 || oldRoot != EmptyHash {
+			return errInvalidProof
+		}
+		return nil
+	}
+	if oldSize&(oldSize-1) == 0 {
+		proof = append([]Hash{oldRoot}, proof...)
+	}
+	if len(proof) == 0 {
+		return errInvalidProof
+	}
+	fn, sn := oldSize-1, newSize-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return errInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = NodeHash(c, fr)
+			sr = NodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = NodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || fr != oldRoot || sr != newRoot {
+		return errInvalidProof
+	}
+	return nil
+}